@@ -0,0 +1,123 @@
+// Package audit keeps an append-only record of the changes flarebot's automation makes in Slack
+// and Jira. Records are written as JSON lines to a Sink.
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Record is one automated action.
+type Record struct {
+	Time  time.Time `json:"time"`
+	RunID string    `json:"runId"`
+	// Seq orders the records of a run.
+	Seq    int    `json:"seq"`
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	// Target is what the action changed, e.g. a channel or a ticket key.
+	Target string      `json:"target"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+	// DryRun records describe an action that would have run.
+	DryRun bool   `json:"dryRun"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Actions recorded by the Jira client.
+const (
+	ActionJiraUpdate      = "jira.update"
+	ActionJiraAddLabel    = "jira.label.add"
+	ActionJiraRemoveLabel = "jira.label.remove"
+	ActionJiraComment     = "jira.comment"
+	ActionJiraAttachment  = "jira.attachment"
+	ActionJiraTransition  = "jira.transition"
+)
+
+// ActionRunStart is the first record of every run. Its After holds the run's config.
+const ActionRunStart = "run.start"
+
+// Logger stamps records with the run they belong to and writes them to a sink. A nil *Logger
+// drops every record, so callers don't need to check whether auditing is enabled.
+type Logger struct {
+	sink   Sink
+	actor  string
+	runID  string
+	dryRun bool
+	now    func() time.Time
+
+	mu  sync.Mutex
+	seq int
+}
+
+// New returns a Logger for one run. A nil sink returns a nil Logger.
+func New(sink Sink, actor, runID string, dryRun bool) *Logger {
+	if sink == nil {
+		return nil
+	}
+	return &Logger{sink: sink, actor: actor, runID: runID, dryRun: dryRun, now: time.Now}
+}
+
+// NewRunID returns an ID for a run that didn't get one from its caller, like a Lambda request ID.
+func NewRunID() string {
+	now := time.Now().UTC()
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		// Fall back to the clock so runs started in the same second still get different IDs,
+		// rather than all sharing an all-zero suffix.
+		binary.BigEndian.PutUint32(b, uint32(now.Nanosecond()))
+	}
+	return now.Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
+// RunID is the ID every record of the run carries.
+func (l *Logger) RunID() string {
+	if l == nil {
+		return ""
+	}
+	return l.runID
+}
+
+// Start records the config the run uses.
+func (l *Logger) Start(ctx context.Context, config interface{}) error {
+	return l.Record(ctx, Record{Action: ActionRunStart, Target: l.RunID(), After: config})
+}
+
+// Record fills in the run fields of r and writes it.
+func (l *Logger) Record(ctx context.Context, r Record) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	r.Seq = l.seq
+	r.Time = l.now().UTC()
+	r.RunID = l.runID
+	r.Actor = l.actor
+	r.DryRun = r.DryRun || l.dryRun
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encoding audit record: %w", err)
+	}
+	if err := l.sink.Write(ctx, r, append(line, '\n')); err != nil {
+		return fmt.Errorf("writing audit record: %w", err)
+	}
+	return nil
+}
+
+// Change records an action that was just run. err is the action's error, if any.
+func (l *Logger) Change(ctx context.Context, action, target string, before, after interface{}, err error) error {
+	r := Record{Action: action, Target: target, Before: before, After: after}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return l.Record(ctx, r)
+}
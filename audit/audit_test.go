@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fixedClock() time.Time {
+	return time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(`{"seq":0}`+"\n"), 0o644))
+	sink, err := OpenSink("file:"+path, nil)
+	require.NoError(t, err)
+
+	l := New(sink, "flarebot-test", "run-1", false)
+	l.now = fixedClock
+	ctx := context.Background()
+	require.NoError(t, l.Start(ctx, map[string]string{"DRY_RUN": "false"}))
+	require.NoError(t, l.Change(ctx, "slack.archive", "#flare-1", nil, nil, nil))
+	require.NoError(t, l.Change(ctx, ActionJiraAddLabel, "FLARE-1", []string{}, []string{"archived"}, errors.New("Status-code:500")))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	records := []Record{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var r Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	// records are appended after what was already in the file
+	if assert.Len(t, records, 4) {
+		assert.Equal(t, 0, records[0].Seq)
+		assert.Equal(t, Record{Time: fixedClock(), RunID: "run-1", Seq: 1, Actor: "flarebot-test", Action: ActionRunStart, Target: "run-1",
+			After: map[string]interface{}{"DRY_RUN": "false"}}, records[1])
+		assert.Equal(t, Record{Time: fixedClock(), RunID: "run-1", Seq: 2, Actor: "flarebot-test", Action: "slack.archive", Target: "#flare-1"}, records[2])
+		assert.Equal(t, Record{Time: fixedClock(), RunID: "run-1", Seq: 3, Actor: "flarebot-test", Action: ActionJiraAddLabel, Target: "FLARE-1",
+			Before: []interface{}{}, After: []interface{}{"archived"}, Error: "Status-code:500"}, records[3])
+	}
+}
+
+type stubS3 struct {
+	objects map[string]string
+}
+
+func (s *stubS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)] = string(body)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestS3Sink(t *testing.T) {
+	client := &stubS3{objects: map[string]string{}}
+	sink, err := OpenSink("s3:flarebot-audit/cleanup", client)
+	require.NoError(t, err)
+
+	l := New(sink, "flarebot-test", "run-1", true)
+	l.now = fixedClock
+	require.NoError(t, l.Change(context.Background(), "slack.archive", "#flare-1", nil, nil, nil))
+	require.NoError(t, l.Change(context.Background(), "slack.archive", "#flare-2", nil, nil, nil))
+
+	assert.Equal(t, map[string]string{
+		"flarebot-audit/cleanup/2026-10-19/run-1/000001.jsonl": `{"time":"2026-10-19T12:00:00Z","runId":"run-1","seq":1,"actor":"flarebot-test","action":"slack.archive","target":"#flare-1","dryRun":true}` + "\n",
+		"flarebot-audit/cleanup/2026-10-19/run-1/000002.jsonl": `{"time":"2026-10-19T12:00:00Z","runId":"run-1","seq":2,"actor":"flarebot-test","action":"slack.archive","target":"#flare-2","dryRun":true}` + "\n",
+	}, client.objects)
+}
+
+func TestParseSink(t *testing.T) {
+	for _, spec := range []string{"file", "file:", "ftp:host/path"} {
+		_, _, err := ParseSink(spec)
+		assert.Error(t, err, spec)
+	}
+	kind, location, err := ParseSink("s3:bucket/prefix")
+	require.NoError(t, err)
+	assert.Equal(t, "s3", kind)
+	assert.Equal(t, "bucket/prefix", location)
+
+	sink, err := OpenSink("", nil)
+	require.NoError(t, err)
+	assert.Nil(t, sink)
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	assert.Nil(t, New(nil, "flarebot-test", "run-1", false))
+	assert.NoError(t, l.Change(context.Background(), "slack.archive", "#flare-1", nil, nil, nil))
+	assert.Equal(t, "", l.RunID())
+}
+
+func TestNewRunID(t *testing.T) {
+	id := NewRunID()
+	assert.Regexp(t, `^\d{8}T\d{6}Z-[0-9a-f]{8}$`, id)
+	assert.NotEqual(t, id, NewRunID())
+}
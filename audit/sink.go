@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Sink stores audit records. line is the JSON encoding of record, newline included.
+type Sink interface {
+	Write(ctx context.Context, record Record, line []byte) error
+}
+
+// S3Client is the S3 call the S3 sink uses.
+type S3Client interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// ParseSink splits a sink spec like "file:/tmp/audit.jsonl" or "s3:bucket/prefix" into its kind
+// and location. An empty spec disables auditing.
+func ParseSink(spec string) (kind, location string, err error) {
+	if spec == "" {
+		return "", "", nil
+	}
+	kind, location, ok := strings.Cut(spec, ":")
+	if !ok || location == "" {
+		return "", "", fmt.Errorf("%q is not kind:location", spec)
+	}
+	switch kind {
+	case "file", "s3":
+		return kind, location, nil
+	default:
+		return "", "", fmt.Errorf("unknown sink %q, expected file or s3", kind)
+	}
+}
+
+// OpenSink returns the sink for a spec, see ParseSink, or nil if the spec is empty. s3Client is
+// only used by s3 sinks; point it at another endpoint for S3-compatible stores.
+func OpenSink(spec string, s3Client S3Client) (Sink, error) {
+	kind, location, err := ParseSink(spec)
+	if err != nil || kind == "" {
+		return nil, err
+	}
+	if kind == "file" {
+		return &FileSink{Path: location}, nil
+	}
+	bucket, prefix, _ := strings.Cut(location, "/")
+	return &S3Sink{Client: s3Client, Bucket: bucket, Prefix: prefix}, nil
+}
+
+// FileSink appends records to a local file.
+type FileSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (s *FileSink) Write(ctx context.Context, record Record, line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// S3Sink writes every record to its own object, under
+// <prefix>/<date>/<run ID>/<seq>.jsonl, so records are never overwritten.
+type S3Sink struct {
+	Client S3Client
+	Bucket string
+	Prefix string
+}
+
+func (s *S3Sink) Write(ctx context.Context, record Record, line []byte) error {
+	key := path.Join(s.Prefix, record.Time.Format("2006-01-02"), record.RunID, fmt.Sprintf("%06d.jsonl", record.Seq))
+	_, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(line),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	return err
+}
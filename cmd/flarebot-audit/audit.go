@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Clever/flarebot/flare"
+	"github.com/Clever/flarebot/jira"
+	"github.com/Clever/flarebot/slackutil"
+
+	slk "github.com/slack-go/slack"
+)
+
+// Problems the audit looks for.
+const (
+	problemMissingChannel       = "missing-channel"
+	problemOrphanChannel        = "orphan-channel"
+	problemChannelFieldMismatch = "channel-field-mismatch"
+	problemArchivedMismatch     = "archived-mismatch"
+)
+
+const defaultPageSize = 200
+
+type SlackClient interface {
+	GetConversations(params *slk.GetConversationsParameters) ([]slk.Channel, string, error)
+}
+
+type JiraClient interface {
+	SearchTickets(jql string, fields []string) ([]jira.Ticket, error)
+	SetLabel(ticket *jira.Ticket, label string) error
+	SetField(ticket *jira.Ticket, fieldID string, value interface{}) error
+}
+
+// Finding is one inconsistency between a flare ticket and its Slack channel.
+type Finding struct {
+	Problem   string `json:"problem"`
+	Key       string `json:"key,omitempty"`
+	Channel   string `json:"channel,omitempty"`
+	ChannelID string `json:"channelId,omitempty"`
+	Detail    string `json:"detail"`
+	// Fix describes the automatic fix. Findings without one need a human.
+	Fix      string `json:"fix,omitempty"`
+	Fixed    bool   `json:"fixed"`
+	FixError string `json:"fixError,omitempty"`
+
+	apply func() error
+}
+
+// Report is the full output of an audit run.
+type Report struct {
+	Project  string    `json:"project"`
+	Tickets  int       `json:"tickets"`
+	Channels int       `json:"channels"`
+	Findings []Finding `json:"findings"`
+}
+
+// Unresolved counts findings that are still wrong after any fixes were applied.
+func (r *Report) Unresolved() int {
+	count := 0
+	for _, finding := range r.Findings {
+		if !finding.Fixed {
+			count++
+		}
+	}
+	return count
+}
+
+// Auditor cross-checks every flare ticket in a project against the Slack flare channels.
+type Auditor struct {
+	slackClient    SlackClient
+	jiraClient     JiraClient
+	project        string
+	channelFieldID string
+	slackOrigin    string
+}
+
+// audit finds inconsistencies without changing anything.
+func (a Auditor) audit() (*Report, error) {
+	jql := fmt.Sprintf(`project = "%s" ORDER BY created ASC`, a.project)
+	tickets, err := a.jiraClient.SearchTickets(jql, []string{"status", "labels", a.channelFieldID})
+	if err != nil {
+		return nil, err
+	}
+	channels, err := a.listChannels()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Project: a.project, Tickets: len(tickets), Channels: len(channels), Findings: []Finding{}}
+	channelsByName := map[string]slk.Channel{}
+	for _, channel := range channels {
+		channelsByName[channel.Name] = channel
+	}
+
+	keys := map[string]bool{}
+	newest := 0
+	for i := range tickets {
+		ticket := &tickets[i]
+		keys[ticket.Key] = true
+		if n, ok := a.keyNumber(ticket.Key); ok && n > newest {
+			newest = n
+		}
+
+		channel, ok := channelsByName[flare.ChannelName(ticket.Key)]
+		if !ok {
+			detail := fmt.Sprintf("no channel named #%s", flare.ChannelName(ticket.Key))
+			if url := flare.ChannelURL(*ticket, a.channelFieldID); url != "" {
+				detail += fmt.Sprintf(", ticket links %s", url)
+			}
+			report.Findings = append(report.Findings, Finding{Problem: problemMissingChannel, Key: ticket.Key, Detail: detail})
+			continue
+		}
+		report.Findings = append(report.Findings, a.checkTicket(ticket, channel)...)
+	}
+
+	orphans := []Finding{}
+	pattern := a.channelPattern()
+	for _, channel := range channels {
+		matches := pattern.FindStringSubmatch(channel.Name)
+		if matches == nil || keys[strings.ToUpper(channel.Name)] {
+			continue
+		}
+		detail := fmt.Sprintf("no %s ticket exists", strings.ToUpper(channel.Name))
+		if n, _ := strconv.Atoi(matches[1]); n > newest {
+			detail += fmt.Sprintf("; the number is past the newest ticket %s-%d, so the channel was probably created by hand", a.project, newest)
+		}
+		orphans = append(orphans, Finding{Problem: problemOrphanChannel, Channel: channel.Name, ChannelID: channel.ID, Detail: detail})
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].Channel < orphans[j].Channel })
+	report.Findings = append(report.Findings, orphans...)
+
+	return report, nil
+}
+
+// checkTicket compares a ticket with the channel named after it.
+func (a Auditor) checkTicket(ticket *jira.Ticket, channel slk.Channel) []Finding {
+	findings := []Finding{}
+	base := Finding{Key: ticket.Key, Channel: channel.Name, ChannelID: channel.ID}
+
+	// The slack channel field is the authoritative link, so only an empty one is filled in from
+	// the channel name. A link to another channel needs a human to tell which one is right.
+	if linked := flare.ChannelURL(*ticket, a.channelFieldID); linked == "" {
+		url := fmt.Sprintf("%s/archives/%s", a.slackOrigin, channel.ID)
+		finding := base
+		finding.Problem = problemChannelFieldMismatch
+		finding.Detail = "ticket has no slack channel link"
+		finding.Fix = fmt.Sprintf("set the slack channel field to %s", url)
+		finding.apply = func() error { return a.jiraClient.SetField(ticket, a.channelFieldID, url) }
+		findings = append(findings, finding)
+	} else if flare.ChannelID(*ticket, a.channelFieldID) != channel.ID {
+		finding := base
+		finding.Problem = problemChannelFieldMismatch
+		finding.Detail = fmt.Sprintf("ticket links %q, not the channel named #%s", linked, channel.Name)
+		findings = append(findings, finding)
+	}
+
+	labeled := flare.HasLabel(*ticket, flare.ArchivedLabel)
+	if channel.IsArchived && !labeled {
+		finding := base
+		finding.Problem = problemArchivedMismatch
+		finding.Detail = fmt.Sprintf("channel is archived but the ticket has no %q label", flare.ArchivedLabel)
+		finding.Fix = fmt.Sprintf("add the %q label", flare.ArchivedLabel)
+		finding.apply = func() error { return a.jiraClient.SetLabel(ticket, flare.ArchivedLabel) }
+		findings = append(findings, finding)
+	} else if !channel.IsArchived && labeled {
+		// archiving is not undoable by the bot, so leave this one to a human
+		finding := base
+		finding.Problem = problemArchivedMismatch
+		finding.Detail = fmt.Sprintf("ticket has the %q label but the channel is not archived", flare.ArchivedLabel)
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// fix applies every automatic fix in the report and records the outcome on each finding.
+func (a Auditor) fix(report *Report) {
+	for i := range report.Findings {
+		finding := &report.Findings[i]
+		if finding.apply == nil {
+			continue
+		}
+		if err := finding.apply(); err != nil {
+			finding.FixError = err.Error()
+			continue
+		}
+		finding.Fixed = true
+	}
+}
+
+// listChannels returns every public channel, including archived ones.
+func (a Auditor) listChannels() ([]slk.Channel, error) {
+	channels := []slk.Channel{}
+	params := &slk.GetConversationsParameters{ExcludeArchived: false, Limit: defaultPageSize}
+	for {
+		var page []slk.Channel
+		var cursor string
+		err := slackutil.RetryRateLimited(slackutil.RateLimitAttempts, time.Sleep, func() (err error) {
+			page, cursor, err = a.slackClient.GetConversations(params)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, page...)
+		if cursor == "" {
+			return channels, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// channelPattern matches the channel names fireFlare creates for the project, the same shape
+// flarebot-slack-cleanup's isFlareChannel looks for.
+func (a Auditor) channelPattern() *regexp.Regexp {
+	return regexp.MustCompile("^" + regexp.QuoteMeta(flare.ChannelName(a.project)) + `-(\d+)$`)
+}
+
+func (a Auditor) keyNumber(key string) (int, bool) {
+	number, found := strings.CutPrefix(key, a.project+"-")
+	if !found {
+		return 0, false
+	}
+	n, err := strconv.Atoi(number)
+	return n, err == nil
+}
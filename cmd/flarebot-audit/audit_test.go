@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/jira"
+	slk "github.com/slack-go/slack"
+)
+
+//go:generate mockgen -package main -destination mock.go -source audit.go SlackClient,JiraClient
+
+const channelFieldID = "customfield_12345"
+
+func ticket(key, channelURL string, labels ...string) jira.Ticket {
+	fields := jira.TicketFields{Labels: labels, CustomFields: map[string]json.RawMessage{}}
+	if channelURL != "" {
+		fields.CustomFields[channelFieldID] = json.RawMessage(`"` + channelURL + `"`)
+	}
+	return jira.Ticket{Key: key, Fields: fields}
+}
+
+func channel(id, name string, archived bool) slk.Channel {
+	c := slk.Channel{}
+	c.ID = id
+	c.Name = name
+	c.IsArchived = archived
+	return c
+}
+
+func newAuditor(slackClient SlackClient, jiraClient JiraClient) Auditor {
+	return Auditor{
+		slackClient:    slackClient,
+		jiraClient:     jiraClient,
+		project:        "FLARE",
+		channelFieldID: channelFieldID,
+		slackOrigin:    "https://clever.slack.com",
+	}
+}
+
+func TestAudit(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	slackClient := NewMockSlackClient(mockController)
+	jiraClient := NewMockJiraClient(mockController)
+
+	tickets := []jira.Ticket{
+		ticket("FLARE-1", "https://clever.slack.com/archives/C1", "archived"),
+		ticket("FLARE-2", ""),
+		ticket("FLARE-3", "https://clever.slack.com/archives/C3"),
+		ticket("FLARE-4", "https://clever.slack.com/archives/C4", "Archived"),
+		ticket("FLARE-5", "https://clever.slack.com/archives/C5"),
+	}
+	jiraClient.EXPECT().SearchTickets(`project = "FLARE" ORDER BY created ASC`, []string{"status", "labels", channelFieldID}).Return(tickets, nil).Times(1)
+	slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{
+		channel("C1", "flare-1", true),
+		channel("C2", "flare-2", false),
+		channel("C3", "flare-3", true),
+		channel("C99", "flare-99", false),
+	}, "next", nil).Times(1)
+	slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{
+		channel("C4", "flare-4", false),
+		channel("C0", "flare-0", true),
+		channel("C6", "flare-team", false),
+		channel("C7", "FLARE-7-notes", false),
+	}, "", nil).Times(1)
+
+	report, err := newAuditor(slackClient, jiraClient).audit()
+	require.NoError(t, err)
+	assert.Equal(t, 5, report.Tickets)
+	assert.Equal(t, 8, report.Channels)
+
+	type summary struct{ problem, key, channel string }
+	summaries := []summary{}
+	for _, finding := range report.Findings {
+		summaries = append(summaries, summary{finding.Problem, finding.Key, finding.Channel})
+	}
+	assert.Equal(t, []summary{
+		{problemChannelFieldMismatch, "FLARE-2", "flare-2"},
+		{problemArchivedMismatch, "FLARE-3", "flare-3"},
+		{problemArchivedMismatch, "FLARE-4", "flare-4"},
+		{problemMissingChannel, "FLARE-5", ""},
+		{problemOrphanChannel, "", "flare-0"},
+		{problemOrphanChannel, "", "flare-99"},
+	}, summaries)
+
+	assert.Equal(t, "add the \"archived\" label", report.Findings[1].Fix)
+	assert.Empty(t, report.Findings[2].Fix)
+	assert.Equal(t, "no channel named #flare-5, ticket links https://clever.slack.com/archives/C5", report.Findings[3].Detail)
+	assert.Equal(t, "no FLARE-0 ticket exists", report.Findings[4].Detail)
+	assert.Contains(t, report.Findings[5].Detail, "past the newest ticket FLARE-5")
+	assert.Equal(t, 6, report.Unresolved())
+}
+
+func TestFix(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	slackClient := NewMockSlackClient(mockController)
+	jiraClient := NewMockJiraClient(mockController)
+
+	tickets := []jira.Ticket{
+		ticket("FLARE-1", ""),
+		ticket("FLARE-2", "https://clever.slack.com/archives/C2"),
+		ticket("FLARE-3", "https://clever.slack.com/archives/COTHER"),
+	}
+	jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return(tickets, nil).Times(1)
+	slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{
+		channel("C1", "flare-1", false),
+		channel("C2", "flare-2", true),
+		channel("C3", "flare-3", false),
+	}, "", nil).Times(1)
+	jiraClient.EXPECT().SetField(gomock.Any(), channelFieldID, "https://clever.slack.com/archives/C1").Return(nil).Times(1)
+	jiraClient.EXPECT().SetLabel(gomock.Any(), "archived").Return(errors.New("jira down")).Times(1)
+
+	auditor := newAuditor(slackClient, jiraClient)
+	report, err := auditor.audit()
+	require.NoError(t, err)
+	require.Len(t, report.Findings, 3)
+	auditor.fix(report)
+
+	assert.True(t, report.Findings[0].Fixed, "empty links are filled in")
+	assert.False(t, report.Findings[1].Fixed)
+	assert.Equal(t, "jira down", report.Findings[1].FixError)
+	assert.False(t, report.Findings[2].Fixed, "links to another channel are left to a human")
+	assert.Empty(t, report.Findings[2].Fix)
+	assert.Equal(t, `ticket links "https://clever.slack.com/archives/COTHER", not the channel named #flare-3`, report.Findings[2].Detail)
+	assert.Equal(t, 2, report.Unresolved())
+
+	var buf bytes.Buffer
+	require.NoError(t, writeReport(&buf, report, formatText))
+	assert.Contains(t, buf.String(), "fixed: set the slack channel field to https://clever.slack.com/archives/C1")
+	assert.Contains(t, buf.String(), "failed to add the \"archived\" label: jira down")
+}
+
+func TestAuditErrors(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	slackClient := NewMockSlackClient(mockController)
+	jiraClient := NewMockJiraClient(mockController)
+
+	jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return(nil, errors.New("jira down")).Times(1)
+	_, err := newAuditor(slackClient, jiraClient).audit()
+	assert.EqualError(t, err, "jira down")
+
+	jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return(nil, nil).Times(1)
+	slackClient.EXPECT().GetConversations(gomock.Any()).Return(nil, "", errors.New("invalid_auth")).Times(1)
+	_, err = newAuditor(slackClient, jiraClient).audit()
+	assert.EqualError(t, err, "invalid_auth")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/Clever/flarebot/jira"
+
+	slk "github.com/slack-go/slack"
+)
+
+func main() {
+	project := flag.String("project", "FLARE", "Jira project key for flares")
+	format := flag.String("format", formatText, "output format: text or json")
+	fix := flag.Bool("fix", false, "apply the automatic fixes: fill in empty slack channel links and label archived tickets")
+	flag.Parse()
+
+	switch *format {
+	case formatText, formatJSON:
+	default:
+		log.Fatalf("invalid -format %q, expected text or json", *format)
+	}
+
+	auditor := Auditor{
+		slackClient: slk.New(requireEnvVar("SLACK_BOT_TOKEN")),
+		jiraClient: &jira.JiraServer{
+			Origin:   requireEnvVar("JIRA_ORIGIN"),
+			Username: requireEnvVar("JIRA_USERNAME"),
+			Password: requireEnvVar("JIRA_PASSWORD"),
+		},
+		project:        *project,
+		channelFieldID: requireEnvVar("JIRA_SLACK_CHANNEL_FIELD_ID"),
+		slackOrigin:    requireEnvVar("SLACK_ORIGIN"),
+	}
+
+	report, err := auditor.audit()
+	if err != nil {
+		log.Fatalf("error auditing flares: %v", err)
+	}
+	if *fix {
+		auditor.fix(report)
+	}
+	if err := writeReport(os.Stdout, report, *format); err != nil {
+		log.Fatalf("error writing report: %v", err)
+	}
+	if report.Unresolved() > 0 {
+		os.Exit(1)
+	}
+}
+
+func requireEnvVar(s string) string {
+	val, present := os.LookupEnv(s)
+	if !present {
+		log.Fatalf("env var %s is not defined", s)
+	}
+	return val
+}
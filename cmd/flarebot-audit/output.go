@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+func writeReport(w io.Writer, report *Report, format string) error {
+	switch format {
+	case formatText:
+		return writeText(w, report)
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	default:
+		return fmt.Errorf("unknown format %q, expected one of %s, %s", format, formatText, formatJSON)
+	}
+}
+
+func writeText(w io.Writer, report *Report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Audited %d %s tickets against %d slack channels\n", report.Tickets, report.Project, report.Channels)
+	fmt.Fprintf(tw, "Findings:\t%d (%d unresolved)\n", len(report.Findings), report.Unresolved())
+	if len(report.Findings) == 0 {
+		return tw.Flush()
+	}
+
+	fmt.Fprintf(tw, "\nPROBLEM\tTICKET\tCHANNEL\tDETAIL\tFIX\n")
+	for _, finding := range report.Findings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", finding.Problem, dash(finding.Key), dash(finding.Channel), finding.Detail, fixStatus(finding))
+	}
+	return tw.Flush()
+}
+
+func fixStatus(finding Finding) string {
+	switch {
+	case finding.Fixed:
+		return "fixed: " + finding.Fix
+	case finding.FixError != "":
+		return fmt.Sprintf("failed to %s: %s", finding.Fix, finding.FixError)
+	case finding.Fix != "":
+		return "fixable: " + finding.Fix
+	default:
+		return "manual"
+	}
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
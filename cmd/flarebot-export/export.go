@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Clever/flarebot/slackutil"
+
+	slk "github.com/slack-go/slack"
+)
+
+const defaultPageSize = 200
+
+// Files the export directory holds.
+const (
+	messagesFile       = "messages.jsonl"
+	htmlTranscript     = "transcript.html"
+	markdownTranscript = "transcript.md"
+	attachmentsDir     = "files"
+)
+
+type SlackClient interface {
+	GetConversations(params *slk.GetConversationsParameters) ([]slk.Channel, string, error)
+	GetConversationInfo(input *slk.GetConversationInfoInput) (*slk.Channel, error)
+	GetConversationHistory(params *slk.GetConversationHistoryParameters) (*slk.GetConversationHistoryResponse, error)
+	GetConversationReplies(params *slk.GetConversationRepliesParameters) ([]slk.Message, bool, string, error)
+	GetUserInfo(user string) (*slk.User, error)
+	GetFile(downloadURL string, writer io.Writer) error
+}
+
+var channelIDRegex = regexp.MustCompile(`^[CG][A-Z0-9]{6,}$`)
+
+// Entry is one exported message, a line of messages.jsonl. Message is kept as Slack returned
+// it, so edits, subtypes and file metadata survive the export.
+type Entry struct {
+	Message slk.Message `json:"message"`
+	// Files maps the ID of each downloaded attachment to its path in the export directory.
+	Files map[string]string `json:"files,omitempty"`
+	// PreviousText holds the text of the message before each edit a later run picked up, oldest
+	// first.
+	PreviousText []string `json:"previousText,omitempty"`
+	// Deleted is set once a later run finds the message deleted in Slack. The entry keeps the
+	// message as it was last exported.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Export is a channel's exported history.
+type Export struct {
+	Channel slk.Channel
+	// Entries holds every exported message, thread replies included, oldest first.
+	Entries []Entry
+	// Added, Edited and Deleted count the entries this run added, found edited and found
+	// deleted.
+	Added   int
+	Edited  int
+	Deleted int
+	// Users and Channels map the IDs mentioned in the history to names.
+	Users    map[string]string
+	Channels map[string]string
+}
+
+// Exporter exports a channel's history into a directory. Runs after the first fetch what was
+// posted since the last exported message, and go over the lookback before it again for edits,
+// deletions and new thread replies.
+type Exporter struct {
+	slackClient SlackClient
+	dir         string
+	// full ignores any earlier export and fetches the whole history again.
+	full     bool
+	lookback time.Duration
+	// sleep waits out rate limits. It defaults to time.Sleep.
+	sleep func(time.Duration)
+}
+
+// call calls fn, a Slack call, again while it's rate limited. Exports of large channels make a
+// call per thread and run into the limits.
+func (e *Exporter) call(fn func() error) error {
+	sleep := e.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	return slackutil.RetryRateLimited(slackutil.RateLimitAttempts, sleep, fn)
+}
+
+// export fetches the history of channel, a channel ID or name, merges it into the earlier
+// export and downloads the attachments.
+func (e *Exporter) export(channel string) (*Export, error) {
+	found, err := e.findChannel(channel)
+	if err != nil {
+		return nil, err
+	}
+	export := &Export{Channel: *found}
+	if !e.full {
+		if export.Entries, err = readEntries(filepath.Join(e.dir, messagesFile)); err != nil {
+			return nil, fmt.Errorf("reading the earlier export: %v", err)
+		}
+	}
+
+	// Messages fetched again replace their earlier copy, keeping the text from before an edit.
+	index := map[string]int{}
+	for i, entry := range export.Entries {
+		index[entry.Message.Timestamp] = i
+	}
+	fetched := map[string]bool{}
+	add := func(message slk.Message) {
+		fetched[message.Timestamp] = true
+		i, ok := index[message.Timestamp]
+		if !ok {
+			index[message.Timestamp] = len(export.Entries)
+			export.Entries = append(export.Entries, Entry{Message: message})
+			export.Added++
+			return
+		}
+		entry := &export.Entries[i]
+		if entry.Message.Text != message.Text {
+			entry.PreviousText = append(entry.PreviousText, entry.Message.Text)
+			export.Edited++
+		}
+		entry.Message = message
+	}
+	markDeleted := func(entry *Entry) {
+		if !entry.Deleted {
+			entry.Deleted = true
+			export.Deleted++
+		}
+	}
+
+	oldest := e.rescanFrom(lastTimestamp(export.Entries))
+	messages, err := e.history(found.ID, oldest)
+	if err != nil {
+		return nil, fmt.Errorf("fetching the history of #%s: %v", found.Name, err)
+	}
+	for _, message := range messages {
+		add(message)
+	}
+	for i := range export.Entries {
+		entry := &export.Entries[i]
+		if !isReply(entry.Message) && tsLess(oldest, entry.Message.Timestamp) && !fetched[entry.Message.Timestamp] {
+			markDeleted(entry)
+		}
+	}
+
+	// Replies aren't in the channel history, so the threads of every message fetched above,
+	// new or old, are fetched whole. So are the threads with a reply in the lookback, whose
+	// parent can be older than that and get new replies all the same.
+	latest := latestReplies(export.Entries)
+	for _, thread := range threads(export.Entries) {
+		if !fetched[thread] && !tsLess(oldest, latest[thread]) {
+			continue
+		}
+		replies, err := e.replies(found.ID, thread)
+		if err != nil {
+			return nil, fmt.Errorf("fetching the replies to %s in #%s: %v", thread, found.Name, err)
+		}
+		inThread := map[string]bool{}
+		for _, reply := range replies {
+			add(reply)
+			inThread[reply.Timestamp] = true
+		}
+		for i := range export.Entries {
+			entry := &export.Entries[i]
+			if isReply(entry.Message) && entry.Message.ThreadTimestamp == thread && !inThread[entry.Message.Timestamp] {
+				markDeleted(entry)
+			}
+		}
+	}
+	sort.SliceStable(export.Entries, func(i, j int) bool {
+		return tsLess(export.Entries[i].Message.Timestamp, export.Entries[j].Message.Timestamp)
+	})
+
+	e.downloadFiles(export.Entries)
+	export.Users = e.resolveUsers(export.Entries)
+	export.Channels = e.resolveChannels(export.Entries)
+	return export, nil
+}
+
+// findChannel looks channel up by ID, or by name through the channel list, archived channels
+// included.
+func (e *Exporter) findChannel(channel string) (*slk.Channel, error) {
+	if channelIDRegex.MatchString(channel) {
+		var found *slk.Channel
+		err := e.call(func() (err error) {
+			found, err = e.slackClient.GetConversationInfo(&slk.GetConversationInfoInput{ChannelID: channel})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("looking up channel %s: %v", channel, err)
+		}
+		return found, nil
+	}
+
+	name := strings.TrimPrefix(channel, "#")
+	params := &slk.GetConversationsParameters{
+		Types: []string{"public_channel", "private_channel"},
+		Limit: defaultPageSize,
+	}
+	for {
+		var channels []slk.Channel
+		var cursor string
+		err := e.call(func() (err error) {
+			channels, cursor, err = e.slackClient.GetConversations(params)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("listing channels: %v", err)
+		}
+		for _, c := range channels {
+			if c.Name == name {
+				return &c, nil
+			}
+		}
+		if cursor == "" {
+			return nil, fmt.Errorf("no channel named #%s", name)
+		}
+		params.Cursor = cursor
+	}
+}
+
+// rescanFrom returns the timestamp the history is fetched from, the lookback before the last
+// exported message, or "" for the whole history.
+func (e *Exporter) rescanFrom(last string) string {
+	if last == "" {
+		return ""
+	}
+	seconds, micros := splitTimestamp(last)
+	from := time.Unix(seconds, micros*1000).Add(-e.lookback)
+	return fmt.Sprintf("%d.%06d", from.Unix(), from.Nanosecond()/1000)
+}
+
+// history returns the channel's messages posted after oldest, or all of them when it's empty.
+func (e *Exporter) history(channelID, oldest string) ([]slk.Message, error) {
+	messages := []slk.Message{}
+	params := &slk.GetConversationHistoryParameters{
+		ChannelID: channelID,
+		Oldest:    oldest,
+		Limit:     defaultPageSize,
+	}
+	for {
+		var history *slk.GetConversationHistoryResponse
+		err := e.call(func() (err error) {
+			history, err = e.slackClient.GetConversationHistory(params)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, history.Messages...)
+		if !history.HasMore || history.ResponseMetaData.NextCursor == "" {
+			return messages, nil
+		}
+		params.Cursor = history.ResponseMetaData.NextCursor
+	}
+}
+
+// replies returns the thread's parent and all its replies.
+func (e *Exporter) replies(channelID, thread string) ([]slk.Message, error) {
+	replies := []slk.Message{}
+	params := &slk.GetConversationRepliesParameters{
+		ChannelID: channelID,
+		Timestamp: thread,
+		Limit:     defaultPageSize,
+	}
+	for {
+		var messages []slk.Message
+		var hasMore bool
+		var cursor string
+		err := e.call(func() (err error) {
+			messages, hasMore, cursor, err = e.slackClient.GetConversationReplies(params)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, messages...)
+		if !hasMore || cursor == "" {
+			return replies, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// downloadFiles downloads the attachments that aren't in the export directory yet. A failed
+// download is logged and tried again on the next run.
+func (e *Exporter) downloadFiles(entries []Entry) {
+	for i := range entries {
+		entry := &entries[i]
+		for _, file := range entry.Message.Files {
+			if file.URLPrivateDownload == "" || entry.Files[file.ID] != "" {
+				continue
+			}
+			path := filepath.Join(attachmentsDir, file.ID+"-"+safeFileName(file.Name))
+			if err := e.download(file.URLPrivateDownload, path); err != nil {
+				log.Printf("error downloading %s (%s): %v", file.Name, file.ID, err)
+				continue
+			}
+			if entry.Files == nil {
+				entry.Files = map[string]string{}
+			}
+			entry.Files[file.ID] = filepath.ToSlash(path)
+		}
+	}
+}
+
+func (e *Exporter) download(url, path string) error {
+	target := filepath.Join(e.dir, path)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(target), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	// A rate limited download writes nothing, so the file can be reused for the next attempt.
+	if err := e.call(func() error { return e.slackClient.GetFile(url, f) }); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), target)
+}
+
+var (
+	userMentionRegex    = regexp.MustCompile(`<@([UW][A-Z0-9]+)(?:\|[^>]*)?>`)
+	channelMentionRegex = regexp.MustCompile(`<#([CG][A-Z0-9]+)(\|[^>]*)?>`)
+)
+
+// resolveUsers maps the authors and mentioned users of the entries to their display names.
+// Users that can't be looked up keep their ID.
+func (e *Exporter) resolveUsers(entries []Entry) map[string]string {
+	users := map[string]string{}
+	resolve := func(id string) {
+		if id == "" || users[id] != "" {
+			return
+		}
+		users[id] = id
+		var user *slk.User
+		err := e.call(func() (err error) {
+			user, err = e.slackClient.GetUserInfo(id)
+			return err
+		})
+		if err == nil {
+			users[id] = userName(user)
+		} else {
+			log.Printf("error looking up user %s: %v", id, err)
+		}
+	}
+	for _, entry := range entries {
+		resolve(entry.Message.User)
+		for _, match := range userMentionRegex.FindAllStringSubmatch(entry.Message.Text, -1) {
+			resolve(match[1])
+		}
+	}
+	return users
+}
+
+func userName(user *slk.User) string {
+	for _, name := range []string{user.Profile.DisplayName, user.RealName, user.Profile.RealName, user.Name} {
+		if name != "" {
+			return name
+		}
+	}
+	return user.ID
+}
+
+// resolveChannels maps the mentioned channels to their names. Mentions usually carry the name,
+// the others are looked up.
+func (e *Exporter) resolveChannels(entries []Entry) map[string]string {
+	channels := map[string]string{}
+	for _, entry := range entries {
+		for _, match := range channelMentionRegex.FindAllStringSubmatch(entry.Message.Text, -1) {
+			id, label := match[1], strings.TrimPrefix(match[2], "|")
+			switch {
+			case label != "":
+				channels[id] = label
+			case channels[id] != "":
+			default:
+				channels[id] = id
+				var channel *slk.Channel
+				err := e.call(func() (err error) {
+					channel, err = e.slackClient.GetConversationInfo(&slk.GetConversationInfoInput{ChannelID: id})
+					return err
+				})
+				if err == nil {
+					channels[id] = channel.Name
+				} else {
+					log.Printf("error looking up channel %s: %v", id, err)
+				}
+			}
+		}
+	}
+	return channels
+}
+
+// readEntries reads an earlier export. A missing file is an empty export.
+func readEntries(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// threads returns the timestamps of the thread parents among the entries, including messages
+// whose replies were all deleted since.
+func threads(entries []Entry) []string {
+	parents := []string{}
+	found := map[string]bool{}
+	for _, entry := range entries {
+		thread := ""
+		if isParent(entry.Message) {
+			thread = entry.Message.Timestamp
+		} else if isReply(entry.Message) {
+			thread = entry.Message.ThreadTimestamp
+		}
+		if thread != "" && !found[thread] {
+			found[thread] = true
+			parents = append(parents, thread)
+		}
+	}
+	return parents
+}
+
+// latestReplies maps each thread among the entries to the timestamp of its newest reply, the
+// parent's latest_reply or a newer exported reply.
+func latestReplies(entries []Entry) map[string]string {
+	latest := map[string]string{}
+	for _, entry := range entries {
+		thread, ts := "", ""
+		if isParent(entry.Message) {
+			thread, ts = entry.Message.Timestamp, entry.Message.LatestReply
+		} else if isReply(entry.Message) {
+			thread, ts = entry.Message.ThreadTimestamp, entry.Message.Timestamp
+		}
+		if thread != "" && tsLess(latest[thread], ts) {
+			latest[thread] = ts
+		}
+	}
+	return latest
+}
+
+func isParent(message slk.Message) bool {
+	return message.ReplyCount > 0 && message.ThreadTimestamp == message.Timestamp
+}
+
+func isReply(message slk.Message) bool {
+	return message.ThreadTimestamp != "" && message.ThreadTimestamp != message.Timestamp
+}
+
+// lastTimestamp returns the newest timestamp among the entries, or "" when there are none.
+func lastTimestamp(entries []Entry) string {
+	last := ""
+	for _, entry := range entries {
+		if last == "" || tsLess(last, entry.Message.Timestamp) {
+			last = entry.Message.Timestamp
+		}
+	}
+	return last
+}
+
+// tsLess orders Slack timestamps, "seconds.micros" strings, by number rather than as text.
+func tsLess(a, b string) bool {
+	aSeconds, aMicros := splitTimestamp(a)
+	bSeconds, bMicros := splitTimestamp(b)
+	if aSeconds != bSeconds {
+		return aSeconds < bSeconds
+	}
+	return aMicros < bMicros
+}
+
+func splitTimestamp(ts string) (int64, int64) {
+	seconds, micros, _ := strings.Cut(ts, ".")
+	s, _ := strconv.ParseInt(seconds, 10, 64)
+	m, _ := strconv.ParseInt(micros, 10, 64)
+	return s, m
+}
+
+var unsafeFileNameRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// safeFileName turns a Slack file name into one that's safe on disk and in a link.
+func safeFileName(name string) string {
+	name = strings.Trim(unsafeFileNameRegex.ReplaceAllString(name, "_"), "._")
+	if name == "" {
+		return "file"
+	}
+	return name
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	slk "github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/slackutil/slacktest"
+)
+
+func channel(id, name string) slk.Channel {
+	c := slk.Channel{}
+	c.ID = id
+	c.Name = name
+	c.IsMember = true
+	return c
+}
+
+// newWorkspace returns a workspace with #flare-123 holding a mention, a thread, an edit and an
+// image, and the timestamp of the thread's parent.
+func newWorkspace(t *testing.T) (*slacktest.Server, string) {
+	server := slacktest.NewServer(t)
+	server.MaxPageSize = 2
+	server.Now = func() time.Time { return time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC) }
+	flareChannel := channel("C0FLARE123", "flare-123")
+	flareChannel.Topic.Value = "SSO is down"
+	server.AddChannel(flareChannel)
+	server.AddChannel(channel("C0ENGINFRA", "eng-infra"))
+	server.AddUser(slk.User{ID: "U1", Name: "alice", Profile: slk.UserProfile{DisplayName: "alice"}})
+	server.AddUser(slk.User{ID: "U2", Name: "bob", RealName: "Bob Smith"})
+	graph := server.AddFile(slk.File{ID: "F1", Name: "error graph.png", Mimetype: "image/png"}, []byte("png"))
+	log := server.AddFile(slk.File{ID: "F2", Name: "app.log", Mimetype: "text/plain"}, []byte("error"))
+
+	parent := server.AddMessages("C0FLARE123", slk.Message{Msg: slk.Msg{User: "U1", Text: "SSO is down for <@U2>, see <#C0ENGINFRA> & <https://status.example.com|status> &lt;3 <!here>"}})[0]
+	server.AddMessages("C0FLARE123",
+		slk.Message{Msg: slk.Msg{User: "U2", Text: "looking", ThreadTimestamp: parent}},
+		slk.Message{Msg: slk.Msg{User: "U2", Text: "graph attached", Files: []slk.File{graph, log}}},
+		slk.Message{Msg: slk.Msg{User: "U1", Text: "fixed\nby a rollback", Edited: &slk.Edited{User: "U1"}}},
+	)
+	return server, parent
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestExport(t *testing.T) {
+	server, _ := newWorkspace(t)
+	dir := t.TempDir()
+	exporter := Exporter{slackClient: server.Client(), dir: dir}
+
+	export, err := exporter.export("#flare-123")
+	require.NoError(t, err)
+	require.NoError(t, writeExport(dir, export))
+
+	assert.Equal(t, 4, export.Added)
+	texts := []string{}
+	for _, entry := range export.Entries {
+		texts = append(texts, entry.Message.Text)
+	}
+	assert.Equal(t, []string{"SSO is down for <@U2>, see <#C0ENGINFRA> & <https://status.example.com|status> &lt;3 <!here>", "looking", "graph attached", "fixed\nby a rollback"}, texts)
+	assert.Equal(t, map[string]string{"U1": "alice", "U2": "Bob Smith"}, export.Users)
+	assert.Equal(t, map[string]string{"C0ENGINFRA": "eng-infra"}, export.Channels)
+	assert.Equal(t, "png", readFile(t, filepath.Join(dir, "files", "F1-error_graph.png")))
+	assert.Equal(t, "error", readFile(t, filepath.Join(dir, "files", "F2-app.log")))
+
+	entries, err := readEntries(filepath.Join(dir, messagesFile))
+	require.NoError(t, err)
+	assert.Equal(t, export.Entries, entries)
+
+	// Lines of a message end in two spaces, Markdown's line break.
+	assert.Equal(t, strings.Join([]string{
+		"# #flare-123",
+		"",
+		"Topic: SSO is down",
+		"",
+		"4 messages from 2024-03-01 10:00:00 UTC to 2024-03-01 10:00:00 UTC",
+		"",
+		"**alice** 2024-03-01 10:00:00 UTC  ",
+		"SSO is down for @Bob Smith, see #eng-infra & [status](https://status.example.com) <3 @here",
+		">",
+		"> **Bob Smith** 2024-03-01 10:00:00 UTC  ",
+		"> looking",
+		"",
+		"**Bob Smith** 2024-03-01 10:00:00 UTC  ",
+		"graph attached  ",
+		"- [error graph.png](files/F1-error_graph.png)  ",
+		"- [app.log](files/F2-app.log)",
+		"",
+		"**alice** 2024-03-01 10:00:00 UTC (edited)  ",
+		"fixed  ",
+		"by a rollback",
+		"",
+	}, "\n"), readFile(t, filepath.Join(dir, markdownTranscript)))
+
+	transcript := readFile(t, filepath.Join(dir, htmlTranscript))
+	assert.Contains(t, transcript, `SSO is down for @Bob Smith, see #eng-infra &amp; <a href="https://status.example.com">status</a> &lt;3 @here`)
+	assert.Contains(t, transcript, `<div class="replies">`)
+	assert.Contains(t, transcript, `<img src="data:image/png;base64,cG5n" alt="error graph.png">`)
+	assert.Contains(t, transcript, `<a href="files/F2-app.log">app.log</a>`)
+	assert.Contains(t, transcript, `<span class="edited">(edited)</span>`)
+}
+
+func TestIncrementalExport(t *testing.T) {
+	tests := []struct {
+		description string
+		noLookback  bool
+		// change changes the workspace after the first export. messages are its timestamps.
+		change            func(server *slacktest.Server, messages []string)
+		added             int
+		edited, deleted   int
+		texts             []string
+		deletedTexts      []string
+		markdownFragments []string
+	}{
+		{
+			description: "new messages and replies",
+			change: func(server *slacktest.Server, messages []string) {
+				server.AddMessages("C0FLARE123",
+					slk.Message{Msg: slk.Msg{User: "U1", Text: "thanks", ThreadTimestamp: messages[0]}},
+					slk.Message{Msg: slk.Msg{User: "U2", Text: "closing out"}},
+				)
+			},
+			added:             2,
+			texts:             []string{"SSO is down for <@U2>, see <#C0ENGINFRA> & <https://status.example.com|status> &lt;3 <!here>", "looking", "graph attached", "fixed\nby a rollback", "thanks", "closing out"},
+			markdownFragments: []string{"> **Bob Smith** 2024-03-01 10:00:00 UTC  \n> looking\n>\n> **alice** 2024-03-01 10:00:00 UTC  \n> thanks\n"},
+		},
+		{
+			description: "first reply to an exported message",
+			change: func(server *slacktest.Server, messages []string) {
+				server.AddMessages("C0FLARE123", slk.Message{Msg: slk.Msg{User: "U1", Text: "which graph?", ThreadTimestamp: messages[2]}})
+			},
+			added:             1,
+			texts:             []string{"SSO is down for <@U2>, see <#C0ENGINFRA> & <https://status.example.com|status> &lt;3 <!here>", "looking", "graph attached", "fixed\nby a rollback", "which graph?"},
+			markdownFragments: []string{"- [app.log](files/F2-app.log)\n>\n> **alice** 2024-03-01 10:00:00 UTC  \n> which graph?\n"},
+		},
+		{
+			description: "edited message",
+			change: func(server *slacktest.Server, messages []string) {
+				server.UpdateMessage("C0FLARE123", slk.Message{Msg: slk.Msg{User: "U1", Text: "fixed by rolling back", Timestamp: messages[3], Edited: &slk.Edited{User: "U1"}}})
+			},
+			edited: 1,
+			texts:  []string{"SSO is down for <@U2>, see <#C0ENGINFRA> & <https://status.example.com|status> &lt;3 <!here>", "looking", "graph attached", "fixed by rolling back"},
+		},
+		{
+			description: "deleted message and reply",
+			change: func(server *slacktest.Server, messages []string) {
+				server.DeleteMessage("C0FLARE123", messages[1])
+				server.DeleteMessage("C0FLARE123", messages[2])
+			},
+			deleted:           2,
+			texts:             []string{"SSO is down for <@U2>, see <#C0ENGINFRA> & <https://status.example.com|status> &lt;3 <!here>", "looking", "graph attached", "fixed\nby a rollback"},
+			deletedTexts:      []string{"looking", "graph attached"},
+			markdownFragments: []string{"> **Bob Smith** 2024-03-01 10:00:00 UTC (deleted in Slack)  \n> looking\n"},
+		},
+		{
+			description: "changes before the lookback are missed",
+			noLookback:  true,
+			change: func(server *slacktest.Server, messages []string) {
+				server.AddMessages("C0FLARE123", slk.Message{Msg: slk.Msg{User: "U1", Text: "which graph?", ThreadTimestamp: messages[2]}})
+				server.DeleteMessage("C0FLARE123", messages[0])
+			},
+			texts: []string{"SSO is down for <@U2>, see <#C0ENGINFRA> & <https://status.example.com|status> &lt;3 <!here>", "looking", "graph attached", "fixed\nby a rollback"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			server, _ := newWorkspace(t)
+			lookback := 7 * 24 * time.Hour
+			if test.noLookback {
+				lookback = 0
+			}
+			dir := t.TempDir()
+			first, err := (&Exporter{slackClient: server.Client(), dir: dir, lookback: lookback}).export("C0FLARE123")
+			require.NoError(t, err)
+			require.NoError(t, writeExport(dir, first))
+
+			messages := []string{}
+			for _, message := range server.Messages("C0FLARE123") {
+				messages = append(messages, message.Timestamp)
+			}
+			test.change(server, messages)
+			second, err := (&Exporter{slackClient: server.Client(), dir: dir, lookback: lookback}).export("C0FLARE123")
+			require.NoError(t, err)
+			require.NoError(t, writeExport(dir, second))
+
+			assert.Equal(t, test.added, second.Added)
+			assert.Equal(t, test.edited, second.Edited)
+			assert.Equal(t, test.deleted, second.Deleted)
+			texts, deletedTexts := []string{}, []string{}
+			for _, entry := range second.Entries {
+				texts = append(texts, entry.Message.Text)
+				if entry.Deleted {
+					deletedTexts = append(deletedTexts, entry.Message.Text)
+				}
+			}
+			assert.Equal(t, test.texts, texts)
+			if len(test.deletedTexts) > 0 {
+				assert.Equal(t, test.deletedTexts, deletedTexts)
+			} else {
+				assert.Empty(t, deletedTexts)
+			}
+			markdown := readFile(t, filepath.Join(dir, markdownTranscript))
+			for _, fragment := range test.markdownFragments {
+				assert.Contains(t, markdown, fragment)
+			}
+
+			downloads := 0
+			for _, request := range server.Requests() {
+				if strings.HasPrefix(request, "/files/") {
+					downloads++
+				}
+			}
+			assert.Equal(t, 2, downloads, "files are only downloaded once")
+		})
+	}
+}
+
+func TestEditKeepsPreviousText(t *testing.T) {
+	server, _ := newWorkspace(t)
+	dir := t.TempDir()
+	exporter := Exporter{slackClient: server.Client(), dir: dir, lookback: time.Hour}
+	first, err := exporter.export("C0FLARE123")
+	require.NoError(t, err)
+	require.NoError(t, writeExport(dir, first))
+
+	fixed := server.Messages("C0FLARE123")[3]
+	fixed.Text = "fixed by rolling back"
+	server.UpdateMessage("C0FLARE123", fixed)
+	second, err := exporter.export("C0FLARE123")
+	require.NoError(t, err)
+	require.NoError(t, writeExport(dir, second))
+
+	entries, err := readEntries(filepath.Join(dir, messagesFile))
+	require.NoError(t, err)
+	assert.Equal(t, "fixed by rolling back", entries[3].Message.Text)
+	assert.Equal(t, []string{"fixed\nby a rollback"}, entries[3].PreviousText)
+
+	full, err := (&Exporter{slackClient: server.Client(), dir: dir, full: true}).export("C0FLARE123")
+	require.NoError(t, err)
+	assert.Equal(t, 4, full.Added)
+	assert.Empty(t, full.Entries[3].PreviousText, "-full starts over")
+}
+
+func TestExportPicksUpRepliesToOldThreads(t *testing.T) {
+	server := slacktest.NewServer(t)
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	server.Now = func() time.Time { return start }
+	server.AddChannel(channel("C0FLARE123", "flare-123"))
+	server.AddUser(slk.User{ID: "U1", Name: "alice"})
+	threads := server.AddMessages("C0FLARE123",
+		slk.Message{Msg: slk.Msg{User: "U1", Text: "quiet thread"}},
+		slk.Message{Msg: slk.Msg{User: "U1", Text: "busy thread"}},
+	)
+	server.AddMessages("C0FLARE123", slk.Message{Msg: slk.Msg{User: "U1", Text: "done", ThreadTimestamp: threads[0]}})
+	server.Now = func() time.Time { return start.Add(10 * 24 * time.Hour) }
+	server.AddMessages("C0FLARE123", slk.Message{Msg: slk.Msg{User: "U1", Text: "still digging", ThreadTimestamp: threads[1]}})
+
+	dir := t.TempDir()
+	exporter := Exporter{slackClient: server.Client(), dir: dir, lookback: 7 * 24 * time.Hour}
+	first, err := exporter.export("C0FLARE123")
+	require.NoError(t, err)
+	require.NoError(t, writeExport(dir, first))
+
+	server.Now = func() time.Time { return start.Add(11 * 24 * time.Hour) }
+	server.AddMessages("C0FLARE123", slk.Message{Msg: slk.Msg{User: "U1", Text: "found it", ThreadTimestamp: threads[1]}})
+	before := len(server.Requests())
+	second, err := exporter.export("C0FLARE123")
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, second.Added, "the parent is older than the lookback, its last reply isn't")
+	texts := []string{}
+	for _, entry := range second.Entries {
+		texts = append(texts, entry.Message.Text)
+	}
+	assert.Equal(t, []string{"quiet thread", "busy thread", "done", "still digging", "found it"}, texts)
+	fetches := 0
+	for _, request := range server.Requests()[before:] {
+		if strings.Contains(request, "conversations.replies") {
+			fetches++
+		}
+	}
+	assert.Equal(t, 1, fetches, "threads quiet since before the lookback aren't fetched again")
+}
+
+func TestExportWaitsOutRateLimits(t *testing.T) {
+	server, _ := newWorkspace(t)
+	server.InjectFault(slacktest.Fault{Method: "conversations.replies", Status: http.StatusTooManyRequests, RetryAfter: 2 * time.Second, Times: 2})
+	server.InjectFault(slacktest.Fault{Method: "users.info", Status: http.StatusTooManyRequests, RetryAfter: time.Second, Times: 1})
+	waits := []time.Duration{}
+	exporter := Exporter{slackClient: server.Client(), dir: t.TempDir(), sleep: func(d time.Duration) { waits = append(waits, d) }}
+
+	export, err := exporter.export("C0FLARE123")
+	require.NoError(t, err)
+	assert.Len(t, export.Entries, 4)
+	assert.Equal(t, "alice", export.Users["U1"])
+	assert.Equal(t, []time.Duration{2 * time.Second, 2 * time.Second, time.Second}, waits)
+}
+
+func TestFindChannel(t *testing.T) {
+	server, _ := newWorkspace(t)
+	exporter := Exporter{slackClient: server.Client()}
+
+	for _, name := range []string{"C0FLARE123", "flare-123", "#flare-123"} {
+		found, err := exporter.findChannel(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, "C0FLARE123", found.ID, name)
+	}
+	_, err := exporter.findChannel("flare-124")
+	assert.EqualError(t, err, "no channel named #flare-124")
+	_, err = exporter.findChannel("C0MISSING1")
+	assert.EqualError(t, err, "looking up channel C0MISSING1: channel_not_found")
+}
+
+func TestMarkdownText(t *testing.T) {
+	export := &Export{Users: map[string]string{"U1": "alice"}, Channels: map[string]string{}}
+	for _, test := range []struct {
+		text, markdown string
+	}{
+		{"plain", "plain"},
+		{"<@U1> and <@U9|someone>", "@alice and @someone"},
+		{"<#C1|general> <#C2>", "#general #C2"},
+		{"<!channel> <!subteam^S1|@oncall>", "@channel @oncall"},
+		{"<https://example.com> <https://example.com?a=1&amp;b=2|link>", "<https://example.com> [link](https://example.com?a=1&b=2)"},
+		{"<javascript:alert(1)|click>", "click"},
+		{"a &lt;b&gt; &amp; c", "a <b> & c"},
+	} {
+		assert.Equal(t, test.markdown, export.markdown(test.text), test.text)
+	}
+}
+
+func TestTimestampOrder(t *testing.T) {
+	assert.True(t, tsLess("999999999.000001", "1000000000.000000"))
+	assert.True(t, tsLess("1700000000.000001", "1700000000.000002"))
+	assert.False(t, tsLess("1700000000.000002", "1700000000.000002"))
+	assert.Equal(t, "1700000000.000010", lastTimestamp([]Entry{
+		{Message: slk.Message{Msg: slk.Msg{Timestamp: "1700000000.000010"}}},
+		{Message: slk.Message{Msg: slk.Msg{Timestamp: "1700000000.000009"}}},
+	}))
+}
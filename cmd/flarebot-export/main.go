@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Clever/flarebot/flare"
+
+	slk "github.com/slack-go/slack"
+)
+
+func main() {
+	key := flag.String("key", "", "flare ticket key, e.g. FLARE-123, to export the flare channel of")
+	channel := flag.String("channel", "", "channel ID or name to export, instead of -key")
+	out := flag.String("out", "", "export directory. Defaults to the channel name")
+	full := flag.Bool("full", false, "ignore an earlier export in the directory and export the whole history again")
+	lookback := flag.Duration("lookback", 7*24*time.Hour, "how far before the last exported message to check again for edits, deletions and new thread replies")
+	flag.Parse()
+
+	switch {
+	case *key == "" && *channel == "":
+		log.Fatalf("one of -key or -channel is required")
+	case *key != "" && *channel != "":
+		log.Fatalf("-key and -channel can't be used together")
+	case *key != "":
+		*channel = flare.ChannelName(*key)
+	}
+	if *out == "" {
+		*out = strings.TrimPrefix(*channel, "#")
+	}
+
+	exporter := Exporter{
+		slackClient: slk.New(requireEnvVar("SLACK_BOT_TOKEN")),
+		dir:         *out,
+		full:        *full,
+		lookback:    *lookback,
+	}
+	export, err := exporter.export(*channel)
+	if err != nil {
+		log.Fatalf("error exporting %s: %v", *channel, err)
+	}
+	if err := writeExport(*out, export); err != nil {
+		log.Fatalf("error writing the export: %v", err)
+	}
+	fmt.Printf("Exported %d new messages from #%s to %s, %d in total. %d were edited and %d deleted since the last export\n",
+		export.Added, export.Channel.Name, *out, len(export.Entries), export.Edited, export.Deleted)
+}
+
+func requireEnvVar(s string) string {
+	val, present := os.LookupEnv(s)
+	if !present {
+		log.Fatalf("env var %s is not defined", s)
+	}
+	return val
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	slk "github.com/slack-go/slack"
+)
+
+const timeFormat = "2006-01-02 15:04:05 UTC"
+
+// writeExport writes messages.jsonl and both transcripts into dir. Each file is replaced as a
+// whole, so an interrupted run leaves the earlier export readable.
+func writeExport(dir string, export *Export) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, write := range map[string]func(io.Writer) error{
+		messagesFile:       func(w io.Writer) error { return writeJSONL(w, export) },
+		htmlTranscript:     func(w io.Writer) error { return writeHTML(w, dir, export) },
+		markdownTranscript: func(w io.Writer) error { return writeMarkdown(w, export) },
+	} {
+		if err := writeFile(filepath.Join(dir, name), write); err != nil {
+			return fmt.Errorf("writing %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func writeJSONL(w io.Writer, export *Export) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for _, entry := range export.Entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// thread is a top-level message with its replies. Replies whose parent isn't in the export are
+// threads of their own.
+type thread struct {
+	Entry
+	Replies []Entry
+}
+
+func (x *Export) threads() []*thread {
+	threads := []*thread{}
+	parents := map[string]*thread{}
+	for _, entry := range x.Entries {
+		if parent, ok := parents[entry.Message.ThreadTimestamp]; ok && isReply(entry.Message) {
+			parent.Replies = append(parent.Replies, entry)
+			continue
+		}
+		t := &thread{Entry: entry}
+		threads = append(threads, t)
+		parents[entry.Message.Timestamp] = t
+	}
+	return threads
+}
+
+func (x *Export) author(message slk.Message) string {
+	switch {
+	case message.User != "":
+		return x.Users[message.User]
+	case message.Username != "":
+		return message.Username
+	case message.BotProfile != nil && message.BotProfile.Name != "":
+		return message.BotProfile.Name
+	default:
+		return "unknown"
+	}
+}
+
+// summary describes the exported range, e.g. "12 messages from ... to ...".
+func (x *Export) summary() string {
+	if len(x.Entries) == 0 {
+		return "No messages"
+	}
+	first, last := x.Entries[0].Message.Timestamp, x.Entries[len(x.Entries)-1].Message.Timestamp
+	return fmt.Sprintf("%d messages from %s to %s", len(x.Entries), formatTimestamp(first), formatTimestamp(last))
+}
+
+func formatTimestamp(ts string) string {
+	seconds, _ := splitTimestamp(ts)
+	return time.Unix(seconds, 0).UTC().Format(timeFormat)
+}
+
+func isDeleted(message slk.Message) bool {
+	return message.SubType == "tombstone" || message.SubType == slk.MsgSubTypeMessageDeleted
+}
+
+// segment is a run of message text. Segments with a URL are links labelled with Text.
+type segment struct {
+	Text string
+	URL  string
+}
+
+var (
+	slackMarkupRegex = regexp.MustCompile(`<([^<>]+)>`)
+	slackUnescaper   = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+)
+
+// segments splits Slack formatted text into plain text and links, with user, channel and
+// special mentions replaced by names.
+func (x *Export) segments(text string) []segment {
+	segments := []segment{}
+	last := 0
+	for _, match := range slackMarkupRegex.FindAllStringSubmatchIndex(text, -1) {
+		if match[0] > last {
+			segments = append(segments, segment{Text: slackUnescaper.Replace(text[last:match[0]])})
+		}
+		segments = append(segments, x.markup(text[match[2]:match[3]]))
+		last = match[1]
+	}
+	if last < len(text) {
+		segments = append(segments, segment{Text: slackUnescaper.Replace(text[last:])})
+	}
+	return segments
+}
+
+// markup renders what's between the angle brackets of Slack's markup, like "@U123" or
+// "https://example.com|example".
+func (x *Export) markup(markup string) segment {
+	target, label, _ := strings.Cut(markup, "|")
+	label = slackUnescaper.Replace(label)
+	switch {
+	case strings.HasPrefix(target, "@"):
+		if name := x.Users[target[1:]]; name != "" {
+			return segment{Text: "@" + name}
+		}
+		return segment{Text: "@" + firstNonEmpty(label, target[1:])}
+	case strings.HasPrefix(target, "#"):
+		if name := x.Channels[target[1:]]; name != "" {
+			return segment{Text: "#" + name}
+		}
+		return segment{Text: "#" + firstNonEmpty(label, target[1:])}
+	case strings.HasPrefix(target, "!"):
+		// Special mentions like <!here>, and <!subteam^S123|@team> or <!date^...|fallback>
+		// that carry their own label.
+		if label != "" {
+			return segment{Text: label}
+		}
+		return segment{Text: "@" + strings.SplitN(target[1:], "^", 2)[0]}
+	}
+	url := slackUnescaper.Replace(target)
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "mailto:") {
+		return segment{Text: firstNonEmpty(label, url)}
+	}
+	return segment{Text: firstNonEmpty(label, url), URL: url}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func writeMarkdown(w io.Writer, export *Export) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# #%s\n\n", export.Channel.Name)
+	if topic := export.Channel.Topic.Value; topic != "" {
+		fmt.Fprintf(&b, "Topic: %s\n\n", export.markdown(topic))
+	}
+	if purpose := export.Channel.Purpose.Value; purpose != "" {
+		fmt.Fprintf(&b, "Purpose: %s\n\n", export.markdown(purpose))
+	}
+	fmt.Fprintf(&b, "%s\n", export.summary())
+	for _, t := range export.threads() {
+		b.WriteString("\n")
+		export.writeMarkdownMessage(&b, t.Entry, "")
+		for _, reply := range t.Replies {
+			b.WriteString(">\n")
+			export.writeMarkdownMessage(&b, reply, "> ")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMarkdownMessage writes one message, each line starting with prefix.
+func (x *Export) writeMarkdownMessage(b *strings.Builder, entry Entry, prefix string) {
+	message := entry.Message
+	header := fmt.Sprintf("**%s** %s", x.author(message), formatTimestamp(message.Timestamp))
+	if message.Edited != nil {
+		header += " (edited)"
+	}
+	if entry.Deleted {
+		header += " (deleted in Slack)"
+	}
+	lines := []string{header}
+	if isDeleted(message) {
+		lines = append(lines, "_This message was deleted._")
+	} else if message.Text != "" {
+		lines = append(lines, strings.Split(x.markdown(message.Text), "\n")...)
+	}
+	for _, file := range message.Files {
+		if path := entry.Files[file.ID]; path != "" {
+			lines = append(lines, fmt.Sprintf("- [%s](%s)", file.Name, path))
+		} else {
+			lines = append(lines, fmt.Sprintf("- %s (not downloaded)", file.Name))
+		}
+	}
+	for i, line := range lines {
+		// Two trailing spaces keep the lines of a message apart without a blank line.
+		if i < len(lines)-1 {
+			line += "  "
+		}
+		fmt.Fprintf(b, "%s%s\n", prefix, line)
+	}
+}
+
+func (x *Export) markdown(text string) string {
+	var b strings.Builder
+	for _, s := range x.segments(text) {
+		switch {
+		case s.URL == "":
+			b.WriteString(s.Text)
+		case s.Text == s.URL:
+			fmt.Fprintf(&b, "<%s>", s.URL)
+		default:
+			fmt.Fprintf(&b, "[%s](%s)", s.Text, s.URL)
+		}
+	}
+	return b.String()
+}
+
+func (x *Export) html(text string) template.HTML {
+	var b strings.Builder
+	for _, s := range x.segments(text) {
+		if s.URL == "" {
+			b.WriteString(html.EscapeString(s.Text))
+		} else {
+			fmt.Fprintf(&b, `<a href="%s">%s</a>`, html.EscapeString(s.URL), html.EscapeString(s.Text))
+		}
+	}
+	return template.HTML(b.String())
+}
+
+type htmlMessage struct {
+	Author  string
+	Time    string
+	Text    template.HTML
+	Edited  bool
+	Deleted bool
+	// Removed is set for messages deleted in Slack after they were exported.
+	Removed bool
+	Files   []htmlFile
+	Replies []htmlMessage
+}
+
+// htmlFile is an attachment. Images are embedded in the transcript, other files link to their
+// copy in the export directory.
+type htmlFile struct {
+	Name  string
+	Href  template.URL
+	Image bool
+}
+
+func (x *Export) htmlMessage(dir string, entry Entry) htmlMessage {
+	message := entry.Message
+	view := htmlMessage{
+		Author:  x.author(message),
+		Time:    formatTimestamp(message.Timestamp),
+		Text:    x.html(message.Text),
+		Edited:  message.Edited != nil,
+		Deleted: isDeleted(message),
+		Removed: entry.Deleted,
+	}
+	for _, file := range message.Files {
+		f := htmlFile{Name: file.Name}
+		if path := entry.Files[file.ID]; path != "" {
+			f.Href = template.URL(path)
+			if strings.HasPrefix(file.Mimetype, "image/") {
+				if content, err := os.ReadFile(filepath.Join(dir, path)); err == nil {
+					f.Href = template.URL("data:" + file.Mimetype + ";base64," + base64.StdEncoding.EncodeToString(content))
+					f.Image = true
+				}
+			}
+		}
+		view.Files = append(view.Files, f)
+	}
+	return view
+}
+
+var transcriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>#{{.Name}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; color: #1d1c1d; }
+.summary { color: #616061; }
+.message { margin: 1em 0; }
+.author { font-weight: bold; }
+.time, .edited, .deleted, .missing { color: #616061; font-size: 0.85em; }
+.text { white-space: pre-wrap; }
+.replies { margin-left: 1.5em; padding-left: 1em; border-left: 3px solid #ddd; }
+img { max-width: 100%; display: block; margin: 0.5em 0; }
+</style>
+</head>
+<body>
+<h1>#{{.Name}}</h1>
+{{if .Topic}}<p>Topic: {{.Topic}}</p>
+{{end}}{{if .Purpose}}<p>Purpose: {{.Purpose}}</p>
+{{end}}<p class="summary">{{.Summary}}</p>
+{{range .Messages}}{{template "message" .}}{{end}}</body>
+</html>
+{{define "message"}}<div class="message">
+<div><span class="author">{{.Author}}</span> <span class="time">{{.Time}}</span>{{if .Edited}} <span class="edited">(edited)</span>{{end}}{{if .Removed}} <span class="deleted">(deleted in Slack)</span>{{end}}</div>
+{{if .Deleted}}<div class="deleted">This message was deleted.</div>
+{{else if .Text}}<div class="text">{{.Text}}</div>
+{{end}}{{range .Files}}{{if .Image}}<img src="{{.Href}}" alt="{{.Name}}">
+{{else if .Href}}<div><a href="{{.Href}}">{{.Name}}</a></div>
+{{else}}<div>{{.Name}} <span class="missing">(not downloaded)</span></div>
+{{end}}{{end}}{{if .Replies}}<div class="replies">
+{{range .Replies}}{{template "message" .}}{{end}}</div>
+{{end}}</div>
+{{end}}`))
+
+func writeHTML(w io.Writer, dir string, export *Export) error {
+	messages := []htmlMessage{}
+	for _, t := range export.threads() {
+		message := export.htmlMessage(dir, t.Entry)
+		for _, reply := range t.Replies {
+			message.Replies = append(message.Replies, export.htmlMessage(dir, reply))
+		}
+		messages = append(messages, message)
+	}
+	return transcriptTemplate.Execute(w, map[string]interface{}{
+		"Name":     export.Channel.Name,
+		"Topic":    export.html(export.Channel.Topic.Value),
+		"Purpose":  export.html(export.Channel.Purpose.Value),
+		"Summary":  export.summary(),
+		"Messages": messages,
+	})
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	_ "embed"
+	// FOLLOWUP_TIMEZONE needs the zone database, which the Lambda runtime doesn't have
+	_ "time/tzdata"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/Clever/flarebot/duration"
+	"github.com/Clever/flarebot/flare"
+	"github.com/Clever/flarebot/followup"
+	"github.com/Clever/flarebot/jira"
+	"github.com/Clever/flarebot/slackutil"
+	"github.com/Clever/kayvee-go/v7/logger"
+
+	slk "github.com/slack-go/slack"
+)
+
+// generate launch config
+//go:generate sh -c "$GENERATE_PWD/bin/launch-gen -o launch.go -p main $GENERATE_PWD/launch/flarebot-followup-enforcer.yml"
+
+// generate kv config bytes for setting up log routing
+//
+//go:embed kvconfig.yml
+var kvconfig []byte
+
+type SlackClient interface {
+	PostMessage(channelID string, options ...slk.MsgOption) (string, string, error)
+	GetConversationHistory(params *slk.GetConversationHistoryParameters) (*slk.GetConversationHistoryResponse, error)
+	GetConversationReplies(params *slk.GetConversationRepliesParameters) ([]slk.Message, bool, string, error)
+	GetUserByEmail(email string) (*slk.User, error)
+	ScheduleMessage(channelID, postAt string, options ...slk.MsgOption) (string, string, error)
+	GetScheduledMessages(params *slk.GetScheduledMessagesParameters) ([]slk.ScheduledMessage, string, error)
+	DeleteScheduledMessage(params *slk.DeleteScheduledMessageParameters) (bool, error)
+}
+
+type JiraClient interface {
+	SearchTickets(jql string, fields []string) ([]jira.Ticket, error)
+	GetChangelog(key string) ([]jira.ChangelogEntry, error)
+	SetLabel(ticket *jira.Ticket, label string) error
+}
+
+// Handler encapsulates the external dependencies of the lambda function.
+type Handler struct {
+	slackClient  SlackClient
+	jiraClient   JiraClient
+	launchConfig LaunchConfig
+	// now is the clock, time.Now when nil
+	now func() time.Time
+}
+
+type FailedFlare struct {
+	Key   string
+	Error string
+}
+
+// settings are the parsed form of the duration and list env vars.
+type settings struct {
+	followupLabels    []string
+	followupLinkTypes []string
+	remindAfter       time.Duration
+	remindInterval    time.Duration
+	escalateAfter     time.Duration
+	// schedule is when followup sign-up reminders are posted, nil when they're left to the app
+	schedule *followup.Schedule
+}
+
+// Constants for the handler
+const (
+	// escalatedLabel records on the ticket that the flares channel was already told about it
+	escalatedLabel = "followup-escalated"
+)
+
+// Handle is invoked by the Lambda runtime with the contents of the function input.
+func (h Handler) Handle(ctx context.Context) error {
+	// create a request-specific logger, attach it to ctx, and add the Lambda request ID.
+	ctx = logger.NewContext(ctx, logger.New(os.Getenv("APP_NAME")))
+	if lambdaContext, ok := lambdacontext.FromContext(ctx); ok {
+		logger.FromContext(ctx).AddContext("aws-request-id", lambdaContext.AwsRequestID)
+	}
+
+	s, err := h.settings()
+	if err != nil {
+		return err
+	}
+	logger.FromContext(ctx).InfoD("starting-followup-check", logger.M{
+		"followupLabels": s.followupLabels, "followupLinkTypes": s.followupLinkTypes, "remindAfter": s.remindAfter.String(),
+		"remindInterval": s.remindInterval.String(), "escalateAfter": s.escalateAfter.String(),
+	})
+	if s.schedule != nil && s.schedule.Holidays != nil {
+		for _, skipped := range s.schedule.Holidays.Skipped {
+			logger.FromContext(ctx).WarnD("holiday-event-skipped", logger.M{"error": skipped.Error()})
+		}
+	}
+
+	env := h.launchConfig.Env
+	jql := fmt.Sprintf(`project = %s AND status = "%s"`, env.JiraProjectID, flare.StatusMitigated)
+	tickets, err := h.jiraClient.SearchTickets(jql, []string{"summary", "status", "assignee", "created", "description", "labels", "issuelinks", env.JiraSlackChannelFieldID})
+	if err != nil {
+		return err
+	}
+
+	failedFlares := []FailedFlare{}
+	for _, ticket := range tickets {
+		err := h.checkFlare(ctx, ticket, s)
+		if err != nil {
+			failedFlares = append(failedFlares, FailedFlare{Key: ticket.Key, Error: err.Error()})
+		}
+	}
+
+	if s.schedule != nil {
+		// flares that were unmitigated don't need their sign-up reminders anymore
+		jql := fmt.Sprintf(`project = %s AND status = "%s"`, env.JiraProjectID, flare.StatusInProgress)
+		inProgress, err := h.jiraClient.SearchTickets(jql, []string{"status", env.JiraSlackChannelFieldID})
+		if err != nil {
+			return err
+		}
+		for _, ticket := range inProgress {
+			if err := h.cancelFollowups(ctx, ticket); err != nil {
+				failedFlares = append(failedFlares, FailedFlare{Key: ticket.Key, Error: err.Error()})
+			}
+		}
+	}
+
+	if len(failedFlares) > 0 {
+		logger.FromContext(ctx).ErrorD("error-enforcing-followups", logger.M{"flares": failedFlares})
+	}
+	return nil
+}
+
+func (h Handler) settings() (settings, error) {
+	env := h.launchConfig.Env
+	s := settings{
+		followupLabels:    splitList(env.FollowupLabels),
+		followupLinkTypes: splitList(env.FollowupLinkTypes),
+	}
+
+	var err error
+	if s.remindAfter, err = duration.Parse(env.RemindAfter); err != nil {
+		return s, fmt.Errorf("invalid REMIND_AFTER: %w", err)
+	}
+	if s.remindInterval, err = duration.Parse(env.RemindInterval); err != nil {
+		return s, fmt.Errorf("invalid REMIND_INTERVAL: %w", err)
+	}
+	if s.escalateAfter, err = duration.Parse(env.EscalateAfter); err != nil {
+		return s, fmt.Errorf("invalid ESCALATE_AFTER: %w", err)
+	}
+	if s.schedule, err = loadSchedule(env); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// splitList splits a comma separated setting, dropping empty entries.
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (h Handler) timeNow() time.Time {
+	if h.now == nil {
+		return time.Now()
+	}
+	return h.now()
+}
+
+// checkFlare reminds the flare channel about a mitigated flare with missing followup, and tells
+// the flares channel once the followup is overdue.
+func (h Handler) checkFlare(ctx context.Context, ticket jira.Ticket, s settings) error {
+	missing := missingFollowup(ticket, s.followupLinkTypes, s.followupLabels)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	changelog, err := h.jiraClient.GetChangelog(ticket.Key)
+	if err != nil {
+		return err
+	}
+	mitigatedAt := flare.StatusSince(ticket, jira.StatusChanges(changelog))
+	if s.schedule != nil {
+		if err := h.scheduleFollowup(ctx, ticket, mitigatedAt, s); err != nil {
+			return err
+		}
+	}
+	mitigatedFor := h.timeNow().Sub(mitigatedAt)
+	if mitigatedFor < s.remindAfter {
+		return nil
+	}
+
+	reminder := followupReminder{
+		Key:          ticket.Key,
+		TicketURL:    fmt.Sprintf("%s/browse/%s", h.launchConfig.Env.JiraOrigin, ticket.Key),
+		ChannelID:    flare.ChannelID(ticket, h.launchConfig.Env.JiraSlackChannelFieldID),
+		MitigatedFor: mitigatedFor,
+		Missing:      missing,
+		Assignee:     h.mention(ctx, ticket.Fields.Assignee),
+	}
+
+	if mitigatedFor >= s.escalateAfter && !flare.HasLabel(ticket, escalatedLabel) {
+		logger.FromContext(ctx).InfoD("escalating-followup", logger.M{"key": ticket.Key, "missing": missing})
+		_, _, err = h.slackClient.PostMessage(h.launchConfig.Env.FlaresChannelID,
+			slk.MsgOptionBlocks(reminder.escalationBlocks()...),
+			slk.MsgOptionText(reminder.escalationText(), false),
+		)
+		if err != nil {
+			return err
+		}
+		err = h.jiraClient.SetLabel(&ticket, escalatedLabel)
+		if err != nil {
+			return err
+		}
+	}
+
+	if reminder.ChannelID == "" {
+		return fmt.Errorf("ticket has no slack channel link")
+	}
+	reminded, err := slackutil.PostedSince(h.slackClient, reminder.ChannelID, h.timeNow().Add(-s.remindInterval), followupReminderBlockID)
+	if err != nil {
+		return err
+	}
+	if reminded {
+		logger.FromContext(ctx).DebugD("recently-reminded", logger.M{"key": ticket.Key})
+		return nil
+	}
+
+	logger.FromContext(ctx).InfoD("reminding-followup", logger.M{"key": ticket.Key, "missing": missing})
+	_, _, err = h.slackClient.PostMessage(reminder.ChannelID,
+		slk.MsgOptionBlocks(reminder.blocks()...),
+		slk.MsgOptionText(reminder.text(), false),
+	)
+	return err
+}
+
+// missingFollowup lists what still needs doing before the followup counts as complete. Only
+// links from the flare to another ticket with one of followupLinkTypes count as a followup.
+func missingFollowup(ticket jira.Ticket, followupLinkTypes, followupLabels []string) []string {
+	missing := []string{}
+	if strings.Contains(ticket.Fields.Description, flare.TemplatePlaceholder) {
+		missing = append(missing, "the ticket description still has the template's example text")
+	}
+
+	tracked := false
+	for _, link := range ticket.Fields.IssueLinks {
+		for _, linkType := range followupLinkTypes {
+			tracked = tracked || (link.OutwardIssue != nil && strings.EqualFold(link.Type.Name, linkType))
+		}
+	}
+	for _, label := range followupLabels {
+		tracked = tracked || flare.HasLabel(ticket, label)
+	}
+	if !tracked && len(followupLabels) == 0 {
+		missing = append(missing, "no followup ticket is linked")
+	} else if !tracked {
+		missing = append(missing, fmt.Sprintf("no followup ticket is linked and it has none of the labels %s", strings.Join(followupLabels, ", ")))
+	}
+	return missing
+}
+
+// mention tags the Jira assignee in Slack when their email resolves to a Slack user.
+func (h Handler) mention(ctx context.Context, assignee jira.User) string {
+	mention, err := slackutil.Mention(h.slackClient, assignee.EmailAddress, assignee.DisplayName)
+	if err != nil {
+		logger.FromContext(ctx).WarnD("slack-user-lookup-failed", logger.M{"email": assignee.EmailAddress, "error": err.Error()})
+	}
+	return mention
+}
+
+func main() {
+	ctx := context.Background()
+	if err := logger.SetGlobalRoutingFromBytes(kvconfig); err != nil {
+		log.Fatalf("Error setting kvconfig: %v", err)
+	}
+	lg := logger.FromContext(ctx)
+
+	launchConfig := InitLaunchConfig(nil)
+	slackClient := slk.New(launchConfig.Env.SlackBotToken)
+	jiraServer := jira.JiraServer{
+		Origin:   launchConfig.Env.JiraOrigin,
+		Username: launchConfig.Env.JiraUsername,
+		Password: launchConfig.Env.JiraPassword,
+	}
+
+	handler := Handler{
+		slackClient:  slackClient,
+		jiraClient:   &jiraServer,
+		launchConfig: launchConfig,
+		now:          time.Now,
+	}
+
+	if os.Getenv("IS_LOCAL") == "true" {
+		lg.InfoD("running locally", logger.M{})
+		err := handler.Handle(ctx)
+		if err != nil {
+			lg.ErrorD("error on handle", logger.M{"err": err.Error()})
+			os.Exit(1)
+		}
+	} else {
+		_, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			log.Fatalf("Error loading AWS config: %v", err)
+		}
+		lambda.Start(handler.Handle)
+	}
+}
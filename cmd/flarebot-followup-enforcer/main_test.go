@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Clever/flarebot/jira"
+	slk "github.com/slack-go/slack"
+)
+
+//go:generate mockgen -package main -destination mock.go -source main.go SlackClient,JiraClient
+
+type handleOutput struct {
+	err error
+}
+
+type handleTest struct {
+	description      string
+	output           handleOutput
+	mockExpectations func(slackClient *MockSlackClient, jiraClient *MockJiraClient)
+}
+
+var launchConfig = LaunchConfig{Env: Environment{
+	FlaresChannelID:         "C-FLARES",
+	JiraOrigin:              "https://mock-jira.com",
+	JiraProjectID:           "11701",
+	JiraSlackChannelFieldID: "customfield_12345",
+	FollowupLabels:          "no-followup-needed",
+	FollowupLinkTypes:       "Followup",
+	RemindAfter:             "7d",
+	RemindInterval:          "7d",
+	EscalateAfter:           "21d",
+}}
+
+const templateDescription = "h2. Customer Impact\n_[example: All users attempting to use Help center documentation ...]_"
+
+func mitigatedTicket(key, description string, labels ...string) jira.Ticket {
+	return jira.Ticket{
+		Key: key,
+		Fields: jira.TicketFields{
+			Status:       jira.Status{Name: "Mitigated"},
+			Description:  description,
+			Labels:       labels,
+			Assignee:     jira.User{DisplayName: "Alice Smith", EmailAddress: "alice@example.com"},
+			CustomFields: map[string]json.RawMessage{"customfield_12345": json.RawMessage(`"https://clever.slack.com/archives/C1"`)},
+		},
+	}
+}
+
+func mitigatedDaysAgo(days int) []jira.ChangelogEntry {
+	return []jira.ChangelogEntry{
+		{Created: jira.Time{Time: time.Now().AddDate(0, 0, -days)}, Items: []jira.ChangelogItem{{Field: "status", FromString: "In Progress", ToString: "Mitigated"}}},
+	}
+}
+
+func TestHandle(t *testing.T) {
+	incomplete := mitigatedTicket("FLARE-1", templateDescription)
+
+	tests := []handleTest{
+		{
+			description: "reminds the flare channel about incomplete followup",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(`project = 11701 AND status = "Mitigated"`, gomock.Any()).Return([]jira.Ticket{incomplete}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(mitigatedDaysAgo(8), nil).Times(1)
+				slackClient.EXPECT().GetUserByEmail("alice@example.com").Return(&slk.User{ID: "U1"}, nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{}, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C1", gomock.Any()).Return("", "", nil).Times(1)
+			},
+		},
+		{
+			description: "leaves complete followups alone",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				complete := mitigatedTicket("FLARE-2", "Nobody could log in for 10 minutes", "no-followup-needed")
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{complete}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog(gomock.Any()).Times(0)
+				slackClient.EXPECT().PostMessage(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "waits for the remind after period",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{incomplete}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(mitigatedDaysAgo(2), nil).Times(1)
+				slackClient.EXPECT().PostMessage(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "does not remind twice within the remind interval",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{incomplete}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(mitigatedDaysAgo(8), nil).Times(1)
+				slackClient.EXPECT().GetUserByEmail(gomock.Any()).Return(&slk.User{ID: "U1"}, nil).Times(1)
+				previous := slk.Message{}
+				previous.Blocks = slk.Blocks{BlockSet: followupReminder{}.blocks()}
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{Messages: []slk.Message{previous}}, nil).Times(1)
+				slackClient.EXPECT().PostMessage(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "escalates to the flares channel once and labels the ticket",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{incomplete}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(mitigatedDaysAgo(22), nil).Times(1)
+				slackClient.EXPECT().GetUserByEmail(gomock.Any()).Return(&slk.User{ID: "U1"}, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C-FLARES", gomock.Any()).Return("", "", nil).Times(1)
+				jiraClient.EXPECT().SetLabel(gomock.Any(), "followup-escalated").Return(nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{}, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C1", gomock.Any()).Return("", "", nil).Times(1)
+			},
+		},
+		{
+			description: "does not escalate a ticket that was already escalated",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				escalated := mitigatedTicket("FLARE-1", templateDescription, "followup-escalated")
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{escalated}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(mitigatedDaysAgo(40), nil).Times(1)
+				slackClient.EXPECT().GetUserByEmail(gomock.Any()).Return(&slk.User{ID: "U1"}, nil).Times(1)
+				jiraClient.EXPECT().SetLabel(gomock.Any(), gomock.Any()).Times(0)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{}, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C1", gomock.Any()).Return("", "", nil).Times(1)
+			},
+		},
+		{
+			description: "jira search error",
+			output:      handleOutput{err: errors.New("jira down")},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return(nil, errors.New("jira down")).Times(1)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mockController := gomock.NewController(t)
+			defer mockController.Finish()
+			mockSlackClient := NewMockSlackClient(mockController)
+			mockJiraClient := NewMockJiraClient(mockController)
+			test.mockExpectations(mockSlackClient, mockJiraClient)
+			err := Handler{slackClient: mockSlackClient, jiraClient: mockJiraClient, launchConfig: launchConfig}.Handle(context.Background())
+			assert.Equal(t, test.output.err, err)
+		})
+	}
+}
+
+func TestHandleInvalidSettings(t *testing.T) {
+	config := launchConfig
+	config.Env.RemindAfter = "xd"
+	err := Handler{launchConfig: config}.Handle(context.Background())
+	assert.EqualError(t, err, `invalid REMIND_AFTER: invalid duration "xd"`)
+}
+
+func TestMissingFollowup(t *testing.T) {
+	labels := []string{"no-followup-needed"}
+	linkTypes := []string{"Followup"}
+
+	assert.Len(t, missingFollowup(mitigatedTicket("FLARE-1", templateDescription), linkTypes, labels), 2)
+	assert.Empty(t, missingFollowup(mitigatedTicket("FLARE-1", "written up", "No-Followup-Needed"), linkTypes, labels))
+
+	linked := mitigatedTicket("FLARE-1", "written up")
+	linked.Fields.IssueLinks = []jira.IssueLink{{Type: jira.LinkType{Name: "followup"}, OutwardIssue: &jira.Ticket{Key: "INFRA-1"}}}
+	assert.Empty(t, missingFollowup(linked, linkTypes, labels))
+
+	unrelated := mitigatedTicket("FLARE-1", "written up")
+	unrelated.Fields.IssueLinks = []jira.IssueLink{
+		{Type: jira.LinkType{Name: "Relates"}, OutwardIssue: &jira.Ticket{Key: "FLARE-2"}},
+		{Type: jira.LinkType{Name: "Followup"}, InwardIssue: &jira.Ticket{Key: "FLARE-0"}},
+	}
+	assert.Equal(t, []string{"no followup ticket is linked and it has none of the labels no-followup-needed"}, missingFollowup(unrelated, linkTypes, labels))
+
+	assert.Equal(t, []string{"no followup ticket is linked"}, missingFollowup(mitigatedTicket("FLARE-1", "written up"), linkTypes, nil))
+}
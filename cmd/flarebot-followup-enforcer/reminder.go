@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Clever/flarebot/flare"
+	slk "github.com/slack-go/slack"
+)
+
+// followupReminderBlockID marks the reminder block so later runs can find it in the channel history.
+const followupReminderBlockID = "flarebot-followup-reminder"
+
+// followupDocsURL is the same followup guide flareTransition links to.
+const followupDocsURL = "https://clever.atlassian.net/wiki/spaces/ENG/pages/108210465/Flare+Followups#Step-2%3A-Updating-the-flare-ticket"
+
+type followupReminder struct {
+	Key          string
+	TicketURL    string
+	ChannelID    string
+	MitigatedFor time.Duration
+	Missing      []string
+	Assignee     string
+}
+
+func (r followupReminder) text() string {
+	return fmt.Sprintf("%s %s was mitigated %s ago but its followup isn't finished.", r.Assignee, r.Key, flare.FormatDuration(r.MitigatedFor))
+}
+
+func (r followupReminder) blocks() []slk.Block {
+	details := fmt.Sprintf("Still missing:\n• %s\nPlease fill out the <%s|jira ticket> following the instructions <%s|here>.",
+		strings.Join(r.Missing, "\n• "), r.TicketURL, followupDocsURL)
+	return []slk.Block{
+		slk.NewSectionBlock(slk.NewTextBlockObject(slk.MarkdownType, ":memo: "+r.text(), false, false), nil, nil, slk.SectionBlockOptionBlockID(followupReminderBlockID)),
+		slk.NewSectionBlock(slk.NewTextBlockObject(slk.MarkdownType, details, false, false), nil, nil),
+	}
+}
+
+func (r followupReminder) escalationText() string {
+	channel := r.Key
+	if r.ChannelID != "" {
+		channel = fmt.Sprintf("<#%s>", r.ChannelID)
+	}
+	return fmt.Sprintf("%s was mitigated %s ago and its followup is still incomplete. Incident lead: %s", channel, flare.FormatDuration(r.MitigatedFor), r.Assignee)
+}
+
+func (r followupReminder) escalationBlocks() []slk.Block {
+	details := fmt.Sprintf("Still missing:\n• %s\n<%s|%s>", strings.Join(r.Missing, "\n• "), r.TicketURL, r.Key)
+	return []slk.Block{
+		slk.NewSectionBlock(slk.NewTextBlockObject(slk.MarkdownType, ":rotating_light: "+r.escalationText(), false, false), nil, nil),
+		slk.NewSectionBlock(slk.NewTextBlockObject(slk.MarkdownType, details, false, false), nil, nil),
+	}
+}
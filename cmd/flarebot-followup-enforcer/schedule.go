@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Clever/flarebot/flare"
+	"github.com/Clever/flarebot/followup"
+	"github.com/Clever/flarebot/jira"
+	"github.com/Clever/flarebot/slackutil"
+	"github.com/Clever/kayvee-go/v7/logger"
+
+	slk "github.com/slack-go/slack"
+)
+
+// followupSlotBlockID marks the sign-up reminder so later runs don't post it twice.
+const followupSlotBlockID = "flarebot-followup-slot"
+
+// followupSignupURL is the same sign-up guide flareTransition links to.
+const followupSignupURL = "https://clever.atlassian.net/wiki/spaces/ENG/pages/108210465/Flare+Followups#Step-1%3A-Signing-up-for-flare-followup"
+
+// followupSlotMarker is in the text of every sign-up reminder, including the ones the app
+// schedules, which is all Slack returns about scheduled messages.
+const followupSlotMarker = "|sign up> for followup"
+
+// calendarClient fetches HOLIDAY_CALENDAR URLs. The timeout keeps a slow calendar host from
+// using up the Lambda's whole run.
+var calendarClient = &http.Client{Timeout: 10 * time.Second}
+
+type followupSlot struct {
+	Key       string
+	TicketURL string
+	Assignee  string
+}
+
+func (s followupSlot) text() string {
+	return fmt.Sprintf("%s if you haven't already, can you please <%s%s? Fill out the <%s|jira ticket> to capture what we know, following the instructions <%s|here>.",
+		s.Assignee, followupSignupURL, followupSlotMarker, s.TicketURL, followupDocsURL)
+}
+
+func (s followupSlot) blocks() []slk.Block {
+	return []slk.Block{
+		slk.NewSectionBlock(slk.NewTextBlockObject(slk.MarkdownType, s.text(), false, false), nil, nil, slk.SectionBlockOptionBlockID(followupSlotBlockID)),
+	}
+}
+
+// loadSchedule reads FOLLOWUP_SCHEDULE, FOLLOWUP_TIMEZONE and HOLIDAY_CALENDAR. It returns nil
+// when FOLLOWUP_SCHEDULE isn't set, which leaves the sign-up reminders to the app.
+func loadSchedule(env Environment) (*followup.Schedule, error) {
+	if env.FollowupSchedule == "" {
+		return nil, nil
+	}
+	schedule, err := followup.ParseSchedule(env.FollowupSchedule, env.FollowupTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FOLLOWUP_SCHEDULE: %w", err)
+	}
+	if env.HolidayCalendar != "" {
+		if schedule.Holidays, err = loadHolidays(env.HolidayCalendar, schedule.Location); err != nil {
+			return nil, fmt.Errorf("invalid HOLIDAY_CALENDAR: %w", err)
+		}
+	}
+	return &schedule, nil
+}
+
+// loadHolidays reads an ICS file from a path or an https URL, like a shared calendar's
+// public address. Events with a time are on their date in zone, the schedule's time zone.
+func loadHolidays(location string, zone *time.Location) (*followup.Holidays, error) {
+	var calendar io.ReadCloser
+	if strings.HasPrefix(location, "https://") {
+		resp, err := calendarClient.Get(location)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("fetching %s: %s", location, resp.Status)
+		}
+		calendar = resp.Body
+	} else {
+		file, err := os.Open(location)
+		if err != nil {
+			return nil, err
+		}
+		calendar = file
+	}
+	defer calendar.Close()
+	return followup.ParseICS(calendar, zone)
+}
+
+// scheduleFollowup makes sure the flare channel gets the followup sign-up reminder at the flare's
+// slot: scheduled in Slack while the slot is ahead, posted right away once it's due. Flares
+// mitigated longer than REMIND_AFTER ago get the regular reminders instead.
+func (h Handler) scheduleFollowup(ctx context.Context, ticket jira.Ticket, mitigatedAt time.Time, s settings) error {
+	now := h.timeNow()
+	if now.Sub(mitigatedAt) >= s.remindAfter {
+		return nil
+	}
+	channelID := flare.ChannelID(ticket, h.launchConfig.Env.JiraSlackChannelFieldID)
+	if channelID == "" {
+		return fmt.Errorf("ticket has no slack channel link")
+	}
+	due, err := s.schedule.Next(mitigatedAt)
+	if err != nil {
+		return err
+	}
+
+	scheduled, err := h.scheduledFollowups(channelID)
+	if err != nil {
+		return err
+	}
+	// The app schedules its own reminder for Thursday 15:00 UTC. One on the flare's slot is kept,
+	// any other is replaced so the schedule takes effect.
+	onSlot := false
+	for _, message := range scheduled {
+		if !onSlot && due.After(now) && int64(message.PostAt) == due.Unix() {
+			onSlot = true
+			continue
+		}
+		logger.FromContext(ctx).InfoD("replacing-followup", logger.M{"key": ticket.Key, "id": message.ID, "postAt": time.Unix(int64(message.PostAt), 0).UTC().Format(time.RFC3339)})
+		_, err := h.slackClient.DeleteScheduledMessage(&slk.DeleteScheduledMessageParameters{Channel: channelID, ScheduledMessageID: message.ID})
+		if err != nil {
+			return err
+		}
+	}
+	if onSlot {
+		return nil
+	}
+	posted, err := h.followupPosted(channelID, mitigatedAt)
+	if err != nil || posted {
+		return err
+	}
+
+	slot := followupSlot{
+		Key:       ticket.Key,
+		TicketURL: fmt.Sprintf("%s/browse/%s", h.launchConfig.Env.JiraOrigin, ticket.Key),
+		Assignee:  h.mention(ctx, ticket.Fields.Assignee),
+	}
+	options := []slk.MsgOption{slk.MsgOptionBlocks(slot.blocks()...), slk.MsgOptionText(slot.text(), false)}
+	if due.After(now) {
+		logger.FromContext(ctx).InfoD("scheduling-followup", logger.M{"key": ticket.Key, "postAt": due.Format(time.RFC3339)})
+		_, _, err = h.slackClient.ScheduleMessage(channelID, strconv.FormatInt(due.Unix(), 10), options...)
+		return err
+	}
+	logger.FromContext(ctx).InfoD("posting-followup", logger.M{"key": ticket.Key})
+	_, _, err = h.slackClient.PostMessage(channelID, options...)
+	return err
+}
+
+// cancelFollowups deletes the sign-up reminders scheduled in the channel of a flare that's back
+// in progress, like flareTransition does when a flare is unmitigated.
+func (h Handler) cancelFollowups(ctx context.Context, ticket jira.Ticket) error {
+	channelID := flare.ChannelID(ticket, h.launchConfig.Env.JiraSlackChannelFieldID)
+	if channelID == "" {
+		return nil
+	}
+	scheduled, err := h.scheduledFollowups(channelID)
+	if err != nil {
+		return err
+	}
+	for _, message := range scheduled {
+		logger.FromContext(ctx).InfoD("cancelling-followup", logger.M{"key": ticket.Key, "id": message.ID})
+		_, err := h.slackClient.DeleteScheduledMessage(&slk.DeleteScheduledMessageParameters{Channel: channelID, ScheduledMessageID: message.ID})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// followupPosted reports whether a sign-up reminder was posted in the channel after since, by
+// this job or by the app, which answers in the thread of the mitigation message when the
+// flare is mitigated on a Thursday afternoon.
+func (h Handler) followupPosted(channelID string, since time.Time) (bool, error) {
+	isFollowup := func(message slk.Message) bool {
+		return slackutil.HasBlockID(message, followupSlotBlockID) || strings.Contains(message.Text, followupSlotMarker)
+	}
+	params := &slk.GetConversationHistoryParameters{ChannelID: channelID, Oldest: strconv.FormatInt(since.Unix(), 10)}
+	for {
+		history, err := h.slackClient.GetConversationHistory(params)
+		if err != nil {
+			return false, err
+		}
+		for _, message := range history.Messages {
+			if isFollowup(message) {
+				return true, nil
+			}
+			if message.ReplyCount == 0 {
+				continue
+			}
+			replies := &slk.GetConversationRepliesParameters{ChannelID: channelID, Timestamp: message.Timestamp}
+			for {
+				thread, hasMore, cursor, err := h.slackClient.GetConversationReplies(replies)
+				if err != nil {
+					return false, err
+				}
+				for _, reply := range thread {
+					if isFollowup(reply) {
+						return true, nil
+					}
+				}
+				if !hasMore || cursor == "" {
+					break
+				}
+				replies.Cursor = cursor
+			}
+		}
+		if !history.HasMore || history.ResponseMetaData.NextCursor == "" {
+			return false, nil
+		}
+		params.Cursor = history.ResponseMetaData.NextCursor
+	}
+}
+
+// scheduledFollowups lists the sign-up reminders scheduled in the channel.
+func (h Handler) scheduledFollowups(channelID string) ([]slk.ScheduledMessage, error) {
+	followups := []slk.ScheduledMessage{}
+	params := &slk.GetScheduledMessagesParameters{Channel: channelID}
+	for {
+		messages, cursor, err := h.slackClient.GetScheduledMessages(params)
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			if strings.Contains(message.Text, followupSlotMarker) {
+				followups = append(followups, message)
+			}
+		}
+		if cursor == "" {
+			return followups, nil
+		}
+		params.Cursor = cursor
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/jira"
+	slk "github.com/slack-go/slack"
+)
+
+// scheduleNow is a Tuesday, the followup slot is Thursday 2026-10-22 15:00 UTC.
+var scheduleNow = time.Date(2026, 10, 20, 16, 0, 0, 0, time.UTC)
+
+func mitigatedOn(at time.Time) []jira.ChangelogEntry {
+	return []jira.ChangelogEntry{
+		{Created: jira.Time{Time: at}, Items: []jira.ChangelogItem{{Field: "status", FromString: "In Progress", ToString: "Mitigated"}}},
+	}
+}
+
+func TestHandleWithSchedule(t *testing.T) {
+	incomplete := mitigatedTicket("FLARE-1", templateDescription)
+	inProgress := jira.Ticket{Key: "FLARE-2", Fields: jira.TicketFields{
+		Status:       jira.Status{Name: "In Progress"},
+		CustomFields: map[string]json.RawMessage{"customfield_12345": json.RawMessage(`"https://clever.slack.com/archives/C2"`)},
+	}}
+	// the slot is Thursday 2026-10-22 15:00 UTC, 1792681200
+	signup := slk.ScheduledMessage{ID: "Q1", PostAt: 1792681200, Text: "<@U1> if you haven't already, can you please <https://wiki|sign up> for followup for tomorrow?"}
+	searchMitigated := func(jiraClient *MockJiraClient, tickets ...jira.Ticket) {
+		jiraClient.EXPECT().SearchTickets(`project = 11701 AND status = "Mitigated"`, gomock.Any()).Return(tickets, nil).Times(1)
+	}
+	searchInProgress := func(jiraClient *MockJiraClient, tickets ...jira.Ticket) {
+		jiraClient.EXPECT().SearchTickets(`project = 11701 AND status = "In Progress"`, gomock.Any()).Return(tickets, nil).Times(1)
+	}
+
+	tests := []handleTest{
+		{
+			description: "schedules the sign-up reminder for the next slot",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				searchMitigated(jiraClient, incomplete)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(mitigatedOn(scheduleNow.AddDate(0, 0, -1)), nil).Times(1)
+				slackClient.EXPECT().GetScheduledMessages(&slk.GetScheduledMessagesParameters{Channel: "C1"}).Return(nil, "", nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{}, nil).Times(1)
+				slackClient.EXPECT().GetUserByEmail("alice@example.com").Return(&slk.User{ID: "U1"}, nil).Times(1)
+				slackClient.EXPECT().ScheduleMessage("C1", "1792681200", gomock.Any()).Return("", "", nil).Times(1)
+				searchInProgress(jiraClient)
+			},
+		},
+		{
+			description: "posts the sign-up reminder once its slot has passed",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				searchMitigated(jiraClient, incomplete)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(mitigatedOn(scheduleNow.AddDate(0, 0, -5)), nil).Times(1)
+				slackClient.EXPECT().GetScheduledMessages(gomock.Any()).Return(nil, "", nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{}, nil).Times(1)
+				slackClient.EXPECT().GetUserByEmail("alice@example.com").Return(&slk.User{ID: "U1"}, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C1", gomock.Any()).Return("", "", nil).Times(1)
+				searchInProgress(jiraClient)
+			},
+		},
+		{
+			description: "does not schedule a reminder that's already scheduled",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				searchMitigated(jiraClient, incomplete)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(mitigatedOn(scheduleNow.AddDate(0, 0, -1)), nil).Times(1)
+				slackClient.EXPECT().GetScheduledMessages(gomock.Any()).Return([]slk.ScheduledMessage{signup}, "", nil).Times(1)
+				slackClient.EXPECT().ScheduleMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				searchInProgress(jiraClient)
+			},
+		},
+		{
+			description: "replaces a reminder the app scheduled for another time",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				searchMitigated(jiraClient, incomplete)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(mitigatedOn(scheduleNow.AddDate(0, 0, -1)), nil).Times(1)
+				fromApp := signup
+				fromApp.PostAt = 1793286000 // the Thursday after
+				slackClient.EXPECT().GetScheduledMessages(gomock.Any()).Return([]slk.ScheduledMessage{fromApp}, "", nil).Times(1)
+				gomock.InOrder(
+					slackClient.EXPECT().DeleteScheduledMessage(&slk.DeleteScheduledMessageParameters{Channel: "C1", ScheduledMessageID: "Q1"}).Return(true, nil).Times(1),
+					slackClient.EXPECT().ScheduleMessage("C1", "1792681200", gomock.Any()).Return("", "", nil).Times(1),
+				)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{}, nil).Times(1)
+				slackClient.EXPECT().GetUserByEmail("alice@example.com").Return(&slk.User{ID: "U1"}, nil).Times(1)
+				searchInProgress(jiraClient)
+			},
+		},
+		{
+			description: "does not post a reminder the app posted in the mitigation thread",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				searchMitigated(jiraClient, incomplete)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(mitigatedOn(scheduleNow.AddDate(0, 0, -5)), nil).Times(1)
+				slackClient.EXPECT().GetScheduledMessages(gomock.Any()).Return(nil, "", nil).Times(1)
+				mitigation := slk.Message{}
+				mitigation.Timestamp = "1792600000.000100"
+				mitigation.ReplyCount = 2
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{Messages: []slk.Message{mitigation}}, nil).Times(1)
+				reply := slk.Message{}
+				reply.Text = "<@U1> can you please <https://wiki|sign up> for followup for tomorrow?"
+				slackClient.EXPECT().GetConversationReplies(&slk.GetConversationRepliesParameters{ChannelID: "C1", Timestamp: "1792600000.000100"}).
+					Return([]slk.Message{mitigation, reply}, false, "", nil).Times(1)
+				slackClient.EXPECT().PostMessage(gomock.Any(), gomock.Any()).Times(0)
+				searchInProgress(jiraClient)
+			},
+		},
+		{
+			description: "does not post a reminder that was already posted",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				searchMitigated(jiraClient, incomplete)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(mitigatedOn(scheduleNow.AddDate(0, 0, -5)), nil).Times(1)
+				slackClient.EXPECT().GetScheduledMessages(gomock.Any()).Return(nil, "", nil).Times(1)
+				posted := slk.Message{}
+				posted.Blocks = slk.Blocks{BlockSet: followupSlot{}.blocks()}
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{Messages: []slk.Message{posted}}, nil).Times(1)
+				slackClient.EXPECT().PostMessage(gomock.Any(), gomock.Any()).Times(0)
+				searchInProgress(jiraClient)
+			},
+		},
+		{
+			description: "leaves flares mitigated before remind after to the regular reminders",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				searchMitigated(jiraClient, incomplete)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(mitigatedOn(scheduleNow.AddDate(0, 0, -8)), nil).Times(1)
+				slackClient.EXPECT().GetScheduledMessages(gomock.Any()).Times(0)
+				slackClient.EXPECT().GetUserByEmail(gomock.Any()).Return(&slk.User{ID: "U1"}, nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{}, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C1", gomock.Any()).Return("", "", nil).Times(1)
+				searchInProgress(jiraClient)
+			},
+		},
+		{
+			description: "cancels the sign-up reminders of unmitigated flares",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				searchMitigated(jiraClient)
+				searchInProgress(jiraClient, inProgress)
+				other := slk.ScheduledMessage{ID: "Q2", Text: "standup in 5"}
+				slackClient.EXPECT().GetScheduledMessages(&slk.GetScheduledMessagesParameters{Channel: "C2"}).Return([]slk.ScheduledMessage{signup, other}, "", nil).Times(1)
+				slackClient.EXPECT().DeleteScheduledMessage(&slk.DeleteScheduledMessageParameters{Channel: "C2", ScheduledMessageID: "Q1"}).Return(true, nil).Times(1)
+			},
+		},
+	}
+
+	config := launchConfig
+	config.Env.FollowupSchedule = "Thu 15:00"
+	config.Env.FollowupTimezone = "UTC"
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mockController := gomock.NewController(t)
+			defer mockController.Finish()
+			mockSlackClient := NewMockSlackClient(mockController)
+			mockJiraClient := NewMockJiraClient(mockController)
+			test.mockExpectations(mockSlackClient, mockJiraClient)
+			h := Handler{slackClient: mockSlackClient, jiraClient: mockJiraClient, launchConfig: config, now: func() time.Time { return scheduleNow }}
+			assert.NoError(t, h.Handle(context.Background()))
+		})
+	}
+}
+
+func TestLoadSchedule(t *testing.T) {
+	schedule, err := loadSchedule(Environment{})
+	require.NoError(t, err)
+	assert.Nil(t, schedule)
+
+	calendar := filepath.Join(t.TempDir(), "holidays.ics")
+	require.NoError(t, os.WriteFile(calendar, []byte("BEGIN:VEVENT\nDTSTART;VALUE=DATE:20261126\nSUMMARY:Thanksgiving\nEND:VEVENT\n"), 0o644))
+	schedule, err = loadSchedule(Environment{FollowupSchedule: "Thu 15:00", FollowupTimezone: "America/New_York", HolidayCalendar: calendar})
+	require.NoError(t, err)
+	_, holiday := schedule.Holidays.On(time.Date(2026, 11, 26, 0, 0, 0, 0, time.UTC))
+	assert.True(t, holiday)
+
+	_, err = loadSchedule(Environment{FollowupSchedule: "Thu 15:00", HolidayCalendar: "missing.ics"})
+	assert.ErrorContains(t, err, "invalid HOLIDAY_CALENDAR")
+	_, err = loadSchedule(Environment{FollowupSchedule: "someday"})
+	assert.ErrorContains(t, err, "invalid FOLLOWUP_SCHEDULE")
+}
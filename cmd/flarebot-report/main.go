@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Clever/flarebot/jira"
+)
+
+const dateLayout = "2006-01-02"
+
+func main() {
+	now := time.Now().UTC()
+	fromFlag := flag.String("from", now.AddDate(0, -3, 0).Format(dateLayout), "only include flares created on or after this date (YYYY-MM-DD)")
+	toFlag := flag.String("to", now.AddDate(0, 0, 1).Format(dateLayout), "only include flares created before this date (YYYY-MM-DD)")
+	project := flag.String("project", "FLARE", "Jira project key for flares")
+	format := flag.String("format", formatText, "output format: text, csv or json")
+	flag.Parse()
+
+	switch *format {
+	case formatText, formatCSV, formatJSON:
+	default:
+		log.Fatalf("invalid -format %q, expected text, csv or json", *format)
+	}
+
+	from, err := time.Parse(dateLayout, *fromFlag)
+	if err != nil {
+		log.Fatalf("invalid -from: %v", err)
+	}
+	to, err := time.Parse(dateLayout, *toFlag)
+	if err != nil {
+		log.Fatalf("invalid -to: %v", err)
+	}
+	if !from.Before(to) {
+		log.Fatalf("-from must be before -to")
+	}
+
+	jiraServer := jira.JiraServer{
+		Origin:   requireEnvVar("JIRA_ORIGIN"),
+		Username: requireEnvVar("JIRA_USERNAME"),
+		Password: requireEnvVar("JIRA_PASSWORD"),
+	}
+
+	report, err := buildReport(&jiraServer, *project, from, to)
+	if err != nil {
+		log.Fatalf("error building report: %v", err)
+	}
+	if err := writeReport(os.Stdout, report, *format); err != nil {
+		log.Fatalf("error writing report: %v", err)
+	}
+}
+
+func requireEnvVar(s string) string {
+	val, present := os.LookupEnv(s)
+	if !present {
+		log.Fatalf("env var %s is not defined", s)
+	}
+	return val
+}
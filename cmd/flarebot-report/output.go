@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	formatText = "text"
+	formatCSV  = "csv"
+	formatJSON = "json"
+)
+
+func writeReport(w io.Writer, report *Report, format string) error {
+	switch format {
+	case formatText:
+		return writeText(w, report)
+	case formatCSV:
+		return writeCSV(w, report)
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	default:
+		return fmt.Errorf("unknown format %q, expected one of %s, %s, %s", format, formatText, formatCSV, formatJSON)
+	}
+}
+
+func writeText(w io.Writer, report *Report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Flares created %s to %s\n\n", report.From.Format("2006-01-02"), report.To.Format("2006-01-02"))
+	fmt.Fprintf(tw, "Total flares:\t%d\n", report.Total)
+	fmt.Fprintf(tw, "Not a flare:\t%d (%s)\n", report.NotAFlare, percent(report.NotAFlareRatio))
+	fmt.Fprintf(tw, "Followups completed:\t%d of %d mitigated (%s)\n", report.FollowupsDone, report.Mitigated, percent(report.FollowupRatio))
+
+	fmt.Fprintf(tw, "\nTIME TO MITIGATE\nPRIORITY\tMONTH\tCOUNT\tP50\tP90\tMAX\n")
+	for _, row := range report.TimeToMitigate {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", row.Priority, row.Month, row.Count,
+			formatDuration(row.P50), formatDuration(row.P90), formatDuration(row.Max))
+	}
+
+	fmt.Fprintf(tw, "\nFLARE COUNTS\nPRIORITY\tTYPE\tCOUNT\n")
+	for _, row := range report.CountsByPriority {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", row.Priority, row.Type, row.Count)
+	}
+
+	if len(report.ChangelogFailures) > 0 {
+		fmt.Fprintf(tw, "\nCould not load history for: %v\n", report.ChangelogFailures)
+	}
+	return tw.Flush()
+}
+
+// writeCSV writes one row per flare so the data can be pivoted in a spreadsheet.
+func writeCSV(w io.Writer, report *Report) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"key", "summary", "priority", "type", "status", "created", "mitigated", "time_to_mitigate_minutes", "not_a_flare", "followup_done"})
+	if err != nil {
+		return err
+	}
+	for _, flare := range report.Flares {
+		mitigated, ttm := "", ""
+		if flare.MitigatedAt != nil {
+			mitigated = flare.MitigatedAt.Format(time.RFC3339)
+		}
+		if flare.TimeToMitigate != nil {
+			ttm = strconv.FormatFloat(flare.TimeToMitigate.Minutes(), 'f', 1, 64)
+		}
+		err = cw.Write([]string{
+			flare.Key,
+			flare.Summary,
+			flare.Priority,
+			flare.Type,
+			flare.Status,
+			flare.Created.Format(time.RFC3339),
+			mitigated,
+			ttm,
+			strconv.FormatBool(flare.NotAFlare),
+			strconv.FormatBool(flare.FollowupDone),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Minute).String()
+}
+
+func percent(ratio float64) string {
+	return strconv.FormatFloat(ratio*100, 'f', 1, 64) + "%"
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Clever/flarebot/flare"
+	"github.com/Clever/flarebot/jira"
+)
+
+const (
+	typeRetroactive   = "retroactive"
+	typePreemptive    = "preemptive"
+	typeStandard      = "standard"
+	retroactiveWindow = 2 * time.Minute
+	monthLayout       = "2006-01"
+)
+
+var reportTicketFields = []string{"summary", "status", "priority", "labels", "created", "description", "assignee"}
+
+type JiraClient interface {
+	SearchTickets(jql string, fields []string) ([]jira.Ticket, error)
+	GetChangelog(key string) ([]jira.ChangelogEntry, error)
+}
+
+// Flare is a flare ticket with the lifecycle facts the report cares about.
+type Flare struct {
+	Key            string         `json:"key"`
+	Summary        string         `json:"summary"`
+	Priority       string         `json:"priority"`
+	Type           string         `json:"type"`
+	Status         string         `json:"status"`
+	Created        time.Time      `json:"created"`
+	MitigatedAt    *time.Time     `json:"mitigatedAt,omitempty"`
+	TimeToMitigate *time.Duration `json:"timeToMitigateNs,omitempty"`
+	NotAFlare      bool           `json:"notAFlare"`
+	FollowupDone   bool           `json:"followupDone"`
+}
+
+// MitigationStats summarizes time to mitigate for one priority and month.
+type MitigationStats struct {
+	Priority string        `json:"priority"`
+	Month    string        `json:"month"`
+	Count    int           `json:"count"`
+	P50      time.Duration `json:"p50Ns"`
+	P90      time.Duration `json:"p90Ns"`
+	Max      time.Duration `json:"maxNs"`
+}
+
+// CountRow is the number of flares for one priority and type.
+type CountRow struct {
+	Priority string `json:"priority"`
+	Type     string `json:"type"`
+	Count    int    `json:"count"`
+}
+
+// Report is the full output of a report run.
+type Report struct {
+	From              time.Time         `json:"from"`
+	To                time.Time         `json:"to"`
+	Total             int               `json:"total"`
+	NotAFlare         int               `json:"notAFlare"`
+	NotAFlareRatio    float64           `json:"notAFlareRatio"`
+	Mitigated         int               `json:"mitigated"`
+	FollowupsDone     int               `json:"followupsDone"`
+	FollowupRatio     float64           `json:"followupRatio"`
+	TimeToMitigate    []MitigationStats `json:"timeToMitigate"`
+	CountsByPriority  []CountRow        `json:"countsByPriority"`
+	Flares            []Flare           `json:"flares"`
+	ChangelogFailures []string          `json:"changelogFailures,omitempty"`
+}
+
+// buildReport fetches every flare created in [from, to) and computes the report.
+func buildReport(client JiraClient, project string, from, to time.Time) (*Report, error) {
+	jql := fmt.Sprintf(`project = "%s" AND created >= "%s" AND created < "%s" ORDER BY created ASC`,
+		project, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	tickets, err := client.SearchTickets(jql, reportTicketFields)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{From: from, To: to}
+	for _, ticket := range tickets {
+		changelog, err := client.GetChangelog(ticket.Key)
+		if err != nil {
+			// a missing changelog only affects time to mitigate, so keep going
+			report.ChangelogFailures = append(report.ChangelogFailures, ticket.Key)
+		}
+		report.Flares = append(report.Flares, toFlare(ticket, jira.StatusChanges(changelog)))
+	}
+	summarize(report)
+	return report, nil
+}
+
+func toFlare(ticket jira.Ticket, changes []jira.StatusChange) Flare {
+	f := Flare{
+		Key:       ticket.Key,
+		Summary:   ticket.Fields.Summary,
+		Priority:  flare.Priority(ticket),
+		Status:    ticket.Fields.Status.Name,
+		Created:   ticket.Fields.Created.Time,
+		NotAFlare: flare.WasNotAFlare(ticket, changes),
+	}
+
+	if mitigatedAt, ok := flare.MitigatedAt(changes); ok {
+		f.MitigatedAt = &mitigatedAt
+		if !f.NotAFlare {
+			ttm := mitigatedAt.Sub(f.Created)
+			f.TimeToMitigate = &ttm
+		}
+	}
+
+	f.Type = flareType(ticket.Fields.Labels, f.TimeToMitigate)
+	f.FollowupDone = f.MitigatedAt != nil && !strings.Contains(ticket.Fields.Description, flare.TemplatePlaceholder)
+	return f
+}
+
+// flareType prefers an explicit label. Jira has no field for the flare type, but flarebot
+// transitions retroactive flares straight to Mitigated, so a near-instant mitigation is
+// treated as retroactive. Preemptive flares can only be identified by label.
+func flareType(labels []string, ttm *time.Duration) string {
+	for _, label := range labels {
+		switch strings.ToLower(label) {
+		case typeRetroactive:
+			return typeRetroactive
+		case typePreemptive, "pre-emptive":
+			return typePreemptive
+		}
+	}
+	if ttm != nil && *ttm < retroactiveWindow {
+		return typeRetroactive
+	}
+	return typeStandard
+}
+
+func summarize(report *Report) {
+	report.Total = len(report.Flares)
+
+	durations := map[[2]string][]time.Duration{}
+	counts := map[[2]string]int{}
+	for _, flare := range report.Flares {
+		counts[[2]string{flare.Priority, flare.Type}]++
+		if flare.NotAFlare {
+			report.NotAFlare++
+			continue
+		}
+		if flare.MitigatedAt != nil {
+			report.Mitigated++
+			if flare.FollowupDone {
+				report.FollowupsDone++
+			}
+		}
+		// retroactive flares are mitigated before they are filed, so they would skew the numbers
+		if flare.TimeToMitigate != nil && flare.Type != typeRetroactive {
+			key := [2]string{flare.Priority, flare.Created.Format(monthLayout)}
+			durations[key] = append(durations[key], *flare.TimeToMitigate)
+		}
+	}
+	report.NotAFlareRatio = ratio(report.NotAFlare, report.Total)
+	report.FollowupRatio = ratio(report.FollowupsDone, report.Mitigated)
+
+	for key, values := range durations {
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		report.TimeToMitigate = append(report.TimeToMitigate, MitigationStats{
+			Priority: key[0],
+			Month:    key[1],
+			Count:    len(values),
+			P50:      percentile(values, 50),
+			P90:      percentile(values, 90),
+			Max:      values[len(values)-1],
+		})
+	}
+	sort.Slice(report.TimeToMitigate, func(i, j int) bool {
+		a, b := report.TimeToMitigate[i], report.TimeToMitigate[j]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.Month < b.Month
+	})
+
+	for key, count := range counts {
+		report.CountsByPriority = append(report.CountsByPriority, CountRow{Priority: key[0], Type: key[1], Count: count})
+	}
+	sort.Slice(report.CountsByPriority, func(i, j int) bool {
+		a, b := report.CountsByPriority[i], report.CountsByPriority[j]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.Type < b.Type
+	})
+}
+
+// percentile uses the nearest-rank method on an already sorted slice.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func ratio(numerator, denominator int) float64 {
+	if denominator == 0 {
+		return 0
+	}
+	return float64(numerator) / float64(denominator)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/jira"
+)
+
+//go:generate mockgen -package main -destination mock.go -source report.go JiraClient
+
+var reportStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func ticket(key, priority, status string, created time.Time, description string, labels ...string) jira.Ticket {
+	return jira.Ticket{
+		Key: key,
+		Fields: jira.TicketFields{
+			Summary:     key + " summary",
+			Description: description,
+			Status:      jira.Status{Name: status},
+			Priority:    jira.Priority{Name: priority},
+			Labels:      labels,
+			Created:     jira.Time{Time: created},
+		},
+	}
+}
+
+func transition(to string, at time.Time) []jira.ChangelogEntry {
+	return []jira.ChangelogEntry{
+		{Created: jira.Time{Time: at}, Items: []jira.ChangelogItem{{Field: "status", FromString: "In Progress", ToString: to}}},
+	}
+}
+
+func TestBuildReport(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	client := NewMockJiraClient(mockController)
+
+	jan := reportStart.Add(24 * time.Hour)
+	feb := reportStart.AddDate(0, 1, 1)
+	tickets := []jira.Ticket{
+		ticket("FLARE-1", "P0 - Critical", "Mitigated", jan, "all written up"),
+		ticket("FLARE-2", "P0 - Critical", "Mitigated", jan, "[example: All users attempting ..."),
+		ticket("FLARE-3", "P2 - Major", "NotAFlare", feb, ""),
+		ticket("FLARE-4", "P1 - High", "Mitigated", feb, "done", "preemptive"),
+		ticket("FLARE-5", "P1 - High", "Mitigated", feb, "done"),
+		ticket("FLARE-6", "P1 - High", "In Progress", feb, ""),
+	}
+	client.EXPECT().SearchTickets(gomock.Any(), reportTicketFields).Return(tickets, nil).Times(1)
+	client.EXPECT().GetChangelog("FLARE-1").Return(transition("Mitigated", jan.Add(30*time.Minute)), nil)
+	client.EXPECT().GetChangelog("FLARE-2").Return(transition("Mitigated", jan.Add(90*time.Minute)), nil)
+	client.EXPECT().GetChangelog("FLARE-3").Return(transition("NotAFlare", feb.Add(10*time.Minute)), nil)
+	client.EXPECT().GetChangelog("FLARE-4").Return(transition("Mitigated", feb.Add(4*time.Hour)), nil)
+	client.EXPECT().GetChangelog("FLARE-5").Return(transition("Mitigated", feb.Add(30*time.Second)), nil)
+	client.EXPECT().GetChangelog("FLARE-6").Return(nil, errors.New("boom"))
+
+	report, err := buildReport(client, "FLARE", reportStart, reportStart.AddDate(0, 3, 0))
+	require.NoError(t, err)
+
+	assert.Equal(t, 6, report.Total)
+	assert.Equal(t, 1, report.NotAFlare)
+	assert.InDelta(t, 1.0/6, report.NotAFlareRatio, 0.0001)
+	assert.Equal(t, 4, report.Mitigated)
+	assert.Equal(t, 3, report.FollowupsDone)
+	assert.Equal(t, []string{"FLARE-6"}, report.ChangelogFailures)
+
+	assert.Equal(t, []MitigationStats{
+		{Priority: "P0", Month: "2024-01", Count: 2, P50: 30 * time.Minute, P90: 90 * time.Minute, Max: 90 * time.Minute},
+		{Priority: "P1", Month: "2024-02", Count: 1, P50: 4 * time.Hour, P90: 4 * time.Hour, Max: 4 * time.Hour},
+	}, report.TimeToMitigate)
+
+	assert.Equal(t, []CountRow{
+		{Priority: "P0", Type: typeStandard, Count: 2},
+		{Priority: "P1", Type: typePreemptive, Count: 1},
+		{Priority: "P1", Type: typeRetroactive, Count: 1},
+		{Priority: "P1", Type: typeStandard, Count: 1},
+		{Priority: "P2", Type: typeStandard, Count: 1},
+	}, report.CountsByPriority)
+}
+
+func TestBuildReportSearchError(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	client := NewMockJiraClient(mockController)
+	client.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return(nil, errors.New("jira down"))
+
+	_, err := buildReport(client, "FLARE", reportStart, reportStart.AddDate(0, 1, 0))
+	assert.EqualError(t, err, "jira down")
+}
+
+func TestPercentile(t *testing.T) {
+	values := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{p: 0, expected: 1},
+		{p: 50, expected: 5},
+		{p: 90, expected: 9},
+		{p: 100, expected: 10},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, percentile(values, test.p))
+	}
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+}
+
+func TestWriteReport(t *testing.T) {
+	ttm := 45 * time.Minute
+	mitigated := reportStart.Add(ttm)
+	report := &Report{
+		From:  reportStart,
+		To:    reportStart.AddDate(0, 1, 0),
+		Total: 1,
+		Flares: []Flare{
+			{Key: "FLARE-1", Summary: "db, down", Priority: "P0", Type: typeStandard, Status: "Mitigated", Created: reportStart, MitigatedAt: &mitigated, TimeToMitigate: &ttm},
+		},
+		TimeToMitigate: []MitigationStats{{Priority: "P0", Month: "2024-01", Count: 1, P50: ttm, P90: ttm, Max: ttm}},
+	}
+
+	for _, format := range []string{formatText, formatCSV, formatJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, writeReport(&buf, report, format))
+			assert.Contains(t, buf.String(), "P0")
+		})
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeReport(&buf, report, formatCSV))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, `FLARE-1,"db, down",P0,standard,Mitigated,2024-01-01T00:00:00Z,2024-01-01T00:45:00Z,45.0,false,false`, lines[1])
+
+	assert.Error(t, writeReport(&buf, report, "xml"))
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Clever/flarebot/slackutil"
+	"github.com/Clever/kayvee-go/v7/logger"
+
+	slk "github.com/slack-go/slack"
+)
+
+// cleanupWarningBlockID marks warnings so they aren't repeated and don't count as activity.
+const cleanupWarningBlockID = "flarebot-cleanup-warning"
+
+// runActions runs the rule's actions in order and stops at the first failure.
+func (h Handler) runActions(ctx context.Context, c *flareChannel, rule *Rule) error {
+	for _, action := range rule.Actions {
+		logger.FromContext(ctx).DebugD("running-action", logger.M{"channel": c.channel.Name, "rule": rule.Name, "action": action.Type})
+		if err := h.runAction(ctx, c, action); err != nil {
+			return fmt.Errorf("%s: %w", action.Type, err)
+		}
+	}
+	return nil
+}
+
+func (h Handler) runAction(ctx context.Context, c *flareChannel, action Action) error {
+	switch action.Type {
+	case actionKeep:
+		return nil
+	case actionWarn:
+		return h.warn(ctx, c, action)
+	case actionArchive:
+		return h.archive(ctx, c)
+	case actionRename:
+		name := expand(action.Name, c.channel.Name, c.key)
+		before := c.channel.Name
+		err := h.inChannel(ctx, c, func() error {
+			_, err := h.slackClient.RenameConversation(c.channel.ID, name)
+			return err
+		})
+		return h.recordChange(ctx, auditSlackRename, c, before, name, err)
+	case actionExport:
+		return h.export(ctx, c)
+	case actionComment:
+		ticket, err := c.resolveTicket()
+		if err != nil {
+			return err
+		}
+		return h.jiraClient.AddComment(ticket, expand(action.Message, c.channel.Name, c.key))
+	case actionLabel:
+		ticket, err := c.resolveTicket()
+		if err != nil {
+			return err
+		}
+		return h.jiraClient.SetLabel(ticket, expand(action.Label, c.channel.Name, c.key))
+	default:
+		return fmt.Errorf("unknown action")
+	}
+}
+
+// warn posts the warning unless one was posted within the action's interval.
+func (h Handler) warn(ctx context.Context, c *flareChannel, action Action) error {
+	var warned bool
+	err := h.inChannel(ctx, c, func() (err error) {
+		warned, err = slackutil.PostedSince(h.slackClient, c.channel.ID, c.now.Add(-action.every), cleanupWarningBlockID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if warned {
+		logger.FromContext(ctx).DebugD("recently-warned", logger.M{"channel": c.channel.Name})
+		return nil
+	}
+
+	text := expand(action.Message, c.channel.Name, c.key)
+	block := slk.NewSectionBlock(slk.NewTextBlockObject(slk.MarkdownType, text, false, false), nil, nil,
+		slk.SectionBlockOptionBlockID(cleanupWarningBlockID))
+	err = h.inChannel(ctx, c, func() error {
+		_, _, err := h.slackClient.PostMessage(c.channel.ID, slk.MsgOptionBlocks(block), slk.MsgOptionText(text, false))
+		return err
+	})
+	return h.recordChange(ctx, auditSlackPost, c, nil, text, err)
+}
+
+// export attaches the full channel history to the flare ticket as JSON.
+func (h Handler) export(ctx context.Context, c *flareChannel) error {
+	ticket, err := c.resolveTicket()
+	if err != nil {
+		return err
+	}
+	var messages []slk.Message
+	err = h.inChannel(ctx, c, func() (err error) {
+		messages, err = slackutil.History(h.slackClient, c.channel.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(messages, "", "  ")
+	if err != nil {
+		return err
+	}
+	return h.jiraClient.AddAttachment(ticket, c.channel.Name+"-history.json", content)
+}
+
+// archive archives the channel. Shared channels are
+// only archived when approved, after posting SHARED_CHANNEL_NOTICE if it's set.
+func (h Handler) archive(ctx context.Context, c *flareChannel) error {
+	if isShared(c.channel) {
+		if !h.config.approvedForArchival(c.channel) {
+			return errSharedChannel
+		}
+		if h.config.SharedChannelNotice != "" {
+			text := expand(h.config.SharedChannelNotice, c.channel.Name, c.key)
+			err := h.inChannel(ctx, c, func() error {
+				_, _, err := h.slackClient.PostMessage(c.channel.ID, slk.MsgOptionText(text, false))
+				return err
+			})
+			if err := h.recordChange(ctx, auditSlackPost, c, nil, text, err); err != nil {
+				return fmt.Errorf("posting shared channel notice: %w", err)
+			}
+		}
+	}
+	err := h.inChannel(ctx, c, func() error {
+		return h.slackClient.ArchiveConversation(c.channel.ID)
+	})
+	if err == nil {
+		c.archived = true
+	}
+	return h.recordChange(ctx, auditSlackArchive, c, nil, nil, err)
+}
+
+// errSharedChannel is returned instead of archiving a channel shared with other workspaces that
+// isn't approved, since archiving it affects the other organizations too.
+var errSharedChannel = errors.New("channel is shared with other workspaces and isn't approved for archival")
+
+func isShared(channel slk.Channel) bool {
+	return channel.IsShared || channel.IsExtShared || channel.IsOrgShared || channel.IsPendingExtShared
+}
+
+// errPrivateChannel is returned for private channels the bot isn't in. Bots can't join private
+// channels, so someone in the channel has to invite flarebot or clean it up by hand.
+var errPrivateChannel = errors.New("private channel the bot isn't a member of, invite flarebot or archive it by hand")
+
+// errNeedsJoin is returned when reading a channel the bot isn't in during a run that doesn't
+// change anything. A real run joins the channel first.
+var errNeedsJoin = errors.New("flarebot isn't in the channel, a run that's not a dry run joins it to read it")
+
+// needsMember reports whether the bot has to be invited before it can act on the channel.
+func needsMember(channel slk.Channel) bool {
+	return channel.IsPrivate && !channel.IsMember
+}
+
+// inChannel runs fn in the channel, joining it first when the listing says the bot isn't a
+// member. The listing can be stale, so it also joins and retries when Slack says not_in_channel.
+func (h Handler) inChannel(ctx context.Context, c *flareChannel, fn func() error) error {
+	if needsMember(c.channel) {
+		return errPrivateChannel
+	}
+	if !c.channel.IsMember {
+		if err := h.join(ctx, c); err != nil {
+			return err
+		}
+	}
+	_, err := retrySlack(ctx, h.clock, defaultRetryAttempts, defaultRetryDelay, func() (interface{}, error) {
+		err := fn()
+		if slackutil.IsError(err, "not_in_channel") {
+			if joinErr := h.join(ctx, c); joinErr != nil {
+				return nil, joinErr
+			}
+			err = fn()
+		}
+		return nil, err
+	})
+	return err
+}
+
+func (h Handler) join(ctx context.Context, c *flareChannel) error {
+	if c.readOnly {
+		return errNeedsJoin
+	}
+	logger.FromContext(ctx).DebugD("joining-channel", logger.M{"channel": c.channel.Name})
+	_, err := retrySlack(ctx, h.clock, defaultRetryAttempts, defaultRetryDelay, func() (interface{}, error) {
+		_, _, _, err := h.slackClient.JoinConversation(c.channel.ID)
+		return nil, err
+	})
+	if err != nil {
+		return err
+	}
+	c.channel.IsMember = true
+	c.joined = true
+	return nil
+}
+
+// leave leaves a channel the bot only joined to clean it up, unless it was archived. Channels
+// the bot was already in are left alone.
+func (h Handler) leave(ctx context.Context, c *flareChannel) {
+	if !h.config.LeaveJoinedChannels || !c.joined || c.archived {
+		return
+	}
+	_, err := retrySlack(ctx, h.clock, defaultRetryAttempts, defaultRetryDelay, func() (interface{}, error) {
+		return h.slackClient.LeaveConversation(c.channel.ID)
+	})
+	if err != nil {
+		logger.FromContext(ctx).ErrorD("error-leaving-channel", logger.M{"channel": c.channel.Name, "error": err.Error()})
+		return
+	}
+	c.joined = false
+	logger.FromContext(ctx).DebugD("left-channel", logger.M{"channel": c.channel.Name})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/Clever/flarebot/audit"
+	"github.com/Clever/flarebot/jira"
+	"github.com/Clever/kayvee-go/v7/logger"
+)
+
+// Slack actions recorded in the audit log. Jira changes are recorded by the jira package.
+const (
+	auditSlackArchive   = "slack.archive"
+	auditSlackUnarchive = "slack.unarchive"
+	auditSlackRename    = "slack.rename"
+	auditSlackPost      = "slack.post-message"
+)
+
+// plannedAuditActions are the audit actions a dry run records for the policy's actions.
+var plannedAuditActions = map[string]string{
+	actionWarn:    auditSlackPost,
+	actionArchive: auditSlackArchive,
+	actionRename:  auditSlackRename,
+	actionExport:  audit.ActionJiraAttachment,
+	actionComment: audit.ActionJiraComment,
+	actionLabel:   audit.ActionJiraAddLabel,
+}
+
+// openAuditSink opens AUDIT_SINK.
+func openAuditSink(ctx context.Context, config Config) (audit.Sink, error) {
+	kind, _, err := audit.ParseSink(config.AuditSink)
+	if err != nil || kind != "s3" {
+		return audit.OpenSink(config.AuditSink, nil)
+	}
+	client, err := newS3Client(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return audit.OpenSink(config.AuditSink, client)
+}
+
+// newS3Client returns the client for s3: audit sinks and recordings. It uses AUDIT_S3_ENDPOINT
+// when it's set, for S3-compatible stores.
+func newS3Client(ctx context.Context, config Config) (*s3.Client, error) {
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+	return s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		if config.AuditS3Endpoint != "" {
+			o.BaseEndpoint = &config.AuditS3Endpoint
+			o.UsePathStyle = true
+		}
+	}), nil
+}
+
+// startAudit returns a copy of the handler that records its changes, and the Jira client's,
+// under runID, starting with the config of the run. It's a no-op without an audit sink.
+func (h Handler) startAudit(ctx context.Context, actor, runID string, dryRun bool) (Handler, error) {
+	h.audit = audit.New(h.auditSink, actor, runID, dryRun)
+	if h.audit == nil {
+		return h, nil
+	}
+	if server, ok := h.jiraClient.(*jira.JiraServer); ok {
+		copy := *server
+		copy.Audit = h.audit
+		h.jiraClient = &copy
+	}
+	policy, err := h.loadPolicy()
+	if err != nil {
+		return h, err
+	}
+	return h, h.audit.Start(ctx, h.config.audited(policy, dryRun))
+}
+
+// cliActor names whoever ran a cleanup command in the audit log.
+func cliActor() string {
+	user := os.Getenv("USER")
+	if user == "" {
+		user = "unknown"
+	}
+	return "flarebot-slack-cleanup cli (" + user + ")"
+}
+
+// audited is the config recorded at the start of a run, without credentials.
+func (c Config) audited(policy *Policy, dryRun bool) map[string]interface{} {
+	matchers := []string{}
+	for _, matcher := range c.Matchers {
+		matchers = append(matchers, matcher.Type+":"+matcher.Pattern)
+	}
+	rules := []string{}
+	for _, rule := range policy.Rules {
+		rules = append(rules, rule.Name)
+	}
+	return map[string]interface{}{
+		"dryRun":                 dryRun,
+		"channelAgeThreshold":    c.ChannelAgeThreshold.String(),
+		"matchers":               matchers,
+		"rules":                  rules,
+		"sharedChannelArchival":  c.SharedChannelArchival,
+		"approvedSharedChannels": c.ApprovedSharedChannels,
+		"leaveJoinedChannels":    c.LeaveJoinedChannels,
+		"failureBudget":          c.FailureBudget.String(),
+		"jiraOrigin":             c.JiraOrigin,
+	}
+}
+
+// recordChange records a change to the channel and returns the change's error. A record that
+// couldn't be written is logged rather than returned, so an archive that went through isn't
+// counted against the failure budget and retried.
+func (h Handler) recordChange(ctx context.Context, action string, c *flareChannel, before, after interface{}, err error) error {
+	target := fmt.Sprintf("#%s (%s)", c.channel.Name, c.channel.ID)
+	if auditErr := h.audit.Change(ctx, action, target, before, after, err); auditErr != nil {
+		lg := logger.FromContext(ctx)
+		lg.ErrorD("audit-write-failed", logger.M{"action": action, "target": target, "error": auditErr.Error()})
+		lg.CounterD("audit-write-errors", 1, logger.M{"action": action})
+	}
+	return err
+}
+
+// recordPlanned records the actions a dry run would have run on the channel.
+func (h Handler) recordPlanned(ctx context.Context, c *flareChannel, rule *Rule) error {
+	for _, action := range rule.Actions {
+		auditAction, ok := plannedAuditActions[action.Type]
+		if !ok {
+			continue
+		}
+		target := fmt.Sprintf("#%s (%s)", c.channel.Name, c.channel.ID)
+		err := h.audit.Record(ctx, audit.Record{Action: auditAction, Target: target, After: map[string]string{"rule": rule.Name}, DryRun: true})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	slk "github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/audit"
+	"github.com/Clever/flarebot/jira"
+)
+
+type recordingSink struct {
+	records []audit.Record
+}
+
+func (s *recordingSink) Write(ctx context.Context, record audit.Record, line []byte) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestAuditedRun(t *testing.T) {
+	old := namedChannel("flaretest-1")
+	old.ID = "C1"
+
+	tests := []struct {
+		description      string
+		dryRun           bool
+		actions          []string
+		mockExpectations func(slackClient *MockSlackClient, jiraClient *MockJiraClient)
+	}{
+		{
+			description: "records archived channels",
+			actions:     []string{audit.ActionRunStart, auditSlackArchive},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ArchiveConversation("C1").Return(nil).Times(1)
+				jiraClient.EXPECT().GetTicketByKey("FLARETEST-1").Return(&jira.Ticket{Key: "FLARETEST-1"}, nil).Times(1)
+				jiraClient.EXPECT().SetLabel(&jira.Ticket{Key: "FLARETEST-1"}, "archived").Return(nil).Times(1)
+			},
+		},
+		{
+			description: "dry runs record what they would do",
+			dryRun:      true,
+			actions:     []string{audit.ActionRunStart, auditSlackArchive, audit.ActionJiraAddLabel},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ArchiveConversation(gomock.Any()).Times(0)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mockController := gomock.NewController(t)
+			defer mockController.Finish()
+			slackClient := NewMockSlackClient(mockController)
+			jiraClient := NewMockJiraClient(mockController)
+			slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{old}, "", nil).Times(1)
+			test.mockExpectations(slackClient, jiraClient)
+
+			sink := &recordingSink{}
+			config := newTestConfig(t, map[string]string{"DRY_RUN": "false"})
+			config.DryRun = test.dryRun
+			h := Handler{slackClient: slackClient, jiraClient: jiraClient, config: config, auditSink: sink, clock: newFakeClock(time.Now())}
+			require.NoError(t, h.Handle(context.Background()))
+
+			actions := []string{}
+			for _, record := range sink.records {
+				actions = append(actions, record.Action)
+				assert.Equal(t, test.dryRun, record.DryRun)
+				assert.Equal(t, "flarebot-slack-cleanup", record.Actor)
+				assert.Equal(t, sink.records[0].RunID, record.RunID)
+			}
+			assert.Equal(t, test.actions, actions)
+			if len(sink.records) > 1 {
+				assert.Equal(t, "#flaretest-1 (C1)", sink.records[1].Target)
+				assert.Equal(t, test.dryRun, sink.records[0].After.(map[string]interface{})["dryRun"])
+			}
+		})
+	}
+}
+
+// failingSink fails every write after the run's start record.
+type failingSink struct{}
+
+func (failingSink) Write(ctx context.Context, record audit.Record, line []byte) error {
+	if record.Action == audit.ActionRunStart {
+		return nil
+	}
+	return errors.New("disk full")
+}
+
+func TestAuditFailureDoesNotFailTheArchive(t *testing.T) {
+	old := namedChannel("flaretest-1")
+	old.ID = "C1"
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	slackClient := NewMockSlackClient(mockController)
+	jiraClient := NewMockJiraClient(mockController)
+	slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{old}, "", nil).Times(1)
+	slackClient.EXPECT().ArchiveConversation("C1").Return(nil).Times(1)
+	jiraClient.EXPECT().GetTicketByKey("FLARETEST-1").Return(&jira.Ticket{Key: "FLARETEST-1"}, nil).Times(1)
+	jiraClient.EXPECT().SetLabel(&jira.Ticket{Key: "FLARETEST-1"}, "archived").Return(nil).Times(1)
+
+	config := newTestConfig(t, map[string]string{"DRY_RUN": "false", "FAILURE_BUDGET": "0"})
+	h := Handler{slackClient: slackClient, jiraClient: jiraClient, config: config, auditSink: failingSink{}, clock: newFakeClock(time.Now())}
+	assert.NoError(t, h.Handle(context.Background()))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	slk "github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/jira"
+)
+
+func TestRetrySlackWaits(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	errs := []error{&slk.RateLimitedError{RetryAfter: 30 * time.Second}, errors.New("fatal_error"), nil}
+	calls := 0
+	_, err := retrySlack(context.Background(), clock, 3, time.Second, func() (interface{}, error) {
+		calls++
+		return nil, errs[calls-1]
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []time.Duration{30 * time.Second, time.Second}, clock.Waits(), "rate limits wait as long as Slack asks")
+	assert.Equal(t, start.Add(31*time.Second), clock.Now())
+
+	clock = newFakeClock(start)
+	_, err = retrySlack(context.Background(), clock, 3, time.Second, func() (interface{}, error) {
+		return nil, errors.New("fatal_error")
+	})
+	assert.EqualError(t, err, "fatal_error")
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, clock.Waits(), "no wait after the last attempt")
+
+	clock = newFakeClock(start)
+	calls = 0
+	_, err = retrySlack(context.Background(), clock, 3, time.Second, func() (interface{}, error) {
+		calls++
+		return nil, slk.SlackErrorResponse{Err: "channel_not_found"}
+	})
+	assert.EqualError(t, err, "channel_not_found")
+	assert.Equal(t, 1, calls, "permanent errors aren't retried")
+	assert.Empty(t, clock.Waits())
+}
+
+func TestRetrySlackDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	_, err := retrySlack(ctx, newFakeClock(time.Now()), 3, time.Second, func() (interface{}, error) {
+		calls++
+		return nil, &slk.RateLimitedError{RetryAfter: time.Minute}
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+}
+
+func TestThresholdBoundary(t *testing.T) {
+	created := time.Date(2026, 4, 22, 9, 30, 0, 0, time.UTC)
+	channel := namedChannel("flaretest-1")
+	channel.ID = "C1"
+	channel.Created = slk.JSONTime(created.Unix())
+	threshold := 180 * 24 * time.Hour
+
+	tests := []struct {
+		description string
+		since       time.Duration
+		archived    bool
+	}{
+		{description: "a second before the threshold", since: threshold - time.Second},
+		{description: "exactly at the threshold", since: threshold},
+		{description: "a second past the threshold", since: threshold + time.Second, archived: true},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mockController := gomock.NewController(t)
+			slackClient := NewMockSlackClient(mockController)
+			jiraClient := NewMockJiraClient(mockController)
+			slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{channel}, "", nil).Times(1)
+			if test.archived {
+				slackClient.EXPECT().ArchiveConversation("C1").Return(nil).Times(1)
+				jiraClient.EXPECT().GetTicketByKey("FLARETEST-1").Return(&jira.Ticket{Key: "FLARETEST-1"}, nil).Times(1)
+				jiraClient.EXPECT().SetLabel(gomock.Any(), "archived").Return(nil).Times(1)
+			}
+
+			clock := newFakeClock(created.Add(test.since))
+			h := Handler{slackClient: slackClient, jiraClient: jiraClient, config: newTestConfig(t, nil), clock: clock}
+			run, err := h.run(context.Background(), false)
+			require.NoError(t, err)
+			require.Len(t, run.Channels, 1)
+			assert.Equal(t, test.archived, run.Channels[0].Archived)
+			if test.archived {
+				assert.Equal(t, []time.Duration{defaultPauseDuration}, clock.Waits(), "pauses after acting on a channel")
+			}
+		})
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Clever/flarebot/audit"
+	"github.com/Clever/flarebot/flare"
+	"github.com/Clever/flarebot/httprecord"
+	"github.com/Clever/flarebot/tracing"
+
+	slk "github.com/slack-go/slack"
+)
+
+const commandUsage = `usage:
+  flarebot-slack-cleanup run [flags]
+      run the cleanup once, like the Lambda does
+  flarebot-slack-cleanup validate [-policy file]
+      check a policy file, the deployed policy.yml by default
+  flarebot-slack-cleanup explain [flags] <channel>
+      show which rule fires for a channel and the actions it would run
+  flarebot-slack-cleanup scan [flags]
+      list the channels a run would act on and why, without changing anything
+  flarebot-slack-cleanup archive [flags] <channel>...
+      archive channels by hand and label their tickets archived
+  flarebot-slack-cleanup unarchive [flags] <channel>...
+      unarchive channels and remove the archived label from their tickets
+  flarebot-slack-cleanup reconcile [flags]
+      make the archived label on flare tickets match whether their channel is archived
+  flarebot-slack-cleanup report [flags]
+      count what a run would do by outcome and rule, without changing anything
+
+The commands read the same settings as the Lambda, see README.md. archive, unarchive and
+reconcile honor DRY_RUN, which defaults to true, so pass -dry-run=false to make changes.
+-record saves the Slack and Jira traffic of a command to a cassette, and -replay answers a
+command from a cassette instead, e.g. one saved by HTTP_RECORDING, without network access or
+credentials.
+
+flags:
+`
+
+// replayOrigin is the Jira origin of replays, which never reach it.
+const replayOrigin = "http://replay.invalid"
+
+// flagSettings maps the command flags to the settings they override.
+var flagSettings = map[string]string{
+	"dry-run":      "DRY_RUN",
+	"prefix":       "FLARE_CHANNEL_PREFIX",
+	"matchers":     "CHANNEL_MATCHERS",
+	"threshold":    "CHANNEL_AGE_THRESHOLD",
+	"leave-joined": "LEAVE_JOINED_CHANNELS",
+}
+
+// runCommand runs the maintenance commands and returns the process exit code.
+func runCommand(ctx context.Context, args []string, w io.Writer) int {
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(w)
+	flags.Usage = func() {
+		fmt.Fprint(w, commandUsage)
+		flags.PrintDefaults()
+	}
+	policyFile := flags.String("policy", "", "policy file to use instead of the deployed policy.yml")
+	format := flags.String("format", formatTable, "output format: table or json")
+	all := flags.Bool("all", false, "scan: include channels that are kept")
+	flags.Bool("dry-run", defaultDryRun, "only show what would change, overrides DRY_RUN")
+	flags.String("prefix", "", "flare channel prefix, overrides FLARE_CHANNEL_PREFIX")
+	flags.String("matchers", "", "JSON channel matchers, overrides CHANNEL_MATCHERS")
+	flags.String("threshold", "", "channel age threshold like 180d, overrides CHANNEL_AGE_THRESHOLD")
+	flags.Bool("leave-joined", false, "leave channels joined only for the cleanup, overrides LEAVE_JOINED_CHANNELS")
+	record := flags.String("record", "", "save the Slack and Jira traffic to a cassette file, overrides HTTP_RECORDING")
+	replay := flags.String("replay", "", "answer Slack and Jira requests from a cassette file")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *record != "" && *replay != "" {
+		fmt.Fprintf(w, "-record and -replay can't be used together\n")
+		return 2
+	}
+
+	policy, err := readPolicy(*policyFile)
+	if err != nil {
+		fmt.Fprintf(w, "%v\n", err)
+		return 1
+	}
+
+	command := args[0]
+	switch {
+	case command == "validate" && flags.NArg() == 0:
+		fmt.Fprintf(w, "policy is valid: %d rules\n", len(policy.Rules))
+		for _, rule := range policy.Rules {
+			fmt.Fprintf(w, "  %s\n", rule.Name)
+		}
+		return 0
+	case command == "explain" && flags.NArg() == 1:
+	case (command == "archive" || command == "unarchive") && flags.NArg() > 0:
+	case (command == "run" || command == "scan" || command == "reconcile" || command == "report") && flags.NArg() == 0:
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	overrides := map[string]string{}
+	flags.Visit(func(f *flag.Flag) {
+		if key, ok := flagSettings[f.Name]; ok {
+			overrides[key] = f.Value.String()
+		}
+	})
+	if *record != "" {
+		overrides["HTTP_RECORDING"] = "file:" + *record
+	}
+	if *replay != "" {
+		// nothing is sent, so no credentials are needed, and a replay isn't audited or recorded.
+		// Replays match requests on their path, so any valid origin will do.
+		for _, key := range requiredConfigKeys {
+			overrides[key] = httprecord.Redacted
+		}
+		overrides["JIRA_ORIGIN"] = replayOrigin
+		overrides["AUDIT_SINK"] = ""
+		overrides["HTTP_RECORDING"] = ""
+	}
+	config, err := loadConfig(ctx, overrides)
+	if err != nil {
+		fmt.Fprintf(w, "%v\n", err)
+		return 1
+	}
+
+	var handler Handler
+	var replayer *httprecord.Replayer
+	if *replay != "" {
+		handler, replayer, err = replayHandler(config, *replay)
+	} else {
+		var recording *recording
+		if recording, err = openRecording(ctx, config); err == nil {
+			handler = newHandler(config, recording.client())
+			handler.recording = recording
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(w, "%v\n", err)
+		return 1
+	}
+	handler.policy = policy
+	if replayer != nil {
+		defer func() {
+			if unused := replayer.Unused(); len(unused) > 0 {
+				fmt.Fprintf(w, "%d recorded requests weren't replayed\n", len(unused))
+			}
+		}()
+	}
+	exporter, err := tracing.NewExporter(ctx, config.TracesExporter)
+	if err == nil {
+		handler.flushTraces, err = tracing.Install(exporter, serviceName)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "%v\n", err)
+		return 1
+	}
+	if command == "run" {
+		if handler.auditSink, err = openAuditSink(ctx, config); err == nil {
+			err = handler.Handle(ctx)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "%v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	defer handler.flush(ctx)
+	defer handler.saveRecording(ctx, audit.NewRunID())
+	ctx, span := tracer.Start(ctx, "cleanup "+command, trace.WithAttributes(attribute.Bool("cleanup.dry_run", config.DryRun)))
+	if command == "archive" || command == "unarchive" || command == "reconcile" {
+		// only the commands that change channels or tickets are audited
+		if handler.auditSink, err = openAuditSink(ctx, config); err == nil {
+			handler, err = handler.startAudit(ctx, cliActor(), audit.NewRunID(), config.DryRun)
+		}
+		if err != nil {
+			tracing.End(span, err)
+			fmt.Fprintf(w, "%v\n", err)
+			return 1
+		}
+	}
+	handler = handler.withContext(ctx)
+
+	var results []ChannelResult
+	switch command {
+	case "explain":
+		err = handler.explain(ctx, w, flags.Arg(0))
+	case "scan":
+		var run *Run
+		if run, err = handler.run(ctx, true); err == nil {
+			results = run.Channels
+			if !*all {
+				results = run.withOutcome(outcomeCandidate, outcomeNeedsApproval, outcomeManual, outcomeUnknown, outcomeFailed)
+			}
+		}
+	case "report":
+		var run *Run
+		if run, err = handler.run(ctx, true); err == nil {
+			err = writeSummary(w, *format, run.summarize())
+		}
+	case "archive":
+		results, err = handler.archiveChannels(ctx, flags.Args(), config.DryRun)
+	case "unarchive":
+		results, err = handler.unarchiveChannels(ctx, flags.Args(), config.DryRun)
+	case "reconcile":
+		results, err = handler.reconcile(ctx, config.DryRun)
+	}
+	tracing.End(span, err)
+	if err == nil && results != nil {
+		err = writeResults(w, *format, results)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "%v\n", err)
+		return 1
+	}
+	for _, result := range results {
+		if result.Outcome == outcomeFailed && command != "scan" {
+			return 1
+		}
+	}
+	return 0
+}
+
+func readPolicy(path string) (*Policy, error) {
+	if path == "" {
+		return parsePolicy(defaultPolicy)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePolicy(data)
+}
+
+// explain evaluates the policy against one channel without running any actions.
+func (h Handler) explain(ctx context.Context, w io.Writer, name string) error {
+	policy, err := h.loadPolicy()
+	if err != nil {
+		return err
+	}
+	channel, err := h.findChannel(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	matcher, key, ok := matchChannel(h.config.Matchers, channel.Name)
+	if !ok {
+		fmt.Fprintf(w, "#%s is not a flare channel: no matcher accepts it\n", channel.Name)
+		return nil
+	}
+	fmt.Fprintf(w, "#%s maps to %s (%s matcher %q)\n", channel.Name, key, matcher.Type, matcher.Pattern)
+
+	if needsMember(channel) {
+		fmt.Fprintf(w, "#%s needs manual action: %v\n", channel.Name, errPrivateChannel)
+		return nil
+	}
+
+	c := &flareChannel{ctx: ctx, handler: h, channel: channel, key: key, matcher: matcher, now: h.clock.Now(), readOnly: true}
+	rule, results, err := policy.evaluate(c)
+	for _, result := range results {
+		outcome := "skipped"
+		if result.Matched {
+			outcome = "FIRED"
+		}
+		fmt.Fprintf(w, "  %-8s %s: %s\n", outcome, result.Rule, result.Reason)
+	}
+	if errors.Is(err, errNeedsJoin) {
+		fmt.Fprintf(w, "#%s can't be checked further: %v\n", channel.Name, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if rule == nil {
+		fmt.Fprintf(w, "no rule fired, the channel is left alone\n")
+		return nil
+	}
+
+	if rule.archives() && isShared(channel) && !h.config.approvedForArchival(channel) {
+		fmt.Fprintf(w, "#%s needs approval: %v\n", channel.Name, errSharedChannel)
+		return nil
+	}
+	fmt.Fprintf(w, "actions:\n")
+	for _, action := range rule.Actions {
+		fmt.Fprintf(w, "  %s\n", describeAction(action, channel.Name, key))
+	}
+	return nil
+}
+
+func describeAction(action Action, channelName, key string) string {
+	switch action.Type {
+	case actionWarn:
+		return fmt.Sprintf("warn at most every %s: %q", action.every, expand(action.Message, channelName, key))
+	case actionComment:
+		return fmt.Sprintf("comment on %s: %q", key, expand(action.Message, channelName, key))
+	case actionRename:
+		return fmt.Sprintf("rename to #%s", expand(action.Name, channelName, key))
+	case actionLabel:
+		return fmt.Sprintf("label %s %q", key, expand(action.Label, channelName, key))
+	case actionExport:
+		return fmt.Sprintf("attach the channel history to %s", key)
+	default:
+		return action.Type
+	}
+}
+
+// findChannel looks up a channel by name, including archived channels.
+func (h Handler) findChannel(ctx context.Context, name string) (slk.Channel, error) {
+	params := &slk.GetConversationsParameters{ExcludeArchived: false, Limit: defaultPageSize, Types: channelTypes}
+	for {
+		var channels []slk.Channel
+		var cursor string
+		_, err := retrySlack(ctx, h.clock, defaultRetryAttempts, defaultRetryDelay, func() (interface{}, error) {
+			var err error
+			channels, cursor, err = h.slackClient.GetConversations(params)
+			return nil, err
+		})
+		if err != nil {
+			return slk.Channel{}, err
+		}
+		for _, channel := range channels {
+			if channel.Name == name || "#"+channel.Name == name {
+				return channel, nil
+			}
+		}
+		if cursor == "" {
+			return slk.Channel{}, fmt.Errorf("no channel named %s", name)
+		}
+		params.Cursor = cursor
+	}
+}
+
+// errAlreadyArchived and errNotArchived are returned when archiving or unarchiving by hand has
+// nothing to do.
+var (
+	errAlreadyArchived = errors.New("channel is already archived")
+	errNotArchived     = errors.New("channel isn't archived")
+)
+
+// archiveChannels archives flare channels by hand, with the same safeguards as the policy, and
+// labels their tickets archived.
+func (h Handler) archiveChannels(ctx context.Context, names []string, dryRun bool) ([]ChannelResult, error) {
+	return h.byHand(ctx, names, dryRun, func(c *flareChannel) error {
+		if c.channel.IsArchived {
+			return errAlreadyArchived
+		}
+		if err := c.handler.archive(c.ctx, c); err != nil {
+			return err
+		}
+		ticket, err := c.resolveTicket()
+		if err != nil {
+			return err
+		}
+		return c.handler.jiraClient.SetLabel(ticket, flare.ArchivedLabel)
+	})
+}
+
+// unarchiveChannels unarchives flare channels and removes the archived label from their tickets.
+func (h Handler) unarchiveChannels(ctx context.Context, names []string, dryRun bool) ([]ChannelResult, error) {
+	return h.byHand(ctx, names, dryRun, func(c *flareChannel) error {
+		if !c.channel.IsArchived {
+			return errNotArchived
+		}
+		err := c.handler.slackClient.UnArchiveConversation(c.channel.ID)
+		if err := c.handler.recordChange(c.ctx, auditSlackUnarchive, c, nil, nil, err); err != nil {
+			return err
+		}
+		ticket, err := c.resolveTicket()
+		if err != nil {
+			return err
+		}
+		return c.handler.jiraClient.RemoveLabel(ticket, flare.ArchivedLabel)
+	})
+}
+
+// byHand runs fn on each named flare channel and records the outcome.
+func (h Handler) byHand(ctx context.Context, names []string, dryRun bool, fn func(c *flareChannel) error) ([]ChannelResult, error) {
+	results := []ChannelResult{}
+	for _, name := range names {
+		channel, err := h.findChannel(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		matcher, key, ok := matchChannel(h.config.Matchers, channel.Name)
+		if !ok {
+			return nil, fmt.Errorf("#%s is not a flare channel: no matcher accepts it", channel.Name)
+		}
+		ctx, span, h := h.startChannel(ctx, channel, key)
+		c := &flareChannel{ctx: ctx, handler: h, channel: channel, key: key, matcher: matcher, now: h.clock.Now()}
+		result := ChannelResult{Name: channel.Name, ID: channel.ID, Key: key, Reason: "by hand", Outcome: outcomeCandidate}
+		if !dryRun {
+			result.Outcome = outcomeApplied
+			if err := fn(c); err != nil {
+				result.fail(err)
+			}
+			h.leave(ctx, c)
+			result.Archived = c.archived
+		}
+		endChannel(span, &result)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// reconcile labels the tickets of archived flare channels archived, and removes the label from
+// tickets whose channel is open.
+func (h Handler) reconcile(ctx context.Context, dryRun bool) ([]ChannelResult, error) {
+	results := []ChannelResult{}
+	err := h.forEachChannel(ctx, false, func(channel slk.Channel) {
+		matcher, key, ok := matchChannel(h.config.Matchers, channel.Name)
+		if !ok {
+			return
+		}
+		ctx, span, h := h.startChannel(ctx, channel, key)
+		c := &flareChannel{ctx: ctx, handler: h, channel: channel, key: key, matcher: matcher, now: h.clock.Now()}
+		result := ChannelResult{Name: channel.Name, ID: channel.ID, Key: key}
+		defer func() { endChannel(span, &result) }()
+		ticket, err := c.resolveTicket()
+		if err != nil {
+			result.fail(err)
+			results = append(results, result)
+			return
+		}
+		result.Key = ticket.Key
+
+		labeled := containsFold(ticket.Fields.Labels, flare.ArchivedLabel)
+		var fix func() error
+		switch {
+		case channel.IsArchived && !labeled:
+			result.Reason = "channel is archived, labeling the ticket archived"
+			fix = func() error { return h.jiraClient.SetLabel(ticket, flare.ArchivedLabel) }
+		case !channel.IsArchived && labeled:
+			result.Reason = "channel is open, removing the archived label"
+			fix = func() error { return h.jiraClient.RemoveLabel(ticket, flare.ArchivedLabel) }
+		default:
+			return
+		}
+
+		result.Outcome = outcomeCandidate
+		if !dryRun {
+			result.Outcome = outcomeApplied
+			if err := fix(); err != nil {
+				result.fail(err)
+			}
+		}
+		results = append(results, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Summary counts the channels of a run by outcome and by the rule that fired.
+type Summary struct {
+	DryRun   bool           `json:"dryRun"`
+	Channels int            `json:"channels"`
+	Outcomes map[string]int `json:"outcomes"`
+	Rules    map[string]int `json:"rules"`
+}
+
+func (r *Run) summarize() Summary {
+	summary := Summary{DryRun: r.DryRun, Channels: len(r.Channels), Outcomes: map[string]int{}, Rules: map[string]int{}}
+	for _, channel := range r.Channels {
+		summary.Outcomes[channel.Outcome]++
+		if channel.Rule != "" {
+			summary.Rules[channel.Rule]++
+		}
+	}
+	return summary
+}
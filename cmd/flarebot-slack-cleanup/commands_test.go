@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	slk "github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/jira"
+)
+
+func TestScan(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	slackClient := NewMockSlackClient(mockController)
+	jiraClient := NewMockJiraClient(mockController)
+
+	old := namedChannel("flaretest-1")
+	old.ID = "C1"
+	shared := namedChannel("flaretest-2")
+	shared.ID = "C2"
+	shared.IsShared = true
+	recent := namedChannel("flaretest-3")
+	recent.ID = "C3"
+	recent.Created = slk.JSONTime(time.Now().Unix())
+	slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{old, shared, recent, namedChannel("general")}, "", nil).Times(1)
+	slackClient.EXPECT().ArchiveConversation(gomock.Any()).Times(0)
+	jiraClient.EXPECT().SetLabel(gomock.Any(), gomock.Any()).Times(0)
+
+	h := Handler{slackClient: slackClient, jiraClient: jiraClient, config: newTestConfig(t, nil), clock: newFakeClock(time.Now())}
+	run, err := h.run(context.Background(), true)
+	require.NoError(t, err)
+	assert.Equal(t, []ChannelResult{
+		{Name: "flaretest-1", ID: "C1", Key: "FLARETEST-1", Rule: "archive-past-threshold", Reason: "pastThreshold is true", Outcome: outcomeCandidate},
+		{Name: "flaretest-2", ID: "C2", Key: "FLARETEST-2", Rule: "archive-past-threshold", Reason: errSharedChannel.Error(), Outcome: outcomeNeedsApproval},
+		{Name: "flaretest-3", ID: "C3", Key: "FLARETEST-3", Reason: "no rule fired", Outcome: outcomeKept},
+	}, run.Channels)
+
+	var out bytes.Buffer
+	require.NoError(t, writeResults(&out, formatTable, run.withOutcome(outcomeCandidate)))
+	assert.Equal(t, "CHANNEL       TICKET       OUTCOME    RULE                    DETAIL\n"+
+		"#flaretest-1  FLARETEST-1  candidate  archive-past-threshold  pastThreshold is true\n", out.String())
+
+	out.Reset()
+	require.NoError(t, writeSummary(&out, formatTable, run.summarize()))
+	assert.Equal(t, `Flare channels:  3 (dry run)
+
+OUTCOME         CHANNELS
+candidate       1
+kept            1
+needs-approval  1
+
+RULE                    CHANNELS
+archive-past-threshold  2
+`, out.String())
+}
+
+func TestArchiveAndUnarchiveChannels(t *testing.T) {
+	open := namedChannel("flaretest-1")
+	open.ID = "C1"
+	archived := namedChannel("flaretest-2")
+	archived.ID = "C2"
+	archived.IsArchived = true
+	channels := []slk.Channel{open, archived, namedChannel("general")}
+
+	tests := []struct {
+		description      string
+		unarchive        bool
+		names            []string
+		dryRun           bool
+		results          []ChannelResult
+		err              string
+		mockExpectations func(slackClient *MockSlackClient, jiraClient *MockJiraClient)
+	}{
+		{
+			description: "archives and labels the ticket",
+			names:       []string{"#flaretest-1"},
+			results:     []ChannelResult{{Name: "flaretest-1", ID: "C1", Key: "FLARETEST-1", Reason: "by hand", Outcome: outcomeApplied, Archived: true}},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ArchiveConversation("C1").Return(nil).Times(1)
+				jiraClient.EXPECT().GetTicketByKey("FLARETEST-1").Return(&jira.Ticket{Key: "FLARETEST-1"}, nil).Times(1)
+				jiraClient.EXPECT().SetLabel(&jira.Ticket{Key: "FLARETEST-1"}, "archived").Return(nil).Times(1)
+			},
+		},
+		{
+			description: "dry run changes nothing",
+			names:       []string{"flaretest-1"},
+			dryRun:      true,
+			results:     []ChannelResult{{Name: "flaretest-1", ID: "C1", Key: "FLARETEST-1", Reason: "by hand", Outcome: outcomeCandidate}},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ArchiveConversation(gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "archived channels fail",
+			names:       []string{"flaretest-2"},
+			results:     []ChannelResult{{Name: "flaretest-2", ID: "C2", Key: "FLARETEST-2", Reason: "by hand", Outcome: outcomeFailed, Error: "channel is already archived", ErrorClass: errorClassPermanent}},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ArchiveConversation(gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "only flare channels",
+			names:       []string{"general"},
+			err:         "#general is not a flare channel: no matcher accepts it",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+			},
+		},
+		{
+			description: "unarchives and removes the label",
+			unarchive:   true,
+			names:       []string{"flaretest-2"},
+			results:     []ChannelResult{{Name: "flaretest-2", ID: "C2", Key: "FLARETEST-2", Reason: "by hand", Outcome: outcomeApplied}},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().UnArchiveConversation("C2").Return(nil).Times(1)
+				jiraClient.EXPECT().GetTicketByKey("FLARETEST-2").Return(&jira.Ticket{Key: "FLARETEST-2"}, nil).Times(1)
+				jiraClient.EXPECT().RemoveLabel(&jira.Ticket{Key: "FLARETEST-2"}, "archived").Return(nil).Times(1)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mockController := gomock.NewController(t)
+			defer mockController.Finish()
+			slackClient := NewMockSlackClient(mockController)
+			jiraClient := NewMockJiraClient(mockController)
+			slackClient.EXPECT().GetConversations(gomock.Any()).Return(channels, "", nil).AnyTimes()
+			test.mockExpectations(slackClient, jiraClient)
+
+			h := Handler{slackClient: slackClient, jiraClient: jiraClient, config: newTestConfig(t, nil), clock: newFakeClock(time.Now())}
+			byHand := h.archiveChannels
+			if test.unarchive {
+				byHand = h.unarchiveChannels
+			}
+			results, err := byHand(context.Background(), test.names, test.dryRun)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.results, results)
+		})
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	slackClient := NewMockSlackClient(mockController)
+	jiraClient := NewMockJiraClient(mockController)
+
+	archived := namedChannel("flaretest-1")
+	archived.ID = "C1"
+	archived.IsArchived = true
+	reopened := namedChannel("flaretest-2")
+	reopened.ID = "C2"
+	consistent := namedChannel("flaretest-3")
+	consistent.ID = "C3"
+	missing := namedChannel("flaretest-4")
+	missing.ID = "C4"
+	slackClient.EXPECT().GetConversations(&slk.GetConversationsParameters{Limit: defaultPageSize, Types: channelTypes}).
+		Return([]slk.Channel{archived, reopened, consistent, missing}, "", nil).Times(1)
+
+	labeled := jira.TicketFields{Labels: []string{"archived"}}
+	jiraClient.EXPECT().GetTicketByKey("FLARETEST-1").Return(&jira.Ticket{Key: "FLARETEST-1"}, nil).Times(1)
+	jiraClient.EXPECT().GetTicketByKey("FLARETEST-2").Return(&jira.Ticket{Key: "FLARETEST-2", Fields: labeled}, nil).Times(1)
+	jiraClient.EXPECT().GetTicketByKey("FLARETEST-3").Return(&jira.Ticket{Key: "FLARETEST-3"}, nil).Times(1)
+	jiraClient.EXPECT().GetTicketByKey("FLARETEST-4").Return(nil, errors.New("Status-code:404")).Times(1)
+	jiraClient.EXPECT().SetLabel(&jira.Ticket{Key: "FLARETEST-1"}, "archived").Return(nil).Times(1)
+	jiraClient.EXPECT().RemoveLabel(&jira.Ticket{Key: "FLARETEST-2", Fields: labeled}, "archived").Return(nil).Times(1)
+
+	h := Handler{slackClient: slackClient, jiraClient: jiraClient, config: newTestConfig(t, nil), clock: newFakeClock(time.Now())}
+	results, err := h.reconcile(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, []ChannelResult{
+		{Name: "flaretest-1", ID: "C1", Key: "FLARETEST-1", Reason: "channel is archived, labeling the ticket archived", Outcome: outcomeApplied},
+		{Name: "flaretest-2", ID: "C2", Key: "FLARETEST-2", Reason: "channel is open, removing the archived label", Outcome: outcomeApplied},
+		{Name: "flaretest-4", ID: "C4", Key: "FLARETEST-4", Outcome: outcomeFailed, Error: "no ticket links channel C4 and looking up FLARETEST-4 failed: Status-code:404", ErrorClass: errorClassUnknown},
+	}, results)
+}
+
+func TestRunCommandUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"archive"},
+		{"scan", "flaretest-1"},
+		{"report", "-format"},
+		{"delete", "flaretest-1"},
+	} {
+		var out bytes.Buffer
+		assert.Equal(t, 2, runCommand(context.Background(), args, &out), args)
+		assert.Contains(t, out.String(), "usage:", args)
+	}
+}
+
+func TestFindChannelRetries(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	slackClient := NewMockSlackClient(mockController)
+	channel := namedChannel("flaretest-1")
+	gomock.InOrder(
+		slackClient.EXPECT().GetConversations(gomock.Any()).Return(nil, "", &slk.RateLimitedError{RetryAfter: 30 * time.Second}).Times(1),
+		slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{channel}, "", nil).Times(1),
+	)
+
+	clock := newFakeClock(time.Now())
+	h := Handler{slackClient: slackClient, config: newTestConfig(t, nil), clock: clock}
+	found, err := h.findChannel(context.Background(), "#flaretest-1")
+	require.NoError(t, err)
+	assert.Equal(t, channel, found)
+	assert.Equal(t, []time.Duration{30 * time.Second}, clock.Waits())
+}
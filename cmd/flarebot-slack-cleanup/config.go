@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Clever/flarebot/audit"
+	"github.com/Clever/flarebot/duration"
+	"github.com/Clever/flarebot/tracing"
+
+	slk "github.com/slack-go/slack"
+)
+
+// Defaults for the optional settings, see README.md.
+const (
+	defaultFlareChannelPrefix  = "flaretest-"
+	defaultChannelAgeThreshold = 180 * 24 * time.Hour
+	defaultDryRun              = true
+	defaultFailureBudget       = "10%"
+)
+
+// Values of SHARED_CHANNEL_ARCHIVAL.
+const (
+	// sharedChannelsSkip never archives channels shared with other workspaces.
+	sharedChannelsSkip = "skip"
+	// sharedChannelsApproval archives shared channels listed in APPROVED_SHARED_CHANNELS and
+	// reports the rest for approval.
+	sharedChannelsApproval = "approval"
+)
+
+// configKeys are every setting the cleanup reads. They are the env var names and also the keys
+// of a CONFIG_SOURCE document.
+var configKeys = []string{
+	"FLARE_CHANNEL_PREFIX",
+	"CHANNEL_MATCHERS",
+	"CHANNEL_AGE_THRESHOLD",
+	"DRY_RUN",
+	"SHARED_CHANNEL_ARCHIVAL",
+	"APPROVED_SHARED_CHANNELS",
+	"SHARED_CHANNEL_NOTICE",
+	"LEAVE_JOINED_CHANNELS",
+	"FAILURE_BUDGET",
+	"AUDIT_SINK",
+	"AUDIT_S3_ENDPOINT",
+	"HTTP_RECORDING",
+	"TRACES_EXPORTER",
+	"JIRA_ORIGIN",
+	"JIRA_USERNAME",
+	"JIRA_PASSWORD",
+	"JIRA_SLACK_CHANNEL_FIELD_ID",
+	"SLACK_BOT_TOKEN",
+	"SLACK_ORIGIN",
+}
+
+var requiredConfigKeys = []string{"JIRA_ORIGIN", "JIRA_USERNAME", "JIRA_PASSWORD", "SLACK_BOT_TOKEN"}
+
+// Config is the parsed and validated cleanup configuration. The generated InitLaunchConfig
+// isn't used because it treats every setting as required.
+type Config struct {
+	FlareChannelPrefix  string
+	ChannelAgeThreshold time.Duration
+	DryRun              bool
+	Matchers            []ChannelMatcher
+
+	SharedChannelArchival  string
+	ApprovedSharedChannels []string
+	SharedChannelNotice    string
+	// LeaveJoinedChannels makes the bot leave channels it joined to run actions that didn't
+	// archive them.
+	LeaveJoinedChannels bool
+	// FailureBudget is how many failed channels make the Lambda return an error.
+	FailureBudget FailureBudget
+	// AuditSink is where changes are recorded, see audit.ParseSink. AuditS3Endpoint points S3
+	// sinks at an S3-compatible store.
+	AuditSink       string
+	AuditS3Endpoint string
+	// HTTPRecording is where each run's Slack and Jira traffic is saved as a cassette, in the same
+	// form as AuditSink.
+	HTTPRecording string
+	// TracesExporter is where spans go, see the tracing package.
+	TracesExporter string
+
+	JiraOrigin              string
+	JiraUsername            string
+	JiraPassword            string
+	JiraSlackChannelFieldID string
+	SlackBotToken           string
+	SlackOrigin             string
+}
+
+// SSMClient and SecretsManagerClient are the AWS calls a CONFIG_SOURCE can use.
+type SSMClient interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+type SecretsManagerClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// configLoader builds a Config from the environment and an optional CONFIG_SOURCE.
+type configLoader struct {
+	lookupEnv      func(string) (string, bool)
+	readFile       func(string) ([]byte, error)
+	ssmClient      SSMClient
+	secretsManager SecretsManagerClient
+	// overrides, e.g. from command flags, take precedence over everything else.
+	overrides map[string]string
+}
+
+func newConfigLoader(ssmClient SSMClient, secretsManager SecretsManagerClient) configLoader {
+	return configLoader{lookupEnv: os.LookupEnv, readFile: os.ReadFile, ssmClient: ssmClient, secretsManager: secretsManager}
+}
+
+// load reads settings from CONFIG_SOURCE, if set, with env vars and then overrides taking
+// precedence, then fills in defaults and validates everything. CONFIG_SOURCE is one of
+//
+//	file:<path>
+//	ssm:<parameter name>
+//	secretsmanager:<secret id>
+//
+// and holds a YAML or JSON object keyed by the env var names.
+func (l configLoader) load(ctx context.Context) (Config, error) {
+	values := map[string]string{}
+	if source, ok := l.lookupEnv("CONFIG_SOURCE"); ok && source != "" {
+		document, err := l.fetch(ctx, source)
+		if err != nil {
+			return Config{}, fmt.Errorf("loading CONFIG_SOURCE %s: %w", source, err)
+		}
+		if err := yaml.Unmarshal(document, &values); err != nil {
+			return Config{}, fmt.Errorf("parsing CONFIG_SOURCE %s: %w", source, err)
+		}
+	}
+	for _, key := range configKeys {
+		if value, ok := l.lookupEnv(key); ok {
+			values[key] = value
+		}
+	}
+	for key, value := range l.overrides {
+		values[key] = value
+	}
+	return parseConfig(values)
+}
+
+func (l configLoader) fetch(ctx context.Context, source string) ([]byte, error) {
+	kind, location, found := strings.Cut(source, ":")
+	if !found || location == "" {
+		return nil, errors.New("expected file:<path>, ssm:<name> or secretsmanager:<id>")
+	}
+	switch kind {
+	case "file":
+		return l.readFile(location)
+	case "ssm":
+		if l.ssmClient == nil {
+			return nil, errors.New("no SSM client")
+		}
+		output, err := l.ssmClient.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(location), WithDecryption: aws.Bool(true)})
+		if err != nil {
+			return nil, err
+		}
+		return []byte(aws.ToString(output.Parameter.Value)), nil
+	case "secretsmanager":
+		if l.secretsManager == nil {
+			return nil, errors.New("no Secrets Manager client")
+		}
+		output, err := l.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(location)})
+		if err != nil {
+			return nil, err
+		}
+		return []byte(aws.ToString(output.SecretString)), nil
+	default:
+		return nil, fmt.Errorf("unknown source %q, expected file, ssm or secretsmanager", kind)
+	}
+}
+
+// parseConfig validates the settings and reports every problem at once.
+func parseConfig(values map[string]string) (Config, error) {
+	problems := []error{}
+	known := map[string]bool{}
+	for _, key := range configKeys {
+		known[key] = true
+	}
+	unknown := []string{}
+	for key := range values {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		problems = append(problems, fmt.Errorf("%s is not a setting", key))
+	}
+	for _, key := range requiredConfigKeys {
+		if values[key] == "" {
+			problems = append(problems, fmt.Errorf("%s is required", key))
+		}
+	}
+
+	config := Config{
+		FlareChannelPrefix:      values["FLARE_CHANNEL_PREFIX"],
+		ChannelAgeThreshold:     defaultChannelAgeThreshold,
+		DryRun:                  defaultDryRun,
+		SharedChannelArchival:   values["SHARED_CHANNEL_ARCHIVAL"],
+		SharedChannelNotice:     values["SHARED_CHANNEL_NOTICE"],
+		TracesExporter:          values["TRACES_EXPORTER"],
+		AuditSink:               values["AUDIT_SINK"],
+		AuditS3Endpoint:         values["AUDIT_S3_ENDPOINT"],
+		HTTPRecording:           values["HTTP_RECORDING"],
+		JiraOrigin:              values["JIRA_ORIGIN"],
+		JiraUsername:            values["JIRA_USERNAME"],
+		JiraPassword:            values["JIRA_PASSWORD"],
+		JiraSlackChannelFieldID: values["JIRA_SLACK_CHANNEL_FIELD_ID"],
+		SlackBotToken:           values["SLACK_BOT_TOKEN"],
+		SlackOrigin:             values["SLACK_ORIGIN"],
+	}
+	if config.FlareChannelPrefix == "" {
+		config.FlareChannelPrefix = defaultFlareChannelPrefix
+	}
+
+	if value := values["CHANNEL_AGE_THRESHOLD"]; value != "" {
+		threshold, err := parseThreshold(value)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("CHANNEL_AGE_THRESHOLD: %w", err))
+		}
+		config.ChannelAgeThreshold = threshold
+	}
+	if value := values["DRY_RUN"]; value != "" {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("DRY_RUN: %q is not true or false", value))
+		}
+		config.DryRun = dryRun
+	}
+	switch config.SharedChannelArchival {
+	case "":
+		config.SharedChannelArchival = sharedChannelsSkip
+	case sharedChannelsSkip, sharedChannelsApproval:
+	default:
+		problems = append(problems, fmt.Errorf("SHARED_CHANNEL_ARCHIVAL: %q is not %s or %s", config.SharedChannelArchival, sharedChannelsSkip, sharedChannelsApproval))
+	}
+	for _, channel := range strings.Split(values["APPROVED_SHARED_CHANNELS"], ",") {
+		if channel = strings.TrimPrefix(strings.TrimSpace(channel), "#"); channel != "" {
+			config.ApprovedSharedChannels = append(config.ApprovedSharedChannels, channel)
+		}
+	}
+	if len(config.ApprovedSharedChannels) > 0 && config.SharedChannelArchival != sharedChannelsApproval {
+		problems = append(problems, fmt.Errorf("APPROVED_SHARED_CHANNELS needs SHARED_CHANNEL_ARCHIVAL=%s", sharedChannelsApproval))
+	}
+	if value := values["LEAVE_JOINED_CHANNELS"]; value != "" {
+		leave, err := strconv.ParseBool(value)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("LEAVE_JOINED_CHANNELS: %q is not true or false", value))
+		}
+		config.LeaveJoinedChannels = leave
+	}
+	budget := values["FAILURE_BUDGET"]
+	if budget == "" {
+		budget = defaultFailureBudget
+	}
+	failureBudget, err := parseFailureBudget(budget)
+	if err != nil {
+		problems = append(problems, fmt.Errorf("FAILURE_BUDGET: %w", err))
+	}
+	config.FailureBudget = failureBudget
+	if _, _, err := audit.ParseSink(config.AuditSink); err != nil {
+		problems = append(problems, fmt.Errorf("AUDIT_SINK: %w", err))
+	}
+	if _, _, err := audit.ParseSink(config.HTTPRecording); err != nil {
+		problems = append(problems, fmt.Errorf("HTTP_RECORDING: %w", err))
+	}
+	if !tracing.ValidExporter(config.TracesExporter) {
+		problems = append(problems, fmt.Errorf("TRACES_EXPORTER: %q is not %s, %s or %s", config.TracesExporter, tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP))
+	}
+	if (config.JiraSlackChannelFieldID == "") != (config.SlackOrigin == "") {
+		problems = append(problems, errors.New("JIRA_SLACK_CHANNEL_FIELD_ID and SLACK_ORIGIN must be set together"))
+	}
+
+	matchers, err := parseMatchers(values["CHANNEL_MATCHERS"], config.FlareChannelPrefix, config.ChannelAgeThreshold)
+	if err != nil {
+		problems = append(problems, err)
+	}
+	config.Matchers = matchers
+
+	if err := errors.Join(problems...); err != nil {
+		return Config{}, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return config, nil
+}
+
+// approvedForArchival reports whether a shared channel may be archived. The approval list takes
+// channel names or IDs.
+func (c Config) approvedForArchival(channel slk.Channel) bool {
+	if c.SharedChannelArchival != sharedChannelsApproval {
+		return false
+	}
+	for _, approved := range c.ApprovedSharedChannels {
+		if approved == channel.Name || approved == channel.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// parseThreshold accepts durations like "180d" or "6mo". A bare number is a number of days,
+// which is how CHANNEL_AGE_THRESHOLD was originally set.
+func parseThreshold(value string) (time.Duration, error) {
+	if days, err := strconv.Atoi(value); err == nil && days >= 0 {
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return duration.Parse(value)
+}
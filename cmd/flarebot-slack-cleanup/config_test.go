@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubSSM and stubSecretsManager serve documents from memory in place of AWS.
+type stubSSM map[string]string
+
+func (s stubSSM) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	value, ok := s[aws.ToString(params.Name)]
+	if !ok {
+		return nil, errors.New("ParameterNotFound")
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Value: aws.String(value)}}, nil
+}
+
+type stubSecretsManager map[string]string
+
+func (s stubSecretsManager) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	value, ok := s[aws.ToString(params.SecretId)]
+	if !ok {
+		return nil, errors.New("ResourceNotFoundException")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil
+}
+
+func envFrom(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+var requiredSettings = map[string]string{
+	"JIRA_ORIGIN":     "https://clever.atlassian.net",
+	"JIRA_USERNAME":   "flarebot",
+	"JIRA_PASSWORD":   "password",
+	"SLACK_BOT_TOKEN": "xoxb-token",
+}
+
+func TestParseConfig(t *testing.T) {
+	config, err := parseConfig(requiredSettings)
+	require.NoError(t, err)
+	assert.Equal(t, "flaretest-", config.FlareChannelPrefix)
+	assert.Equal(t, 180*24*time.Hour, config.ChannelAgeThreshold)
+	assert.True(t, config.DryRun)
+	assert.Equal(t, FailureBudget{Ratio: 0.1, IsRatio: true}, config.FailureBudget)
+	if assert.Len(t, config.Matchers, 1) {
+		assert.Equal(t, "FLARETEST", config.Matchers[0].Project)
+	}
+
+	for value, expected := range map[string]time.Duration{
+		"180":  180 * 24 * time.Hour,
+		"180d": 180 * 24 * time.Hour,
+		"6mo":  6 * 30 * 24 * time.Hour,
+		"2w":   14 * 24 * time.Hour,
+	} {
+		settings := map[string]string{"CHANNEL_AGE_THRESHOLD": value}
+		for key, v := range requiredSettings {
+			settings[key] = v
+		}
+		config, err := parseConfig(settings)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, config.ChannelAgeThreshold, value)
+	}
+}
+
+func TestParseConfigReportsEveryProblem(t *testing.T) {
+	_, err := parseConfig(map[string]string{
+		"CHANNEL_AGE_THRESHOLD":    "soon",
+		"DRY_RUN":                  "maybe",
+		"CHANNEL_MATCHERS":         `[{"type": "glob", "pattern": "flare-*"}]`,
+		"SLACK_ORIGIN":             "https://clever.slack.com",
+		"SLACK_TOKEN":              "xoxb-token",
+		"SHARED_CHANNEL_ARCHIVAL":  "always",
+		"APPROVED_SHARED_CHANNELS": "flare-1",
+		"FAILURE_BUDGET":           "150%",
+	})
+	require.Error(t, err)
+	for _, problem := range []string{
+		"SLACK_TOKEN is not a setting",
+		"JIRA_ORIGIN is required",
+		"JIRA_USERNAME is required",
+		"JIRA_PASSWORD is required",
+		"SLACK_BOT_TOKEN is required",
+		"CHANNEL_AGE_THRESHOLD: ",
+		`DRY_RUN: "maybe" is not true or false`,
+		"JIRA_SLACK_CHANNEL_FIELD_ID and SLACK_ORIGIN must be set together",
+		"invalid channel matcher 0: project is required for glob matchers",
+		`SHARED_CHANNEL_ARCHIVAL: "always" is not skip or approval`,
+		"APPROVED_SHARED_CHANNELS needs SHARED_CHANNEL_ARCHIVAL=approval",
+		`FAILURE_BUDGET: "150%" is not a percentage between 0% and 100%`,
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	document := `
+JIRA_ORIGIN: https://clever.atlassian.net
+JIRA_USERNAME: flarebot
+JIRA_PASSWORD: password
+SLACK_BOT_TOKEN: xoxb-token
+CHANNEL_AGE_THRESHOLD: 4w
+DRY_RUN: "false"
+`
+	file := filepath.Join(t.TempDir(), "cleanup.yml")
+	require.NoError(t, os.WriteFile(file, []byte(document), 0o600))
+
+	tests := []struct {
+		description string
+		env         map[string]string
+		threshold   time.Duration
+		dryRun      bool
+		err         string
+	}{
+		{
+			description: "environment only",
+			env:         map[string]string{"JIRA_ORIGIN": "o", "JIRA_USERNAME": "u", "JIRA_PASSWORD": "p", "SLACK_BOT_TOKEN": "t"},
+			threshold:   180 * 24 * time.Hour,
+			dryRun:      true,
+		},
+		{
+			description: "file",
+			env:         map[string]string{"CONFIG_SOURCE": "file:" + file},
+			threshold:   28 * 24 * time.Hour,
+		},
+		{
+			description: "ssm",
+			env:         map[string]string{"CONFIG_SOURCE": "ssm:/flarebot/cleanup"},
+			threshold:   28 * 24 * time.Hour,
+		},
+		{
+			description: "secrets manager",
+			env:         map[string]string{"CONFIG_SOURCE": "secretsmanager:flarebot-cleanup"},
+			threshold:   180 * 24 * time.Hour,
+		},
+		{
+			description: "environment overrides the source",
+			env:         map[string]string{"CONFIG_SOURCE": "ssm:/flarebot/cleanup", "DRY_RUN": "true", "CHANNEL_AGE_THRESHOLD": "90d"},
+			threshold:   90 * 24 * time.Hour,
+			dryRun:      true,
+		},
+		{
+			description: "missing parameter",
+			env:         map[string]string{"CONFIG_SOURCE": "ssm:/flarebot/missing"},
+			err:         "loading CONFIG_SOURCE ssm:/flarebot/missing: ParameterNotFound",
+		},
+		{
+			description: "unknown source",
+			env:         map[string]string{"CONFIG_SOURCE": "vault:flarebot"},
+			err:         `loading CONFIG_SOURCE vault:flarebot: unknown source "vault", expected file, ssm or secretsmanager`,
+		},
+		{
+			description: "invalid document",
+			env:         map[string]string{"CONFIG_SOURCE": "secretsmanager:not-yaml"},
+			err:         "parsing CONFIG_SOURCE secretsmanager:not-yaml: yaml: unmarshal errors:\n  line 1: cannot unmarshal !!seq into map[string]string",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			loader := newConfigLoader(
+				stubSSM{"/flarebot/cleanup": document},
+				stubSecretsManager{"flarebot-cleanup": `{"JIRA_ORIGIN": "https://clever.atlassian.net", "JIRA_USERNAME": "flarebot", "JIRA_PASSWORD": "password", "SLACK_BOT_TOKEN": "xoxb-token", "DRY_RUN": "false"}`, "not-yaml": `[1, 2]`},
+			)
+			loader.lookupEnv = envFrom(test.env)
+			config, err := loader.load(context.Background())
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.dryRun, config.DryRun)
+			assert.Equal(t, test.threshold, config.ChannelAgeThreshold)
+		})
+	}
+}
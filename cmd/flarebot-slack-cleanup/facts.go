@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Clever/flarebot/flare"
+	"github.com/Clever/flarebot/jira"
+	"github.com/Clever/flarebot/slackutil"
+	"github.com/Clever/kayvee-go/v7/logger"
+
+	slk "github.com/slack-go/slack"
+)
+
+// recentHistorySize is how many messages are read to find the last activity in a channel.
+const recentHistorySize = 20
+
+// flareChannel is a channel a matcher accepted. It implements ChannelFacts and caches every
+// lookup so conditions and actions share them.
+type flareChannel struct {
+	ctx     context.Context
+	handler Handler
+	channel slk.Channel
+	key     string
+	matcher ChannelMatcher
+	now     time.Time
+
+	inactive *time.Duration
+	pins     []string
+	ticket   *jira.Ticket
+
+	// readOnly keeps the bot from joining the channel to read it, for dry runs and explain.
+	readOnly bool
+	// joined is set when the bot joined the channel during this run, archived once it's archived.
+	joined   bool
+	archived bool
+}
+
+func (c *flareChannel) Age() time.Duration {
+	return c.now.Sub(time.Unix(int64(c.channel.Created), 0))
+}
+
+func (c *flareChannel) PastThreshold() bool {
+	return isOlderThanThreshold(c.now, int64(c.channel.Created), c.matcher.threshold)
+}
+
+func (c *flareChannel) Members() int {
+	return c.channel.NumMembers
+}
+
+// Inactive is the time since the last message, ignoring cleanup warnings and people joining or
+// leaving. Channels without such messages count as inactive since they were created.
+func (c *flareChannel) Inactive() (time.Duration, error) {
+	if c.inactive != nil {
+		return *c.inactive, nil
+	}
+	var history *slk.GetConversationHistoryResponse
+	err := c.handler.inChannel(c.ctx, c, func() (err error) {
+		history, err = c.handler.slackClient.GetConversationHistory(&slk.GetConversationHistoryParameters{
+			ChannelID: c.channel.ID,
+			Limit:     recentHistorySize,
+		})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	inactive := c.Age()
+	for _, message := range history.Messages {
+		if slackutil.HasBlockID(message, cleanupWarningBlockID) || message.SubType == "channel_join" || message.SubType == "channel_leave" {
+			continue
+		}
+		if ts, err := strconv.ParseFloat(message.Timestamp, 64); err == nil {
+			inactive = c.now.Sub(time.Unix(int64(ts), 0))
+			break
+		}
+	}
+	c.inactive = &inactive
+	return inactive, nil
+}
+
+// Pins returns the text of the channel's pinned messages.
+func (c *flareChannel) Pins() ([]string, error) {
+	if c.pins != nil {
+		return c.pins, nil
+	}
+	var items []slk.Item
+	err := c.handler.inChannel(c.ctx, c, func() (err error) {
+		items, _, err = c.handler.slackClient.ListPins(c.channel.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.pins = []string{}
+	for _, item := range items {
+		if item.Message != nil {
+			c.pins = append(c.pins, item.Message.Text)
+		}
+	}
+	return c.pins, nil
+}
+
+func (c *flareChannel) Ticket() (*TicketFacts, error) {
+	ticket, err := c.resolveTicket()
+	if err != nil {
+		return nil, err
+	}
+	return &TicketFacts{
+		Status:   ticket.Fields.Status.Name,
+		Priority: flare.Priority(*ticket),
+		Labels:   ticket.Fields.Labels,
+	}, nil
+}
+
+// resolveTicket finds the channel's flare ticket, see flare.Resolver.
+func (c *flareChannel) resolveTicket() (*jira.Ticket, error) {
+	if c.ticket != nil {
+		return c.ticket, nil
+	}
+	resolver := flare.Resolver{
+		Client:         c.handler.jiraClient,
+		ChannelFieldID: c.handler.config.JiraSlackChannelFieldID,
+		SlackOrigin:    c.handler.config.SlackOrigin,
+	}
+	ticket, strategy, err := resolver.Resolve(c.channel.ID, c.key)
+	if err != nil {
+		return nil, err
+	}
+	logger.FromContext(c.ctx).InfoD("resolved-flare-ticket", logger.M{"channel": c.channel.Name, "key": ticket.Key, "strategy": strategy})
+	trace.SpanFromContext(c.ctx).SetAttributes(attribute.String("jira.key", ticket.Key), attribute.String("jira.resolve_strategy", strategy))
+	c.ticket = ticket
+	return ticket, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	slk "github.com/slack-go/slack"
+
+	"github.com/Clever/flarebot/jira"
+	"github.com/Clever/flarebot/slackutil"
+)
+
+// Classes of channel failures. Transient failures are expected to clear up on the next run,
+// permanent ones need someone to look at the channel or its ticket. Errors the cleanup doesn't
+// recognize are unknown, and are retried like transient ones.
+const (
+	errorClassTransient = "transient"
+	errorClassPermanent = "permanent"
+	errorClassUnknown   = "unknown"
+)
+
+var errorClasses = []string{errorClassTransient, errorClassPermanent, errorClassUnknown}
+
+// transientSlackErrors are Slack error codes that mean Slack itself had trouble.
+var transientSlackErrors = []string{"ratelimited", "internal_error", "fatal_error", "service_unavailable", "request_timeout"}
+
+// permanentSlackErrors are Slack error codes that come back the same on every attempt.
+var permanentSlackErrors = []string{
+	"channel_not_found", "is_archived", "already_archived", "not_archived", "not_in_channel",
+	"cant_archive_general", "restricted_action", "method_not_supported_for_channel_type",
+	"name_taken", "invalid_name", "missing_scope", "not_authed", "invalid_auth", "account_inactive", "token_revoked",
+}
+
+// classifyError tells rate limits, 5xx answers and network errors apart from errors that won't
+// go away by themselves, like channel_not_found or a missing ticket.
+func classifyError(err error) string {
+	var rateLimited *slk.RateLimitedError
+	if errors.As(err, &rateLimited) {
+		return errorClassTransient
+	}
+	var slackStatus slk.StatusCodeError
+	if errors.As(err, &slackStatus) && (slackStatus.Code == 429 || slackStatus.Code >= 500) {
+		return errorClassTransient
+	}
+	for _, code := range transientSlackErrors {
+		if slackutil.IsError(err, code) {
+			return errorClassTransient
+		}
+	}
+	for _, code := range permanentSlackErrors {
+		if slackutil.IsError(err, code) {
+			return errorClassPermanent
+		}
+	}
+	var jiraStatus *jira.StatusError
+	if errors.As(err, &jiraStatus) {
+		if jiraStatus.StatusCode == 429 || jiraStatus.StatusCode >= 500 {
+			return errorClassTransient
+		}
+		return errorClassPermanent
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return errorClassTransient
+	}
+	for _, known := range []error{errSharedChannel, errPrivateChannel, errNeedsJoin, errAlreadyArchived, errNotArchived} {
+		if errors.Is(err, known) {
+			return errorClassPermanent
+		}
+	}
+	return errorClassUnknown
+}
+
+// fail marks the channel failed with err.
+func (r *ChannelResult) fail(err error) {
+	r.Outcome = outcomeFailed
+	r.Error = err.Error()
+	r.ErrorClass = classifyError(err)
+}
+
+// FailureBudget is how many channels a run may fail before the Lambda reports an error. It's
+// either a count of channels or, set as a percentage, a ratio of the channels actions ran on.
+type FailureBudget struct {
+	Count int
+	Ratio float64
+	// IsRatio is set for budgets given as a percentage.
+	IsRatio bool
+}
+
+// parseFailureBudget accepts a count like "5" or a percentage like "10%".
+func parseFailureBudget(value string) (FailureBudget, error) {
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		ratio, err := strconv.ParseFloat(percent, 64)
+		if err != nil || ratio < 0 || ratio > 100 {
+			return FailureBudget{}, fmt.Errorf("%q is not a percentage between 0%% and 100%%", value)
+		}
+		return FailureBudget{Ratio: ratio / 100, IsRatio: true}, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return FailureBudget{}, fmt.Errorf("%q is not a count of channels or a percentage", value)
+	}
+	return FailureBudget{Count: count}, nil
+}
+
+func (b FailureBudget) String() string {
+	if b.IsRatio {
+		return strconv.FormatFloat(b.Ratio*100, 'f', -1, 64) + "%"
+	}
+	return strconv.Itoa(b.Count)
+}
+
+// exceeded reports whether failed channels out of the attempted ones are over the budget.
+func (b FailureBudget) exceeded(failed, attempted int) bool {
+	if b.IsRatio {
+		return attempted > 0 && float64(failed)/float64(attempted) > b.Ratio
+	}
+	return failed > b.Count
+}
+
+// RunError is returned by Handle when a run fails more channels than the failure budget allows.
+type RunError struct {
+	Budget    FailureBudget
+	Attempted int
+	Failed    []ChannelResult
+}
+
+// Classes counts the failed channels by error class.
+func (e *RunError) Classes() map[string]int {
+	classes := map[string]int{}
+	for _, channel := range e.Failed {
+		classes[channel.ErrorClass]++
+	}
+	return classes
+}
+
+func (e *RunError) Error() string {
+	classes := e.Classes()
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d channels failed, over the failure budget of %s (%d transient, %d permanent, %d unknown):",
+		len(e.Failed), e.Attempted, e.Budget, classes[errorClassTransient], classes[errorClassPermanent], classes[errorClassUnknown])
+	for _, channel := range e.Failed {
+		fmt.Fprintf(&b, "\n#%s (%s): %s", channel.Name, channel.ErrorClass, channel.Error)
+	}
+	return b.String()
+}
+
+// checkBudget returns a RunError if the run failed more channels than the budget allows.
+// Channels count as attempted when their actions ran, whether they failed or not.
+func (r *Run) checkBudget(budget FailureBudget) error {
+	failed := r.withOutcome(outcomeFailed)
+	attempted := len(r.withOutcome(outcomeApplied, outcomeFailed))
+	if len(failed) == 0 || !budget.exceeded(len(failed), attempted) {
+		return nil
+	}
+	return &RunError{Budget: budget, Attempted: attempted, Failed: failed}
+}
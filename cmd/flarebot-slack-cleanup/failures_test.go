@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	slk "github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/jira"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, test := range []struct {
+		err   error
+		class string
+	}{
+		{&slk.RateLimitedError{}, errorClassTransient},
+		{slk.StatusCodeError{Code: 503, Status: "503 Service Unavailable"}, errorClassTransient},
+		{fmt.Errorf("archive: %w", slk.SlackErrorResponse{Err: "internal_error"}), errorClassTransient},
+		{fmt.Errorf("label: %w", &jira.StatusError{StatusCode: 502}), errorClassTransient},
+		{context.DeadlineExceeded, errorClassTransient},
+		{slk.SlackErrorResponse{Err: "channel_not_found"}, errorClassPermanent},
+		{fmt.Errorf("label: %w", &jira.StatusError{StatusCode: 404}), errorClassPermanent},
+		{errSharedChannel, errorClassPermanent},
+		{fmt.Errorf("label: %w", &jira.StatusError{StatusCode: 400}), errorClassPermanent},
+		{errors.New("fatal_error"), errorClassUnknown},
+		{slk.SlackErrorResponse{Err: "some_new_error"}, errorClassUnknown},
+	} {
+		assert.Equal(t, test.class, classifyError(test.err), test.err.Error())
+	}
+}
+
+func TestFailureBudget(t *testing.T) {
+	for _, test := range []struct {
+		budget            string
+		failed, attempted int
+		exceeded          bool
+	}{
+		{"0", 0, 10, false},
+		{"0", 1, 10, true},
+		{"2", 2, 3, false},
+		{"2", 3, 3, true},
+		{"10%", 1, 10, false},
+		{"10%", 2, 10, true},
+		{"10%", 0, 0, false},
+		{"100%", 5, 5, false},
+	} {
+		budget, err := parseFailureBudget(test.budget)
+		require.NoError(t, err, test.budget)
+		assert.Equal(t, test.budget, budget.String())
+		assert.Equal(t, test.exceeded, budget.exceeded(test.failed, test.attempted), test)
+	}
+
+	for _, value := range []string{"", "-1", "ten", "x%", "101%"} {
+		_, err := parseFailureBudget(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestHandleFailsOverBudget(t *testing.T) {
+	old := namedChannel("flaretest-1")
+	old.ID = "C1"
+	missing := namedChannel("flaretest-2")
+	missing.ID = "C2"
+	channels := []slk.Channel{old, missing}
+
+	tests := []struct {
+		description string
+		budget      string
+		err         string
+	}{
+		{
+			description: "under the budget",
+			budget:      "50%",
+		},
+		{
+			description: "over the budget",
+			budget:      "0",
+			err: "1 of 2 channels failed, over the failure budget of 0 (0 transient, 1 permanent, 0 unknown):\n" +
+				"#flaretest-2 (permanent): archive: channel_not_found",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mockController := gomock.NewController(t)
+			defer mockController.Finish()
+			slackClient := NewMockSlackClient(mockController)
+			jiraClient := NewMockJiraClient(mockController)
+			slackClient.EXPECT().GetConversations(gomock.Any()).Return(channels, "", nil).Times(1)
+			slackClient.EXPECT().ArchiveConversation("C1").Return(nil).Times(1)
+			slackClient.EXPECT().ArchiveConversation("C2").Return(slk.SlackErrorResponse{Err: "channel_not_found"}).Times(1)
+			jiraClient.EXPECT().GetTicketByKey("FLARETEST-1").Return(&jira.Ticket{Key: "FLARETEST-1"}, nil).Times(1)
+			jiraClient.EXPECT().SetLabel(&jira.Ticket{Key: "FLARETEST-1"}, "archived").Return(nil).Times(1)
+
+			h := Handler{slackClient: slackClient, jiraClient: jiraClient, config: newTestConfig(t, map[string]string{"FAILURE_BUDGET": test.budget}), clock: newFakeClock(time.Now())}
+			err := h.Handle(context.Background())
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, test.err)
+			var runErr *RunError
+			if assert.True(t, errors.As(err, &runErr)) {
+				assert.Equal(t, map[string]int{errorClassPermanent: 1}, runErr.Classes())
+			}
+		})
+	}
+}
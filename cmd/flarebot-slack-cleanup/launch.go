@@ -21,13 +21,26 @@ type Dependencies struct{}
 
 // Environment has environment variables and their values
 type Environment struct {
-	FlareChannelPrefix  string
-	JiraOrigin          string
-	JiraUsername        string
-	JiraPassword        string
-	SlackBotToken       string
-	ChannelAgeThreshold string
-	DryRun              string
+	FlareChannelPrefix      string
+	ChannelMatchers         string
+	JiraOrigin              string
+	JiraUsername            string
+	JiraPassword            string
+	JiraSlackChannelFieldID string
+	SlackBotToken           string
+	SlackOrigin             string
+	ChannelAgeThreshold     string
+	DryRun                  string
+	SharedChannelArchival   string
+	ApprovedSharedChannels  string
+	SharedChannelNotice     string
+	LeaveJoinedChannels     string
+	FailureBudget           string
+	AuditSink               string
+	AuditS3Endpoint         string
+	HttpRecording           string
+	ConfigSource            string
+	TracesExporter          string
 }
 
 // AwsResources contains string IDs that will help for accessing various AWS resources
@@ -42,13 +55,26 @@ func InitLaunchConfig(exp *trace.SpanExporter) LaunchConfig {
 		AwsResources: AwsResources{},
 		Deps:         Dependencies{},
 		Env: Environment{
-			ChannelAgeThreshold: requireEnvVar("CHANNEL_AGE_THRESHOLD"),
-			DryRun:              requireEnvVar("DRY_RUN"),
-			FlareChannelPrefix:  requireEnvVar("FLARE_CHANNEL_PREFIX"),
-			JiraOrigin:          requireEnvVar("JIRA_ORIGIN"),
-			JiraPassword:        requireEnvVar("JIRA_PASSWORD"),
-			JiraUsername:        requireEnvVar("JIRA_USERNAME"),
-			SlackBotToken:       requireEnvVar("SLACK_BOT_TOKEN"),
+			ApprovedSharedChannels:  requireEnvVar("APPROVED_SHARED_CHANNELS"),
+			AuditS3Endpoint:         requireEnvVar("AUDIT_S3_ENDPOINT"),
+			AuditSink:               requireEnvVar("AUDIT_SINK"),
+			ChannelAgeThreshold:     requireEnvVar("CHANNEL_AGE_THRESHOLD"),
+			ChannelMatchers:         requireEnvVar("CHANNEL_MATCHERS"),
+			ConfigSource:            requireEnvVar("CONFIG_SOURCE"),
+			DryRun:                  requireEnvVar("DRY_RUN"),
+			FailureBudget:           requireEnvVar("FAILURE_BUDGET"),
+			FlareChannelPrefix:      requireEnvVar("FLARE_CHANNEL_PREFIX"),
+			HttpRecording:           requireEnvVar("HTTP_RECORDING"),
+			JiraOrigin:              requireEnvVar("JIRA_ORIGIN"),
+			JiraPassword:            requireEnvVar("JIRA_PASSWORD"),
+			JiraSlackChannelFieldID: requireEnvVar("JIRA_SLACK_CHANNEL_FIELD_ID"),
+			JiraUsername:            requireEnvVar("JIRA_USERNAME"),
+			LeaveJoinedChannels:     requireEnvVar("LEAVE_JOINED_CHANNELS"),
+			SharedChannelArchival:   requireEnvVar("SHARED_CHANNEL_ARCHIVAL"),
+			SharedChannelNotice:     requireEnvVar("SHARED_CHANNEL_NOTICE"),
+			SlackBotToken:           requireEnvVar("SLACK_BOT_TOKEN"),
+			SlackOrigin:             requireEnvVar("SLACK_ORIGIN"),
+			TracesExporter:          requireEnvVar("TRACES_EXPORTER"),
 		},
 		ExternalUrlUsage: ExternalUrlUsage{},
 	}
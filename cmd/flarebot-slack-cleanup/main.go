@@ -3,20 +3,25 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"regexp"
-	"strconv"
-	"strings"
 	"time"
 
 	_ "embed"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-lambda-go/lambdacontext"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/Clever/flarebot/audit"
 	"github.com/Clever/flarebot/jira"
+	"github.com/Clever/flarebot/tracing"
 	"github.com/Clever/kayvee-go/v7/logger"
 
 	slk "github.com/slack-go/slack"
@@ -30,23 +35,48 @@ import (
 //go:embed kvconfig.yml
 var kvconfig []byte
 
+// the cleanup policy deployed with the lambda
+//
+//go:embed policy.yml
+var defaultPolicy []byte
+
 type SlackClient interface {
 	ArchiveConversation(channelID string) error
+	UnArchiveConversation(channelID string) error
 	JoinConversation(channelID string) (*slk.Channel, string, []string, error)
+	LeaveConversation(channelID string) (bool, error)
 	GetConversations(input *slk.GetConversationsParameters) ([]slk.Channel, string, error)
+	GetConversationHistory(params *slk.GetConversationHistoryParameters) (*slk.GetConversationHistoryResponse, error)
+	ListPins(channel string) ([]slk.Item, *slk.Paging, error)
+	PostMessage(channelID string, options ...slk.MsgOption) (string, string, error)
+	RenameConversation(channelID, channelName string) (*slk.Channel, error)
 }
 
 type JiraClient interface {
 	GetTicketByKey(key string) (*jira.Ticket, error)
+	SearchTickets(jql string, fields []string) ([]jira.Ticket, error)
 	SetLabel(ticket *jira.Ticket, label string) error
+	RemoveLabel(ticket *jira.Ticket, label string) error
+	AddComment(ticket *jira.Ticket, body string) error
+	AddAttachment(ticket *jira.Ticket, filename string, content []byte) error
 }
 
 // Handler encapsulates the external dependencies of the lambda function.
 // The example here demonstrates the case where the handler logic involves communicating with S3.
 type Handler struct {
-	slackClient  SlackClient
-	jiraClient   JiraClient
-	launchConfig LaunchConfig
+	slackClient SlackClient
+	jiraClient  JiraClient
+	config      Config
+	// policy overrides the embedded policy.yml
+	policy *Policy
+	// flushTraces exports the spans of a run before the Lambda is frozen
+	flushTraces func(context.Context) error
+	// auditSink is where runs record their changes, see startAudit
+	auditSink audit.Sink
+	audit     *audit.Logger
+	// recording saves the Slack and Jira traffic of each run, see HTTP_RECORDING
+	recording *recording
+	clock     Clock
 }
 
 type FailedChannel struct {
@@ -55,10 +85,20 @@ type FailedChannel struct {
 	Error string
 }
 
+// ManualChannel is a channel the cleanup can't act on by itself.
+type ManualChannel struct {
+	Name   string
+	ID     string
+	Reason string
+}
+
+// channelTypes are the conversations the cleanup scans. Private channels are only listed when the
+// bot is a member, or when the token can see them for another reason.
+var channelTypes = []string{"public_channel", "private_channel"}
+
 // Constants for the handler
 const (
 	defaultPageSize      = 200
-	jiraArchivedLabel    = "archived"
 	defaultRetryAttempts = 3
 	defaultRetryDelay    = 1 * time.Second
 	defaultPauseDuration = 3 * time.Second
@@ -68,133 +108,72 @@ const (
 func (h Handler) Handle(ctx context.Context) error {
 	// create a request-specific logger, attach it to ctx, and add the Lambda request ID.
 	ctx = logger.NewContext(ctx, logger.New(os.Getenv("APP_NAME")))
+	runID := audit.NewRunID()
 	if lambdaContext, ok := lambdacontext.FromContext(ctx); ok {
 		logger.FromContext(ctx).AddContext("aws-request-id", lambdaContext.AwsRequestID)
+		runID = lambdaContext.AwsRequestID
 	}
 
-	flareChannelPrefix := h.launchConfig.Env.FlareChannelPrefix
-	threshold, err := strconv.Atoi(h.launchConfig.Env.ChannelAgeThreshold)
+	ctx, span := tracer.Start(ctx, "cleanup", trace.WithAttributes(attribute.Bool("cleanup.dry_run", h.config.DryRun)))
+	defer h.flush(ctx)
+	h.startRecording()
+	defer h.saveRecording(ctx, runID)
+	h, err := h.startAudit(ctx, "flarebot-slack-cleanup", runID, h.config.DryRun)
 	if err != nil {
+		tracing.End(span, err)
 		return err
 	}
-	dryRun, err := strconv.ParseBool(h.launchConfig.Env.DryRun)
+	h = h.withContext(ctx)
+
+	start := h.clock.Now()
+	run, err := h.run(ctx, h.config.DryRun)
 	if err != nil {
+		tracing.End(span, err)
 		return err
 	}
-	logger.FromContext(ctx).InfoD("starting-cleanup", logger.M{"flareChannelPrefix": flareChannelPrefix, "threshold": threshold, "dryRun": dryRun})
-
-	var cursor string
-	failedChannels := []FailedChannel{}
-	for {
-		slkInput := &slk.GetConversationsParameters{
-			ExcludeArchived: "true",
-			Limit:           defaultPageSize,
-		}
-
-		if cursor != "" {
-			slkInput.Cursor = cursor
-		}
-
-		response, err := retrySlack(ctx, defaultRetryAttempts, defaultRetryDelay, func() (interface{}, error) {
-			channels, nextCursor, err := h.slackClient.GetConversations(slkInput)
-			if err != nil {
-				return nil, err
-			}
-			return &struct {
-				Channels   []slk.Channel
-				NextCursor string
-			}{channels, nextCursor}, nil
-		})
-		if err != nil {
-			return err
-		}
-
-		conversations := response.(*struct {
-			Channels   []slk.Channel
-			NextCursor string
-		})
-
-		for _, channel := range conversations.Channels {
-			if isFlareChannel(channel.Name, flareChannelPrefix) && isOlderThanThreshold(int64(channel.Created), threshold) {
-				logger.FromContext(ctx).DebugD("archiving-channel", logger.M{"channel": channel.Name})
-				if !dryRun {
-					err = h.cleanupSlackChannel(ctx, channel)
-					if err != nil {
-						failedChannels = append(failedChannels, FailedChannel{Name: channel.Name, ID: channel.ID, Error: err.Error()})
-						continue
-					}
-					// pause to avoid rate limiting
-					time.Sleep(defaultPauseDuration)
-				}
-			}
-		}
-
-		if conversations.NextCursor == "" {
-			break
-		}
-
-		cursor = conversations.NextCursor
-	}
-
-	if len(failedChannels) > 0 {
-		logger.FromContext(ctx).ErrorD("error-archiving-channels", logger.M{"channels": failedChannels})
-	}
-
-	return nil
+	span.SetAttributes(
+		attribute.Int("cleanup.channels", len(run.Channels)),
+		attribute.Int("cleanup.applied", len(run.withOutcome(outcomeApplied))),
+		attribute.Int("cleanup.failed", len(run.withOutcome(outcomeFailed))),
+	)
+	run.log(ctx, h.config.SharedChannelArchival)
+	run.emitMetrics(ctx, h.clock.Now().Sub(start))
+	// fail the invocation so Lambda error alarms and retries kick in
+	err = run.checkBudget(h.config.FailureBudget)
+	tracing.End(span, err)
+
+	return err
 }
 
-func (h Handler) cleanupSlackChannel(ctx context.Context, channel slk.Channel) error {
-	_, err := retrySlack(ctx, defaultRetryAttempts, defaultRetryDelay, func() (interface{}, error) {
-		err := h.slackClient.ArchiveConversation(channel.ID)
-
-		if err != nil && err.Error() == "not_in_channel" {
-			logger.FromContext(ctx).DebugD("joining-channel", logger.M{"channel": channel.Name})
-			_, joinErr := retrySlack(ctx, defaultRetryAttempts, defaultRetryDelay, func() (interface{}, error) {
-				_, _, _, joinErr := h.slackClient.JoinConversation(channel.ID)
-				return nil, joinErr
-			})
-			if joinErr != nil {
-				return nil, joinErr
-			}
-		}
-
-		return nil, err
-	})
-	if err != nil {
-		return err
+func (h Handler) flush(ctx context.Context) {
+	if h.flushTraces == nil {
+		return
 	}
-
-	ticket, err := h.jiraClient.GetTicketByKey(strings.ToUpper(channel.Name))
-	if err != nil {
-		return err
+	if err := h.flushTraces(ctx); err != nil {
+		logger.FromContext(ctx).ErrorD("error-flushing-traces", logger.M{"error": err.Error()})
 	}
+}
 
-	err = h.jiraClient.SetLabel(ticket, jiraArchivedLabel)
-	if err != nil {
-		return err
+func (h Handler) loadPolicy() (*Policy, error) {
+	if h.policy != nil {
+		return h.policy, nil
 	}
-	return nil
+	return parsePolicy(defaultPolicy)
 }
 
-func isOlderThanThreshold(timestamp int64, threshold int) bool {
+func isOlderThanThreshold(now time.Time, timestamp int64, threshold time.Duration) bool {
 	creationTime := time.Unix(timestamp, 0)
-	cutoffTime := time.Now().Add(-time.Duration(threshold) * 24 * time.Hour)
+	cutoffTime := now.Add(-threshold)
 	return creationTime.Before(cutoffTime)
 }
 
-func isFlareChannel(channelName, flareChannelPrefix string) bool {
-	pattern := "^" + regexp.QuoteMeta(flareChannelPrefix) + "\\d+$"
-	matched, err := regexp.MatchString(pattern, channelName)
-	if err != nil {
-		return false
-	}
-	return matched
-}
-
-func retrySlack(ctx context.Context, attempts int, sleep time.Duration, fn func() (interface{}, error)) (interface{}, error) {
+// retrySlack calls fn until it succeeds, waiting out rate limits and backing off from other
+// errors. It gives up early on permanent errors, and with ctx's error if ctx is done while waiting.
+func retrySlack(ctx context.Context, clock Clock, attempts int, sleep time.Duration, fn func() (interface{}, error)) (interface{}, error) {
 	var err error
 	for i := 0; i < attempts; i++ {
-		res, err := fn()
+		var res interface{}
+		res, err = fn()
 		if err == nil {
 			return res, nil
 		}
@@ -202,18 +181,64 @@ func retrySlack(ctx context.Context, attempts int, sleep time.Duration, fn func(
 		var te *slk.RateLimitedError
 		if errors.As(err, &te) {
 			logger.FromContext(ctx).InfoD("slack-ratelimit-error", logger.M{"error": err.Error()})
-			time.Sleep(te.RetryAfter)
+			if waits, ok := ctx.Value(rateLimitWaitsKey{}).(*int); ok {
+				*waits++
+			}
+			recordRetry(ctx, i+1, err)
+			if err := wait(ctx, clock, te.RetryAfter); err != nil {
+				return nil, err
+			}
 			continue
 		}
+		// Errors like channel_not_found or is_archived come back the same on every attempt, unknown
+		// ones are backed off from in case they clear up.
+		if classifyError(err) == errorClassPermanent {
+			return nil, err
+		}
 
 		if i < attempts-1 {
-			time.Sleep(sleep)
+			recordRetry(ctx, i+1, err)
+			if err := wait(ctx, clock, sleep); err != nil {
+				return nil, err
+			}
 			sleep *= 2
 		}
 	}
 	return nil, err
 }
 
+// newHandler returns a handler whose Slack and Jira clients send requests with httpClient, or
+// the default client when it's nil.
+func newHandler(config Config, httpClient *http.Client) Handler {
+	options := []slk.Option{}
+	if httpClient != nil {
+		options = append(options, slk.OptionHTTPClient(httpClient))
+	}
+	return Handler{
+		slackClient: slk.New(config.SlackBotToken, options...),
+		jiraClient: &jira.JiraServer{
+			Origin:     config.JiraOrigin,
+			Username:   config.JiraUsername,
+			Password:   config.JiraPassword,
+			HTTPClient: httpClient,
+		},
+		config: config,
+		clock:  realClock{},
+	}
+}
+
+// loadConfig reads the config from the environment and CONFIG_SOURCE, see configLoader.
+// overrides take precedence over both.
+func loadConfig(ctx context.Context, overrides map[string]string) (Config, error) {
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return Config{}, fmt.Errorf("loading AWS config: %w", err)
+	}
+	loader := newConfigLoader(ssm.NewFromConfig(awsConfig), secretsmanager.NewFromConfig(awsConfig))
+	loader.overrides = overrides
+	return loader.load(ctx)
+}
+
 func main() {
 	ctx := context.Background()
 	if err := logger.SetGlobalRoutingFromBytes(kvconfig); err != nil {
@@ -221,18 +246,31 @@ func main() {
 	}
 	lg := logger.FromContext(ctx)
 
-	launchConfig := InitLaunchConfig(nil)
-	slackClient := slk.New(launchConfig.Env.SlackBotToken)
-	jiraServer := jira.JiraServer{
-		Origin:   launchConfig.Env.JiraOrigin,
-		Username: launchConfig.Env.JiraUsername,
-		Password: launchConfig.Env.JiraPassword,
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(ctx, os.Args[1:], os.Stdout))
 	}
 
-	handler := Handler{
-		slackClient:  slackClient,
-		jiraClient:   &jiraServer,
-		launchConfig: launchConfig,
+	config, err := loadConfig(ctx, nil)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	recording, err := openRecording(ctx, config)
+	if err != nil {
+		log.Fatalf("Error opening recording: %v", err)
+	}
+	handler := newHandler(config, recording.client())
+	handler.recording = recording
+	exporter, err := tracing.NewExporter(ctx, config.TracesExporter)
+	if err != nil {
+		log.Fatalf("Error setting up tracing: %v", err)
+	}
+	handler.flushTraces, err = tracing.Install(exporter, serviceName)
+	if err != nil {
+		log.Fatalf("Error setting up tracing: %v", err)
+	}
+	handler.auditSink, err = openAuditSink(ctx, config)
+	if err != nil {
+		log.Fatalf("Error opening audit sink: %v", err)
 	}
 
 	if os.Getenv("IS_LOCAL") == "true" {
@@ -243,10 +281,6 @@ func main() {
 			os.Exit(1)
 		}
 	} else {
-		_, err := config.LoadDefaultConfig(ctx)
-		if err != nil {
-			log.Fatalf("Error loading AWS config: %v", err)
-		}
 		lambda.Start(handler.Handle)
 	}
 }
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
@@ -10,6 +15,11 @@ import (
 	"github.com/golang/mock/gomock"
 	slk "github.com/slack-go/slack"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/jira"
+	"github.com/Clever/flarebot/jira/jiratest"
+	"github.com/Clever/flarebot/slackutil/slacktest"
 )
 
 //go:generate mockgen -package main -destination mock.go -source main.go SlackClient,JiraClient
@@ -20,7 +30,10 @@ type handleInput struct {
 }
 
 type TestConfig struct {
-	DryRun bool `json:"dryRun"`
+	DryRun          bool   `json:"dryRun"`
+	ChannelMatchers string `json:"channelMatchers"`
+	// Settings are any other config values.
+	Settings map[string]string `json:"settings"`
 }
 
 type handleOutput struct {
@@ -34,15 +47,51 @@ type handleTest struct {
 	mockExpectations func(slackClient *MockSlackClient, jiraClient *MockJiraClient)
 }
 
-func TestHandle(t *testing.T) {
-	jiraKeyId := "FLARETEST-123"
+func namedChannel(name string) slk.Channel {
 	channel := slk.Channel{
 		GroupConversation: slk.GroupConversation{
-			Name: "flaretest-123",
+			Name: name,
 		},
 	}
 	channel.Conversation.Created = slk.JSONTime(1234567890)
-	launchConfig := LaunchConfig{Env: Environment{ChannelAgeThreshold: "180", FlareChannelPrefix: "flaretest-", DryRun: "false"}}
+	channel.IsMember = true
+	return channel
+}
+
+// newTestConfig parses a config with placeholder credentials, a flaretest- prefix and dry run off.
+func newTestConfig(t *testing.T, values map[string]string) Config {
+	settings := map[string]string{
+		"FLARE_CHANNEL_PREFIX": "flaretest-",
+		"DRY_RUN":              "false",
+		"JIRA_ORIGIN":          "https://clever.atlassian.net",
+		"JIRA_USERNAME":        "flarebot",
+		"JIRA_PASSWORD":        "password",
+		"SLACK_BOT_TOKEN":      "xoxb-token",
+	}
+	for key, value := range values {
+		settings[key] = value
+	}
+	config, err := parseConfig(settings)
+	require.NoError(t, err)
+	return config
+}
+
+func TestHandle(t *testing.T) {
+	jiraKeyId := "FLARETEST-123"
+	channel := namedChannel("flaretest-123")
+	renamed := namedChannel("flaretest-1234-db-outage")
+	security := namedChannel("secflare-7")
+	private := namedChannel("flaretest-456")
+	private.ID = "G456"
+	private.IsPrivate = true
+	private.IsMember = true
+	privateNotMember := private
+	privateNotMember.IsMember = false
+	shared := namedChannel("flaretest-789")
+	shared.ID = "C789"
+	shared.IsExtShared = true
+	notMember := channel
+	notMember.IsMember = false
 
 	tests := []handleTest{
 		{
@@ -57,7 +106,7 @@ func TestHandle(t *testing.T) {
 			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
 				slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{channel}, "", nil).Times(1)
 				slackClient.EXPECT().ArchiveConversation(channel.ID).Return(nil).Times(1)
-				jiraClient.EXPECT().GetTicketByKey(jiraKeyId).Return(nil, nil).Times(1)
+				jiraClient.EXPECT().GetTicketByKey(jiraKeyId).Return(&jira.Ticket{Key: jiraKeyId}, nil).Times(1)
 				jiraClient.EXPECT().SetLabel(gomock.Any(), "archived").Return(nil).Times(1)
 			},
 		},
@@ -84,12 +133,51 @@ func TestHandle(t *testing.T) {
 			output: handleOutput{
 				err: nil,
 			},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{notMember}, "", nil).Times(1)
+				gomock.InOrder(
+					slackClient.EXPECT().JoinConversation(channel.ID).Return(&channel, "", []string{}, nil).Times(1),
+					slackClient.EXPECT().ArchiveConversation(channel.ID).Return(nil).Times(1),
+				)
+				jiraClient.EXPECT().GetTicketByKey(jiraKeyId).Return(&jira.Ticket{Key: jiraKeyId}, nil).Times(1)
+				jiraClient.EXPECT().SetLabel(gomock.Any(), "archived").Return(nil).Times(1)
+			},
+		},
+		{
+			description: "test channels archived > stale membership in listing",
+			input: handleInput{
+				ctx:        context.Background(),
+				testConfig: TestConfig{DryRun: false},
+			},
+			output: handleOutput{
+				err: nil,
+			},
 			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
 				slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{channel}, "", nil).Times(1)
-				slackClient.EXPECT().ArchiveConversation(channel.ID).Return(errors.New("not_in_channel")).Times(1)
+				gomock.InOrder(
+					slackClient.EXPECT().ArchiveConversation(channel.ID).Return(slk.SlackErrorResponse{Err: "not_in_channel"}).Times(1),
+					slackClient.EXPECT().JoinConversation(channel.ID).Return(&channel, "", []string{}, nil).Times(1),
+					slackClient.EXPECT().ArchiveConversation(channel.ID).Return(nil).Times(1),
+				)
+				jiraClient.EXPECT().GetTicketByKey(jiraKeyId).Return(&jira.Ticket{Key: jiraKeyId}, nil).Times(1)
+				jiraClient.EXPECT().SetLabel(gomock.Any(), "archived").Return(nil).Times(1)
+			},
+		},
+		{
+			description: "test channels archived > archived channels aren't left",
+			input: handleInput{
+				ctx:        context.Background(),
+				testConfig: TestConfig{Settings: map[string]string{"LEAVE_JOINED_CHANNELS": "true"}},
+			},
+			output: handleOutput{
+				err: nil,
+			},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{notMember}, "", nil).Times(1)
 				slackClient.EXPECT().JoinConversation(channel.ID).Return(&channel, "", []string{}, nil).Times(1)
 				slackClient.EXPECT().ArchiveConversation(channel.ID).Return(nil).Times(1)
-				jiraClient.EXPECT().GetTicketByKey(jiraKeyId).Return(nil, nil).Times(1)
+				slackClient.EXPECT().LeaveConversation(gomock.Any()).Times(0)
+				jiraClient.EXPECT().GetTicketByKey(jiraKeyId).Return(&jira.Ticket{Key: jiraKeyId}, nil).Times(1)
 				jiraClient.EXPECT().SetLabel(gomock.Any(), "archived").Return(nil).Times(1)
 			},
 		},
@@ -109,10 +197,163 @@ func TestHandle(t *testing.T) {
 				}
 				slackClient.EXPECT().ArchiveConversation(channel.ID).Return(rlErr).Times(1)
 				slackClient.EXPECT().ArchiveConversation(channel.ID).Return(nil).Times(1)
-				jiraClient.EXPECT().GetTicketByKey(jiraKeyId).Return(nil, nil).Times(1)
+				jiraClient.EXPECT().GetTicketByKey(jiraKeyId).Return(&jira.Ticket{Key: jiraKeyId}, nil).Times(1)
+				jiraClient.EXPECT().SetLabel(gomock.Any(), "archived").Return(nil).Times(1)
+			},
+		},
+		{
+			description: "private channels the bot is in are archived",
+			input: handleInput{
+				ctx:        context.Background(),
+				testConfig: TestConfig{DryRun: false},
+			},
+			output: handleOutput{
+				err: nil,
+			},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().GetConversations(&slk.GetConversationsParameters{
+					ExcludeArchived: true,
+					Limit:           defaultPageSize,
+					Types:           []string{"public_channel", "private_channel"},
+				}).Return([]slk.Channel{private}, "", nil).Times(1)
+				slackClient.EXPECT().ArchiveConversation("G456").Return(nil).Times(1)
+				jiraClient.EXPECT().GetTicketByKey("FLARETEST-456").Return(&jira.Ticket{Key: "FLARETEST-456"}, nil).Times(1)
+				jiraClient.EXPECT().SetLabel(gomock.Any(), "archived").Return(nil).Times(1)
+			},
+		},
+		{
+			description: "private channels the bot isn't in need manual action",
+			input: handleInput{
+				ctx:        context.Background(),
+				testConfig: TestConfig{DryRun: false},
+			},
+			output: handleOutput{
+				err: nil,
+			},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{privateNotMember}, "", nil).Times(1)
+				slackClient.EXPECT().ArchiveConversation(gomock.Any()).Times(0)
+				slackClient.EXPECT().JoinConversation(gomock.Any()).Times(0)
+				jiraClient.EXPECT().GetTicketByKey(gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "shared channels are skipped by default",
+			input: handleInput{
+				ctx:        context.Background(),
+				testConfig: TestConfig{DryRun: false},
+			},
+			output: handleOutput{
+				err: nil,
+			},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{shared}, "", nil).Times(1)
+				slackClient.EXPECT().ArchiveConversation(gomock.Any()).Times(0)
+				jiraClient.EXPECT().SetLabel(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "shared channels that aren't approved wait for approval",
+			input: handleInput{
+				ctx: context.Background(),
+				testConfig: TestConfig{Settings: map[string]string{
+					"SHARED_CHANNEL_ARCHIVAL":  "approval",
+					"APPROVED_SHARED_CHANNELS": "flaretest-1",
+				}},
+			},
+			output: handleOutput{
+				err: nil,
+			},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{shared}, "", nil).Times(1)
+				slackClient.EXPECT().ArchiveConversation(gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "approved shared channels get a notice and are archived",
+			input: handleInput{
+				ctx: context.Background(),
+				testConfig: TestConfig{Settings: map[string]string{
+					"SHARED_CHANNEL_ARCHIVAL":  "approval",
+					"APPROVED_SHARED_CHANNELS": "#flaretest-789, C1",
+					"SHARED_CHANNEL_NOTICE":    "Archiving #{channel} for {key}",
+				}},
+			},
+			output: handleOutput{
+				err: nil,
+			},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{shared}, "", nil).Times(1)
+				gomock.InOrder(
+					slackClient.EXPECT().PostMessage("C789", gomock.Any()).Return("", "", nil).Times(1),
+					slackClient.EXPECT().ArchiveConversation("C789").Return(nil).Times(1),
+				)
+				jiraClient.EXPECT().GetTicketByKey("FLARETEST-789").Return(&jira.Ticket{Key: "FLARETEST-789"}, nil).Times(1)
+				jiraClient.EXPECT().SetLabel(gomock.Any(), "archived").Return(nil).Times(1)
+			},
+		},
+		{
+			description: "prefix matcher maps to its own project",
+			input: handleInput{
+				ctx:        context.Background(),
+				testConfig: TestConfig{ChannelMatchers: `[{"type": "prefix", "pattern": "flaretest-"}, {"type": "prefix", "pattern": "secflare-", "project": "SEC"}]`},
+			},
+			output: handleOutput{
+				err: nil,
+			},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{renamed, security}, "", nil).Times(1)
+				slackClient.EXPECT().ArchiveConversation(security.ID).Return(nil).Times(1)
+				jiraClient.EXPECT().GetTicketByKey("SEC-7").Return(&jira.Ticket{Key: "SEC-7"}, nil).Times(1)
+				jiraClient.EXPECT().SetLabel(gomock.Any(), "archived").Return(nil).Times(1)
+			},
+		},
+		{
+			description: "regex matcher takes the number from its capture group",
+			input: handleInput{
+				ctx:        context.Background(),
+				testConfig: TestConfig{ChannelMatchers: `[{"type": "regex", "pattern": "^flaretest-(\\d+)-[a-z-]+$", "project": "FLARETEST"}]`},
+			},
+			output: handleOutput{
+				err: nil,
+			},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{channel, renamed, security}, "", nil).Times(1)
+				slackClient.EXPECT().ArchiveConversation(renamed.ID).Return(nil).Times(1)
+				jiraClient.EXPECT().GetTicketByKey("FLARETEST-1234").Return(&jira.Ticket{Key: "FLARETEST-1234"}, nil).Times(1)
 				jiraClient.EXPECT().SetLabel(gomock.Any(), "archived").Return(nil).Times(1)
 			},
 		},
+		{
+			description: "glob matcher takes the first number in the name",
+			input: handleInput{
+				ctx:        context.Background(),
+				testConfig: TestConfig{ChannelMatchers: `[{"type": "glob", "pattern": "*flare-*", "project": "SEC"}]`},
+			},
+			output: handleOutput{
+				err: nil,
+			},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{channel, security}, "", nil).Times(1)
+				slackClient.EXPECT().ArchiveConversation(security.ID).Return(nil).Times(1)
+				jiraClient.EXPECT().GetTicketByKey("SEC-7").Return(&jira.Ticket{Key: "SEC-7"}, nil).Times(1)
+				jiraClient.EXPECT().SetLabel(gomock.Any(), "archived").Return(nil).Times(1)
+			},
+		},
+		{
+			description: "matcher threshold overrides the default",
+			input: handleInput{
+				ctx:        context.Background(),
+				testConfig: TestConfig{ChannelMatchers: `[{"type": "prefix", "pattern": "flaretest-", "threshold": "1000w"}]`},
+			},
+			output: handleOutput{
+				err: nil,
+			},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{channel}, "", nil).Times(1)
+				slackClient.EXPECT().ArchiveConversation(gomock.Any()).Times(0)
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
@@ -121,9 +362,276 @@ func TestHandle(t *testing.T) {
 			mockSlackClient := NewMockSlackClient(mockController)
 			mockJiraClient := NewMockJiraClient(mockController)
 			test.mockExpectations(mockSlackClient, mockJiraClient)
-			launchConfig.Env.DryRun = strconv.FormatBool(test.input.testConfig.DryRun)
-			err := Handler{slackClient: mockSlackClient, jiraClient: mockJiraClient, launchConfig: launchConfig}.Handle(test.input.ctx)
-			assert.Equal(t, test.output.err, err)
+			settings := map[string]string{
+				"DRY_RUN":          strconv.FormatBool(test.input.testConfig.DryRun),
+				"CHANNEL_MATCHERS": test.input.testConfig.ChannelMatchers,
+			}
+			for key, value := range test.input.testConfig.Settings {
+				settings[key] = value
+			}
+			config := newTestConfig(t, settings)
+			err := Handler{slackClient: mockSlackClient, jiraClient: mockJiraClient, config: config, clock: newFakeClock(time.Now())}.Handle(test.input.ctx)
+			if test.output.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.output.err.Error())
+			}
 		})
 	}
 }
+
+func TestArchiveRuleResolvesTicket(t *testing.T) {
+	channel := slk.Channel{}
+	channel.ID = "C123"
+	channel.Name = "flaretest-123-renamed"
+	channel.IsMember = true
+	config := Config{JiraSlackChannelFieldID: "customfield_12345", SlackOrigin: "https://clever.slack.com"}
+
+	tests := []struct {
+		description      string
+		err              error
+		mockExpectations func(slackClient *MockSlackClient, jiraClient *MockJiraClient)
+	}{
+		{
+			description: "labels the ticket that links the channel",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ArchiveConversation("C123").Return(nil).Times(1)
+				jiraClient.EXPECT().SearchTickets(`cf[12345] = "https://clever.slack.com/archives/C123"`, gomock.Any()).Return([]jira.Ticket{{Key: "FLARETEST-123"}}, nil).Times(1)
+				jiraClient.EXPECT().GetTicketByKey(gomock.Any()).Times(0)
+				jiraClient.EXPECT().SetLabel(&jira.Ticket{Key: "FLARETEST-123"}, "archived").Return(nil).Times(1)
+			},
+		},
+		{
+			description: "falls back to the channel name",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ArchiveConversation("C123").Return(nil).Times(1)
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{}, nil).Times(1)
+				jiraClient.EXPECT().GetTicketByKey("FLARETEST-123-RENAMED").Return(&jira.Ticket{Key: "INCIDENT-4"}, nil).Times(1)
+				jiraClient.EXPECT().SetLabel(&jira.Ticket{Key: "INCIDENT-4"}, "archived").Return(nil).Times(1)
+			},
+		},
+		{
+			description: "fails when no ticket can be found",
+			err:         errors.New("label: no ticket links channel C123 and looking up FLARETEST-123-RENAMED failed: Status-code:404"),
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ArchiveConversation("C123").Return(nil).Times(1)
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{}, nil).Times(1)
+				jiraClient.EXPECT().GetTicketByKey("FLARETEST-123-RENAMED").Return(nil, errors.New("Status-code:404")).Times(1)
+				jiraClient.EXPECT().SetLabel(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mockController := gomock.NewController(t)
+			defer mockController.Finish()
+			mockSlackClient := NewMockSlackClient(mockController)
+			mockJiraClient := NewMockJiraClient(mockController)
+			test.mockExpectations(mockSlackClient, mockJiraClient)
+			h := Handler{slackClient: mockSlackClient, jiraClient: mockJiraClient, config: config, clock: newFakeClock(time.Now())}
+			policy, err := h.loadPolicy()
+			assert.NoError(t, err)
+			c := &flareChannel{ctx: context.Background(), handler: h, channel: channel, key: "FLARETEST-123-RENAMED"}
+			err = h.runActions(context.Background(), c, &policy.Rules[0])
+			if test.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.err.Error())
+			}
+		})
+	}
+}
+
+func TestHandleWithFakeJira(t *testing.T) {
+	jiraServer := jiratest.NewServer(t)
+	jiraServer.AddIssue(jira.Ticket{Key: "FLARETEST-1", Fields: jira.TicketFields{
+		Labels: []string{"sev1"},
+		CustomFields: map[string]json.RawMessage{
+			"customfield_12345": json.RawMessage(`"https://clever.slack.com/archives/C1"`),
+		},
+	}})
+	jiraServer.AddIssue(jira.Ticket{Key: "FLARETEST-3"})
+	jiraServer.InjectFault(jiratest.Fault{Path: "/rest/api/2/issue/FLARETEST-3", Status: http.StatusServiceUnavailable})
+
+	linked := namedChannel("flaretest-1")
+	linked.ID = "C1"
+	missing := namedChannel("flaretest-2")
+	missing.ID = "C2"
+	unavailable := namedChannel("flaretest-3")
+	unavailable.ID = "C3"
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	slackClient := NewMockSlackClient(mockController)
+	slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{linked, missing, unavailable}, "", nil).Times(1)
+	slackClient.EXPECT().ArchiveConversation(gomock.Any()).Return(nil).Times(3)
+
+	config := newTestConfig(t, map[string]string{
+		"JIRA_ORIGIN":                 jiraServer.URL,
+		"JIRA_USERNAME":               jiratest.Username,
+		"JIRA_PASSWORD":               jiratest.Password,
+		"JIRA_SLACK_CHANNEL_FIELD_ID": "customfield_12345",
+		"SLACK_ORIGIN":                "https://clever.slack.com",
+		"FAILURE_BUDGET":              "0",
+	})
+	h := Handler{slackClient: slackClient, jiraClient: jiraServer.Client(), config: config, clock: newFakeClock(time.Now())}
+	err := h.Handle(context.Background())
+
+	var runErr *RunError
+	require.True(t, errors.As(err, &runErr), "expected a RunError, got %v", err)
+	assert.Equal(t, map[string]int{errorClassPermanent: 1, errorClassTransient: 1}, runErr.Classes())
+	ticket, _ := jiraServer.Issue("FLARETEST-1")
+	assert.Equal(t, []string{"sev1", "archived"}, ticket.Fields.Labels)
+	ticket, _ = jiraServer.Issue("FLARETEST-3")
+	assert.Empty(t, ticket.Fields.Labels)
+}
+
+func TestHandleWithFakeWorkspace(t *testing.T) {
+	workspace := slacktest.NewServer(t)
+	// one channel a page, so the cleanup has to follow cursors
+	workspace.MaxPageSize = 1
+	member := namedChannel("flaretest-1")
+	member.ID = "C1"
+	workspace.AddChannel(member)
+	notMember := namedChannel("flaretest-2")
+	notMember.ID = "C2"
+	notMember.IsMember = false
+	workspace.AddChannel(notMember)
+	hidden := namedChannel("flaretest-3")
+	hidden.ID = "G3"
+	hidden.IsPrivate = true
+	hidden.IsMember = false
+	workspace.AddChannel(hidden)
+	general := namedChannel("general")
+	general.ID = "C4"
+	workspace.AddChannel(general)
+	workspace.InjectFault(slacktest.Fault{Method: "conversations.archive", Status: http.StatusTooManyRequests, Times: 1})
+
+	jiraServer := jiratest.NewServer(t)
+	jiraServer.AddIssue(jira.Ticket{Key: "FLARETEST-1"})
+	jiraServer.AddIssue(jira.Ticket{Key: "FLARETEST-2"})
+
+	config := newTestConfig(t, map[string]string{
+		"JIRA_ORIGIN":   jiraServer.URL,
+		"JIRA_USERNAME": jiratest.Username,
+		"JIRA_PASSWORD": jiratest.Password,
+	})
+	h := Handler{slackClient: workspace.Client(), jiraClient: jiraServer.Client(), config: config, clock: newFakeClock(time.Now())}
+	require.NoError(t, h.Handle(context.Background()))
+
+	for _, id := range []string{"C1", "C2"} {
+		channel, _ := workspace.Channel(id)
+		assert.True(t, channel.IsArchived, "%s should be archived", channel.Name)
+	}
+	for _, id := range []string{"G3", "C4"} {
+		channel, _ := workspace.Channel(id)
+		assert.False(t, channel.IsArchived, "%s should be left alone", channel.Name)
+	}
+	channel, _ := workspace.Channel("C2")
+	assert.Equal(t, []string{slacktest.BotUserID}, channel.Members)
+	for _, key := range []string{"FLARETEST-1", "FLARETEST-2"} {
+		ticket, _ := jiraServer.Issue(key)
+		assert.Equal(t, []string{"archived"}, ticket.Fields.Labels)
+	}
+}
+
+func TestRecordAndReplayRun(t *testing.T) {
+	workspace := slacktest.NewServer(t)
+	channel := namedChannel("flaretest-1")
+	channel.ID = "C1"
+	workspace.AddChannel(channel)
+	jiraServer := jiratest.NewServer(t)
+	jiraServer.AddIssue(jira.Ticket{Key: "FLARETEST-1"})
+
+	path := filepath.Join(t.TempDir(), "run.json")
+	config := newTestConfig(t, map[string]string{
+		"JIRA_ORIGIN":     jiraServer.URL,
+		"JIRA_USERNAME":   jiratest.Username,
+		"JIRA_PASSWORD":   jiratest.Password,
+		"SLACK_BOT_TOKEN": slacktest.Token,
+		"HTTP_RECORDING":  "file:" + path,
+	})
+	recording, err := openRecording(context.Background(), config)
+	require.NoError(t, err)
+	h := newHandler(config, recording.client())
+	h.slackClient = slk.New(config.SlackBotToken, slk.OptionAPIURL(workspace.URL+"/api/"), slk.OptionHTTPClient(recording.client()))
+	h.recording = recording
+	h.clock = newFakeClock(time.Now())
+	require.NoError(t, h.Handle(context.Background()))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), slacktest.Token)
+	assert.NotContains(t, string(data), jiratest.Password)
+
+	// the services are gone, the replay runs against the cassette alone
+	workspace.Close()
+	jiraServer.Close()
+	config.JiraOrigin = "http://jira.invalid"
+	replayed, replayer, err := replayHandler(config, path)
+	require.NoError(t, err)
+	require.NoError(t, replayed.Handle(context.Background()))
+	assert.Empty(t, replayer.Unused())
+}
+
+func TestReplayCommand(t *testing.T) {
+	workspace := slacktest.NewServer(t)
+	channel := namedChannel("flaretest-1")
+	channel.ID = "C1"
+	workspace.AddChannel(channel)
+	jiraServer := jiratest.NewServer(t)
+	jiraServer.AddIssue(jira.Ticket{Key: "FLARETEST-1"})
+
+	path := filepath.Join(t.TempDir(), "run.json")
+	config := newTestConfig(t, map[string]string{
+		"JIRA_ORIGIN":     jiraServer.URL,
+		"JIRA_USERNAME":   jiratest.Username,
+		"JIRA_PASSWORD":   jiratest.Password,
+		"SLACK_BOT_TOKEN": slacktest.Token,
+		"HTTP_RECORDING":  "file:" + path,
+	})
+	recording, err := openRecording(context.Background(), config)
+	require.NoError(t, err)
+	h := newHandler(config, recording.client())
+	h.slackClient = slk.New(config.SlackBotToken, slk.OptionAPIURL(workspace.URL+"/api/"), slk.OptionHTTPClient(recording.client()))
+	h.recording = recording
+	h.clock = newFakeClock(time.Now())
+	require.NoError(t, h.Handle(context.Background()))
+	workspace.Close()
+	jiraServer.Close()
+
+	// the command line replay gets no credentials or origins, only the cassette
+	var out bytes.Buffer
+	code := runCommand(context.Background(), []string{"run", "-replay", path, "-prefix", "flaretest-", "-dry-run=false"}, &out)
+	assert.Equal(t, 0, code, out.String())
+	assert.NotContains(t, out.String(), "weren't replayed")
+}
+
+func TestParseMatchers(t *testing.T) {
+	matchers, err := parseMatchers("", "flare-", 180*24*time.Hour)
+	assert.NoError(t, err)
+	if assert.Len(t, matchers, 1) {
+		assert.Equal(t, "FLARE", matchers[0].Project)
+		assert.Equal(t, 180*24*time.Hour, matchers[0].threshold)
+	}
+
+	matcher, key, ok := matchChannel(matchers, "flare-123")
+	assert.True(t, ok)
+	assert.Equal(t, "FLARE-123", key)
+	assert.Equal(t, "flare-", matcher.Pattern)
+	for _, name := range []string{"flare-123-db", "flare-", "general", "secflare-1"} {
+		_, _, ok := matchChannel(matchers, name)
+		assert.False(t, ok, name)
+	}
+
+	for _, invalid := range []string{
+		`not json`,
+		`[{"type": "prefix"}]`,
+		`[{"type": "suffix", "pattern": "-flare"}]`,
+		`[{"type": "regex", "pattern": "(", "project": "FLARE"}]`,
+		`[{"type": "glob", "pattern": "[", "project": "FLARE"}]`,
+		`[{"type": "prefix", "pattern": "flare-", "threshold": "soon"}]`,
+	} {
+		_, err := parseMatchers(invalid, "flare-", time.Hour)
+		assert.Error(t, err, invalid)
+	}
+}
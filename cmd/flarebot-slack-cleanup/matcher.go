@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Clever/flarebot/duration"
+)
+
+// Matcher types accepted in CHANNEL_MATCHERS.
+const (
+	matcherPrefix = "prefix"
+	matcherRegex  = "regex"
+	matcherGlob   = "glob"
+)
+
+var digitsRegex = regexp.MustCompile(`\d+`)
+
+// ChannelMatcher decides which channels are flare channels and which Jira project their ticket
+// is in. CHANNEL_MATCHERS holds a JSON list of them, e.g.
+//
+//	[{"type": "prefix", "pattern": "flare-", "project": "FLARE", "threshold": "180d"},
+//	 {"type": "glob", "pattern": "flare-*-*", "project": "FLARE"},
+//	 {"type": "regex", "pattern": "^secflare-(\\d+)", "project": "SECFLARE", "threshold": "365d"}]
+type ChannelMatcher struct {
+	// Type is prefix, regex or glob.
+	//   - prefix matches the prefix followed by the ticket number only, e.g. flare-123.
+	//   - regex takes the ticket number from the first capture group, or the first number in
+	//     the name when the pattern has no groups.
+	//   - glob uses path.Match syntax and takes the first number in the name.
+	Type    string `json:"type"`
+	Pattern string `json:"pattern"`
+	// Project is the Jira project key of the tickets. Prefix matchers default to the prefix
+	// without its trailing dash, e.g. flare- is FLARE.
+	Project string `json:"project"`
+	// Threshold is how old a channel has to be before it is archived. Defaults to
+	// CHANNEL_AGE_THRESHOLD.
+	Threshold string `json:"threshold"`
+
+	regex     *regexp.Regexp
+	threshold time.Duration
+}
+
+// parseMatchers reads CHANNEL_MATCHERS. An empty value keeps the original behavior of a single
+// prefix matcher for FLARE_CHANNEL_PREFIX.
+func parseMatchers(raw string, defaultPrefix string, defaultThreshold time.Duration) ([]ChannelMatcher, error) {
+	matchers := []ChannelMatcher{}
+	if strings.TrimSpace(raw) == "" {
+		matchers = append(matchers, ChannelMatcher{Type: matcherPrefix, Pattern: defaultPrefix})
+	} else if err := json.Unmarshal([]byte(raw), &matchers); err != nil {
+		return nil, fmt.Errorf("invalid CHANNEL_MATCHERS: %w", err)
+	}
+
+	for i := range matchers {
+		if err := matchers[i].init(defaultThreshold); err != nil {
+			return nil, fmt.Errorf("invalid channel matcher %d: %w", i, err)
+		}
+	}
+	return matchers, nil
+}
+
+func (m *ChannelMatcher) init(defaultThreshold time.Duration) error {
+	if m.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+
+	var err error
+	switch m.Type {
+	case matcherPrefix:
+		m.regex = regexp.MustCompile("^" + regexp.QuoteMeta(m.Pattern) + `(\d+)$`)
+		if m.Project == "" {
+			m.Project = strings.ToUpper(strings.TrimRight(m.Pattern, "-_"))
+		}
+	case matcherRegex:
+		if m.regex, err = regexp.Compile(m.Pattern); err != nil {
+			return err
+		}
+	case matcherGlob:
+		if _, err = path.Match(m.Pattern, ""); err != nil {
+			return fmt.Errorf("%w: %s", err, m.Pattern)
+		}
+	default:
+		return fmt.Errorf("unknown type %q, expected %s, %s or %s", m.Type, matcherPrefix, matcherRegex, matcherGlob)
+	}
+	if m.Project == "" {
+		return fmt.Errorf("project is required for %s matchers", m.Type)
+	}
+
+	m.threshold = defaultThreshold
+	if m.Threshold != "" {
+		if m.threshold, err = duration.Parse(m.Threshold); err != nil {
+			return fmt.Errorf("invalid threshold: %w", err)
+		}
+	}
+	return nil
+}
+
+// match returns the ticket key for a matching channel name.
+func (m ChannelMatcher) match(name string) (string, bool) {
+	number := ""
+	switch m.Type {
+	case matcherPrefix, matcherRegex:
+		matches := m.regex.FindStringSubmatch(name)
+		if matches == nil {
+			return "", false
+		}
+		if len(matches) > 1 {
+			number = matches[1]
+		} else {
+			number = digitsRegex.FindString(name)
+		}
+	case matcherGlob:
+		if ok, _ := path.Match(m.Pattern, name); !ok {
+			return "", false
+		}
+		number = digitsRegex.FindString(name)
+	}
+	if number == "" {
+		return "", false
+	}
+	return m.Project + "-" + number, true
+}
+
+// matchChannel returns the first matcher that accepts the channel name and the ticket key it maps to.
+func matchChannel(matchers []ChannelMatcher, name string) (ChannelMatcher, string, bool) {
+	for _, m := range matchers {
+		if key, ok := m.match(name); ok {
+			return m, key, true
+		}
+	}
+	return ChannelMatcher{}, "", false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Clever/kayvee-go/v7/logger"
+)
+
+// Reasons a flare channel was left open, reported in the cleanup-channels-skipped metric.
+const (
+	skipNoRule    = "no-rule"
+	skipKeepRule  = "keep-rule"
+	skipDryRun    = "dry-run"
+	skipPrivate   = "private-channel"
+	skipShared    = "shared-channel"
+	skipNoArchive = "rule-does-not-archive"
+)
+
+var skipReasons = []string{skipNoRule, skipKeepRule, skipDryRun, skipPrivate, skipShared, skipNoArchive}
+
+type rateLimitWaitsKey struct{}
+
+// skipReason returns why a channel was left open, or "" if it was archived or failed.
+func skipReason(result ChannelResult) string {
+	switch result.Outcome {
+	case outcomeKept:
+		if result.Rule == "" {
+			return skipNoRule
+		}
+		return skipKeepRule
+	case outcomeCandidate, outcomeUnknown:
+		return skipDryRun
+	case outcomeManual:
+		return skipPrivate
+	case outcomeNeedsApproval:
+		return skipShared
+	case outcomeApplied:
+		if !result.Archived {
+			return skipNoArchive
+		}
+	}
+	return ""
+}
+
+// emitMetrics logs the counts of a run as kayvee metrics, see kvconfig.yml. Every count is
+// emitted, zeros included, so a cleanup that stops archiving anything can be alerted on.
+func (r *Run) emitMetrics(ctx context.Context, duration time.Duration) {
+	lg := logger.FromContext(ctx)
+	dryRun := strconv.FormatBool(r.DryRun)
+
+	archived := 0
+	failed := map[string]int{}
+	skipped := map[string]int{}
+	for _, channel := range r.Channels {
+		if channel.Archived {
+			archived++
+		}
+		if channel.Outcome == outcomeFailed {
+			failed[channel.ErrorClass]++
+		}
+		if reason := skipReason(channel); reason != "" {
+			skipped[reason]++
+		}
+	}
+
+	lg.CounterD("cleanup-channels-scanned", len(r.Channels), logger.M{"dryRun": dryRun})
+	lg.CounterD("cleanup-channels-archived", archived, logger.M{"dryRun": dryRun})
+	for _, class := range errorClasses {
+		lg.CounterD("cleanup-channels-failed", failed[class], logger.M{"dryRun": dryRun, "class": class})
+	}
+	for _, reason := range skipReasons {
+		lg.CounterD("cleanup-channels-skipped", skipped[reason], logger.M{"dryRun": dryRun, "reason": reason})
+	}
+	lg.CounterD("cleanup-ratelimit-waits", r.rateLimitWaits, logger.M{"dryRun": dryRun})
+	lg.GaugeFloatD("cleanup-run-duration", duration.Seconds(), logger.M{"dryRun": dryRun})
+}
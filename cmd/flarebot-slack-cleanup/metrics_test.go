@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Clever/kayvee-go/v7/logger"
+	"github.com/Clever/kayvee-go/v7/router"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipReason(t *testing.T) {
+	for _, test := range []struct {
+		result ChannelResult
+		reason string
+	}{
+		{ChannelResult{Outcome: outcomeKept}, skipNoRule},
+		{ChannelResult{Outcome: outcomeKept, Rule: "keep-pinned"}, skipKeepRule},
+		{ChannelResult{Outcome: outcomeCandidate, Rule: "archive-past-threshold"}, skipDryRun},
+		{ChannelResult{Outcome: outcomeManual}, skipPrivate},
+		{ChannelResult{Outcome: outcomeNeedsApproval, Rule: "archive-past-threshold"}, skipShared},
+		{ChannelResult{Outcome: outcomeApplied, Rule: "warn"}, skipNoArchive},
+		{ChannelResult{Outcome: outcomeApplied, Rule: "archive-past-threshold", Archived: true}, ""},
+		{ChannelResult{Outcome: outcomeFailed, Rule: "archive-past-threshold", Archived: true}, ""},
+	} {
+		assert.Equal(t, test.reason, skipReason(test.result), test.result)
+	}
+}
+
+func TestEmitMetrics(t *testing.T) {
+	run := &Run{Channels: []ChannelResult{
+		{Name: "flaretest-1", Outcome: outcomeApplied, Rule: "archive-past-threshold", Archived: true},
+		{Name: "flaretest-2", Outcome: outcomeFailed, Rule: "archive-past-threshold", ErrorClass: errorClassTransient},
+		{Name: "flaretest-3", Outcome: outcomeKept},
+	}, rateLimitWaits: 2}
+
+	// every metric is routed by kvconfig.yml
+	routes, err := router.NewFromConfigBytes(kvconfig)
+	require.NoError(t, err)
+	mock := logger.NewMockCountLogger("flarebot-slack-cleanup")
+	mock.SetRouter(routes)
+	run.emitMetrics(logger.NewContext(context.Background(), mock), time.Minute)
+	assert.Equal(t, map[string]int{"cleanup-metrics": 4, "cleanup-failed-metrics": len(errorClasses), "cleanup-skipped-metrics": len(skipReasons)}, mock.RuleCounts())
+
+	var out bytes.Buffer
+	lg := logger.New("flarebot-slack-cleanup")
+	lg.SetOutput(&out)
+	run.emitMetrics(logger.NewContext(context.Background(), lg), time.Minute)
+	values := map[string]float64{}
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var metric struct {
+			Title  string  `json:"title"`
+			Reason string  `json:"reason"`
+			Class  string  `json:"class"`
+			Value  float64 `json:"value"`
+		}
+		require.NoError(t, decoder.Decode(&metric))
+		if metric.Reason != "" {
+			metric.Title += "." + metric.Reason
+		}
+		if metric.Class != "" {
+			metric.Title += "." + metric.Class
+		}
+		values[metric.Title] = metric.Value
+	}
+	assert.Equal(t, map[string]float64{
+		"cleanup-channels-scanned":                       3,
+		"cleanup-channels-archived":                      1,
+		"cleanup-channels-failed.transient":              1,
+		"cleanup-channels-failed.permanent":              0,
+		"cleanup-channels-failed.unknown":                0,
+		"cleanup-channels-skipped.no-rule":               1,
+		"cleanup-channels-skipped.keep-rule":             0,
+		"cleanup-channels-skipped.dry-run":               0,
+		"cleanup-channels-skipped.private-channel":       0,
+		"cleanup-channels-skipped.shared-channel":        0,
+		"cleanup-channels-skipped.rule-does-not-archive": 0,
+		"cleanup-ratelimit-waits":                        2,
+		"cleanup-run-duration":                           60,
+	}, values)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+func writeResults(w io.Writer, format string, results []ChannelResult) error {
+	switch format {
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "CHANNEL\tTICKET\tOUTCOME\tRULE\tDETAIL\n")
+		for _, result := range results {
+			detail := result.Reason
+			if result.Error != "" {
+				detail = result.Error
+			}
+			fmt.Fprintf(tw, "#%s\t%s\t%s\t%s\t%s\n", result.Name, dash(result.Key), result.Outcome, dash(result.Rule), dash(detail))
+		}
+		return tw.Flush()
+	case formatJSON:
+		return writeJSON(w, results)
+	default:
+		return unknownFormat(format)
+	}
+}
+
+func writeSummary(w io.Writer, format string, summary Summary) error {
+	switch format {
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		run := "run"
+		if summary.DryRun {
+			run = "dry run"
+		}
+		fmt.Fprintf(tw, "Flare channels:\t%d (%s)\n", summary.Channels, run)
+		fmt.Fprintf(tw, "\nOUTCOME\tCHANNELS\n")
+		for _, outcome := range sortedKeys(summary.Outcomes) {
+			fmt.Fprintf(tw, "%s\t%d\n", outcome, summary.Outcomes[outcome])
+		}
+		if len(summary.Rules) > 0 {
+			fmt.Fprintf(tw, "\nRULE\tCHANNELS\n")
+			for _, rule := range sortedKeys(summary.Rules) {
+				fmt.Fprintf(tw, "%s\t%d\n", rule, summary.Rules[rule])
+			}
+		}
+		return tw.Flush()
+	case formatJSON:
+		return writeJSON(w, summary)
+	default:
+		return unknownFormat(format)
+	}
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func unknownFormat(format string) error {
+	return fmt.Errorf("unknown format %q, expected one of %s, %s", format, formatTable, formatJSON)
+}
+
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Clever/flarebot/duration"
+	"github.com/Clever/flarebot/flare"
+)
+
+// Action types a rule can run.
+const (
+	actionKeep    = "keep"
+	actionWarn    = "warn"
+	actionArchive = "archive"
+	actionRename  = "rename"
+	actionExport  = "export"
+	actionComment = "comment"
+	actionLabel   = "label"
+)
+
+// defaultWarnEvery is how often a warn action repeats in the same channel when it sets no interval.
+const defaultWarnEvery = 7 * 24 * time.Hour
+
+// Policy decides what happens to each flare channel. Rules are checked in order and the first
+// rule whose conditions all hold runs its actions; channels no rule matches are left alone.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule runs its actions on channels that meet every condition.
+type Rule struct {
+	Name    string     `yaml:"name"`
+	When    Conditions `yaml:"when"`
+	Actions []Action   `yaml:"actions"`
+}
+
+// Conditions are all optional. Unset conditions always hold, so a rule without any matches
+// every channel.
+type Conditions struct {
+	// PastThreshold holds when the channel is older than its matcher's threshold.
+	PastThreshold *bool `yaml:"pastThreshold"`
+	// OlderThan and InactiveFor take durations like "30d". Inactivity is measured from the
+	// last message that isn't a cleanup warning.
+	OlderThan   string `yaml:"olderThan"`
+	InactiveFor string `yaml:"inactiveFor"`
+	// MaxMembers holds when the channel has at most this many members.
+	MaxMembers *int `yaml:"maxMembers"`
+	// Pinned holds when a pinned message in the channel contains this text.
+	Pinned string `yaml:"pinned"`
+	// JiraStatus and JiraPriority hold when the ticket has one of the listed values. Priorities
+	// are written like "P2".
+	JiraStatus   []string `yaml:"jiraStatus"`
+	JiraPriority []string `yaml:"jiraPriority"`
+	// JiraLabels holds when the ticket has all of the labels, JiraLabelsAbsent when it has none.
+	JiraLabels       []string `yaml:"jiraLabels"`
+	JiraLabelsAbsent []string `yaml:"jiraLabelsAbsent"`
+
+	olderThan   time.Duration
+	inactiveFor time.Duration
+}
+
+// Action is one step of a rule. Text fields may use {channel} and {key}, which are replaced
+// with the channel name and ticket key.
+type Action struct {
+	Type string `yaml:"type"`
+	// Message is the text for warn and comment.
+	Message string `yaml:"message"`
+	// Every is the minimum time between warnings in the same channel. Defaults to 7d.
+	Every string `yaml:"every"`
+	// Name is the new channel name for rename.
+	Name string `yaml:"name"`
+	// Label is the Jira label for label.
+	Label string `yaml:"label"`
+
+	every time.Duration
+}
+
+// parsePolicy decodes and validates a policy file, reporting every problem at once so a policy
+// change can be fixed in one pass.
+func parsePolicy(data []byte) (*Policy, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	policy := &Policy{}
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+
+	problems := []error{}
+	if len(policy.Rules) == 0 {
+		problems = append(problems, errors.New("policy has no rules"))
+	}
+	names := map[string]bool{}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		prefix := fmt.Sprintf("rule %d", i)
+		if rule.Name != "" {
+			prefix = fmt.Sprintf("rule %q", rule.Name)
+		}
+		if rule.Name == "" {
+			problems = append(problems, fmt.Errorf("%s: name is required", prefix))
+		} else if names[rule.Name] {
+			problems = append(problems, fmt.Errorf("%s: name is used by an earlier rule", prefix))
+		}
+		names[rule.Name] = true
+
+		for _, err := range rule.When.init() {
+			problems = append(problems, fmt.Errorf("%s: %w", prefix, err))
+		}
+		if len(rule.Actions) == 0 {
+			problems = append(problems, fmt.Errorf("%s: at least one action is required, use %q to leave channels alone", prefix, actionKeep))
+		}
+		for j := range rule.Actions {
+			if err := rule.Actions[j].init(); err != nil {
+				problems = append(problems, fmt.Errorf("%s: action %d: %w", prefix, j, err))
+			}
+		}
+	}
+	if err := errors.Join(problems...); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (c *Conditions) init() []error {
+	problems := []error{}
+	var err error
+	if c.OlderThan != "" {
+		if c.olderThan, err = duration.Parse(c.OlderThan); err != nil {
+			problems = append(problems, fmt.Errorf("olderThan: %w", err))
+		}
+	}
+	if c.InactiveFor != "" {
+		if c.inactiveFor, err = duration.Parse(c.InactiveFor); err != nil {
+			problems = append(problems, fmt.Errorf("inactiveFor: %w", err))
+		}
+	}
+	if c.MaxMembers != nil && *c.MaxMembers < 0 {
+		problems = append(problems, errors.New("maxMembers must not be negative"))
+	}
+	return problems
+}
+
+func (a *Action) init() error {
+	switch a.Type {
+	case actionKeep, actionArchive, actionExport:
+	case actionWarn:
+		if a.Message == "" {
+			return errors.New("warn needs a message")
+		}
+		a.every = defaultWarnEvery
+		if a.Every != "" {
+			every, err := duration.Parse(a.Every)
+			if err != nil {
+				return fmt.Errorf("every: %w", err)
+			}
+			a.every = every
+		}
+	case actionComment:
+		if a.Message == "" {
+			return errors.New("comment needs a message")
+		}
+	case actionRename:
+		if a.Name == "" {
+			return errors.New("rename needs a name")
+		}
+	case actionLabel:
+		if a.Label == "" {
+			return errors.New("label needs a label")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", a.Type)
+	}
+	return nil
+}
+
+// keepsChannel reports whether the rule only exists to leave channels alone.
+func (r *Rule) keepsChannel() bool {
+	for _, action := range r.Actions {
+		if action.Type != actionKeep {
+			return false
+		}
+	}
+	return true
+}
+
+// archives reports whether the rule archives channels.
+func (r *Rule) archives() bool {
+	for _, action := range r.Actions {
+		if action.Type == actionArchive {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleResult records why a rule did or didn't match a channel.
+type RuleResult struct {
+	Rule    string `json:"rule"`
+	Matched bool   `json:"matched"`
+	// Reason is the first condition that failed, or a summary of the conditions that held.
+	Reason string `json:"reason"`
+}
+
+// evaluate returns the first matching rule, or nil, along with the result of every rule checked.
+func (p *Policy) evaluate(facts ChannelFacts) (*Rule, []RuleResult, error) {
+	results := []RuleResult{}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		matched, reason, err := rule.When.check(facts)
+		if err != nil {
+			return nil, results, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		results = append(results, RuleResult{Rule: rule.Name, Matched: matched, Reason: reason})
+		if matched {
+			return rule, results, nil
+		}
+	}
+	return nil, results, nil
+}
+
+// ChannelFacts is what conditions can ask about a channel. Anything that needs an API call is
+// only looked up when a condition needs it.
+type ChannelFacts interface {
+	Age() time.Duration
+	PastThreshold() bool
+	Members() int
+	Inactive() (time.Duration, error)
+	Pins() ([]string, error)
+	Ticket() (*TicketFacts, error)
+}
+
+// TicketFacts are the Jira fields conditions can check.
+type TicketFacts struct {
+	Status   string
+	Priority string
+	Labels   []string
+}
+
+// check tries the conditions from cheapest to most expensive and stops at the first that fails.
+func (c Conditions) check(facts ChannelFacts) (bool, string, error) {
+	held := []string{}
+
+	if c.PastThreshold != nil {
+		if facts.PastThreshold() != *c.PastThreshold {
+			return false, fmt.Sprintf("pastThreshold is %t", facts.PastThreshold()), nil
+		}
+		held = append(held, fmt.Sprintf("pastThreshold is %t", *c.PastThreshold))
+	}
+	if c.OlderThan != "" {
+		if age := facts.Age(); age < c.olderThan {
+			return false, fmt.Sprintf("channel is %s old, not older than %s", flare.FormatDuration(age), c.OlderThan), nil
+		}
+		held = append(held, "older than "+c.OlderThan)
+	}
+	if c.MaxMembers != nil {
+		if members := facts.Members(); members > *c.MaxMembers {
+			return false, fmt.Sprintf("channel has %d members, more than %d", members, *c.MaxMembers), nil
+		}
+		held = append(held, fmt.Sprintf("at most %d members", *c.MaxMembers))
+	}
+	if c.InactiveFor != "" {
+		inactive, err := facts.Inactive()
+		if err != nil {
+			return false, "", err
+		}
+		if inactive < c.inactiveFor {
+			return false, fmt.Sprintf("last activity was %s ago, not %s", flare.FormatDuration(inactive), c.InactiveFor), nil
+		}
+		held = append(held, "inactive for "+c.InactiveFor)
+	}
+	if c.Pinned != "" {
+		pins, err := facts.Pins()
+		if err != nil {
+			return false, "", err
+		}
+		if !containsText(pins, c.Pinned) {
+			return false, fmt.Sprintf("no pinned message contains %q", c.Pinned), nil
+		}
+		held = append(held, fmt.Sprintf("pinned %q", c.Pinned))
+	}
+
+	if len(c.JiraStatus) > 0 || len(c.JiraPriority) > 0 || len(c.JiraLabels) > 0 || len(c.JiraLabelsAbsent) > 0 {
+		ticket, err := facts.Ticket()
+		if err != nil {
+			return false, "", err
+		}
+		if len(c.JiraStatus) > 0 && !containsFold(c.JiraStatus, ticket.Status) {
+			return false, fmt.Sprintf("ticket status is %q", ticket.Status), nil
+		}
+		if len(c.JiraPriority) > 0 && !containsFold(c.JiraPriority, ticket.Priority) {
+			return false, fmt.Sprintf("ticket priority is %q", ticket.Priority), nil
+		}
+		for _, label := range c.JiraLabels {
+			if !containsFold(ticket.Labels, label) {
+				return false, fmt.Sprintf("ticket has no %q label", label), nil
+			}
+		}
+		for _, label := range c.JiraLabelsAbsent {
+			if containsFold(ticket.Labels, label) {
+				return false, fmt.Sprintf("ticket has the %q label", label), nil
+			}
+		}
+		held = append(held, "ticket matches")
+	}
+
+	if len(held) == 0 {
+		return true, "rule has no conditions", nil
+	}
+	return true, strings.Join(held, ", "), nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsText(texts []string, text string) bool {
+	for _, t := range texts {
+		if strings.Contains(t, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// expand fills in the {channel} and {key} placeholders of action text.
+func expand(text, channelName, key string) string {
+	return strings.NewReplacer("{channel}", channelName, "{key}", key).Replace(text)
+}
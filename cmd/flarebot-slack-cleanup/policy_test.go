@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	slk "github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/jira"
+)
+
+type fakeFacts struct {
+	age           time.Duration
+	pastThreshold bool
+	members       int
+	inactive      time.Duration
+	pins          []string
+	ticket        *TicketFacts
+	ticketLookups int
+}
+
+func (f *fakeFacts) Age() time.Duration               { return f.age }
+func (f *fakeFacts) PastThreshold() bool              { return f.pastThreshold }
+func (f *fakeFacts) Members() int                     { return f.members }
+func (f *fakeFacts) Inactive() (time.Duration, error) { return f.inactive, nil }
+func (f *fakeFacts) Pins() ([]string, error)          { return f.pins, nil }
+func (f *fakeFacts) Ticket() (*TicketFacts, error) {
+	f.ticketLookups++
+	if f.ticket == nil {
+		return nil, errors.New("no ticket")
+	}
+	return f.ticket, nil
+}
+
+const testPolicy = `
+rules:
+  - name: keep-pinned
+    when:
+      pinned: "flarebot: keep"
+    actions:
+      - type: keep
+  - name: archive-closed
+    when:
+      olderThan: 30d
+      inactiveFor: 14d
+      jiraStatus: [Mitigated, NotAFlare]
+      jiraLabelsAbsent: [legal-hold]
+    actions:
+      - type: export
+      - type: comment
+        message: "Archived #{channel} after two weeks without activity"
+      - type: archive
+      - type: label
+        label: archived
+  - name: warn-quiet
+    when:
+      inactiveFor: 7d
+      maxMembers: 50
+    actions:
+      - type: warn
+        message: "#{channel} will be archived once {key} is mitigated and the channel is quiet"
+        every: 3d
+`
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := parsePolicy(defaultPolicy)
+	require.NoError(t, err)
+	assert.Len(t, policy.Rules, 1)
+
+	policy, err = parsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+	assert.Equal(t, 30*24*time.Hour, policy.Rules[1].When.olderThan)
+	assert.Equal(t, 3*24*time.Hour, policy.Rules[2].Actions[0].every)
+
+	_, err = parsePolicy([]byte(`
+rules:
+  - name: bad
+    when:
+      olderThan: soon
+    actions:
+      - type: delete
+  - name: bad
+    actions: []
+  - when: {}
+    actions:
+      - type: warn
+`))
+	require.Error(t, err)
+	assert.Equal(t, strings.Join([]string{
+		`rule "bad": olderThan: time: invalid duration "soon"`,
+		`rule "bad": action 0: unknown type "delete"`,
+		`rule "bad": name is used by an earlier rule`,
+		`rule "bad": at least one action is required, use "keep" to leave channels alone`,
+		`rule 2: name is required`,
+		`rule 2: action 0: warn needs a message`,
+	}, "\n"), err.Error())
+
+	_, err = parsePolicy([]byte("rules:\n  - name: typo\n    when:\n      olderthan: 30d\n    actions:\n      - type: keep\n"))
+	assert.ErrorContains(t, err, "field olderthan not found")
+
+	_, err = parsePolicy([]byte("rules: []"))
+	assert.EqualError(t, err, "policy has no rules")
+}
+
+func TestEvaluate(t *testing.T) {
+	policy, err := parsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+
+	tests := []struct {
+		description   string
+		facts         *fakeFacts
+		rule          string
+		reasons       []string
+		ticketLookups int
+	}{
+		{
+			description: "pinned channels are kept",
+			facts:       &fakeFacts{age: 90 * 24 * time.Hour, pins: []string{"flarebot: keep, still investigating"}},
+			rule:        "keep-pinned",
+			reasons:     []string{`pinned "flarebot: keep"`},
+		},
+		{
+			description:   "quiet closed flares are archived",
+			facts:         &fakeFacts{age: 90 * 24 * time.Hour, inactive: 20 * 24 * time.Hour, ticket: &TicketFacts{Status: "Mitigated"}},
+			rule:          "archive-closed",
+			reasons:       []string{`no pinned message contains "flarebot: keep"`, "older than 30d, inactive for 14d, ticket matches"},
+			ticketLookups: 1,
+		},
+		{
+			description:   "open flares are warned instead",
+			facts:         &fakeFacts{age: 90 * 24 * time.Hour, inactive: 20 * 24 * time.Hour, members: 10, ticket: &TicketFacts{Status: "In Progress"}},
+			rule:          "warn-quiet",
+			reasons:       []string{`no pinned message contains "flarebot: keep"`, `ticket status is "In Progress"`, "at most 50 members, inactive for 7d"},
+			ticketLookups: 1,
+		},
+		{
+			description: "young channels don't need the ticket",
+			facts:       &fakeFacts{age: 24 * time.Hour, inactive: time.Hour, members: 3},
+			reasons:     []string{`no pinned message contains "flarebot: keep"`, "channel is 1d0h old, not older than 30d", "last activity was 1h00m ago, not 7d"},
+		},
+		{
+			description:   "legal holds are left alone",
+			facts:         &fakeFacts{age: 90 * 24 * time.Hour, inactive: 20 * 24 * time.Hour, members: 80, ticket: &TicketFacts{Status: "Mitigated", Labels: []string{"Legal-Hold"}}},
+			reasons:       []string{`no pinned message contains "flarebot: keep"`, `ticket has the "legal-hold" label`, "channel has 80 members, more than 50"},
+			ticketLookups: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			rule, results, err := policy.evaluate(test.facts)
+			require.NoError(t, err)
+			if test.rule == "" {
+				assert.Nil(t, rule)
+			} else if assert.NotNil(t, rule) {
+				assert.Equal(t, test.rule, rule.Name)
+			}
+			reasons := []string{}
+			for _, result := range results {
+				reasons = append(reasons, result.Reason)
+			}
+			assert.Equal(t, test.reasons, reasons)
+			assert.Equal(t, test.ticketLookups, test.facts.ticketLookups)
+		})
+	}
+
+	_, _, err = policy.evaluate(&fakeFacts{age: 90 * 24 * time.Hour, inactive: 20 * 24 * time.Hour})
+	assert.EqualError(t, err, `rule "archive-closed": no ticket`)
+}
+
+func TestHandlePolicyActions(t *testing.T) {
+	policy, err := parsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+
+	now := time.Now()
+	channel := namedChannel("flaretest-9")
+	channel.ID = "C9"
+	channel.NumMembers = 5
+	ticket := &jira.Ticket{Key: "FLARETEST-9", Fields: jira.TicketFields{Status: jira.Status{Name: "Mitigated"}}}
+	history := func(ago time.Duration) *slk.GetConversationHistoryResponse {
+		message := slk.Message{}
+		message.Timestamp = strconv.FormatInt(now.Add(-ago).Unix(), 10) + ".000100"
+		return &slk.GetConversationHistoryResponse{Messages: []slk.Message{message}}
+	}
+
+	tests := []struct {
+		description      string
+		notMember        bool
+		settings         map[string]string
+		mockExpectations func(slackClient *MockSlackClient, jiraClient *MockJiraClient)
+	}{
+		{
+			description: "keep rule leaves the channel alone",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ListPins("C9").Return([]slk.Item{{Message: &slk.Message{Msg: slk.Msg{Text: "flarebot: keep"}}}}, nil, nil).Times(1)
+				slackClient.EXPECT().ArchiveConversation(gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "channels the bot isn't in are joined to read their facts and left again",
+			notMember:   true,
+			settings:    map[string]string{"LEAVE_JOINED_CHANNELS": "true"},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				gomock.InOrder(
+					slackClient.EXPECT().JoinConversation("C9").Return(&channel, "", nil, nil).Times(1),
+					slackClient.EXPECT().ListPins("C9").Return([]slk.Item{{Message: &slk.Message{Msg: slk.Msg{Text: "flarebot: keep"}}}}, nil, nil).Times(1),
+					slackClient.EXPECT().LeaveConversation("C9").Return(false, nil).Times(1),
+				)
+			},
+		},
+		{
+			description: "dry runs don't join channels the bot isn't in",
+			notMember:   true,
+			settings:    map[string]string{"DRY_RUN": "true"},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().JoinConversation(gomock.Any()).Times(0)
+				slackClient.EXPECT().ListPins(gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "dry runs don't join when Slack says the bot isn't in the channel",
+			settings:    map[string]string{"DRY_RUN": "true"},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ListPins("C9").Return(nil, nil, slk.SlackErrorResponse{Err: "not_in_channel"}).Times(1)
+				slackClient.EXPECT().JoinConversation(gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "reads join the channel when Slack says the bot isn't in it",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				gomock.InOrder(
+					slackClient.EXPECT().ListPins("C9").Return(nil, nil, slk.SlackErrorResponse{Err: "not_in_channel"}).Times(1),
+					slackClient.EXPECT().JoinConversation("C9").Return(&channel, "", nil, nil).Times(1),
+					slackClient.EXPECT().ListPins("C9").Return(nil, nil, nil).Times(1),
+				)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(history(time.Hour), nil).Times(1)
+			},
+		},
+		{
+			description: "archive rule exports, comments, archives and labels",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ListPins("C9").Return(nil, nil, nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(history(20*24*time.Hour), nil).Times(2)
+				jiraClient.EXPECT().GetTicketByKey("FLARETEST-9").Return(ticket, nil).Times(1)
+				jiraClient.EXPECT().AddAttachment(ticket, "flaretest-9-history.json", gomock.Any()).Return(nil).Times(1)
+				jiraClient.EXPECT().AddComment(ticket, "Archived #flaretest-9 after two weeks without activity").Return(nil).Times(1)
+				slackClient.EXPECT().ArchiveConversation("C9").Return(nil).Times(1)
+				jiraClient.EXPECT().SetLabel(ticket, "archived").Return(nil).Times(1)
+			},
+		},
+		{
+			description: "warn rule posts a warning",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ListPins("C9").Return(nil, nil, nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(history(8*24*time.Hour), nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{}, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C9", gomock.Any()).Return("", "", nil).Times(1)
+			},
+		},
+		{
+			description: "warn rule joins the channel to post",
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ListPins("C9").Return(nil, nil, nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(history(8*24*time.Hour), nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{}, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C9", gomock.Any()).Return("", "", slk.SlackErrorResponse{Err: "not_in_channel"}).Times(1)
+				slackClient.EXPECT().JoinConversation("C9").Return(&channel, "", nil, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C9", gomock.Any()).Return("", "", nil).Times(1)
+			},
+		},
+		{
+			description: "warn rule leaves the channel it joined",
+			notMember:   true,
+			settings:    map[string]string{"LEAVE_JOINED_CHANNELS": "true"},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ListPins("C9").Return(nil, nil, nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(history(8*24*time.Hour), nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{}, nil).Times(1)
+				gomock.InOrder(
+					slackClient.EXPECT().JoinConversation("C9").Return(&channel, "", nil, nil).Times(1),
+					slackClient.EXPECT().PostMessage("C9", gomock.Any()).Return("", "", nil).Times(1),
+					slackClient.EXPECT().LeaveConversation("C9").Return(false, nil).Times(1),
+				)
+			},
+		},
+		{
+			description: "channels the bot was already in aren't left",
+			settings:    map[string]string{"LEAVE_JOINED_CHANNELS": "true"},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				slackClient.EXPECT().ListPins("C9").Return(nil, nil, nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(history(8*24*time.Hour), nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{}, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C9", gomock.Any()).Return("", "", nil).Times(1)
+				slackClient.EXPECT().LeaveConversation(gomock.Any()).Times(0)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mockController := gomock.NewController(t)
+			defer mockController.Finish()
+			mockSlackClient := NewMockSlackClient(mockController)
+			mockJiraClient := NewMockJiraClient(mockController)
+			listed := channel
+			listed.IsMember = !test.notMember
+			mockSlackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{listed}, "", nil).Times(1)
+			test.mockExpectations(mockSlackClient, mockJiraClient)
+			h := Handler{slackClient: mockSlackClient, jiraClient: mockJiraClient, config: newTestConfig(t, test.settings), policy: policy, clock: newFakeClock(now)}
+			assert.NoError(t, h.Handle(context.Background()))
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	slackClient := NewMockSlackClient(mockController)
+	jiraClient := NewMockJiraClient(mockController)
+
+	policy, err := parsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+	channel := namedChannel("flaretest-9")
+	channel.ID = "C9"
+	channel.NumMembers = 5
+
+	slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{namedChannel("general"), channel}, "", nil).Times(1)
+	slackClient.EXPECT().ListPins("C9").Return(nil, nil, nil).Times(1)
+	slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(&slk.GetConversationHistoryResponse{}, nil).Times(1)
+	jiraClient.EXPECT().GetTicketByKey("FLARETEST-9").Return(&jira.Ticket{Key: "FLARETEST-9", Fields: jira.TicketFields{Status: jira.Status{Name: "In Progress"}}}, nil).Times(1)
+
+	config := newTestConfig(t, nil)
+	h := Handler{slackClient: slackClient, jiraClient: jiraClient, config: config, policy: policy, clock: newFakeClock(time.Now())}
+	var out bytes.Buffer
+	require.NoError(t, h.explain(context.Background(), &out, "#flaretest-9"))
+
+	assert.Equal(t, `#flaretest-9 maps to FLARETEST-9 (prefix matcher "flaretest-")
+  skipped  keep-pinned: no pinned message contains "flarebot: keep"
+  skipped  archive-closed: ticket status is "In Progress"
+  FIRED    warn-quiet: at most 50 members, inactive for 7d
+actions:
+  warn at most every 72h0m0s: "#flaretest-9 will be archived once FLARETEST-9 is mitigated and the channel is quiet"
+`, out.String())
+}
+
+func TestExplainDoesNotJoin(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	slackClient := NewMockSlackClient(mockController)
+
+	policy, err := parsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+	channel := namedChannel("flaretest-9")
+	channel.ID = "C9"
+	channel.IsMember = false
+
+	slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{channel}, "", nil).Times(1)
+	slackClient.EXPECT().JoinConversation(gomock.Any()).Times(0)
+
+	h := Handler{slackClient: slackClient, config: newTestConfig(t, nil), policy: policy, clock: newFakeClock(time.Now())}
+	var out bytes.Buffer
+	require.NoError(t, h.explain(context.Background(), &out, "#flaretest-9"))
+	assert.Contains(t, out.String(), "#flaretest-9 can't be checked further: ")
+	assert.Contains(t, out.String(), errNeedsJoin.Error())
+}
+
+func TestValidateCommand(t *testing.T) {
+	var out bytes.Buffer
+	assert.Equal(t, 0, runCommand(context.Background(), []string{"validate"}, &out))
+	assert.Equal(t, "policy is valid: 1 rules\n  archive-past-threshold\n", out.String())
+
+	out.Reset()
+	assert.Equal(t, 1, runCommand(context.Background(), []string{"validate", "-policy", "missing.yml"}, &out))
+	assert.Contains(t, out.String(), "no such file")
+
+	out.Reset()
+	assert.Equal(t, 2, runCommand(context.Background(), []string{"explain"}, &out))
+	assert.Contains(t, out.String(), "usage:")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Clever/kayvee-go/v7/logger"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/Clever/flarebot/audit"
+	"github.com/Clever/flarebot/httprecord"
+)
+
+// recording saves the Slack and Jira traffic of each run to HTTP_RECORDING, so a run that
+// misbehaved can be replayed locally with the -replay flag.
+type recording struct {
+	recorder *httprecord.Recorder
+	kind     string
+	location string
+	s3       audit.S3Client
+}
+
+// openRecording returns the recording for HTTP_RECORDING, or nil if it isn't set. Credentials
+// from the config are redacted from the cassettes.
+func openRecording(ctx context.Context, config Config) (*recording, error) {
+	kind, location, err := audit.ParseSink(config.HTTPRecording)
+	if err != nil || kind == "" {
+		return nil, err
+	}
+	r := &recording{
+		recorder: httprecord.NewRecorder(nil, config.JiraPassword, config.SlackBotToken),
+		kind:     kind,
+		location: location,
+	}
+	if kind == "s3" {
+		if r.s3, err = newS3Client(ctx, config); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// client is the HTTP client the Slack and Jira clients should use, nil to use the default.
+func (r *recording) client() *http.Client {
+	if r == nil {
+		return nil
+	}
+	return r.recorder.Client()
+}
+
+// save writes what was recorded since the last save. File recordings are overwritten by each
+// run, S3 recordings are saved under <prefix>/<date>/<run ID>.json.
+func (r *recording) save(ctx context.Context, runID string) error {
+	cassette := r.recorder.Cassette()
+	r.recorder.Reset()
+	data, err := cassette.Marshal()
+	if err != nil {
+		return err
+	}
+	if r.kind == "file" {
+		return os.WriteFile(r.location, data, 0o644)
+	}
+	bucket, prefix, _ := strings.Cut(r.location, "/")
+	key := path.Join(prefix, cassette.RecordedAt.Format("2006-01-02"), runID+".json")
+	_, err = r.s3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// saveRecording saves the run's traffic, if it's being recorded. Failing to save doesn't fail
+// the run, the recording is only for debugging.
+func (h Handler) saveRecording(ctx context.Context, runID string) {
+	if h.recording == nil {
+		return
+	}
+	if err := h.recording.save(ctx, runID); err != nil {
+		logger.FromContext(ctx).ErrorD("error-saving-recording", logger.M{"error": err.Error()})
+	}
+}
+
+// startRecording drops traffic recorded before the run, e.g. by a previous Lambda invocation
+// whose recording couldn't be saved.
+func (h Handler) startRecording() {
+	if h.recording != nil {
+		h.recording.recorder.Reset()
+	}
+}
+
+// replayHandler returns a handler whose Slack and Jira clients answer from a cassette. Its clock
+// starts when the cassette was recorded, so channel ages come out the same, and doesn't wait
+// for rate limits or pauses that already happened.
+func replayHandler(config Config, path string) (Handler, *httprecord.Replayer, error) {
+	cassette, err := httprecord.Load(path)
+	if err != nil {
+		return Handler{}, nil, err
+	}
+	replayer := httprecord.NewReplayer(cassette, config.JiraPassword, config.SlackBotToken)
+	handler := newHandler(config, replayer.Client())
+	handler.clock = newFakeClock(cassette.RecordedAt)
+	return handler, replayer, nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Clever/flarebot/tracing"
+	"github.com/Clever/kayvee-go/v7/logger"
+
+	slk "github.com/slack-go/slack"
+)
+
+// Outcomes of a channel in a cleanup run.
+const (
+	// outcomeKept channels matched no rule, or a keep rule.
+	outcomeKept = "kept"
+	// outcomeCandidate channels matched a rule whose actions weren't run because of dry run.
+	outcomeCandidate = "candidate"
+	outcomeApplied   = "applied"
+	outcomeFailed    = "failed"
+	// outcomeManual channels are private channels the bot isn't in.
+	outcomeManual = "manual"
+	// outcomeNeedsApproval channels are shared channels a rule would archive.
+	outcomeNeedsApproval = "needs-approval"
+	// outcomeUnknown channels couldn't be checked in a dry run because the bot isn't in them.
+	outcomeUnknown = "unknown"
+)
+
+// Run is what a cleanup run decided for every flare channel.
+type Run struct {
+	DryRun   bool            `json:"dryRun"`
+	Channels []ChannelResult `json:"channels"`
+
+	// rateLimitWaits counts the times Slack rate limited the run
+	rateLimitWaits int
+}
+
+// ChannelResult is the outcome of one flare channel.
+type ChannelResult struct {
+	Name    string `json:"name"`
+	ID      string `json:"id"`
+	Key     string `json:"key"`
+	Rule    string `json:"rule,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+	// ErrorClass is transient, permanent or unknown for failed channels, see classifyError.
+	ErrorClass string `json:"errorClass,omitempty"`
+	// Archived is set when the channel was archived, even if a later action failed.
+	Archived bool `json:"archived,omitempty"`
+}
+
+// run checks every open flare channel against the policy and, unless dryRun is set, runs the
+// actions of the rule that fires. The Lambda and the cleanup commands share it.
+func (h Handler) run(ctx context.Context, dryRun bool) (*Run, error) {
+	policy, err := h.loadPolicy()
+	if err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).InfoD("starting-cleanup", logger.M{"matchers": h.config.Matchers, "dryRun": dryRun, "rules": len(policy.Rules)})
+
+	run := &Run{DryRun: dryRun, Channels: []ChannelResult{}}
+	ctx = context.WithValue(ctx, rateLimitWaitsKey{}, &run.rateLimitWaits)
+	err = h.forEachChannel(ctx, true, func(channel slk.Channel) {
+		matcher, key, ok := matchChannel(h.config.Matchers, channel.Name)
+		if !ok {
+			return
+		}
+		ctx, span, h := h.startChannel(ctx, channel, key)
+		c := &flareChannel{ctx: ctx, handler: h, channel: channel, key: key, matcher: matcher, now: h.clock.Now(), readOnly: dryRun}
+		result := h.runChannel(ctx, c, policy, dryRun)
+		endChannel(span, result)
+		if result != nil {
+			run.Channels = append(run.Channels, *result)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// runChannel decides and applies the policy for one channel. It returns nil for private
+// channels the bot isn't in that aren't past their threshold yet.
+func (h Handler) runChannel(ctx context.Context, c *flareChannel, policy *Policy, dryRun bool) *ChannelResult {
+	result := &ChannelResult{Name: c.channel.Name, ID: c.channel.ID, Key: c.key}
+	if needsMember(c.channel) {
+		// the bot can't read or join the channel, so the policy can't be checked
+		if !c.PastThreshold() {
+			return nil
+		}
+		result.Outcome = outcomeManual
+		result.Reason = errPrivateChannel.Error()
+		return result
+	}
+	// reading the channel's facts can join it too, so leave again whatever the outcome
+	defer h.leave(ctx, c)
+
+	rule, results, err := policy.evaluate(c)
+	if errors.Is(err, errNeedsJoin) {
+		result.Outcome = outcomeUnknown
+		result.Reason = err.Error()
+		return result
+	}
+	if err != nil {
+		result.fail(err)
+		return result
+	}
+	if rule == nil {
+		result.Outcome = outcomeKept
+		result.Reason = "no rule fired"
+		return result
+	}
+	result.Rule = rule.Name
+	result.Reason = results[len(results)-1].Reason
+	if rule.keepsChannel() {
+		result.Outcome = outcomeKept
+		return result
+	}
+	if rule.archives() && isShared(c.channel) && !h.config.approvedForArchival(c.channel) {
+		// skip the whole rule so its other actions don't run on a channel that stays open
+		result.Outcome = outcomeNeedsApproval
+		result.Reason = errSharedChannel.Error()
+		return result
+	}
+
+	logger.FromContext(ctx).DebugD("applying-rule", logger.M{"channel": c.channel.Name, "key": c.key, "matcher": c.matcher.Pattern, "rule": rule.Name})
+	if dryRun {
+		result.Outcome = outcomeCandidate
+		if err := h.recordPlanned(ctx, c, rule); err != nil {
+			result.fail(err)
+		}
+		return result
+	}
+	err = h.runActions(ctx, c, rule)
+	result.Archived = c.archived
+	if err != nil {
+		result.fail(err)
+		return result
+	}
+	result.Outcome = outcomeApplied
+	// pause to avoid rate limiting
+	h.clock.Sleep(defaultPauseDuration)
+	return result
+}
+
+// endChannel records the outcome on the channel's span and ends it.
+func endChannel(span trace.Span, result *ChannelResult) {
+	if result == nil {
+		span.End()
+		return
+	}
+	span.SetAttributes(attribute.String("cleanup.outcome", result.Outcome))
+	if result.Rule != "" {
+		span.SetAttributes(attribute.String("cleanup.rule", result.Rule))
+	}
+	var err error
+	if result.Error != "" {
+		err = errors.New(result.Error)
+	}
+	tracing.End(span, err)
+}
+
+// forEachChannel calls fn for every channel the cleanup scans, page by page.
+func (h Handler) forEachChannel(ctx context.Context, excludeArchived bool, fn func(slk.Channel)) error {
+	var cursor string
+	for {
+		slkInput := &slk.GetConversationsParameters{
+			ExcludeArchived: excludeArchived,
+			Limit:           defaultPageSize,
+			Types:           channelTypes,
+		}
+
+		if cursor != "" {
+			slkInput.Cursor = cursor
+		}
+
+		response, err := retrySlack(ctx, h.clock, defaultRetryAttempts, defaultRetryDelay, func() (interface{}, error) {
+			channels, nextCursor, err := h.slackClient.GetConversations(slkInput)
+			if err != nil {
+				return nil, err
+			}
+			return &struct {
+				Channels   []slk.Channel
+				NextCursor string
+			}{channels, nextCursor}, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		conversations := response.(*struct {
+			Channels   []slk.Channel
+			NextCursor string
+		})
+
+		for _, channel := range conversations.Channels {
+			fn(channel)
+		}
+
+		if conversations.NextCursor == "" {
+			return nil
+		}
+
+		cursor = conversations.NextCursor
+	}
+}
+
+// withOutcome returns the channels with one of the outcomes.
+func (r *Run) withOutcome(outcomes ...string) []ChannelResult {
+	channels := []ChannelResult{}
+	for _, channel := range r.Channels {
+		for _, outcome := range outcomes {
+			if channel.Outcome == outcome {
+				channels = append(channels, channel)
+			}
+		}
+	}
+	return channels
+}
+
+// log reports the channels that need attention.
+func (r *Run) log(ctx context.Context, sharedChannelArchival string) {
+	failedChannels := map[string][]FailedChannel{}
+	for _, channel := range r.withOutcome(outcomeFailed) {
+		failedChannels[channel.ErrorClass] = append(failedChannels[channel.ErrorClass], FailedChannel{Name: channel.Name, ID: channel.ID, Error: channel.Error})
+	}
+	// unknown errors kept failing through the retries, so they're treated like permanent ones
+	if failed := append(failedChannels[errorClassPermanent], failedChannels[errorClassUnknown]...); len(failed) > 0 {
+		logger.FromContext(ctx).ErrorD("error-archiving-channels", logger.M{"channels": failed})
+	}
+	if failed := failedChannels[errorClassTransient]; len(failed) > 0 {
+		// these usually clear up by the next run, so they're alerted on separately
+		logger.FromContext(ctx).WarnD("transient-errors-archiving-channels", logger.M{"channels": failed})
+	}
+	if shared := manualChannels(r.withOutcome(outcomeNeedsApproval)); len(shared) > 0 {
+		logger.FromContext(ctx).WarnD("shared-channels-need-approval", logger.M{"channels": shared, "mode": sharedChannelArchival})
+	}
+	if manual := manualChannels(r.withOutcome(outcomeManual)); len(manual) > 0 {
+		logger.FromContext(ctx).WarnD("channels-need-manual-action", logger.M{"channels": manual})
+	}
+}
+
+func manualChannels(results []ChannelResult) []ManualChannel {
+	channels := []ManualChannel{}
+	for _, result := range results {
+		channels = append(channels, ManualChannel{Name: result.Name, ID: result.ID, Reason: result.Reason})
+	}
+	return channels
+}
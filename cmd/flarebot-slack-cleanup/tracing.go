@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Clever/flarebot/jira"
+	"github.com/Clever/flarebot/tracing"
+
+	slk "github.com/slack-go/slack"
+)
+
+var tracer = otel.Tracer("github.com/Clever/flarebot/cmd/flarebot-slack-cleanup")
+
+// serviceName names the cleanup's spans.
+const serviceName = "flarebot-slack-cleanup"
+
+// withContext returns a copy of the handler whose Slack and Jira calls are traced as children of
+// the span in ctx.
+func (h Handler) withContext(ctx context.Context) Handler {
+	client := h.slackClient
+	if traced, ok := client.(tracedSlackClient); ok {
+		client = traced.client
+	}
+	h.slackClient = tracedSlackClient{client: client, ctx: ctx}
+	if server, ok := h.jiraClient.(*jira.JiraServer); ok {
+		h.jiraClient = server.WithContext(ctx)
+	}
+	return h
+}
+
+// startChannel starts the span for processing one channel and binds the handler to it.
+func (h Handler) startChannel(ctx context.Context, channel slk.Channel, key string) (context.Context, trace.Span, Handler) {
+	ctx, span := tracer.Start(ctx, "cleanup.channel", trace.WithAttributes(
+		attribute.String("slack.channel.name", channel.Name),
+		attribute.String("slack.channel.id", channel.ID),
+		attribute.String("jira.key", key),
+	))
+	ctx = context.WithValue(ctx, retriesKey{}, new(int))
+	return ctx, span, h.withContext(ctx)
+}
+
+type retriesKey struct{}
+
+// recordRetry adds a retry event to the span in ctx and counts the retries of the channel being
+// processed in its retry.count attribute.
+func recordRetry(ctx context.Context, attempt int, err error) {
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt), attribute.String("error", err.Error())))
+	if count, ok := ctx.Value(retriesKey{}).(*int); ok {
+		*count++
+		span.SetAttributes(attribute.Int("retry.count", *count))
+	}
+}
+
+// tracedSlackClient records a span for every Slack call.
+type tracedSlackClient struct {
+	client SlackClient
+	ctx    context.Context
+}
+
+func (c tracedSlackClient) start(method, channelID string) trace.Span {
+	_, span := tracer.Start(c.ctx, "slack "+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("slack.method", method),
+	))
+	if channelID != "" {
+		span.SetAttributes(attribute.String("slack.channel.id", channelID))
+	}
+	return span
+}
+
+func (c tracedSlackClient) ArchiveConversation(channelID string) error {
+	span := c.start("conversations.archive", channelID)
+	err := c.client.ArchiveConversation(channelID)
+	tracing.End(span, err)
+	return err
+}
+
+func (c tracedSlackClient) UnArchiveConversation(channelID string) error {
+	span := c.start("conversations.unarchive", channelID)
+	err := c.client.UnArchiveConversation(channelID)
+	tracing.End(span, err)
+	return err
+}
+
+func (c tracedSlackClient) JoinConversation(channelID string) (*slk.Channel, string, []string, error) {
+	span := c.start("conversations.join", channelID)
+	channel, warning, warnings, err := c.client.JoinConversation(channelID)
+	tracing.End(span, err)
+	return channel, warning, warnings, err
+}
+
+func (c tracedSlackClient) LeaveConversation(channelID string) (bool, error) {
+	span := c.start("conversations.leave", channelID)
+	notInChannel, err := c.client.LeaveConversation(channelID)
+	tracing.End(span, err)
+	return notInChannel, err
+}
+
+func (c tracedSlackClient) GetConversations(input *slk.GetConversationsParameters) ([]slk.Channel, string, error) {
+	span := c.start("conversations.list", "")
+	channels, cursor, err := c.client.GetConversations(input)
+	span.SetAttributes(attribute.Int("slack.channels", len(channels)))
+	tracing.End(span, err)
+	return channels, cursor, err
+}
+
+func (c tracedSlackClient) GetConversationHistory(params *slk.GetConversationHistoryParameters) (*slk.GetConversationHistoryResponse, error) {
+	span := c.start("conversations.history", params.ChannelID)
+	history, err := c.client.GetConversationHistory(params)
+	tracing.End(span, err)
+	return history, err
+}
+
+func (c tracedSlackClient) ListPins(channel string) ([]slk.Item, *slk.Paging, error) {
+	span := c.start("pins.list", channel)
+	items, paging, err := c.client.ListPins(channel)
+	tracing.End(span, err)
+	return items, paging, err
+}
+
+func (c tracedSlackClient) PostMessage(channelID string, options ...slk.MsgOption) (string, string, error) {
+	span := c.start("chat.postMessage", channelID)
+	respChannel, timestamp, err := c.client.PostMessage(channelID, options...)
+	tracing.End(span, err)
+	return respChannel, timestamp, err
+}
+
+func (c tracedSlackClient) RenameConversation(channelID, channelName string) (*slk.Channel, error) {
+	span := c.start("conversations.rename", channelID)
+	channel, err := c.client.RenameConversation(channelID, channelName)
+	tracing.End(span, err)
+	return channel, err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	slk "github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/Clever/flarebot/jira"
+)
+
+func TestChannelSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	slackClient := NewMockSlackClient(mockController)
+	jiraClient := NewMockJiraClient(mockController)
+	channel := namedChannel("flaretest-1")
+	channel.ID = "C1"
+	slackClient.EXPECT().GetConversations(gomock.Any()).Return([]slk.Channel{channel}, "", nil).Times(1)
+	slackClient.EXPECT().ArchiveConversation("C1").Return(nil).Times(1)
+	jiraClient.EXPECT().GetTicketByKey("FLARETEST-1").Return(&jira.Ticket{Key: "FLARETEST-1"}, nil).Times(1)
+	jiraClient.EXPECT().SetLabel(&jira.Ticket{Key: "FLARETEST-1"}, "archived").Return(nil).Times(1)
+
+	ctx, root := tracer.Start(context.Background(), "cleanup")
+	h := Handler{slackClient: slackClient, jiraClient: jiraClient, config: newTestConfig(t, nil), clock: newFakeClock(time.Now())}.withContext(ctx)
+	_, err := h.archiveChannels(ctx, []string{"flaretest-1"}, false)
+	require.NoError(t, err)
+	root.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range exporter.GetSpans().Snapshots() {
+		spans[span.Name()] = span
+	}
+	require.Contains(t, spans, "cleanup.channel")
+	require.Contains(t, spans, "slack conversations.list")
+	require.Contains(t, spans, "slack conversations.archive")
+
+	channelSpan := spans["cleanup.channel"]
+	assert.Equal(t, root.SpanContext().SpanID(), channelSpan.Parent().SpanID())
+	assert.Subset(t, channelSpan.Attributes(), []attribute.KeyValue{
+		attribute.String("slack.channel.name", "flaretest-1"),
+		attribute.String("slack.channel.id", "C1"),
+		attribute.String("jira.key", "FLARETEST-1"),
+		attribute.String("cleanup.outcome", outcomeApplied),
+	})
+	assert.Equal(t, root.SpanContext().SpanID(), spans["slack conversations.list"].Parent().SpanID())
+	assert.Equal(t, channelSpan.SpanContext().SpanID(), spans["slack conversations.archive"].Parent().SpanID())
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	_ "embed"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/Clever/flarebot/duration"
+	"github.com/Clever/flarebot/flare"
+	"github.com/Clever/flarebot/jira"
+	"github.com/Clever/flarebot/slackutil"
+	"github.com/Clever/kayvee-go/v7/logger"
+
+	slk "github.com/slack-go/slack"
+)
+
+// generate launch config
+//go:generate sh -c "$GENERATE_PWD/bin/launch-gen -o launch.go -p main $GENERATE_PWD/launch/flarebot-stale-nagger.yml"
+
+// generate kv config bytes for setting up log routing
+//
+//go:embed kvconfig.yml
+var kvconfig []byte
+
+type SlackClient interface {
+	PostMessage(channelID string, options ...slk.MsgOption) (string, string, error)
+	GetConversationHistory(params *slk.GetConversationHistoryParameters) (*slk.GetConversationHistoryResponse, error)
+	GetUserByEmail(email string) (*slk.User, error)
+}
+
+type JiraClient interface {
+	SearchTickets(jql string, fields []string) ([]jira.Ticket, error)
+	GetChangelog(key string) ([]jira.ChangelogEntry, error)
+}
+
+// Handler encapsulates the external dependencies of the lambda function.
+type Handler struct {
+	slackClient  SlackClient
+	jiraClient   JiraClient
+	launchConfig LaunchConfig
+}
+
+type FailedFlare struct {
+	Key   string
+	Error string
+}
+
+// Handle is invoked by the Lambda runtime with the contents of the function input.
+func (h Handler) Handle(ctx context.Context) error {
+	// create a request-specific logger, attach it to ctx, and add the Lambda request ID.
+	ctx = logger.NewContext(ctx, logger.New(os.Getenv("APP_NAME")))
+	if lambdaContext, ok := lambdacontext.FromContext(ctx); ok {
+		logger.FromContext(ctx).AddContext("aws-request-id", lambdaContext.AwsRequestID)
+	}
+
+	env := h.launchConfig.Env
+	thresholds, err := parseThresholds(env.StaleThresholds)
+	if err != nil {
+		return err
+	}
+	nagInterval, err := duration.Parse(env.NagInterval)
+	if err != nil {
+		return fmt.Errorf("invalid NAG_INTERVAL: %w", err)
+	}
+	logger.FromContext(ctx).InfoD("starting-stale-check", logger.M{"thresholds": env.StaleThresholds, "nagInterval": nagInterval.String()})
+
+	jql := fmt.Sprintf(`project = %s AND status = "%s"`, env.JiraProjectID, flare.StatusInProgress)
+	tickets, err := h.jiraClient.SearchTickets(jql, []string{"summary", "status", "priority", "assignee", "created", env.JiraSlackChannelFieldID})
+	if err != nil {
+		return err
+	}
+
+	failedFlares := []FailedFlare{}
+	for _, ticket := range tickets {
+		err := h.checkFlare(ctx, ticket, thresholds, nagInterval)
+		if err != nil {
+			failedFlares = append(failedFlares, FailedFlare{Key: ticket.Key, Error: err.Error()})
+		}
+	}
+
+	if len(failedFlares) > 0 {
+		logger.FromContext(ctx).ErrorD("error-nagging-flares", logger.M{"flares": failedFlares})
+	}
+	return nil
+}
+
+// checkFlare posts a reminder in the flare channel if the flare has been in progress longer than
+// its priority allows and nobody was reminded within the nag interval.
+func (h Handler) checkFlare(ctx context.Context, ticket jira.Ticket, thresholds map[string]time.Duration, nagInterval time.Duration) error {
+	priority := flare.Priority(ticket)
+	threshold, ok := thresholds[priority]
+	if !ok {
+		threshold, ok = thresholds[defaultThresholdKey]
+	}
+	if !ok {
+		logger.FromContext(ctx).DebugD("no-threshold-for-priority", logger.M{"key": ticket.Key, "priority": priority})
+		return nil
+	}
+
+	changelog, err := h.jiraClient.GetChangelog(ticket.Key)
+	if err != nil {
+		return err
+	}
+	inProgressFor := time.Since(flare.StatusSince(ticket, jira.StatusChanges(changelog)))
+	if inProgressFor < threshold {
+		return nil
+	}
+
+	channelID := flare.ChannelID(ticket, h.launchConfig.Env.JiraSlackChannelFieldID)
+	if channelID == "" {
+		return fmt.Errorf("ticket has no slack channel link")
+	}
+
+	nagged, err := slackutil.PostedSince(h.slackClient, channelID, time.Now().Add(-nagInterval), staleReminderBlockID)
+	if err != nil {
+		return err
+	}
+	if nagged {
+		logger.FromContext(ctx).DebugD("recently-nagged", logger.M{"key": ticket.Key})
+		return nil
+	}
+
+	logger.FromContext(ctx).InfoD("nagging-stale-flare", logger.M{"key": ticket.Key, "priority": priority, "inProgressFor": inProgressFor.String()})
+	reminder := staleReminder{
+		Key:           ticket.Key,
+		Priority:      priority,
+		InProgressFor: inProgressFor,
+		Threshold:     threshold,
+		Assignee:      h.mention(ctx, ticket.Fields.Assignee),
+	}
+	_, _, err = h.slackClient.PostMessage(channelID,
+		slk.MsgOptionBlocks(reminder.blocks()...),
+		slk.MsgOptionText(reminder.text(), false),
+	)
+	return err
+}
+
+// mention tags the Jira assignee in Slack when their email resolves to a Slack user.
+func (h Handler) mention(ctx context.Context, assignee jira.User) string {
+	mention, err := slackutil.Mention(h.slackClient, assignee.EmailAddress, assignee.DisplayName)
+	if err != nil {
+		logger.FromContext(ctx).WarnD("slack-user-lookup-failed", logger.M{"email": assignee.EmailAddress, "error": err.Error()})
+	}
+	return mention
+}
+
+func main() {
+	ctx := context.Background()
+	if err := logger.SetGlobalRoutingFromBytes(kvconfig); err != nil {
+		log.Fatalf("Error setting kvconfig: %v", err)
+	}
+	lg := logger.FromContext(ctx)
+
+	launchConfig := InitLaunchConfig(nil)
+	slackClient := slk.New(launchConfig.Env.SlackBotToken)
+	jiraServer := jira.JiraServer{
+		Origin:   launchConfig.Env.JiraOrigin,
+		Username: launchConfig.Env.JiraUsername,
+		Password: launchConfig.Env.JiraPassword,
+	}
+
+	handler := Handler{
+		slackClient:  slackClient,
+		jiraClient:   &jiraServer,
+		launchConfig: launchConfig,
+	}
+
+	if os.Getenv("IS_LOCAL") == "true" {
+		lg.InfoD("running locally", logger.M{})
+		err := handler.Handle(ctx)
+		if err != nil {
+			lg.ErrorD("error on handle", logger.M{"err": err.Error()})
+			os.Exit(1)
+		}
+	} else {
+		_, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			log.Fatalf("Error loading AWS config: %v", err)
+		}
+		lambda.Start(handler.Handle)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Clever/flarebot/jira"
+	slk "github.com/slack-go/slack"
+)
+
+//go:generate mockgen -package main -destination mock.go -source main.go SlackClient,JiraClient
+
+type handleOutput struct {
+	err error
+}
+
+type handleTest struct {
+	description      string
+	output           handleOutput
+	mockExpectations func(slackClient *MockSlackClient, jiraClient *MockJiraClient)
+}
+
+var launchConfig = LaunchConfig{Env: Environment{
+	JiraProjectID:           "11701",
+	JiraSlackChannelFieldID: "customfield_12345",
+	StaleThresholds:         "P0=4h,P1=1d,P2=3d",
+	NagInterval:             "12h",
+}}
+
+func inProgressTicket(key, priority string, channelURL string) jira.Ticket {
+	return jira.Ticket{
+		Key: key,
+		Fields: jira.TicketFields{
+			Status:       jira.Status{Name: "In Progress"},
+			Priority:     jira.Priority{Name: priority},
+			Assignee:     jira.User{DisplayName: "Alice Smith", EmailAddress: "alice@example.com"},
+			Created:      jira.Time{Time: time.Now().Add(-10 * 24 * time.Hour)},
+			CustomFields: map[string]json.RawMessage{"customfield_12345": json.RawMessage(`"` + channelURL + `"`)},
+		},
+	}
+}
+
+func inProgressSince(ago time.Duration) []jira.ChangelogEntry {
+	return []jira.ChangelogEntry{
+		{Created: jira.Time{Time: time.Now().Add(-ago)}, Items: []jira.ChangelogItem{{Field: "status", FromString: "To Do", ToString: "In Progress"}}},
+	}
+}
+
+func history(messages ...slk.Message) *slk.GetConversationHistoryResponse {
+	return &slk.GetConversationHistoryResponse{Messages: messages}
+}
+
+func reminderMessage() slk.Message {
+	message := slk.Message{}
+	message.Blocks = slk.Blocks{BlockSet: staleReminder{}.blocks()}
+	return message
+}
+
+func TestHandle(t *testing.T) {
+	p0 := inProgressTicket("FLARE-1", "P0 - Critical", "https://clever.slack.com/archives/C1")
+
+	tests := []handleTest{
+		{
+			description: "nags a P0 in progress past its threshold",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(`project = 11701 AND status = "In Progress"`, gomock.Any()).Return([]jira.Ticket{p0}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(inProgressSince(5*time.Hour), nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(history(slk.Message{}), nil).Times(1)
+				slackClient.EXPECT().GetUserByEmail("alice@example.com").Return(&slk.User{ID: "U1"}, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C1", gomock.Any()).Return("", "", nil).Times(1)
+			},
+		},
+		{
+			description: "does not nag a flare within its threshold",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				p2 := inProgressTicket("FLARE-2", "P2 - Major", "https://clever.slack.com/archives/C2")
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{p2}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-2").Return(inProgressSince(2*24*time.Hour), nil).Times(1)
+				slackClient.EXPECT().PostMessage(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "does not re-nag within the nag interval",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{p0}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(inProgressSince(5*time.Hour), nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(history(slk.Message{}, reminderMessage()), nil).Times(1)
+				slackClient.EXPECT().PostMessage(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "follows history pagination when looking for reminders",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{p0}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(inProgressSince(5*time.Hour), nil).Times(1)
+				firstPage := history(slk.Message{})
+				firstPage.HasMore = true
+				firstPage.ResponseMetaData.NextCursor = "next"
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(firstPage, nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(history(reminderMessage()), nil).Times(1)
+				slackClient.EXPECT().PostMessage(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "falls back to the display name when the slack user can't be found",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{p0}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(inProgressSince(5*time.Hour), nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(history(), nil).Times(1)
+				slackClient.EXPECT().GetUserByEmail("alice@example.com").Return(nil, errors.New("users_not_found")).Times(1)
+				slackClient.EXPECT().PostMessage("C1", gomock.Any()).Return("", "", nil).Times(1)
+			},
+		},
+		{
+			description: "skips flares without a channel link and keeps going",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				noChannel := inProgressTicket("FLARE-3", "P0 - Critical", "")
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{noChannel, p0}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-3").Return(inProgressSince(5*time.Hour), nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(inProgressSince(5*time.Hour), nil).Times(1)
+				slackClient.EXPECT().GetConversationHistory(gomock.Any()).Return(history(), nil).Times(1)
+				slackClient.EXPECT().GetUserByEmail(gomock.Any()).Return(&slk.User{ID: "U1"}, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C1", gomock.Any()).Return("", "", nil).Times(1)
+			},
+		},
+		{
+			description: "jira search error",
+			output:      handleOutput{err: errors.New("jira down")},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return(nil, errors.New("jira down")).Times(1)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mockController := gomock.NewController(t)
+			defer mockController.Finish()
+			mockSlackClient := NewMockSlackClient(mockController)
+			mockJiraClient := NewMockJiraClient(mockController)
+			test.mockExpectations(mockSlackClient, mockJiraClient)
+			err := Handler{slackClient: mockSlackClient, jiraClient: mockJiraClient, launchConfig: launchConfig}.Handle(context.Background())
+			assert.Equal(t, test.output.err, err)
+		})
+	}
+}
+
+func TestParseThresholds(t *testing.T) {
+	thresholds, err := parseThresholds("p0=4h, P1=1d,P2=3d,Default=7d")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{
+		"P0":      4 * time.Hour,
+		"P1":      24 * time.Hour,
+		"P2":      72 * time.Hour,
+		"default": 7 * 24 * time.Hour,
+	}, thresholds)
+
+	for _, invalid := range []string{"", "P0", "P0=soon", "P0=xd"} {
+		_, err := parseThresholds(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Clever/flarebot/duration"
+	"github.com/Clever/flarebot/flare"
+	slk "github.com/slack-go/slack"
+)
+
+// staleReminderBlockID marks the reminder block so later runs can find it in the channel history.
+const staleReminderBlockID = "flarebot-stale-reminder"
+
+// defaultThresholdKey applies to priorities without their own threshold.
+const defaultThresholdKey = "default"
+
+type staleReminder struct {
+	Key           string
+	Priority      string
+	InProgressFor time.Duration
+	Threshold     time.Duration
+	Assignee      string
+}
+
+func (r staleReminder) text() string {
+	return fmt.Sprintf("%s %s has been In Progress for %s, longer than the %s expected for %s flares.",
+		r.Assignee, r.Key, flare.FormatDuration(r.InProgressFor), flare.FormatDuration(r.Threshold), r.Priority)
+}
+
+func (r staleReminder) blocks() []slk.Block {
+	instructions := "If the flare is mitigated, say `@flarebot mitigated` in this channel. " +
+		"If it turned out not to be a flare, say `@flarebot not a flare`. " +
+		"If it's still being worked, please post an update so everyone knows where things stand."
+	return []slk.Block{
+		slk.NewSectionBlock(slk.NewTextBlockObject(slk.MarkdownType, ":hourglass: "+r.text(), false, false), nil, nil, slk.SectionBlockOptionBlockID(staleReminderBlockID)),
+		slk.NewContextBlock("", slk.NewTextBlockObject(slk.MarkdownType, instructions, false, false)),
+	}
+}
+
+// parseThresholds parses per-priority thresholds like "P0=4h,P1=1d,P2=3d,default=7d".
+func parseThresholds(value string) (map[string]time.Duration, error) {
+	thresholds := map[string]time.Duration{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid STALE_THRESHOLDS entry %q, expected <priority>=<duration>", pair)
+		}
+		threshold, err := duration.Parse(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid STALE_THRESHOLDS entry %q: %w", pair, err)
+		}
+		key := strings.ToUpper(strings.TrimSpace(parts[0]))
+		if strings.EqualFold(key, defaultThresholdKey) {
+			key = defaultThresholdKey
+		}
+		thresholds[key] = threshold
+	}
+	if len(thresholds) == 0 {
+		return nil, fmt.Errorf("STALE_THRESHOLDS is empty")
+	}
+	return thresholds, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Clever/flarebot/flare"
+	slk "github.com/slack-go/slack"
+)
+
+// Slack rejects messages with more than 50 blocks
+const maxBlocksPerMessage = 50
+
+func digestSummary(entries []DigestEntry) string {
+	open, missingFollowup := 0, 0
+	for _, entry := range entries {
+		if entry.Open {
+			open++
+		}
+		if entry.MissingFollowup {
+			missingFollowup++
+		}
+	}
+	return fmt.Sprintf("%d flares in the last %d days, %d still open, %d missing followup", len(entries), digestWindowDays, open, missingFollowup)
+}
+
+func digestBlocks(entries []DigestEntry) []slk.Block {
+	blocks := []slk.Block{
+		slk.NewHeaderBlock(slk.NewTextBlockObject(slk.PlainTextType, "Weekly Flare Digest", false, false)),
+		slk.NewContextBlock("", slk.NewTextBlockObject(slk.MarkdownType, digestSummary(entries), false, false)),
+		slk.NewDividerBlock(),
+	}
+	if len(entries) == 0 {
+		return append(blocks, markdownSection("No flares this week :tada:"))
+	}
+	for _, entry := range entries {
+		blocks = append(blocks, markdownSection(entryText(entry)))
+	}
+	return blocks
+}
+
+func entryText(entry DigestEntry) string {
+	var text strings.Builder
+	if entry.Open {
+		text.WriteString(":rotating_light: *Still open* ")
+	} else if entry.MissingFollowup {
+		text.WriteString(":memo: *Followup missing* ")
+	}
+	fmt.Fprintf(&text, "*<%s|%s>* %s · %s\n%s\n", entry.TicketURL, entry.Key, entry.Priority, entry.Status, entry.Title)
+
+	details := []string{}
+	if entry.TimeToMitigate != nil {
+		details = append(details, "Time to mitigate: "+flare.FormatDuration(*entry.TimeToMitigate))
+	}
+	lead := entry.IncidentLead
+	if lead == "" {
+		lead = "unassigned"
+	}
+	details = append(details, "Incident lead: "+lead)
+	if entry.ChannelURL != "" {
+		details = append(details, fmt.Sprintf("<%s|Slack channel>", entry.ChannelURL))
+	}
+	if entry.DocURL != "" {
+		details = append(details, fmt.Sprintf("<%s|Flare doc>", entry.DocURL))
+	}
+	text.WriteString(strings.Join(details, " · "))
+	return text.String()
+}
+
+func markdownSection(text string) *slk.SectionBlock {
+	return slk.NewSectionBlock(slk.NewTextBlockObject(slk.MarkdownType, text, false, false), nil, nil)
+}
+
+// chunkBlocks splits blocks into groups small enough to post as one message each.
+func chunkBlocks(blocks []slk.Block, size int) [][]slk.Block {
+	chunks := [][]slk.Block{}
+	for len(blocks) > size {
+		chunks = append(chunks, blocks[:size])
+		blocks = blocks[size:]
+	}
+	return append(chunks, blocks)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	_ "embed"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/Clever/flarebot/flare"
+	"github.com/Clever/flarebot/jira"
+	"github.com/Clever/kayvee-go/v7/logger"
+
+	slk "github.com/slack-go/slack"
+)
+
+// generate launch config
+//go:generate sh -c "$GENERATE_PWD/bin/launch-gen -o launch.go -p main $GENERATE_PWD/launch/flarebot-weekly-digest.yml"
+
+// generate kv config bytes for setting up log routing
+//
+//go:embed kvconfig.yml
+var kvconfig []byte
+
+type SlackClient interface {
+	PostMessage(channelID string, options ...slk.MsgOption) (string, string, error)
+}
+
+type JiraClient interface {
+	SearchTickets(jql string, fields []string) ([]jira.Ticket, error)
+	GetChangelog(key string) ([]jira.ChangelogEntry, error)
+}
+
+// Handler encapsulates the external dependencies of the lambda function.
+type Handler struct {
+	slackClient  SlackClient
+	jiraClient   JiraClient
+	launchConfig LaunchConfig
+}
+
+// Constants for the handler
+const (
+	digestWindowDays = 7
+)
+
+// DigestEntry is one flare as it appears in the digest.
+type DigestEntry struct {
+	Key             string
+	Title           string
+	Priority        string
+	Status          string
+	TimeToMitigate  *time.Duration
+	IncidentLead    string
+	TicketURL       string
+	ChannelURL      string
+	DocURL          string
+	Open            bool
+	MissingFollowup bool
+}
+
+// Handle is invoked by the Lambda runtime with the contents of the function input.
+func (h Handler) Handle(ctx context.Context) error {
+	// create a request-specific logger, attach it to ctx, and add the Lambda request ID.
+	ctx = logger.NewContext(ctx, logger.New(os.Getenv("APP_NAME")))
+	if lambdaContext, ok := lambdacontext.FromContext(ctx); ok {
+		logger.FromContext(ctx).AddContext("aws-request-id", lambdaContext.AwsRequestID)
+	}
+
+	env := h.launchConfig.Env
+	jql := fmt.Sprintf("project = %s AND created >= -%dd ORDER BY created ASC", env.JiraProjectID, digestWindowDays)
+	fields := []string{"summary", "status", "priority", "assignee", "created", "description", env.JiraSlackChannelFieldID}
+	tickets, err := h.jiraClient.SearchTickets(jql, fields)
+	if err != nil {
+		return err
+	}
+	logger.FromContext(ctx).InfoD("building-digest", logger.M{"flares": len(tickets)})
+
+	entries := []DigestEntry{}
+	for _, ticket := range tickets {
+		changelog, err := h.jiraClient.GetChangelog(ticket.Key)
+		if err != nil {
+			// the entry is still useful without time to mitigate
+			logger.FromContext(ctx).ErrorD("error-getting-changelog", logger.M{"key": ticket.Key, "error": err.Error()})
+		}
+		entries = append(entries, h.toDigestEntry(ticket, jira.StatusChanges(changelog)))
+	}
+
+	for _, blocks := range chunkBlocks(digestBlocks(entries), maxBlocksPerMessage) {
+		_, _, err = h.slackClient.PostMessage(env.FlaresChannelID,
+			slk.MsgOptionBlocks(blocks...),
+			slk.MsgOptionText(digestSummary(entries), false),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h Handler) toDigestEntry(ticket jira.Ticket, changes []jira.StatusChange) DigestEntry {
+	entry := DigestEntry{
+		Key:             ticket.Key,
+		Title:           ticket.Fields.Summary,
+		Priority:        flare.Priority(ticket),
+		Status:          ticket.Fields.Status.Name,
+		IncidentLead:    ticket.Fields.Assignee.DisplayName,
+		TicketURL:       fmt.Sprintf("%s/browse/%s", h.launchConfig.Env.JiraOrigin, ticket.Key),
+		ChannelURL:      flare.ChannelURL(ticket, h.launchConfig.Env.JiraSlackChannelFieldID),
+		DocURL:          flare.DocURL(ticket),
+		Open:            flare.IsOpen(ticket),
+		MissingFollowup: flare.NeedsFollowup(ticket),
+	}
+	if mitigatedAt, ok := flare.MitigatedAt(changes); ok && !flare.WasNotAFlare(ticket, changes) {
+		ttm := mitigatedAt.Sub(ticket.Fields.Created.Time)
+		entry.TimeToMitigate = &ttm
+	}
+	return entry
+}
+
+func main() {
+	ctx := context.Background()
+	if err := logger.SetGlobalRoutingFromBytes(kvconfig); err != nil {
+		log.Fatalf("Error setting kvconfig: %v", err)
+	}
+	lg := logger.FromContext(ctx)
+
+	launchConfig := InitLaunchConfig(nil)
+	slackClient := slk.New(launchConfig.Env.SlackBotToken)
+	jiraServer := jira.JiraServer{
+		Origin:   launchConfig.Env.JiraOrigin,
+		Username: launchConfig.Env.JiraUsername,
+		Password: launchConfig.Env.JiraPassword,
+	}
+
+	handler := Handler{
+		slackClient:  slackClient,
+		jiraClient:   &jiraServer,
+		launchConfig: launchConfig,
+	}
+
+	if os.Getenv("IS_LOCAL") == "true" {
+		lg.InfoD("running locally", logger.M{})
+		err := handler.Handle(ctx)
+		if err != nil {
+			lg.ErrorD("error on handle", logger.M{"err": err.Error()})
+			os.Exit(1)
+		}
+	} else {
+		_, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			log.Fatalf("Error loading AWS config: %v", err)
+		}
+		lambda.Start(handler.Handle)
+	}
+}
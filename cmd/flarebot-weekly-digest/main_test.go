@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Clever/flarebot/jira"
+	slk "github.com/slack-go/slack"
+)
+
+//go:generate mockgen -package main -destination mock.go -source main.go SlackClient,JiraClient
+
+type handleOutput struct {
+	err error
+}
+
+type handleTest struct {
+	description      string
+	output           handleOutput
+	mockExpectations func(slackClient *MockSlackClient, jiraClient *MockJiraClient)
+}
+
+var launchConfig = LaunchConfig{Env: Environment{
+	FlaresChannelID:         "C-FLARES",
+	JiraOrigin:              "https://mock-jira.com",
+	JiraProjectID:           "11701",
+	JiraSlackChannelFieldID: "customfield_12345",
+}}
+
+var created = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+func flareTicket(key, status, description string) jira.Ticket {
+	return jira.Ticket{
+		Key: key,
+		Fields: jira.TicketFields{
+			Summary:      key + " title",
+			Description:  description,
+			Status:       jira.Status{Name: status},
+			Priority:     jira.Priority{Name: "P1 - High"},
+			Assignee:     jira.User{DisplayName: "Alice Smith"},
+			Created:      jira.Time{Time: created},
+			CustomFields: map[string]json.RawMessage{"customfield_12345": json.RawMessage(`"https://slack.com/archives/C1"`)},
+		},
+	}
+}
+
+func mitigatedAfter(d time.Duration) []jira.ChangelogEntry {
+	return []jira.ChangelogEntry{
+		{Created: jira.Time{Time: created.Add(d)}, Items: []jira.ChangelogItem{{Field: "status", FromString: "In Progress", ToString: "Mitigated"}}},
+	}
+}
+
+func TestHandle(t *testing.T) {
+	tests := []handleTest{
+		{
+			description: "posts digest for flares in the last week",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets("project = 11701 AND created >= -7d ORDER BY created ASC", gomock.Any()).
+					Return([]jira.Ticket{flareTicket("FLARE-1", "Mitigated", "done"), flareTicket("FLARE-2", "In Progress", "")}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(mitigatedAfter(time.Hour), nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-2").Return(nil, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C-FLARES", gomock.Any()).Return("", "", nil).Times(1)
+			},
+		},
+		{
+			description: "posts digest when there are no flares",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{}, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C-FLARES", gomock.Any()).Return("", "", nil).Times(1)
+			},
+		},
+		{
+			description: "still posts when a changelog can't be loaded",
+			output:      handleOutput{err: nil},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{flareTicket("FLARE-1", "Mitigated", "")}, nil).Times(1)
+				jiraClient.EXPECT().GetChangelog("FLARE-1").Return(nil, errors.New("jira down")).Times(1)
+				slackClient.EXPECT().PostMessage("C-FLARES", gomock.Any()).Return("", "", nil).Times(1)
+			},
+		},
+		{
+			description: "jira search error",
+			output:      handleOutput{err: errors.New("jira down")},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return(nil, errors.New("jira down")).Times(1)
+				slackClient.EXPECT().PostMessage(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			description: "slack post error",
+			output:      handleOutput{err: errors.New("channel_not_found")},
+			mockExpectations: func(slackClient *MockSlackClient, jiraClient *MockJiraClient) {
+				jiraClient.EXPECT().SearchTickets(gomock.Any(), gomock.Any()).Return([]jira.Ticket{}, nil).Times(1)
+				slackClient.EXPECT().PostMessage("C-FLARES", gomock.Any()).Return("", "", errors.New("channel_not_found")).Times(1)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mockController := gomock.NewController(t)
+			defer mockController.Finish()
+			mockSlackClient := NewMockSlackClient(mockController)
+			mockJiraClient := NewMockJiraClient(mockController)
+			test.mockExpectations(mockSlackClient, mockJiraClient)
+			err := Handler{slackClient: mockSlackClient, jiraClient: mockJiraClient, launchConfig: launchConfig}.Handle(context.Background())
+			assert.Equal(t, test.output.err, err)
+		})
+	}
+}
+
+func TestToDigestEntry(t *testing.T) {
+	h := Handler{launchConfig: launchConfig}
+
+	entry := h.toDigestEntry(flareTicket("FLARE-1", "Mitigated", "[example: ...] [Flare Doc|https://docs.google.com/document/d/doc1]"),
+		jira.StatusChanges(mitigatedAfter(90*time.Minute)))
+	assert.Equal(t, "P1", entry.Priority)
+	assert.Equal(t, "https://mock-jira.com/browse/FLARE-1", entry.TicketURL)
+	assert.Equal(t, "https://slack.com/archives/C1", entry.ChannelURL)
+	assert.Equal(t, "https://docs.google.com/document/d/doc1", entry.DocURL)
+	assert.Equal(t, "Alice Smith", entry.IncidentLead)
+	assert.False(t, entry.Open)
+	assert.True(t, entry.MissingFollowup)
+	if assert.NotNil(t, entry.TimeToMitigate) {
+		assert.Equal(t, 90*time.Minute, *entry.TimeToMitigate)
+	}
+
+	entry = h.toDigestEntry(flareTicket("FLARE-2", "In Progress", ""), nil)
+	assert.True(t, entry.Open)
+	assert.False(t, entry.MissingFollowup)
+	assert.Nil(t, entry.TimeToMitigate)
+}
+
+func TestDigestBlocks(t *testing.T) {
+	ttm := 90 * time.Minute
+	entries := []DigestEntry{
+		{Key: "FLARE-1", Title: "db down", Priority: "P0", Status: "Mitigated", TimeToMitigate: &ttm, IncidentLead: "Alice", TicketURL: "https://jira/browse/FLARE-1", MissingFollowup: true},
+		{Key: "FLARE-2", Title: "slow", Priority: "P2", Status: "In Progress", TicketURL: "https://jira/browse/FLARE-2", Open: true},
+	}
+
+	blocks := digestBlocks(entries)
+	assert.Len(t, blocks, 5)
+
+	first := blocks[3].(*slk.SectionBlock).Text.Text
+	assert.True(t, strings.HasPrefix(first, ":memo: *Followup missing*"))
+	assert.Contains(t, first, "*<https://jira/browse/FLARE-1|FLARE-1>* P0 · Mitigated")
+	assert.Contains(t, first, "Time to mitigate: 1h30m")
+	assert.Contains(t, first, "Incident lead: Alice")
+
+	second := blocks[4].(*slk.SectionBlock).Text.Text
+	assert.True(t, strings.HasPrefix(second, ":rotating_light: *Still open*"))
+	assert.Contains(t, second, "Incident lead: unassigned")
+
+	assert.Len(t, digestBlocks(nil), 4)
+}
+
+func TestChunkBlocks(t *testing.T) {
+	blocks := make([]slk.Block, 120)
+	chunks := chunkBlocks(blocks, maxBlocksPerMessage)
+	assert.Len(t, chunks, 3)
+	assert.Len(t, chunks[0], 50)
+	assert.Len(t, chunks[2], 20)
+	assert.Len(t, chunkBlocks(blocks[:3], maxBlocksPerMessage), 1)
+}
@@ -0,0 +1,33 @@
+// Package duration parses the human friendly durations used in flarebot job configuration.
+package duration
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calendar units that time.ParseDuration doesn't support. Months are treated as 30 days.
+var units = map[string]time.Duration{
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+	"mo": 30 * 24 * time.Hour,
+}
+
+// Parse accepts anything time.ParseDuration does, plus a whole number of days ("180d"),
+// weeks ("3w") or months ("6mo").
+func Parse(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	for _, suffix := range []string{"mo", "d", "w"} {
+		if !strings.HasSuffix(value, suffix) {
+			continue
+		}
+		count, err := strconv.Atoi(strings.TrimSuffix(value, suffix))
+		if err != nil || count < 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return time.Duration(count) * units[suffix], nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,38 @@
+package duration_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Clever/flarebot/duration"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{input: "4h", expected: 4 * time.Hour},
+		{input: "90m", expected: 90 * time.Minute},
+		{input: "1h30m", expected: 90 * time.Minute},
+		{input: "180d", expected: 180 * 24 * time.Hour},
+		{input: " 3d ", expected: 72 * time.Hour},
+		{input: "2w", expected: 14 * 24 * time.Hour},
+		{input: "6mo", expected: 180 * 24 * time.Hour},
+		{input: "0d", expected: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			actual, err := duration.Parse(test.input)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+
+	for _, invalid := range []string{"", "soon", "xd", "-3d", "1.5d", "6m0"} {
+		_, err := duration.Parse(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,146 @@
+// Package flare holds the rules for reading flare state out of Jira tickets that are shared
+// by the Go jobs. The TypeScript app is the source of truth for how tickets are written,
+// see src/listeners/messages/fireFlare.ts and src/listeners/messages/flareTransition.ts.
+package flare
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Clever/flarebot/jira"
+)
+
+// Jira statuses flarebot transitions flares through.
+const (
+	StatusInProgress = "In Progress"
+	StatusMitigated  = "Mitigated"
+	StatusNotAFlare  = "NotAFlare"
+	StatusDone       = "Done"
+)
+
+// TemplatePlaceholder starts every example paragraph in the ticket description template
+// (jiraDescription in src/lib/jira.ts). Its presence means the followup was never written up.
+const TemplatePlaceholder = "[example:"
+
+// ArchivedLabel is added to the ticket when flarebot-slack-cleanup archives the flare channel.
+const ArchivedLabel = "archived"
+
+// UnknownPriority is returned when a ticket's priority isn't one of the P<n> priorities.
+const UnknownPriority = "unknown"
+
+var (
+	priorityRegex   = regexp.MustCompile(`(?i)^p\d`)
+	docURLRegex     = regexp.MustCompile(`https://docs\.google\.com/document/d/[A-Za-z0-9_-]+`)
+	channelURLRegex = regexp.MustCompile(`/archives/([A-Z0-9]+)/?$`)
+)
+
+// closedStatuses are statuses where nobody is actively working the flare.
+var closedStatuses = map[string]bool{
+	StatusMitigated: true,
+	StatusNotAFlare: true,
+	StatusDone:      true,
+	"Closed":        true,
+	"Resolved":      true,
+}
+
+// Priority turns Jira priority names like "P2 - Major" into "P2".
+func Priority(ticket jira.Ticket) string {
+	name := ticket.Fields.Priority.Name
+	if !priorityRegex.MatchString(name) {
+		return UnknownPriority
+	}
+	return strings.ToUpper(name[:2])
+}
+
+// IsOpen reports whether the flare is still being worked.
+func IsOpen(ticket jira.Ticket) bool {
+	return !closedStatuses[ticket.Fields.Status.Name]
+}
+
+// NeedsFollowup reports whether a mitigated flare still has template text in its description.
+func NeedsFollowup(ticket jira.Ticket) bool {
+	return ticket.Fields.Status.Name == StatusMitigated && strings.Contains(ticket.Fields.Description, TemplatePlaceholder)
+}
+
+// HasLabel reports whether the ticket has the label, ignoring case like Jira search does.
+func HasLabel(ticket jira.Ticket, label string) bool {
+	for _, l := range ticket.Fields.Labels {
+		if strings.EqualFold(l, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// MitigatedAt returns the time of the first transition to Mitigated.
+func MitigatedAt(changes []jira.StatusChange) (time.Time, bool) {
+	for _, change := range changes {
+		if change.To == StatusMitigated {
+			return change.At, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// WasNotAFlare reports whether the flare is, or was ever, marked NotAFlare.
+func WasNotAFlare(ticket jira.Ticket, changes []jira.StatusChange) bool {
+	if ticket.Fields.Status.Name == StatusNotAFlare {
+		return true
+	}
+	for _, change := range changes {
+		if change.To == StatusNotAFlare {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusSince returns when the ticket entered its current status. Tickets that never changed
+// status have been in it since they were created.
+func StatusSince(ticket jira.Ticket, changes []jira.StatusChange) time.Time {
+	for i := len(changes) - 1; i >= 0; i-- {
+		if changes[i].To == ticket.Fields.Status.Name {
+			return changes[i].At
+		}
+	}
+	return ticket.Fields.Created.Time
+}
+
+// ChannelName is the name fireFlare gives the flare channel for a ticket, e.g. "flare-123".
+func ChannelName(key string) string {
+	return strings.ToLower(key)
+}
+
+// ChannelURL returns the Slack channel link fireFlare stores in the slack channel custom field.
+func ChannelURL(ticket jira.Ticket, channelFieldID string) string {
+	return ticket.Fields.CustomFieldString(channelFieldID)
+}
+
+// ChannelID extracts the Slack channel ID from the ticket's channel link, e.g.
+// "https://clever.slack.com/archives/C0123ABCD" returns "C0123ABCD".
+func ChannelID(ticket jira.Ticket, channelFieldID string) string {
+	matches := channelURLRegex.FindStringSubmatch(ChannelURL(ticket, channelFieldID))
+	if matches == nil {
+		return ""
+	}
+	return matches[1]
+}
+
+// DocURL returns the flare doc link that flarebot writes into the ticket description.
+func DocURL(ticket jira.Ticket) string {
+	return docURLRegex.FindString(ticket.Fields.Description)
+}
+
+// FormatDuration renders a duration for Slack messages, e.g. "45m", "2h05m" or "3d4h".
+func FormatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	if d < 24*time.Hour {
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dd%dh", int(d.Hours())/24, int(d.Hours())%24)
+}
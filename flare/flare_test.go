@@ -0,0 +1,111 @@
+package flare_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Clever/flarebot/flare"
+	"github.com/Clever/flarebot/jira"
+)
+
+func ticketWith(status, priority, description string) jira.Ticket {
+	return jira.Ticket{Fields: jira.TicketFields{
+		Status:      jira.Status{Name: status},
+		Priority:    jira.Priority{Name: priority},
+		Description: description,
+	}}
+}
+
+func TestPriority(t *testing.T) {
+	assert.Equal(t, "P2", flare.Priority(ticketWith("", "P2 - Major", "")))
+	assert.Equal(t, "P0", flare.Priority(ticketWith("", "p0", "")))
+	assert.Equal(t, flare.UnknownPriority, flare.Priority(ticketWith("", "Major", "")))
+	assert.Equal(t, flare.UnknownPriority, flare.Priority(ticketWith("", "", "")))
+}
+
+func TestIsOpen(t *testing.T) {
+	assert.True(t, flare.IsOpen(ticketWith(flare.StatusInProgress, "", "")))
+	assert.True(t, flare.IsOpen(ticketWith("To Do", "", "")))
+	assert.False(t, flare.IsOpen(ticketWith(flare.StatusMitigated, "", "")))
+	assert.False(t, flare.IsOpen(ticketWith(flare.StatusNotAFlare, "", "")))
+}
+
+func TestNeedsFollowup(t *testing.T) {
+	assert.True(t, flare.NeedsFollowup(ticketWith(flare.StatusMitigated, "", "h2. Customer Impact\n_[example: All users ...]_")))
+	assert.False(t, flare.NeedsFollowup(ticketWith(flare.StatusMitigated, "", "h2. Customer Impact\nNobody could log in")))
+	assert.False(t, flare.NeedsFollowup(ticketWith(flare.StatusInProgress, "", "[example: All users ...]")))
+}
+
+func TestMitigatedAt(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	changes := []jira.StatusChange{
+		{From: "To Do", To: flare.StatusInProgress, At: start},
+		{From: flare.StatusInProgress, To: flare.StatusMitigated, At: start.Add(time.Hour)},
+		{From: flare.StatusMitigated, To: flare.StatusInProgress, At: start.Add(2 * time.Hour)},
+		{From: flare.StatusInProgress, To: flare.StatusMitigated, At: start.Add(3 * time.Hour)},
+	}
+
+	at, ok := flare.MitigatedAt(changes)
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(time.Hour), at)
+
+	_, ok = flare.MitigatedAt(changes[:1])
+	assert.False(t, ok)
+}
+
+func TestWasNotAFlare(t *testing.T) {
+	changes := []jira.StatusChange{{From: flare.StatusInProgress, To: flare.StatusNotAFlare}}
+	assert.True(t, flare.WasNotAFlare(ticketWith(flare.StatusNotAFlare, "", ""), nil))
+	assert.True(t, flare.WasNotAFlare(ticketWith("Done", "", ""), changes))
+	assert.False(t, flare.WasNotAFlare(ticketWith(flare.StatusMitigated, "", ""), nil))
+}
+
+func TestDocURL(t *testing.T) {
+	description := "h2. Followup\n[Flare Doc|https://docs.google.com/document/d/1AbC-d_9] | [Slack History|https://docs.google.com/spreadsheets/d/xyz]"
+	assert.Equal(t, "https://docs.google.com/document/d/1AbC-d_9", flare.DocURL(ticketWith("", "", description)))
+	assert.Equal(t, "", flare.DocURL(ticketWith("", "", "no links")))
+}
+
+func TestStatusSince(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ticket := ticketWith(flare.StatusInProgress, "", "")
+	ticket.Fields.Created = jira.Time{Time: start}
+
+	assert.Equal(t, start, flare.StatusSince(ticket, nil))
+
+	changes := []jira.StatusChange{
+		{To: flare.StatusInProgress, At: start.Add(time.Minute)},
+		{To: flare.StatusMitigated, At: start.Add(time.Hour)},
+		{To: flare.StatusInProgress, At: start.Add(2 * time.Hour)},
+	}
+	assert.Equal(t, start.Add(2*time.Hour), flare.StatusSince(ticket, changes))
+}
+
+func TestChannelID(t *testing.T) {
+	ticket := jira.Ticket{Fields: jira.TicketFields{CustomFields: map[string]json.RawMessage{
+		"customfield_1": json.RawMessage(`"https://clever.slack.com/archives/C0123ABCD"`),
+		"customfield_2": json.RawMessage(`"not a url"`),
+	}}}
+
+	assert.Equal(t, "https://clever.slack.com/archives/C0123ABCD", flare.ChannelURL(ticket, "customfield_1"))
+	assert.Equal(t, "C0123ABCD", flare.ChannelID(ticket, "customfield_1"))
+	assert.Equal(t, "", flare.ChannelID(ticket, "customfield_2"))
+	assert.Equal(t, "", flare.ChannelID(ticket, "customfield_3"))
+	assert.Equal(t, "flare-123", flare.ChannelName("FLARE-123"))
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "45m", flare.FormatDuration(45*time.Minute))
+	assert.Equal(t, "2h05m", flare.FormatDuration(2*time.Hour+5*time.Minute))
+	assert.Equal(t, "3d4h", flare.FormatDuration(76*time.Hour))
+}
+
+func TestHasLabel(t *testing.T) {
+	ticket := jira.Ticket{Fields: jira.TicketFields{Labels: []string{"archived", "Followup-Done"}}}
+	assert.True(t, flare.HasLabel(ticket, "archived"))
+	assert.True(t, flare.HasLabel(ticket, "followup-done"))
+	assert.False(t, flare.HasLabel(ticket, "retro"))
+}
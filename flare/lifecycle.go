@@ -0,0 +1,160 @@
+package flare
+
+import (
+	"fmt"
+
+	"github.com/Clever/flarebot/jira"
+)
+
+// State is a stage of a flare's life. Every state but StateNew and StateArchived is a Jira
+// status; archived flares keep the status they were closed with and carry ArchivedLabel.
+type State string
+
+const (
+	StateNew        State = "new"
+	StateInProgress State = "in progress"
+	StateMitigated  State = "mitigated"
+	StateNotAFlare  State = "not a flare"
+	StateDone       State = "done"
+	StateArchived   State = "archived"
+)
+
+// Event moves a flare from one state to another.
+type Event string
+
+const (
+	// EventFire opens the flare, from "fire a flare".
+	EventFire Event = "fire"
+	// EventMitigate is "flare mitigated".
+	EventMitigate Event = "mitigate"
+	// EventNotAFlare is "not a flare".
+	EventNotAFlare Event = "not a flare"
+	// EventUnmitigate is "flare unmitigated", which puts a closed flare back in progress.
+	EventUnmitigate Event = "unmitigate"
+	// EventComplete closes a mitigated flare once its followup is done.
+	EventComplete Event = "complete"
+	// EventArchive archives the channel of a closed flare, see flarebot-slack-cleanup.
+	EventArchive Event = "archive"
+	// EventReopen brings an archived flare back, unarchiving its channel.
+	EventReopen Event = "reopen"
+	// EventEscalate raises the priority of a flare in progress.
+	EventEscalate Event = "escalate"
+)
+
+// Effect is something besides the Jira status that has to happen when a flare changes state.
+// The state machine only names them, callers carry them out.
+type Effect string
+
+const (
+	// EffectNotifyFlares posts the change in the flares channel.
+	EffectNotifyFlares Effect = "notify-flares-channel"
+	// EffectScheduleFollowup schedules the followup reminder in the flare channel.
+	EffectScheduleFollowup Effect = "schedule-followup"
+	// EffectCancelScheduled deletes the flare channel's scheduled messages, like the followup
+	// reminder.
+	EffectCancelScheduled Effect = "cancel-scheduled-messages"
+	// EffectArchiveChannel and EffectUnarchiveChannel archive and unarchive the flare channel.
+	EffectArchiveChannel   Effect = "archive-channel"
+	EffectUnarchiveChannel Effect = "unarchive-channel"
+	// EffectAddArchivedLabel and EffectRemoveArchivedLabel keep ArchivedLabel in sync with the
+	// channel.
+	EffectAddArchivedLabel    Effect = "add-archived-label"
+	EffectRemoveArchivedLabel Effect = "remove-archived-label"
+)
+
+// Transition is an allowed move between states.
+type Transition struct {
+	Event Event
+	From  []State
+	To    State
+	// JiraStatus is the status the ticket moves to, which picks the Jira workflow transition
+	// (see jira.JiraServer.TransitionTo). Empty when the status doesn't change.
+	JiraStatus string
+	Effects    []Effect
+}
+
+// transitions is the flare lifecycle. The effects match what the app does in
+// src/listeners/messages/fireFlare.ts and flareTransition.ts.
+var transitions = []Transition{
+	{Event: EventFire, From: []State{StateNew}, To: StateInProgress, JiraStatus: StatusInProgress,
+		Effects: []Effect{EffectNotifyFlares}},
+	{Event: EventMitigate, From: []State{StateInProgress}, To: StateMitigated, JiraStatus: StatusMitigated,
+		Effects: []Effect{EffectNotifyFlares, EffectScheduleFollowup}},
+	{Event: EventNotAFlare, From: []State{StateInProgress, StateMitigated}, To: StateNotAFlare, JiraStatus: StatusNotAFlare,
+		Effects: []Effect{EffectNotifyFlares}},
+	{Event: EventUnmitigate, From: []State{StateMitigated, StateNotAFlare}, To: StateInProgress, JiraStatus: StatusInProgress,
+		Effects: []Effect{EffectNotifyFlares, EffectCancelScheduled}},
+	{Event: EventComplete, From: []State{StateMitigated}, To: StateDone, JiraStatus: StatusDone},
+	{Event: EventArchive, From: []State{StateMitigated, StateNotAFlare, StateDone}, To: StateArchived,
+		Effects: []Effect{EffectArchiveChannel, EffectAddArchivedLabel}},
+	{Event: EventReopen, From: []State{StateArchived}, To: StateInProgress, JiraStatus: StatusInProgress,
+		Effects: []Effect{EffectUnarchiveChannel, EffectRemoveArchivedLabel, EffectCancelScheduled, EffectNotifyFlares}},
+	{Event: EventEscalate, From: []State{StateInProgress}, To: StateInProgress,
+		Effects: []Effect{EffectNotifyFlares}},
+}
+
+// Transitions returns the whole lifecycle, e.g. to document it.
+func Transitions() []Transition {
+	return append([]Transition{}, transitions...)
+}
+
+// StateOf reads the flare's state from its ticket. Statuses flarebot doesn't know, like
+// Jira's "To Do" before the flare is fired, are StateNew, and closed statuses other than
+// Mitigated and NotAFlare are StateDone.
+func StateOf(ticket jira.Ticket) State {
+	if HasLabel(ticket, ArchivedLabel) {
+		return StateArchived
+	}
+	switch status := ticket.Fields.Status.Name; {
+	case status == StatusInProgress:
+		return StateInProgress
+	case status == StatusMitigated:
+		return StateMitigated
+	case status == StatusNotAFlare:
+		return StateNotAFlare
+	case closedStatuses[status]:
+		return StateDone
+	default:
+		return StateNew
+	}
+}
+
+// Next returns the transition event takes from state, or an error if the lifecycle doesn't
+// allow it.
+func Next(state State, event Event) (Transition, error) {
+	for _, transition := range transitions {
+		if transition.Event != event {
+			continue
+		}
+		for _, from := range transition.From {
+			if from == state {
+				return transition, nil
+			}
+		}
+	}
+	return Transition{}, fmt.Errorf("can't %s a flare that's %s", event, state)
+}
+
+// CanArchive reports whether the flare's channel can be archived: the flare is closed and not
+// archived yet.
+func CanArchive(ticket jira.Ticket) bool {
+	_, err := Next(StateOf(ticket), EventArchive)
+	return err == nil
+}
+
+// CanReopen reports whether a closed or archived flare can go back in progress.
+func CanReopen(ticket jira.Ticket) bool {
+	state := StateOf(ticket)
+	_, unmitigate := Next(state, EventUnmitigate)
+	_, reopen := Next(state, EventReopen)
+	return unmitigate == nil || reopen == nil
+}
+
+// CanEscalate reports whether the flare is in progress with a priority below P0.
+func CanEscalate(ticket jira.Ticket) bool {
+	if _, err := Next(StateOf(ticket), EventEscalate); err != nil {
+		return false
+	}
+	priority := Priority(ticket)
+	return priority != UnknownPriority && priority != "P0"
+}
@@ -0,0 +1,111 @@
+package flare_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Clever/flarebot/flare"
+	"github.com/Clever/flarebot/jira"
+)
+
+func TestStateOf(t *testing.T) {
+	tests := []struct {
+		status   string
+		labels   []string
+		expected flare.State
+	}{
+		{status: "To Do", expected: flare.StateNew},
+		{status: "In Progress", expected: flare.StateInProgress},
+		{status: "Mitigated", expected: flare.StateMitigated},
+		{status: "NotAFlare", expected: flare.StateNotAFlare},
+		{status: "Done", expected: flare.StateDone},
+		{status: "Resolved", expected: flare.StateDone},
+		{status: "Mitigated", labels: []string{"Archived"}, expected: flare.StateArchived},
+	}
+	for _, test := range tests {
+		ticket := ticketWith(test.status, "P1 - Critical", "")
+		ticket.Fields.Labels = test.labels
+		assert.Equal(t, test.expected, flare.StateOf(ticket), test.status)
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		state      flare.State
+		event      flare.Event
+		to         flare.State
+		jiraStatus string
+		effects    []flare.Effect
+	}{
+		{state: flare.StateNew, event: flare.EventFire, to: flare.StateInProgress, jiraStatus: flare.StatusInProgress,
+			effects: []flare.Effect{flare.EffectNotifyFlares}},
+		{state: flare.StateInProgress, event: flare.EventMitigate, to: flare.StateMitigated, jiraStatus: flare.StatusMitigated,
+			effects: []flare.Effect{flare.EffectNotifyFlares, flare.EffectScheduleFollowup}},
+		{state: flare.StateMitigated, event: flare.EventNotAFlare, to: flare.StateNotAFlare, jiraStatus: flare.StatusNotAFlare,
+			effects: []flare.Effect{flare.EffectNotifyFlares}},
+		{state: flare.StateNotAFlare, event: flare.EventUnmitigate, to: flare.StateInProgress, jiraStatus: flare.StatusInProgress,
+			effects: []flare.Effect{flare.EffectNotifyFlares, flare.EffectCancelScheduled}},
+		{state: flare.StateMitigated, event: flare.EventComplete, to: flare.StateDone, jiraStatus: flare.StatusDone},
+		{state: flare.StateDone, event: flare.EventArchive, to: flare.StateArchived,
+			effects: []flare.Effect{flare.EffectArchiveChannel, flare.EffectAddArchivedLabel}},
+		{state: flare.StateArchived, event: flare.EventReopen, to: flare.StateInProgress, jiraStatus: flare.StatusInProgress,
+			effects: []flare.Effect{flare.EffectUnarchiveChannel, flare.EffectRemoveArchivedLabel, flare.EffectCancelScheduled, flare.EffectNotifyFlares}},
+	}
+	for _, test := range tests {
+		transition, err := flare.Next(test.state, test.event)
+		if assert.NoError(t, err, "%s from %s", test.event, test.state) {
+			assert.Equal(t, test.to, transition.To)
+			assert.Equal(t, test.jiraStatus, transition.JiraStatus)
+			assert.Equal(t, test.effects, transition.Effects)
+		}
+	}
+
+	for _, invalid := range []struct {
+		state flare.State
+		event flare.Event
+	}{
+		{state: flare.StateInProgress, event: flare.EventFire},
+		{state: flare.StateNew, event: flare.EventMitigate},
+		{state: flare.StateInProgress, event: flare.EventArchive},
+		{state: flare.StateArchived, event: flare.EventUnmitigate},
+		{state: flare.StateNotAFlare, event: flare.EventComplete},
+	} {
+		_, err := flare.Next(invalid.state, invalid.event)
+		assert.Error(t, err, "%s from %s", invalid.event, invalid.state)
+	}
+	_, err := flare.Next(flare.StateArchived, flare.EventMitigate)
+	assert.EqualError(t, err, "can't mitigate a flare that's archived")
+}
+
+func TestTransitionsCoverEveryState(t *testing.T) {
+	reachable := map[flare.State]bool{flare.StateNew: true}
+	for _, transition := range flare.Transitions() {
+		reachable[transition.To] = true
+	}
+	for _, state := range []flare.State{flare.StateInProgress, flare.StateMitigated, flare.StateNotAFlare, flare.StateDone, flare.StateArchived} {
+		assert.True(t, reachable[state], state)
+	}
+}
+
+func TestCan(t *testing.T) {
+	archived := ticketWith("Mitigated", "P1 - Critical", "")
+	archived.Fields.Labels = []string{flare.ArchivedLabel}
+	tests := []struct {
+		name                      string
+		ticket                    jira.Ticket
+		archive, reopen, escalate bool
+	}{
+		{name: "in progress p1", ticket: ticketWith("In Progress", "P1 - Critical", ""), escalate: true},
+		{name: "in progress p0", ticket: ticketWith("In Progress", "P0 - Blocker", "")},
+		{name: "mitigated", ticket: ticketWith("Mitigated", "P1 - Critical", ""), archive: true, reopen: true},
+		{name: "not a flare", ticket: ticketWith("NotAFlare", "P2 - Major", ""), archive: true, reopen: true},
+		{name: "done", ticket: ticketWith("Done", "P2 - Major", ""), archive: true},
+		{name: "archived", ticket: archived, reopen: true},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.archive, flare.CanArchive(test.ticket), "%s: archive", test.name)
+		assert.Equal(t, test.reopen, flare.CanReopen(test.ticket), "%s: reopen", test.name)
+		assert.Equal(t, test.escalate, flare.CanEscalate(test.ticket), "%s: escalate", test.name)
+	}
+}
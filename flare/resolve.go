@@ -0,0 +1,73 @@
+package flare
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Clever/flarebot/jira"
+)
+
+// Strategies Resolver uses to find the ticket for a flare channel, in the order they are tried.
+const (
+	// StrategyChannelField matches the Slack channel link fireFlare stores on the ticket.
+	StrategyChannelField = "channel-field"
+	// StrategyChannelName uses the ticket key the channel name maps to, e.g. "flare-123" is FLARE-123.
+	StrategyChannelName = "channel-name"
+	// StrategyMovedIssue follows Jira's redirect from the channel name's key to the ticket's
+	// current key after it was moved to another project.
+	StrategyMovedIssue = "moved-issue"
+)
+
+// TicketFinder is the part of the Jira client Resolver needs.
+type TicketFinder interface {
+	SearchTickets(jql string, fields []string) ([]jira.Ticket, error)
+	GetTicketByKey(key string) (*jira.Ticket, error)
+}
+
+// Resolver finds the ticket for a flare channel. The channel link on the ticket is
+// authoritative since it survives channel renames; the channel name is only a fallback for
+// tickets whose link is missing.
+type Resolver struct {
+	Client TicketFinder
+	// ChannelFieldID is the slack channel custom field. Field lookups are skipped when it or
+	// SlackOrigin is empty.
+	ChannelFieldID string
+	SlackOrigin    string
+}
+
+// Resolve returns the ticket for the channel and the strategy that found it. key is the ticket
+// key the channel name maps to.
+func (r Resolver) Resolve(channelID, key string) (*jira.Ticket, string, error) {
+	if r.ChannelFieldID != "" && r.SlackOrigin != "" && channelID != "" {
+		url := fmt.Sprintf("%s/archives/%s", strings.TrimSuffix(r.SlackOrigin, "/"), channelID)
+		jql := fmt.Sprintf(`cf[%s] = "%s"`, strings.TrimPrefix(r.ChannelFieldID, "customfield_"), url)
+		tickets, err := r.Client.SearchTickets(jql, []string{"status", "priority", "labels", r.ChannelFieldID})
+		if err != nil {
+			return nil, "", err
+		}
+		switch len(tickets) {
+		case 0:
+		case 1:
+			return &tickets[0], StrategyChannelField, nil
+		default:
+			keys := []string{}
+			for _, ticket := range tickets {
+				keys = append(keys, ticket.Key)
+			}
+			return nil, "", fmt.Errorf("channel %s is linked from multiple tickets: %s", channelID, strings.Join(keys, ", "))
+		}
+	}
+
+	ticket, err := r.Client.GetTicketByKey(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("no ticket links channel %s and looking up %s failed: %w", channelID, key, err)
+	}
+	if ticket == nil {
+		return nil, "", fmt.Errorf("no ticket links channel %s and %s was not found", channelID, key)
+	}
+	// Jira serves moved issues under their old key, so a different key means the flare moved.
+	if ticket.Key != "" && !strings.EqualFold(ticket.Key, key) {
+		return ticket, StrategyMovedIssue, nil
+	}
+	return ticket, StrategyChannelName, nil
+}
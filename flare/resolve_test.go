@@ -0,0 +1,84 @@
+package flare_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/flare"
+	"github.com/Clever/flarebot/jira"
+)
+
+type fakeFinder struct {
+	searches []string
+	search   []jira.Ticket
+	byKey    map[string]jira.Ticket
+}
+
+func (f *fakeFinder) SearchTickets(jql string, fields []string) ([]jira.Ticket, error) {
+	f.searches = append(f.searches, jql)
+	if f.search == nil {
+		return nil, errors.New("jira down")
+	}
+	return f.search, nil
+}
+
+func (f *fakeFinder) GetTicketByKey(key string) (*jira.Ticket, error) {
+	ticket, ok := f.byKey[key]
+	if !ok {
+		return nil, errors.New("Status-code:404")
+	}
+	return &ticket, nil
+}
+
+func TestResolve(t *testing.T) {
+	finder := &fakeFinder{
+		search: []jira.Ticket{},
+		byKey: map[string]jira.Ticket{
+			"FLARE-1": {Key: "FLARE-1"},
+			"FLARE-2": {Key: "INCIDENT-7"},
+		},
+	}
+	resolver := flare.Resolver{Client: finder, ChannelFieldID: "customfield_12345", SlackOrigin: "https://clever.slack.com/"}
+
+	finder.search = []jira.Ticket{{Key: "FLARE-9"}}
+	ticket, strategy, err := resolver.Resolve("C9", "FLARE-42")
+	require.NoError(t, err)
+	assert.Equal(t, "FLARE-9", ticket.Key)
+	assert.Equal(t, flare.StrategyChannelField, strategy)
+	assert.Equal(t, []string{`cf[12345] = "https://clever.slack.com/archives/C9"`}, finder.searches)
+
+	finder.search = []jira.Ticket{}
+	ticket, strategy, err = resolver.Resolve("C1", "FLARE-1")
+	require.NoError(t, err)
+	assert.Equal(t, "FLARE-1", ticket.Key)
+	assert.Equal(t, flare.StrategyChannelName, strategy)
+
+	ticket, strategy, err = resolver.Resolve("C2", "FLARE-2")
+	require.NoError(t, err)
+	assert.Equal(t, "INCIDENT-7", ticket.Key)
+	assert.Equal(t, flare.StrategyMovedIssue, strategy)
+
+	_, _, err = resolver.Resolve("C3", "FLARE-3")
+	assert.EqualError(t, err, "no ticket links channel C3 and looking up FLARE-3 failed: Status-code:404")
+
+	finder.search = []jira.Ticket{{Key: "FLARE-1"}, {Key: "FLARE-2"}}
+	_, _, err = resolver.Resolve("C1", "FLARE-1")
+	assert.EqualError(t, err, "channel C1 is linked from multiple tickets: FLARE-1, FLARE-2")
+
+	finder.search = nil
+	_, _, err = resolver.Resolve("C1", "FLARE-1")
+	assert.EqualError(t, err, "jira down")
+}
+
+func TestResolveWithoutChannelField(t *testing.T) {
+	finder := &fakeFinder{byKey: map[string]jira.Ticket{"FLARE-1": {Key: "FLARE-1"}}}
+
+	ticket, strategy, err := flare.Resolver{Client: finder}.Resolve("C1", "FLARE-1")
+	require.NoError(t, err)
+	assert.Equal(t, "FLARE-1", ticket.Key)
+	assert.Equal(t, flare.StrategyChannelName, strategy)
+	assert.Empty(t, finder.searches)
+}
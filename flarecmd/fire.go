@@ -0,0 +1,88 @@
+package flarecmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SpecialType marks flares that aren't fired for an ongoing incident.
+type SpecialType string
+
+const (
+	// Preemptive flares are fired before anything breaks, e.g. for a risky migration.
+	Preemptive SpecialType = "preemptive"
+	// Retroactive flares are fired after the fact and go straight to Mitigated.
+	Retroactive SpecialType = "retroactive"
+)
+
+// Fire is a command to fire a flare, like "fire a p1 flare checkout is down".
+type Fire struct {
+	// Priority is 0, 1 or 2. The Jira priority ID is Priority+1.
+	Priority    int
+	SpecialType SpecialType
+	Title       string
+}
+
+var priorityRegex = regexp.MustCompile(`^p\d+$`)
+
+// ParseFire parses a fire command: "fire", then optionally "a", then a priority and an
+// optional special type in either order, with "flare" allowed around them, and the title.
+// Text before "fire", like a mention of the bot, is ignored.
+func ParseFire(text string) (Fire, error) {
+	tokens := tokenize(text)
+	start := -1
+	for i, t := range tokens {
+		if t.word == "fire" {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return Fire{}, &Error{Text: text, Pos: 0, Msg: `expected "fire"`}
+	}
+
+	fire := Fire{Priority: -1}
+	i := start + 1
+	if hasWords(tokens, i, "a") {
+		i++
+	}
+	for i < len(tokens) {
+		t := tokens[i]
+		switch {
+		case t.word == "flare":
+			i++
+		case priorityRegex.MatchString(t.word):
+			if fire.Priority >= 0 {
+				return Fire{}, &Error{Text: text, Pos: t.pos, Msg: "priority given twice"}
+			}
+			if t.word != "p0" && t.word != "p1" && t.word != "p2" {
+				return Fire{}, &Error{Text: text, Pos: t.pos, Msg: fmt.Sprintf("unknown priority %s, expected p0, p1 or p2", text[t.pos:t.end])}
+			}
+			fire.Priority = int(t.word[1] - '0')
+			i++
+		case t.word == "preemptive" || t.word == "pre-emptive" || t.word == "retroactive" || hasWords(tokens, i, "pre", "emptive"):
+			if fire.SpecialType != "" {
+				return Fire{}, &Error{Text: text, Pos: t.pos, Msg: "special type given twice"}
+			}
+			fire.SpecialType = Preemptive
+			if t.word == "retroactive" {
+				fire.SpecialType = Retroactive
+			}
+			if t.word == "pre" {
+				i++
+			}
+			i++
+		default:
+			if fire.Priority < 0 {
+				return Fire{}, &Error{Text: text, Pos: t.pos, Msg: "expected a priority p0, p1 or p2"}
+			}
+			fire.Title = strings.TrimSpace(text[t.pos:])
+			return fire, nil
+		}
+	}
+	if fire.Priority < 0 {
+		return Fire{}, &Error{Text: text, Pos: len(text), Msg: "expected a priority p0, p1 or p2"}
+	}
+	return Fire{}, &Error{Text: text, Pos: len(text), Msg: "expected a title"}
+}
@@ -0,0 +1,65 @@
+package flarecmd_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/flarecmd"
+)
+
+func TestParseFire(t *testing.T) {
+	// the cases of src/listeners/messages/fireFlare.test.ts, and a few more
+	tests := []struct {
+		text     string
+		expected flarecmd.Fire
+	}{
+		{text: "fire a flare p0 Something broke", expected: flarecmd.Fire{Priority: 0, Title: "Something broke"}},
+		{text: "fire a p1 flare Something else", expected: flarecmd.Fire{Priority: 1, Title: "Something else"}},
+		{text: "fire flare p2 Another p2 issue", expected: flarecmd.Fire{Priority: 2, Title: "Another p2 issue"}},
+		{text: "fire p0 flare Yet another issue", expected: flarecmd.Fire{Priority: 0, Title: "Yet another issue"}},
+		{text: "fire p1 Something urgent", expected: flarecmd.Fire{Priority: 1, Title: "Something urgent"}},
+		{text: "fire    a    flare   p2   flare   Lots of spaces", expected: flarecmd.Fire{Priority: 2, Title: "Lots of spaces"}},
+		{text: "FIRE A FLARE P0 UPPERCASE", expected: flarecmd.Fire{Priority: 0, Title: "UPPERCASE"}},
+		{text: "fire a pre-emptive flare p0 Something broke", expected: flarecmd.Fire{Priority: 0, SpecialType: flarecmd.Preemptive, Title: "Something broke"}},
+		{text: "fire a retroactive p1 flare Something else", expected: flarecmd.Fire{Priority: 1, SpecialType: flarecmd.Retroactive, Title: "Something else"}},
+		{text: "fire a flare preemptive p0 Something broke", expected: flarecmd.Fire{Priority: 0, SpecialType: flarecmd.Preemptive, Title: "Something broke"}},
+		{text: "fire a p2 preemptive flare everything could go down", expected: flarecmd.Fire{Priority: 2, SpecialType: flarecmd.Preemptive, Title: "everything could go down"}},
+		{text: "fire a pre emptive p1 db failover", expected: flarecmd.Fire{Priority: 1, SpecialType: flarecmd.Preemptive, Title: "db failover"}},
+		{text: "<@U123> fire a p1 flare checkout is down ", expected: flarecmd.Fire{Priority: 1, Title: "checkout is down"}},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			fire, err := flarecmd.ParseFire(test.text)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, fire)
+		})
+	}
+}
+
+func TestParseFireErrors(t *testing.T) {
+	tests := []struct {
+		text   string
+		column int
+		msg    string
+	}{
+		{text: "fire p3 Not a valid priority", column: 6, msg: "unknown priority p3, expected p0, p1 or p2"},
+		{text: "fire flare p1", column: 14, msg: "expected a title"},
+		{text: "fire a retroactive flare not allowed without priority", column: 26, msg: "expected a priority p0, p1 or p2"},
+		{text: "fire a preemptive retroactive p1 x", column: 19, msg: "special type given twice"},
+		{text: "fire p0 p1 x", column: 9, msg: "priority given twice"},
+		{text: "fire a flare", column: 13, msg: "expected a priority p0, p1 or p2"},
+		{text: "ceasefire p1 x", column: 1, msg: `expected "fire"`},
+		{text: "🔥 fire P9 x", column: 8, msg: "unknown priority P9, expected p0, p1 or p2"},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			_, err := flarecmd.ParseFire(test.text)
+			var parseErr *flarecmd.Error
+			require.ErrorAs(t, err, &parseErr)
+			assert.Equal(t, test.msg, parseErr.Msg)
+			assert.Equal(t, test.column, parseErr.Column())
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Package flarecmd parses the commands people send flarebot in Slack, so Go automation that
+// opens or transitions flares, e.g. from alerts or emails, validates input the same way the
+// app does. It follows fireAFlareRegex and extractPriorityAndTitle in
+// src/listeners/messages/fireFlare.ts, flareTransitionRegex in
+// src/listeners/messages/flareTransition.ts, and the role regexes in incidentLead.ts and
+// commsLead.ts.
+package flarecmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Error is a command that couldn't be parsed. Pos is the byte offset in Text where parsing
+// failed, e.g. the start of an invalid priority.
+type Error struct {
+	Text string
+	Pos  int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Msg, e.Column())
+}
+
+// Column is the 1-based column of Pos, counting characters rather than bytes.
+func (e *Error) Column() int {
+	return utf8.RuneCountInString(e.Text[:e.Pos]) + 1
+}
+
+// token is a whitespace separated word of a command. word is lower cased, without the
+// punctuation people end sentences with.
+type token struct {
+	pos  int
+	end  int
+	word string
+}
+
+func tokenize(text string) []token {
+	tokens := []token{}
+	start := -1
+	for i, r := range text + " " {
+		switch {
+		case unicode.IsSpace(r) && start >= 0:
+			word := strings.TrimRight(strings.ToLower(text[start:i]), ".,!?;:")
+			// Slack clients often send curly apostrophes
+			word = strings.ReplaceAll(word, "’", "'")
+			tokens = append(tokens, token{pos: start, end: i, word: word})
+			start = -1
+		case !unicode.IsSpace(r) && start < 0:
+			start = i
+		}
+	}
+	return tokens
+}
+
+// hasWords reports whether the tokens starting at i are words.
+func hasWords(tokens []token, i int, words ...string) bool {
+	if i+len(words) > len(tokens) {
+		return false
+	}
+	for j, word := range words {
+		if tokens[i+j].word != word {
+			return false
+		}
+	}
+	return true
+}
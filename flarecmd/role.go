@@ -0,0 +1,57 @@
+package flarecmd
+
+// Role is a flare role people take on in the flare channel.
+type Role string
+
+const (
+	IncidentLead Role = "incident lead"
+	CommsLead    Role = "comms lead"
+)
+
+var roles = map[Role][]string{
+	IncidentLead: {"incident", "lead"},
+	CommsLead:    {"comms", "lead"},
+}
+
+// RoleAssignment is someone claiming a role, like "i'm the incident lead". The person is
+// whoever sent the command.
+type RoleAssignment struct {
+	Role Role
+	// Pos is the byte offset of the role in the command.
+	Pos int
+}
+
+// ParseRole accepts a command that starts with the role, a mention followed by the role, like
+// "@flarebot incident lead", or "i am", "i'm", "i am the" or "i'm the" followed by the role
+// anywhere in the text. Other mentions of a role, like "who is incident lead", aren't
+// assignments.
+func ParseRole(text string) (RoleAssignment, error) {
+	tokens := tokenize(text)
+	for _, role := range []Role{IncidentLead, CommsLead} {
+		words := roles[role]
+		if hasWords(tokens, 0, words...) {
+			return RoleAssignment{Role: role, Pos: tokens[0].pos}, nil
+		}
+		if len(tokens) == len(words)+1 && hasWords(tokens, 1, words...) {
+			return RoleAssignment{Role: role, Pos: tokens[1].pos}, nil
+		}
+		for i := range tokens {
+			j := i
+			switch {
+			case hasWords(tokens, j, "i'm"):
+				j++
+			case hasWords(tokens, j, "i", "am"):
+				j += 2
+			default:
+				continue
+			}
+			if hasWords(tokens, j, "the") {
+				j++
+			}
+			if hasWords(tokens, j, words...) {
+				return RoleAssignment{Role: role, Pos: tokens[j].pos}, nil
+			}
+		}
+	}
+	return RoleAssignment{}, &Error{Text: text, Pos: 0, Msg: `expected "i'm the incident lead" or "i'm the comms lead"`}
+}
@@ -0,0 +1,42 @@
+package flarecmd_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Clever/flarebot/flarecmd"
+)
+
+func TestParseRole(t *testing.T) {
+	// the cases of src/listeners/messages/incidentLead.test.ts and commsLead.test.ts
+	for _, role := range []flarecmd.Role{flarecmd.IncidentLead, flarecmd.CommsLead} {
+		name := string(role)
+		for _, text := range []string{
+			"@somebot " + name,
+			name,
+			"i am " + name,
+			"I am " + name,
+			"i'm " + name,
+			"I'm " + name,
+			"i am the " + name,
+			"I am the " + name,
+			"i'm the " + name,
+			"I’m the " + name + "!",
+			"Hey everyone, i am " + name + " for this issue",
+		} {
+			t.Run(text, func(t *testing.T) {
+				assignment, err := flarecmd.ParseRole(text)
+				assert.NoError(t, err)
+				assert.Equal(t, role, assignment.Role)
+			})
+		}
+		for _, text := range []string{"you are " + name, "who is " + name, "i am not the " + name} {
+			t.Run(text, func(t *testing.T) {
+				_, err := flarecmd.ParseRole(text)
+				var parseErr *flarecmd.Error
+				assert.ErrorAs(t, err, &parseErr)
+			})
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package flarecmd
+
+import "github.com/Clever/flarebot/flare"
+
+// TransitionKind is where a transition command moves the flare.
+type TransitionKind string
+
+const (
+	Mitigated   TransitionKind = "mitigated"
+	NotAFlare   TransitionKind = "not a flare"
+	Unmitigated TransitionKind = "unmitigated"
+)
+
+// Transition is a command to move a flare to another status, like "flare is mitigated".
+type Transition struct {
+	Kind TransitionKind
+	// Phrase is what was said, like "mitigate" or "not flare", as extractFlareTransition
+	// returns it.
+	Phrase string
+	// Pos is the byte offset of Phrase in the command.
+	Pos int
+}
+
+// Status is the Jira status the transition moves the ticket to.
+func (t Transition) Status() string {
+	switch t.Kind {
+	case Mitigated:
+		return flare.StatusMitigated
+	case NotAFlare:
+		return flare.StatusNotAFlare
+	default:
+		return flare.StatusInProgress
+	}
+}
+
+// Event is the lifecycle event the command fires, see flare.Next.
+func (t Transition) Event() flare.Event {
+	switch t.Kind {
+	case Mitigated:
+		return flare.EventMitigate
+	case NotAFlare:
+		return flare.EventNotAFlare
+	default:
+		return flare.EventUnmitigate
+	}
+}
+
+var transitionWords = map[string]TransitionKind{
+	"mitigated":   Mitigated,
+	"mitigate":    Mitigated,
+	"unmitigated": Unmitigated,
+	"unmitigate":  Unmitigated,
+}
+
+// ParseTransition finds the first "mitigated", "not a flare" or "unmitigated" in the command,
+// or "mitigate", "not flare" or "unmitigate", anywhere in the text, so "the flare is
+// mitigated now" works.
+func ParseTransition(text string) (Transition, error) {
+	tokens := tokenize(text)
+	for i, t := range tokens {
+		if kind, ok := transitionWords[t.word]; ok {
+			return Transition{Kind: kind, Phrase: t.word, Pos: t.pos}, nil
+		}
+		if hasWords(tokens, i, "not", "a", "flare") {
+			return Transition{Kind: NotAFlare, Phrase: "not a flare", Pos: t.pos}, nil
+		}
+		if hasWords(tokens, i, "not", "flare") {
+			return Transition{Kind: NotAFlare, Phrase: "not flare", Pos: t.pos}, nil
+		}
+	}
+	return Transition{}, &Error{Text: text, Pos: 0, Msg: `expected "mitigated", "not a flare" or "unmitigated"`}
+}
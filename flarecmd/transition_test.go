@@ -0,0 +1,68 @@
+package flarecmd_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/flare"
+	"github.com/Clever/flarebot/flarecmd"
+)
+
+func TestParseTransition(t *testing.T) {
+	// the cases of src/listeners/messages/flareTransition.test.ts
+	tests := []struct {
+		text   string
+		phrase string
+		kind   flarecmd.TransitionKind
+	}{
+		{text: "mitigated", phrase: "mitigated", kind: flarecmd.Mitigated},
+		{text: "mitigate", phrase: "mitigate", kind: flarecmd.Mitigated},
+		{text: "flare mitigated", phrase: "mitigated", kind: flarecmd.Mitigated},
+		{text: "flare is mitigated", phrase: "mitigated", kind: flarecmd.Mitigated},
+		{text: "unmitigated", phrase: "unmitigated", kind: flarecmd.Unmitigated},
+		{text: "unmitigate", phrase: "unmitigate", kind: flarecmd.Unmitigated},
+		{text: "flare unmitigated", phrase: "unmitigated", kind: flarecmd.Unmitigated},
+		{text: "not a flare", phrase: "not a flare", kind: flarecmd.NotAFlare},
+		{text: "not flare", phrase: "not flare", kind: flarecmd.NotAFlare},
+		{text: "flare not a flare", phrase: "not a flare", kind: flarecmd.NotAFlare},
+		{text: "flare not flare", phrase: "not flare", kind: flarecmd.NotAFlare},
+		{text: "flare is not a flare", phrase: "not a flare", kind: flarecmd.NotAFlare},
+		{text: "flare is not flare", phrase: "not flare", kind: flarecmd.NotAFlare},
+		{text: "MITIGATED", phrase: "mitigated", kind: flarecmd.Mitigated},
+		{text: "UNMITIGATED", phrase: "unmitigated", kind: flarecmd.Unmitigated},
+		{text: "NOT A FLARE", phrase: "not a flare", kind: flarecmd.NotAFlare},
+		{text: "NOT FLARE", phrase: "not flare", kind: flarecmd.NotAFlare},
+		{text: "The flare is mitigated now", phrase: "mitigated", kind: flarecmd.Mitigated},
+		{text: "Please mitigate the flare", phrase: "mitigate", kind: flarecmd.Mitigated},
+		{text: "flare was mitigated", phrase: "mitigated", kind: flarecmd.Mitigated},
+		{text: "mitigated flare", phrase: "mitigated", kind: flarecmd.Mitigated},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			transition, err := flarecmd.ParseTransition(test.text)
+			require.NoError(t, err)
+			assert.Equal(t, test.kind, transition.Kind)
+			assert.Equal(t, test.phrase, transition.Phrase)
+		})
+	}
+
+	for _, text := range []string{"flare", "mitigation", "unmitigation", "flare is", "flare mitigation"} {
+		t.Run(text, func(t *testing.T) {
+			_, err := flarecmd.ParseTransition(text)
+			var parseErr *flarecmd.Error
+			assert.ErrorAs(t, err, &parseErr)
+		})
+	}
+}
+
+func TestTransitionStatusAndEvent(t *testing.T) {
+	transition, err := flarecmd.ParseTransition("<@U123> flare is unmitigated.")
+	require.NoError(t, err)
+	assert.Equal(t, 17, transition.Pos)
+	assert.Equal(t, flare.StatusInProgress, transition.Status())
+	assert.Equal(t, flare.EventUnmitigate, transition.Event())
+	assert.Equal(t, flare.StatusMitigated, flarecmd.Transition{Kind: flarecmd.Mitigated}.Status())
+	assert.Equal(t, flare.StatusNotAFlare, flarecmd.Transition{Kind: flarecmd.NotAFlare}.Status())
+}
@@ -0,0 +1,192 @@
+package followup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Holidays are the days of an iCalendar (ICS) file's events, like a company holiday calendar.
+type Holidays struct {
+	// days maps "2006-01-02" to the event's summary, yearly maps "01-02" for events that repeat
+	// every year on the same date
+	days   map[string]string
+	yearly map[string]string
+
+	// Skipped are the events that were left out because their recurrence isn't supported, with
+	// the reason, so callers can log them.
+	Skipped []error
+}
+
+// On reports whether day is a holiday, using the date in day's location, and the holiday's name.
+// It's safe to call on nil Holidays.
+func (h *Holidays) On(day time.Time) (string, bool) {
+	if h == nil {
+		return "", false
+	}
+	if name, ok := h.days[day.Format("2006-01-02")]; ok {
+		return name, true
+	}
+	name, ok := h.yearly[day.Format("01-02")]
+	return name, ok
+}
+
+// ParseICS reads the events of an iCalendar file. All-day events cover the days from DTSTART up
+// to, but not including, DTEND. Events with a time cover the date they start on in location, the
+// schedule's time zone, so an event at 20261224T230000Z can be on December 25th; times without a
+// zone or TZID are read in location too. A nil location is UTC. The only recurrence supported is
+// RRULE:FREQ=YEARLY, for holidays on a fixed date; other rules, like "the fourth Thursday of
+// November", are skipped and listed in Skipped rather than failing the whole calendar.
+func ParseICS(r io.Reader, location *time.Location) (*Holidays, error) {
+	if location == nil {
+		location = time.UTC
+	}
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	h := &Holidays{days: map[string]string{}, yearly: map[string]string{}}
+	var event map[string]property
+	for n, line := range lines {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		// split off parameters like DTSTART;VALUE=DATE or DTSTART;TZID=America/Los_Angeles
+		name, params, _ := strings.Cut(name, ";")
+		name = strings.ToUpper(name)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = map[string]property{}
+		case name == "END" && value == "VEVENT":
+			if err := h.add(event, location); errors.Is(err, errUnsupportedRule) {
+				h.Skipped = append(h.Skipped, fmt.Errorf("event %q ending on line %d: %w", event["SUMMARY"].value, n+1, err))
+			} else if err != nil {
+				return nil, fmt.Errorf("event ending on line %d: %w", n+1, err)
+			}
+			event = nil
+		case event != nil:
+			event[name] = property{value: value, tzid: tzid(params)}
+		}
+	}
+	return h, nil
+}
+
+// property is the value of an event's line and its TZID parameter, if any.
+type property struct {
+	value string
+	tzid  string
+}
+
+// tzid finds the TZID among a line's parameters, e.g. "TZID=America/Los_Angeles;VALUE=DATE-TIME".
+func tzid(params string) string {
+	for _, param := range strings.Split(params, ";") {
+		if name, value, found := strings.Cut(param, "="); found && strings.EqualFold(name, "TZID") {
+			return strings.Trim(value, `"`)
+		}
+	}
+	return ""
+}
+
+// unfold joins the continuation lines of an ICS file, which start with a space or tab.
+func unfold(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+func (h *Holidays) add(event map[string]property, location *time.Location) error {
+	start, err := parseDate(event["DTSTART"], location)
+	if err != nil {
+		return fmt.Errorf("invalid DTSTART: %w", err)
+	}
+	end := start.AddDate(0, 0, 1)
+	if prop, ok := event["DTEND"]; ok && len(prop.value) == len(dateLayout) {
+		if end, err = parseDate(prop, location); err != nil {
+			return fmt.Errorf("invalid DTEND: %w", err)
+		}
+	}
+	summary := event["SUMMARY"].value
+
+	if prop, ok := event["RRULE"]; ok {
+		if err := checkYearly(prop.value, start); err != nil {
+			return err
+		}
+		for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+			h.yearly[day.Format("01-02")] = summary
+		}
+		return nil
+	}
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		h.days[day.Format("2006-01-02")] = summary
+	}
+	return nil
+}
+
+// errUnsupportedRule is returned for recurrences other than once a year on DTSTART's date.
+var errUnsupportedRule = errors.New("unsupported RRULE")
+
+// checkYearly accepts a rule that repeats every year on start's date, like FREQ=YEARLY or the
+// FREQ=YEARLY;BYMONTH=12;BYMONTHDAY=25 calendar apps export.
+func checkYearly(rule string, start time.Time) error {
+	yearly := false
+	for _, part := range strings.Split(strings.ToUpper(rule), ";") {
+		name, value, _ := strings.Cut(part, "=")
+		switch {
+		case name == "FREQ" && value == "YEARLY":
+			yearly = true
+		case name == "INTERVAL" && value == "1", name == "WKST":
+		case name == "BYMONTH" && value == strconv.Itoa(int(start.Month())):
+		case name == "BYMONTHDAY" && value == strconv.Itoa(start.Day()):
+		default:
+			return fmt.Errorf("%w %q, only FREQ=YEARLY on the start date is supported", errUnsupportedRule, rule)
+		}
+	}
+	if !yearly {
+		return fmt.Errorf("%w %q, only FREQ=YEARLY on the start date is supported", errUnsupportedRule, rule)
+	}
+	return nil
+}
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+)
+
+// parseDate reads the date of an ICS DATE (20261225) or DATE-TIME value. DATE-TIMEs are UTC
+// (20261225T090000Z), in their TZID, or floating, and their date is taken in location.
+func parseDate(prop property, location *time.Location) (time.Time, error) {
+	value := prop.value
+	if len(value) == len(dateLayout) {
+		return time.Parse(dateLayout, value)
+	}
+	zone := location
+	switch {
+	case strings.HasSuffix(value, "Z"):
+		zone = time.UTC
+		value = strings.TrimSuffix(value, "Z")
+	case prop.tzid != "":
+		var err error
+		if zone, err = time.LoadLocation(prop.tzid); err != nil {
+			return time.Time{}, fmt.Errorf("unknown TZID %q", prop.tzid)
+		}
+	}
+	t, err := time.ParseInLocation(dateTimeLayout, value, zone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date or date-time", prop.value)
+	}
+	t = t.In(location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
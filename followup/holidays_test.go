@@ -0,0 +1,125 @@
+package followup_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/followup"
+)
+
+func loadHolidays(t *testing.T) *followup.Holidays {
+	file, err := os.Open("testdata/holidays.ics")
+	require.NoError(t, err)
+	defer file.Close()
+	holidays, err := followup.ParseICS(file, time.UTC)
+	require.NoError(t, err)
+	return holidays
+}
+
+func TestParseICS(t *testing.T) {
+	holidays := loadHolidays(t)
+	tests := []struct {
+		date    string
+		holiday string
+	}{
+		{date: "2026-11-25"},
+		{date: "2026-11-26", holiday: "Thanksgiving Break"},
+		{date: "2026-11-27", holiday: "Thanksgiving Break"},
+		{date: "2026-11-28"},
+		{date: "2027-01-01", holiday: "New Year's Day"},
+		{date: "2026-10-15", holiday: "Engineering offsite"},
+	}
+	for _, test := range tests {
+		day, err := time.Parse("2006-01-02", test.date)
+		require.NoError(t, err)
+		name, ok := holidays.On(day)
+		assert.Equal(t, test.holiday != "", ok, test.date)
+		assert.Equal(t, test.holiday, name, test.date)
+	}
+
+	var none *followup.Holidays
+	_, ok := none.On(time.Now())
+	assert.False(t, ok)
+}
+
+func TestParseICSTimeZones(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	pacific, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+
+	tests := []struct {
+		description string
+		dtstart     string
+		location    *time.Location
+		date        string
+	}{
+		{description: "UTC times are on their date in the schedule's zone", dtstart: "DTSTART:20261224T230000Z",
+			location: berlin, date: "2026-12-25"},
+		{description: "UTC times can fall on the day before", dtstart: "DTSTART:20261225T030000Z",
+			location: pacific, date: "2026-12-24"},
+		{description: "TZID times are converted", dtstart: "DTSTART;TZID=America/Los_Angeles:20261224T200000",
+			location: berlin, date: "2026-12-25"},
+		{description: "floating times are in the schedule's zone", dtstart: "DTSTART:20261224T230000",
+			location: pacific, date: "2026-12-24"},
+		{description: "a nil location is UTC", dtstart: "DTSTART;TZID=Europe/Berlin:20261225T003000",
+			date: "2026-12-24"},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			ics := "BEGIN:VEVENT\n" + test.dtstart + "\nSUMMARY:Holiday\nEND:VEVENT\n"
+			holidays, err := followup.ParseICS(strings.NewReader(ics), test.location)
+			require.NoError(t, err)
+			day, err := time.Parse("2006-01-02", test.date)
+			require.NoError(t, err)
+			_, ok := holidays.On(day)
+			assert.True(t, ok, "expected a holiday on %s", test.date)
+			_, ok = holidays.On(day.AddDate(0, 0, 1))
+			assert.False(t, ok)
+			_, ok = holidays.On(day.AddDate(0, 0, -1))
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestParseICSRecurrence(t *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VEVENT", "DTSTART;VALUE=DATE:20261225", "RRULE:FREQ=YEARLY;BYMONTH=12;BYMONTHDAY=25", "SUMMARY:Christmas", "END:VEVENT",
+		"BEGIN:VEVENT", "DTSTART;VALUE=DATE:20260704", "RRULE:FREQ=YEARLY;INTERVAL=1;WKST=SU", "SUMMARY:Independence Day", "END:VEVENT",
+		"BEGIN:VEVENT", "DTSTART;VALUE=DATE:20261126", "RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=4TH", "SUMMARY:Thanksgiving", "END:VEVENT",
+		"BEGIN:VEVENT", "DTSTART;VALUE=DATE:20260101", "RRULE:FREQ=YEARLY;BYMONTH=2", "SUMMARY:Mismatched", "END:VEVENT",
+	}, "\n")
+	holidays, err := followup.ParseICS(strings.NewReader(ics), time.UTC)
+	require.NoError(t, err, "unsupported rules skip their event rather than the calendar")
+
+	for date, holiday := range map[string]string{"2031-12-25": "Christmas", "2027-07-04": "Independence Day"} {
+		day, err := time.Parse("2006-01-02", date)
+		require.NoError(t, err)
+		name, ok := holidays.On(day)
+		assert.True(t, ok, date)
+		assert.Equal(t, holiday, name)
+	}
+	_, ok := holidays.On(time.Date(2026, 11, 26, 0, 0, 0, 0, time.UTC))
+	assert.False(t, ok)
+	if assert.Len(t, holidays.Skipped, 2) {
+		assert.Contains(t, holidays.Skipped[0].Error(), `event "Thanksgiving" ending on line 15: unsupported RRULE "FREQ=YEARLY;BYMONTH=11;BYDAY=4TH"`)
+		assert.Contains(t, holidays.Skipped[1].Error(), `"Mismatched"`)
+	}
+}
+
+func TestParseICSErrors(t *testing.T) {
+	for _, invalid := range []string{
+		"BEGIN:VEVENT\nDTSTART;VALUE=DATE:2026\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nSUMMARY:No start\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART;TZID=Mars/Olympus_Mons:20261126T090000\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART:20261126T0900\nEND:VEVENT\n",
+	} {
+		_, err := followup.ParseICS(strings.NewReader(invalid), time.UTC)
+		assert.Error(t, err, invalid)
+	}
+}
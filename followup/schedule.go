@@ -0,0 +1,120 @@
+// Package followup decides when flare followup reminders are posted. The app used to schedule
+// them for "Thursday 15:00" (flareTransition.ts); a Schedule makes the weekly slots, their time
+// zone and the holidays to skip configurable. Nothing here reads the clock, so callers pass the
+// time in and tests can use any clock they like.
+package followup
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Slot is a weekly time followups can be scheduled for, in the schedule's time zone.
+type Slot struct {
+	Weekday time.Weekday
+	Hour    int
+	Minute  int
+}
+
+func (s Slot) String() string {
+	return fmt.Sprintf("%s %02d:%02d", s.Weekday.String()[:3], s.Hour, s.Minute)
+}
+
+// Schedule is when followup reminders are posted.
+type Schedule struct {
+	Slots    []Slot
+	Location *time.Location
+	// Holidays are skipped, nil for none.
+	Holidays *Holidays
+}
+
+// maxDays bounds the search for a slot, in case holidays cover every slot.
+const maxDays = 366
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule reads comma separated slots like "Thu 15:00" or "Tue 10:00, Thu 15:00" in the
+// named time zone, e.g. "America/Los_Angeles". An empty zone is UTC.
+func ParseSchedule(slots, zone string) (Schedule, error) {
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return Schedule{}, fmt.Errorf("invalid time zone %q: %w", zone, err)
+	}
+	schedule := Schedule{Location: location}
+	for _, value := range strings.Split(slots, ",") {
+		slot, err := parseSlot(strings.TrimSpace(value))
+		if err != nil {
+			return Schedule{}, err
+		}
+		schedule.Slots = append(schedule.Slots, slot)
+	}
+	sort.Slice(schedule.Slots, func(i, j int) bool {
+		a, b := schedule.Slots[i], schedule.Slots[j]
+		if a.Weekday != b.Weekday {
+			return a.Weekday < b.Weekday
+		}
+		return a.Hour*60+a.Minute < b.Hour*60+b.Minute
+	})
+	return schedule, nil
+}
+
+func parseSlot(value string) (Slot, error) {
+	day, clock, found := strings.Cut(value, " ")
+	weekday, ok := weekdays[strings.ToLower(day)]
+	if !found || !ok {
+		return Slot{}, fmt.Errorf("invalid slot %q, expected a day and time like Thu 15:00", value)
+	}
+	hour, minute, found := strings.Cut(strings.TrimSpace(clock), ":")
+	h, hErr := strconv.Atoi(hour)
+	m, mErr := strconv.Atoi(minute)
+	if !found || hErr != nil || mErr != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return Slot{}, fmt.Errorf("invalid slot %q, expected a day and time like Thu 15:00", value)
+	}
+	return Slot{Weekday: weekday, Hour: h, Minute: m}, nil
+}
+
+// Next returns when the followup reminder for a flare mitigated at t is due: the first slot
+// after t that isn't on a holiday. A flare mitigated on a slot's day after the day's last slot is
+// due right away, at t, instead of a week later, like the app does on Thursday afternoons.
+func (s Schedule) Next(t time.Time) (time.Time, error) {
+	if len(s.Slots) == 0 {
+		return time.Time{}, errors.New("the followup schedule has no slots")
+	}
+	location := s.Location
+	if location == nil {
+		location = time.UTC
+	}
+	local := t.In(location)
+	for days := 0; days < maxDays; days++ {
+		// time.Date normalizes the day and applies the zone's offset on that date, so slots
+		// stay at the same wall clock time across daylight saving changes
+		day := time.Date(local.Year(), local.Month(), local.Day()+days, 0, 0, 0, 0, location)
+		if _, holiday := s.Holidays.On(day); holiday {
+			continue
+		}
+		// slots are sorted, so the first one still ahead is the next
+		passed := false
+		for _, slot := range s.Slots {
+			if slot.Weekday != day.Weekday() {
+				continue
+			}
+			at := time.Date(day.Year(), day.Month(), day.Day(), slot.Hour, slot.Minute, 0, 0, location)
+			if days == 0 && !at.After(local) {
+				passed = true
+				continue
+			}
+			return at, nil
+		}
+		if passed {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("no followup slot in the %d days after %s", maxDays, t.Format(time.RFC3339))
+}
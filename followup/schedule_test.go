@@ -0,0 +1,87 @@
+package followup_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/followup"
+)
+
+func TestParseSchedule(t *testing.T) {
+	schedule, err := followup.ParseSchedule("thu 15:00, Tue 9:30", "America/Los_Angeles")
+	require.NoError(t, err)
+	assert.Equal(t, []followup.Slot{{Weekday: time.Tuesday, Hour: 9, Minute: 30}, {Weekday: time.Thursday, Hour: 15}}, schedule.Slots)
+	assert.Equal(t, "America/Los_Angeles", schedule.Location.String())
+	assert.Equal(t, "Tue 09:30", schedule.Slots[0].String())
+
+	for _, invalid := range []struct{ slots, zone string }{
+		{slots: "Thursday 15:00"},
+		{slots: "Thu"},
+		{slots: "Thu 25:00"},
+		{slots: "Thu 15:00,"},
+		{slots: "Thu 15:00", zone: "Mars/Olympus_Mons"},
+	} {
+		_, err := followup.ParseSchedule(invalid.slots, invalid.zone)
+		assert.Error(t, err, invalid.slots)
+	}
+}
+
+func TestNext(t *testing.T) {
+	utc, err := followup.ParseSchedule("Thu 15:00", "")
+	require.NoError(t, err)
+	pacific, err := followup.ParseSchedule("Thu 08:00", "America/Los_Angeles")
+	require.NoError(t, err)
+	withHolidays := pacific
+	withHolidays.Holidays = loadHolidays(t)
+	twice, err := followup.ParseSchedule("Tue 10:00, Thu 15:00", "")
+	require.NoError(t, err)
+	sameDay, err := followup.ParseSchedule("Thu 15:00, Thu 09:00", "")
+	require.NoError(t, err)
+
+	tests := []struct {
+		description string
+		schedule    followup.Schedule
+		mitigated   string
+		expected    string
+	}{
+		{description: "later in the week", schedule: utc,
+			mitigated: "2026-10-19T12:00:00Z", expected: "2026-10-22T15:00:00Z"},
+		{description: "the slot's day before the slot", schedule: utc,
+			mitigated: "2026-10-22T09:00:00Z", expected: "2026-10-22T15:00:00Z"},
+		{description: "the slot's day after the slot is due right away", schedule: utc,
+			mitigated: "2026-10-22T16:30:00Z", expected: "2026-10-22T16:30:00Z"},
+		{description: "after the slot's day waits a week", schedule: utc,
+			mitigated: "2026-10-23T01:00:00Z", expected: "2026-10-29T15:00:00Z"},
+		{description: "slots are in the schedule's time zone", schedule: pacific,
+			mitigated: "2026-10-20T12:00:00Z", expected: "2026-10-22T15:00:00Z"},
+		{description: "slots keep their wall clock time across daylight saving", schedule: pacific,
+			mitigated: "2026-10-30T12:00:00Z", expected: "2026-11-05T16:00:00Z"},
+		{description: "the day is read in the schedule's time zone", schedule: pacific,
+			mitigated: "2026-10-23T02:00:00Z", expected: "2026-10-22T19:00:00-07:00"},
+		{description: "holidays are skipped", schedule: withHolidays,
+			mitigated: "2026-11-24T12:00:00Z", expected: "2026-12-03T16:00:00Z"},
+		{description: "the next of several slots", schedule: twice,
+			mitigated: "2026-10-23T12:00:00Z", expected: "2026-10-27T10:00:00Z"},
+		{description: "between two slots on the same day waits for the later one", schedule: sameDay,
+			mitigated: "2026-10-22T10:00:00Z", expected: "2026-10-22T15:00:00Z"},
+		{description: "after every slot of the day is due right away", schedule: sameDay,
+			mitigated: "2026-10-22T16:00:00Z", expected: "2026-10-22T16:00:00Z"},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mitigated, err := time.Parse(time.RFC3339, test.mitigated)
+			require.NoError(t, err)
+			expected, err := time.Parse(time.RFC3339, test.expected)
+			require.NoError(t, err)
+			next, err := test.schedule.Next(mitigated)
+			require.NoError(t, err)
+			assert.True(t, expected.Equal(next), "expected %s, got %s", expected, next)
+		})
+	}
+
+	_, err = followup.Schedule{}.Next(time.Now())
+	assert.Error(t, err)
+}
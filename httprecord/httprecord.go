@@ -0,0 +1,421 @@
+// Package httprecord records the HTTP traffic of a run to a cassette and replays it later, so a
+// run that misbehaved in production can be re-run locally against the same Slack and Jira
+// answers. Secrets and people's emails, names and phone numbers are redacted before anything is
+// written. Message text and ticket fields are kept, since replays depend on them.
+package httprecord
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Redacted replaces secrets and personal data in cassettes.
+const Redacted = "REDACTED"
+
+// secretParams are query and form parameters that always hold credentials, like Slack's token,
+// or personal data, like the email users.lookupByEmail is sent.
+var secretParams = []string{"token", "client_secret", "email"}
+
+// personalFields are the JSON fields of Slack and Jira users that identify a person.
+var personalFields = map[string]bool{
+	"email": true, "emailAddress": true, "phone": true,
+	"real_name": true, "real_name_normalized": true, "display_name": true, "display_name_normalized": true,
+	"displayName": true, "first_name": true, "last_name": true,
+}
+
+// personKeys mark a JSON object as a Slack or Jira user, whose "name" is redacted too. Other
+// objects, like channels and statuses, keep their names.
+var personKeys = []string{"profile", "real_name", "accountId", "emailAddress"}
+
+// keptHeaders are the only headers written to cassettes. Everything else, like Authorization and
+// cookies, is dropped.
+var keptHeaders = []string{"Content-Type", "Retry-After"}
+
+// Cassette is a recorded session.
+type Cassette struct {
+	// RecordedAt is when the recording started, so a replay can run at the same time.
+	RecordedAt   time.Time     `json:"recordedAt"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a request and the response it got.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+type Response struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Body is written as a string, or as base64 when it isn't UTF-8, like a downloaded file.
+type Body []byte
+
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = Body(text)
+		return nil
+	}
+	var encoded struct {
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded.Base64)
+	*b = decoded
+	return err
+}
+
+// Load reads a cassette file.
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("reading cassette %s: %w", path, err)
+	}
+	return &cassette, nil
+}
+
+// Marshal encodes the cassette as indented JSON, so recordings diff well.
+func (c *Cassette) Marshal() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// Save writes the cassette to a file.
+func (c *Cassette) Save(path string) error {
+	data, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// redactor scrubs credentials from requests and responses.
+type redactor struct {
+	secrets []string
+}
+
+func newRedactor(secrets []string) redactor {
+	r := redactor{}
+	for _, secret := range secrets {
+		// short values would redact unrelated text
+		if len(secret) >= 4 {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+	return r
+}
+
+func (r redactor) text(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	return s
+}
+
+func (r redactor) url(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	query := redacted.Query()
+	for _, param := range secretParams {
+		if query.Has(param) {
+			query.Set(param, Redacted)
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	return r.text(redacted.String())
+}
+
+func (r redactor) header(header http.Header) http.Header {
+	kept := http.Header{}
+	for _, name := range keptHeaders {
+		if values, ok := header[name]; ok {
+			kept[name] = values
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+func (r redactor) body(contentType string, body []byte) []byte {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/x-www-form-urlencoded" {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for _, param := range secretParams {
+				if form.Has(param) {
+					form.Set(param, Redacted)
+				}
+			}
+			body = []byte(form.Encode())
+		}
+	}
+	if mediaType == "application/json" {
+		body = redactJSON(body)
+	}
+	return []byte(r.text(string(body)))
+}
+
+// redactJSON replaces the personal fields in a JSON body. Bodies without any are returned as they
+// are, so cassettes only differ from the traffic where something was redacted.
+func redactJSON(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// keep numbers like Slack timestamps and Jira IDs exactly as they were
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || !redactPersonal(value) {
+		return body
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	// Slack mentions like <@U1> stay readable
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return body
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// redactPersonal replaces personal fields in value, and reports whether it found any.
+func redactPersonal(value interface{}) bool {
+	redacted := false
+	switch value := value.(type) {
+	case map[string]interface{}:
+		person := false
+		for _, key := range personKeys {
+			if _, ok := value[key]; ok {
+				person = true
+			}
+		}
+		for key, field := range value {
+			if text, ok := field.(string); ok && text != "" && (personalFields[key] || person && key == "name") {
+				value[key] = Redacted
+				redacted = true
+				continue
+			}
+			redacted = redactPersonal(field) || redacted
+		}
+	case []interface{}:
+		for _, item := range value {
+			redacted = redactPersonal(item) || redacted
+		}
+	}
+	return redacted
+}
+
+func (r redactor) request(req *http.Request, body []byte) Request {
+	return Request{
+		Method: req.Method,
+		URL:    r.url(req.URL),
+		Header: r.header(req.Header),
+		Body:   r.body(req.Header.Get("Content-Type"), body),
+	}
+}
+
+// readBody reads a request or response body and puts back a copy, so it can still be sent or read.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, err
+}
+
+// Recorder is a RoundTripper that records every request it sends and the response it got.
+type Recorder struct {
+	transport http.RoundTripper
+	redactor  redactor
+	now       func() time.Time
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder records the traffic sent through transport, or http.DefaultTransport when it's nil.
+// secrets are redacted wherever they show up, on top of tokens and auth headers.
+func NewRecorder(transport http.RoundTripper, secrets ...string) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	r := &Recorder{transport: transport, redactor: newRedactor(secrets), now: time.Now}
+	r.Reset()
+	return r
+}
+
+// Reset drops what was recorded so far and starts a new cassette.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette = Cassette{RecordedAt: r.now().UTC(), Interactions: []Interaction{}}
+}
+
+// Cassette returns a copy of what was recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cassette := r.cassette
+	cassette.Interactions = append([]Interaction{}, r.cassette.Interactions...)
+	return &cassette
+}
+
+// Client returns an HTTP client that records through r.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := Interaction{
+		Request: r.redactor.request(req, requestBody),
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     r.redactor.header(resp.Header),
+			Body:       r.redactor.body(resp.Header.Get("Content-Type"), responseBody),
+		},
+	}
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// Replayer is a RoundTripper that answers requests from a cassette instead of the network.
+// A request gets the response of the first unused interaction with the same method, path,
+// query and body. Hosts aren't compared, so a replay can use different origins than the
+// recording, and bodies are only compared when they're forms or JSON.
+type Replayer struct {
+	cassette *Cassette
+	redactor redactor
+
+	mu   sync.Mutex
+	used []bool
+}
+
+// NewReplayer replays a cassette. secrets are redacted from requests before they're matched,
+// like they were when recording.
+func NewReplayer(cassette *Cassette, secrets ...string) *Replayer {
+	return &Replayer{cassette: cassette, redactor: newRedactor(secrets), used: make([]bool, len(cassette.Interactions))}
+}
+
+// Client returns an HTTP client that replays through r.
+func (r *Replayer) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Unused returns the recorded requests that weren't replayed, as "METHOD url".
+func (r *Replayer) Unused() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	unused := []string{}
+	for i, interaction := range r.cassette.Interactions {
+		if !r.used[i] {
+			unused = append(unused, interaction.Request.Method+" "+interaction.Request.URL)
+		}
+	}
+	return unused
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	want := matchKey(r.redactor.request(req, body))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || matchKey(interaction.Request) != want {
+			continue
+		}
+		r.used[i] = true
+		recorded := interaction.Response
+		header := http.Header{}
+		for name, values := range recorded.Header {
+			header[name] = values
+		}
+		return &http.Response{
+			StatusCode:    recorded.StatusCode,
+			Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(recorded.Body)),
+			ContentLength: int64(len(recorded.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("httprecord: no recorded response left for %s %s", req.Method, req.URL.Path)
+}
+
+// matchKey is what replays compare requests on.
+func matchKey(req Request) string {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return req.Method + " " + req.URL
+	}
+	key := req.Method + " " + u.Path + "?" + u.Query().Encode()
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		form, _ := url.ParseQuery(string(req.Body))
+		key += "\n" + form.Encode()
+	case "application/json":
+		// re-encode so key order and whitespace don't matter
+		var value interface{}
+		if json.Unmarshal(req.Body, &value) == nil {
+			canonical, _ := json.Marshal(value)
+			key += "\n" + string(canonical)
+		}
+	}
+	return key
+}
@@ -0,0 +1,131 @@
+package httprecord_test
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	slk "github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/httprecord"
+	"github.com/Clever/flarebot/jira"
+	"github.com/Clever/flarebot/jira/jiratest"
+	"github.com/Clever/flarebot/slackutil/slacktest"
+)
+
+func channel(id, name string) slk.Channel {
+	channel := slk.Channel{}
+	channel.ID = id
+	channel.Name = name
+	channel.IsMember = true
+	return channel
+}
+
+// session runs a few Slack and Jira calls with the given HTTP client.
+func session(t *testing.T, client *http.Client, slackURL string, jiraServer *jira.JiraServer) {
+	slackClient := slk.New(slacktest.Token, slk.OptionAPIURL(slackURL+"/api/"), slk.OptionHTTPClient(client))
+	channels, _, err := slackClient.GetConversations(&slk.GetConversationsParameters{})
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	require.NoError(t, slackClient.ArchiveConversation(channels[0].ID))
+	user, err := slackClient.GetUserByEmail("alice@example.com")
+	require.NoError(t, err)
+	require.Equal(t, "U1", user.ID)
+
+	jiraServer.HTTPClient = client
+	ticket, err := jiraServer.GetTicketByKey("FLARE-1")
+	require.NoError(t, err)
+	require.NoError(t, jiraServer.SetLabel(ticket, "archived"))
+	require.NoError(t, jiraServer.AddAttachment(ticket, "history.bin", []byte{0xff, 0xfe, 0x00}))
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	workspace := slacktest.NewServer(t)
+	workspace.AddChannel(channel("C1", "flare-1"))
+	workspace.AddUser(slk.User{ID: "U1", Name: "alice", RealName: "Alice Liddell", Profile: slk.UserProfile{Email: "alice@example.com", RealName: "Alice Liddell"}})
+	jiraFake := jiratest.NewServer(t)
+	jiraFake.AddIssue(jira.Ticket{Key: "FLARE-1", Fields: jira.TicketFields{
+		Assignee: jira.User{AccountId: "A1", Name: "alice", DisplayName: "Alice Liddell", EmailAddress: "alice@example.com"},
+	}})
+
+	recorder := httprecord.NewRecorder(nil, jiratest.Password, slacktest.Token)
+	session(t, recorder.Client(), workspace.URL, jiraFake.Client())
+	path := filepath.Join(t.TempDir(), "session.json")
+	require.NoError(t, recorder.Cassette().Save(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), slacktest.Token)
+	assert.NotContains(t, string(data), "Authorization")
+	assert.Contains(t, string(data), "token="+httprecord.Redacted)
+	for _, personal := range []string{"alice@example.com", "Alice Liddell", `"alice"`} {
+		assert.NotContains(t, string(data), personal, "people's emails and names are redacted")
+	}
+
+	cassette, err := httprecord.Load(path)
+	require.NoError(t, err)
+	require.Len(t, cassette.Interactions, 6)
+	assert.Contains(t, string(cassette.Interactions[0].Response.Body), `"name":"flare-1"`, "channel names are kept")
+	assert.Contains(t, string(data), `"base64"`, "binary bodies are base64 encoded")
+	assert.True(t, bytes.Contains(cassette.Interactions[5].Request.Body, []byte{0xff, 0xfe, 0x00}), "binary bodies round trip")
+
+	// replay against origins that don't exist, with other credentials
+	replayer := httprecord.NewReplayer(cassette, "other-password")
+	offline := &jira.JiraServer{Origin: "http://jira.invalid", Username: "someone", Password: "other-password"}
+	session(t, replayer.Client(), "http://slack.invalid", offline)
+	assert.Empty(t, replayer.Unused())
+
+	// everything was answered, so a repeat has nothing left to replay
+	_, err = offline.GetTicketByKey("FLARE-1")
+	assert.ErrorContains(t, err, "no recorded response left for GET /rest/api/2/issue/FLARE-1")
+}
+
+func TestReplayMatchesBodies(t *testing.T) {
+	jiraFake := jiratest.NewServer(t)
+	jiraFake.AddIssue(jira.Ticket{Key: "FLARE-1"})
+	recorder := httprecord.NewRecorder(nil)
+	client := jiraFake.Client()
+	client.HTTPClient = recorder.Client()
+	require.NoError(t, client.SetLabel(&jira.Ticket{Key: "FLARE-1"}, "archived"))
+
+	replayer := httprecord.NewReplayer(recorder.Cassette())
+	client.HTTPClient = replayer.Client()
+	err := client.SetLabel(&jira.Ticket{Key: "FLARE-1"}, "unarchived")
+	assert.ErrorContains(t, err, "no recorded response left for PUT /rest/api/2/issue/FLARE-1")
+	assert.Len(t, replayer.Unused(), 1)
+	require.NoError(t, client.SetLabel(&jira.Ticket{Key: "FLARE-1"}, "archived"))
+}
+
+func TestForTest(t *testing.T) {
+	jiraFake := jiratest.NewServer(t)
+	jiraFake.AddIssue(jira.Ticket{Key: "FLARE-1", Fields: jira.TicketFields{Summary: "api is down"}})
+	path := filepath.Join(t.TempDir(), "testdata", "ticket.json")
+
+	t.Run("record", func(t *testing.T) {
+		t.Setenv(httprecord.ModeEnv, "record")
+		client, recordedAt := httprecord.ForTest(t, path)
+		assert.False(t, recordedAt.IsZero())
+		server := jiraFake.Client()
+		server.HTTPClient = client
+		_, err := server.GetTicketByKey("FLARE-1")
+		require.NoError(t, err)
+	})
+	jiraFake.Close()
+
+	t.Run("replay", func(t *testing.T) {
+		client, _ := httprecord.ForTest(t, path)
+		server := &jira.JiraServer{Origin: "http://jira.invalid", HTTPClient: client}
+		ticket, err := server.GetTicketByKey("FLARE-1")
+		require.NoError(t, err)
+		assert.Equal(t, "api is down", ticket.Fields.Summary)
+	})
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(string(data), `"recordedAt"`))
+}
@@ -0,0 +1,45 @@
+package httprecord
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ModeEnv selects what ForTest does. HTTPRECORD=record sends requests to the real services and
+// rewrites the cassettes; otherwise cassettes are replayed and tests don't need the network.
+const ModeEnv = "HTTPRECORD"
+
+// ForTest returns an HTTP client for a test backed by the cassette at path, and the time the
+// cassette was recorded, so the test can run its clock from there. When replaying, requests
+// missing from the cassette fail, and the test fails if it didn't use every recorded request.
+func ForTest(t testing.TB, path string, secrets ...string) (*http.Client, time.Time) {
+	t.Helper()
+	if os.Getenv(ModeEnv) == "record" {
+		recorder := NewRecorder(nil, secrets...)
+		t.Cleanup(func() {
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Errorf("saving cassette: %v", err)
+				return
+			}
+			if err := recorder.Cassette().Save(path); err != nil {
+				t.Errorf("saving cassette: %v", err)
+			}
+		})
+		return recorder.Client(), recorder.Cassette().RecordedAt
+	}
+
+	cassette, err := Load(path)
+	if err != nil {
+		t.Fatalf("loading cassette, run with %s=record to create it: %v", ModeEnv, err)
+	}
+	replayer := NewReplayer(cassette, secrets...)
+	t.Cleanup(func() {
+		if unused := replayer.Unused(); len(unused) > 0 && !t.Failed() {
+			t.Errorf("%d recorded requests weren't replayed: %v", len(unused), unused)
+		}
+	})
+	return replayer.Client(), cassette.RecordedAt
+}
@@ -2,16 +2,31 @@ package jira
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"io/ioutil"
+	"mime/multipart"
+
+	"github.com/Clever/flarebot/audit"
+	"github.com/Clever/kayvee-go/v7/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/Clever/flarebot/jira")
+
 type User struct {
 	AccountId    string `json:"accountId"`
 	Name         string `json:"name"`
+	DisplayName  string `json:"displayName"`
 	EmailAddress string `json:"emailAddress"`
 }
 
@@ -21,11 +36,79 @@ type Project struct {
 	Name string `json:"name"`
 }
 
+type Status struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Priority struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type LinkType struct {
+	Name    string `json:"name"`
+	Inward  string `json:"inward"`
+	Outward string `json:"outward"`
+}
+
+// IssueLink links two tickets. Only one of InwardIssue and OutwardIssue is set,
+// depending on which side of the link the ticket being read is on.
+type IssueLink struct {
+	ID           string   `json:"id"`
+	Type         LinkType `json:"type"`
+	InwardIssue  *Ticket  `json:"inwardIssue,omitempty"`
+	OutwardIssue *Ticket  `json:"outwardIssue,omitempty"`
+}
+
 type TicketFields struct {
-	Project  Project `json:"project"`
-	Creator  User    `json:"creator"`
-	Reporter User    `json:"reporter"`
-	Assignee User    `json:"assignee"`
+	Project     Project     `json:"project"`
+	Creator     User        `json:"creator"`
+	Reporter    User        `json:"reporter"`
+	Assignee    User        `json:"assignee"`
+	Summary     string      `json:"summary"`
+	Description string      `json:"description"`
+	Status      Status      `json:"status"`
+	Priority    Priority    `json:"priority"`
+	Labels      []string    `json:"labels"`
+	IssueLinks  []IssueLink `json:"issuelinks"`
+	Created     Time        `json:"created"`
+	Updated     Time        `json:"updated"`
+
+	// CustomFields holds the raw value of every customfield_* field on the ticket,
+	// since their IDs differ between Jira instances.
+	CustomFields map[string]json.RawMessage `json:"-"`
+}
+
+func (fields *TicketFields) UnmarshalJSON(data []byte) error {
+	// alias drops the methods so the standard decoding doesn't recurse
+	type alias TicketFields
+	if err := json.Unmarshal(data, (*alias)(fields)); err != nil {
+		return err
+	}
+
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for name, value := range raw {
+		if strings.HasPrefix(name, "customfield_") && string(value) != "null" {
+			if fields.CustomFields == nil {
+				fields.CustomFields = map[string]json.RawMessage{}
+			}
+			fields.CustomFields[name] = value
+		}
+	}
+	return nil
+}
+
+// CustomFieldString returns the value of a string custom field, or "" if it is unset or not a string.
+func (fields TicketFields) CustomFieldString(id string) string {
+	var value string
+	if err := json.Unmarshal(fields.CustomFields[id], &value); err != nil {
+		return ""
+	}
+	return value
 }
 
 type Ticket struct {
@@ -38,6 +121,88 @@ type JiraServer struct {
 	Origin   string
 	Username string
 	Password string
+	// Audit records the changes the server makes to tickets. It's off when nil.
+	Audit *audit.Logger
+	// HTTPClient sends the requests, http.DefaultClient when nil.
+	HTTPClient *http.Client
+
+	// ctx is set by WithContext. The methods don't take a context because the JiraClient
+	// interfaces every job declares and mocks don't, like slack-go's methods, so a copy bound to
+	// one request's context carries it instead, as http.Request.WithContext does.
+	ctx context.Context
+}
+
+// WithContext returns a copy of the server whose requests use ctx, so they're traced as children
+// of the span in ctx, canceled with it and counted in kayvee metrics on its logger. Servers
+// without a context still trace their requests, as root spans, but report no metrics.
+func (server *JiraServer) WithContext(ctx context.Context) *JiraServer {
+	copy := *server
+	copy.ctx = ctx
+	return &copy
+}
+
+func (server *JiraServer) context() context.Context {
+	if server.ctx != nil {
+		return server.ctx
+	}
+	return context.Background()
+}
+
+// send runs the request in a span that records the method, path and status code.
+func (server *JiraServer) send(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	ctx, span := tracer.Start(server.context(), "jira "+req.Method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.path", req.URL.Path),
+		))
+	defer span.End()
+
+	client := server.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		server.recordRequest(req.Method, 0, time.Since(start))
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode > 299 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	server.recordRequest(req.Method, resp.StatusCode, time.Since(start))
+	return resp, nil
+}
+
+// recordRequest logs the latency of a request, and counts it as an error if it failed, as
+// kayvee metrics. statusCode is 0 when no response came back. Only servers bound with WithContext
+// report metrics, to the context's logger, so CLIs printing to stdout aren't cluttered with them.
+func (server *JiraServer) recordRequest(method string, statusCode int, latency time.Duration) {
+	if server.ctx == nil {
+		return
+	}
+	status := "error"
+	if statusCode != 0 {
+		status = strconv.Itoa(statusCode)
+	}
+	lg := logger.FromContext(server.ctx)
+	lg.GaugeFloatD("jira-request-latency", float64(latency.Milliseconds()), logger.M{"method": method, "status": status})
+	if statusCode == 0 || statusCode > 299 {
+		lg.CounterD("jira-request-errors", 1, logger.M{"method": method, "status": status})
+	}
+}
+
+// StatusError is returned when Jira answers a request with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Status-code:%d, error: %s", e.StatusCode, e.Body)
 }
 
 // unmarshalls into the provided data structure
@@ -56,8 +221,7 @@ func (server *JiraServer) DoRequest(method string, path string, body map[string]
 
 	req.SetBasicAuth(server.Username, server.Password)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := server.send(req)
 
 	if err != nil {
 		fmt.Printf("got an error: %s\n", err)
@@ -69,7 +233,7 @@ func (server *JiraServer) DoRequest(method string, path string, body map[string]
 	responseBody, _ := ioutil.ReadAll(resp.Body)
 
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("Status-code:%d, error: %s", resp.StatusCode, responseBody)
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(responseBody)}
 	}
 
 	if len(responseBody) == 0 || response == nil {
@@ -93,6 +257,11 @@ func (server *JiraServer) GetTicketByKey(key string) (*Ticket, error) {
 }
 
 func (server *JiraServer) UpdateTicket(ticket *Ticket, request map[string]interface{}) error {
+	err := server.update(ticket, request)
+	return server.audit(audit.ActionJiraUpdate, ticket, nil, request, err)
+}
+
+func (server *JiraServer) update(ticket *Ticket, request map[string]interface{}) error {
 	url := "/rest/api/2/issue/" + ticket.Key
 	err := server.DoRequest("PUT", url, request, nil)
 
@@ -100,6 +269,7 @@ func (server *JiraServer) UpdateTicket(ticket *Ticket, request map[string]interf
 	return err
 }
 
+// SetLabel adds the label to the ticket, keeping its other labels.
 func (server *JiraServer) SetLabel(ticket *Ticket, label string) error {
 	request := map[string]interface{}{
 		"update": &map[string]interface{}{
@@ -108,5 +278,142 @@ func (server *JiraServer) SetLabel(ticket *Ticket, label string) error {
 			},
 		},
 	}
+	err := server.update(ticket, request)
+	after := ticket.Fields.Labels
+	if !containsLabel(after, label) {
+		after = append(append([]string{}, after...), label)
+	}
+	return server.audit(audit.ActionJiraAddLabel, ticket, ticket.Fields.Labels, after, err)
+}
+
+// RemoveLabel removes the label from the ticket, keeping its other labels.
+func (server *JiraServer) RemoveLabel(ticket *Ticket, label string) error {
+	request := map[string]interface{}{
+		"update": &map[string]interface{}{
+			"labels": []map[string]interface{}{
+				{"remove": label},
+			},
+		},
+	}
+	err := server.update(ticket, request)
+	after := []string{}
+	for _, existing := range ticket.Fields.Labels {
+		if existing != label {
+			after = append(after, existing)
+		}
+	}
+	return server.audit(audit.ActionJiraRemoveLabel, ticket, ticket.Fields.Labels, after, err)
+}
+
+func containsLabel(labels []string, label string) bool {
+	for _, existing := range labels {
+		if existing == label {
+			return true
+		}
+	}
+	return false
+}
+
+// audit records a change to the ticket and returns the change's error. A record that couldn't
+// be written is logged rather than returned, so a change that went through isn't reported as
+// failed and tried again.
+func (server *JiraServer) audit(action string, ticket *Ticket, before, after interface{}, err error) error {
+	if auditErr := server.Audit.Change(server.context(), action, ticket.Key, before, after, err); auditErr != nil {
+		lg := logger.FromContext(server.context())
+		lg.ErrorD("audit-write-failed", logger.M{"action": action, "target": ticket.Key, "error": auditErr.Error()})
+		lg.CounterD("audit-write-errors", 1, logger.M{"action": action})
+	}
+	return err
+}
+
+// SetField overwrites a single field, e.g. a custom field, on the ticket.
+func (server *JiraServer) SetField(ticket *Ticket, fieldID string, value interface{}) error {
+	request := map[string]interface{}{
+		"fields": map[string]interface{}{
+			fieldID: value,
+		},
+	}
 	return server.UpdateTicket(ticket, request)
 }
+
+// AddComment adds a comment to the ticket. body uses Jira wiki markup.
+func (server *JiraServer) AddComment(ticket *Ticket, body string) error {
+	request := map[string]interface{}{
+		"body": body,
+	}
+	err := server.DoRequest("POST", fmt.Sprintf("/rest/api/2/issue/%s/comment", ticket.Key), request, nil)
+	return server.audit(audit.ActionJiraComment, ticket, nil, body, err)
+}
+
+// AddAttachment uploads a file to the ticket.
+func (server *JiraServer) AddAttachment(ticket *Ticket, filename string, content []byte) error {
+	err := server.upload(ticket, filename, content)
+	return server.audit(audit.ActionJiraAttachment, ticket, nil, map[string]interface{}{"filename": filename, "bytes": len(content)}, err)
+}
+
+// Transition is a move the ticket's workflow allows from its current status.
+type Transition struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	To   Status `json:"to"`
+}
+
+// TransitionTo moves the ticket to a status through the workflow transition that leads there,
+// like doJiraTransition in src/lib/jira.ts. It fails when the workflow doesn't allow the move
+// from the ticket's current status.
+func (server *JiraServer) TransitionTo(ticket *Ticket, status string) error {
+	var response struct {
+		Transitions []Transition `json:"transitions"`
+	}
+	path := fmt.Sprintf("/rest/api/2/issue/%s/transitions", ticket.Key)
+	if err := server.DoRequest("GET", path, nil, &response); err != nil {
+		return err
+	}
+	allowed := []string{}
+	for _, transition := range response.Transitions {
+		if transition.To.Name != status {
+			allowed = append(allowed, transition.To.Name)
+			continue
+		}
+		request := map[string]interface{}{"transition": map[string]interface{}{"id": transition.ID}}
+		err := server.DoRequest("POST", path, request, nil)
+		return server.audit(audit.ActionJiraTransition, ticket, ticket.Fields.Status.Name, status, err)
+	}
+	return fmt.Errorf("jira transition to %q not found, allowed transitions for current status: [%s]", status, strings.Join(allowed, ", "))
+}
+
+func (server *JiraServer) upload(ticket *Ticket, filename string, content []byte) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(content); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/rest/api/2/issue/%s/attachments", server.Origin, ticket.Key), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+	// Jira rejects uploads without this header as a CSRF protection
+	req.Header.Add("X-Atlassian-Token", "no-check")
+	req.SetBasicAuth(server.Username, server.Password)
+
+	resp, err := server.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		responseBody, _ := ioutil.ReadAll(resp.Body)
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(responseBody)}
+	}
+	return nil
+}
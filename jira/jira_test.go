@@ -1,13 +1,27 @@
 package jira_test
 
 import (
+	"errors"
 	//	"fmt"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/Clever/kayvee-go/v7/logger"
 	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 
+	"github.com/Clever/flarebot/audit"
 	"github.com/Clever/flarebot/jira"
 )
 
@@ -60,3 +74,341 @@ func TestGetTicketByKey(t *testing.T) {
 		assert.Equal(t, theTicket.Key, mockIssueID)
 	}
 }
+
+func TestSearchTickets(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	pages := []string{
+		`{"issues":[{"key":"FLARE-1","fields":{"summary":"one","created":"2024-01-02T08:21:13.591-0700","status":{"name":"Mitigated"}}}],"nextPageToken":"page-2","isLast":false}`,
+		`{"issues":[{"key":"FLARE-2","fields":{"summary":"two","created":null}}],"isLast":true}`,
+	}
+	calls := 0
+	httpmock.RegisterResponder("POST", mockOrigin+"/rest/api/2/search/jql",
+		func(req *http.Request) (*http.Response, error) {
+			var body map[string]interface{}
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				return nil, err
+			}
+			assert.Equal(t, "project = FLARE", body["jql"])
+			if calls == 1 {
+				assert.Equal(t, "page-2", body["nextPageToken"])
+			}
+			resp := httpmock.NewStringResponse(200, pages[calls])
+			calls++
+			return resp, nil
+		},
+	)
+
+	tickets, err := CreateTestJiraServer().SearchTickets("project = FLARE", []string{"summary", "created", "status"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	if assert.Len(t, tickets, 2) {
+		assert.Equal(t, "FLARE-1", tickets[0].Key)
+		assert.Equal(t, "Mitigated", tickets[0].Fields.Status.Name)
+		assert.Equal(t, time.Date(2024, 1, 2, 15, 21, 13, 591000000, time.UTC), tickets[0].Fields.Created.UTC())
+		assert.True(t, tickets[1].Fields.Created.IsZero())
+	}
+}
+
+func TestGetChangelog(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", mockOrigin+"/rest/api/2/issue/"+mockIssueID+"/changelog",
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewStringResponse(200, `{"startAt":0,"maxResults":100,"total":2,"isLast":true,"values":[
+				{"id":"1","created":"2024-01-02T08:00:00.000+0000","items":[{"field":"status","fromString":"Open","toString":"In Progress"}]},
+				{"id":"2","created":"2024-01-02T09:00:00.000+0000","items":[{"field":"assignee","toString":"Alice"},{"field":"status","fromString":"In Progress","toString":"Mitigated"}]}
+			]}`), nil
+		},
+	)
+
+	entries, err := CreateTestJiraServer().GetChangelog(mockIssueID)
+
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	changes := jira.StatusChanges(entries)
+	if assert.Len(t, changes, 2) {
+		assert.Equal(t, "In Progress", changes[0].To)
+		assert.Equal(t, "Mitigated", changes[1].To)
+		assert.Equal(t, time.Hour, changes[1].At.Sub(changes[0].At))
+	}
+}
+
+func TestCustomFields(t *testing.T) {
+	var ticket jira.Ticket
+	err := json.Unmarshal([]byte(mockIssueContent), &ticket)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "the world is collapsing", ticket.Fields.Summary)
+	assert.Equal(t, "9223372036854775807", ticket.Fields.CustomFieldString("customfield_10006"))
+	assert.Equal(t, "", ticket.Fields.CustomFieldString("customfield_11100"))
+	assert.Equal(t, "", ticket.Fields.CustomFieldString("customfield_99999"))
+	_, present := ticket.Fields.CustomFields["customfield_11100"]
+	assert.False(t, present)
+}
+
+func TestSetField(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var body map[string]interface{}
+	httpmock.RegisterResponder("PUT", mockOrigin+"/rest/api/2/issue/"+mockIssueID,
+		func(req *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				return nil, err
+			}
+			return httpmock.NewStringResponse(204, ""), nil
+		},
+	)
+
+	err := CreateTestJiraServer().SetField(&jira.Ticket{Key: mockIssueID}, "customfield_12345", "https://clever.slack.com/archives/C1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"fields": map[string]interface{}{"customfield_12345": "https://clever.slack.com/archives/C1"},
+	}, body)
+}
+
+func TestRemoveLabel(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var body map[string]interface{}
+	httpmock.RegisterResponder("PUT", mockOrigin+"/rest/api/2/issue/"+mockIssueID,
+		func(req *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				return nil, err
+			}
+			return httpmock.NewStringResponse(204, ""), nil
+		},
+	)
+
+	err := CreateTestJiraServer().RemoveLabel(&jira.Ticket{Key: mockIssueID}, "archived")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"update": map[string]interface{}{"labels": []interface{}{map[string]interface{}{"remove": "archived"}}},
+	}, body)
+}
+
+type recordingSink struct {
+	records []audit.Record
+}
+
+func (s *recordingSink) Write(ctx context.Context, record audit.Record, line []byte) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestAuditedChanges(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("PUT", mockOrigin+"/rest/api/2/issue/"+mockIssueID, httpmock.NewStringResponder(204, ""))
+	httpmock.RegisterResponder("POST", mockOrigin+"/rest/api/2/issue/"+mockIssueID+"/comment",
+		httpmock.NewStringResponder(500, "unavailable"))
+
+	sink := &recordingSink{}
+	server := CreateTestJiraServer()
+	server.Audit = audit.New(sink, "flarebot-test", "run-1", false)
+	ticket := &jira.Ticket{Key: mockIssueID, Fields: jira.TicketFields{Labels: []string{"archived", "sev1"}}}
+
+	assert.NoError(t, server.SetLabel(ticket, "cleanup"))
+	assert.NoError(t, server.RemoveLabel(ticket, "archived"))
+	assert.NoError(t, server.SetField(ticket, "customfield_1", "x"))
+	assert.Error(t, server.AddComment(ticket, "closing"))
+
+	if !assert.Len(t, sink.records, 4) {
+		return
+	}
+	type change struct {
+		Action        string
+		Before, After interface{}
+		Error         string
+	}
+	changes := []change{}
+	for _, r := range sink.records {
+		assert.Equal(t, mockIssueID, r.Target)
+		changes = append(changes, change{r.Action, r.Before, r.After, r.Error})
+	}
+	assert.Equal(t, []change{
+		{Action: audit.ActionJiraAddLabel, Before: []string{"archived", "sev1"}, After: []string{"archived", "sev1", "cleanup"}},
+		{Action: audit.ActionJiraRemoveLabel, Before: []string{"archived", "sev1"}, After: []string{"sev1"}},
+		{Action: audit.ActionJiraUpdate, After: map[string]interface{}{"fields": map[string]interface{}{"customfield_1": "x"}}},
+		{Action: audit.ActionJiraComment, After: "closing", Error: "Status-code:500, error: unavailable"},
+	}, changes)
+}
+
+type failingSink struct{}
+
+func (failingSink) Write(ctx context.Context, record audit.Record, line []byte) error {
+	return errors.New("disk full")
+}
+
+func TestAuditFailureKeepsTheChangesError(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("PUT", mockOrigin+"/rest/api/2/issue/"+mockIssueID, httpmock.NewStringResponder(204, ""))
+	httpmock.RegisterResponder("POST", mockOrigin+"/rest/api/2/issue/"+mockIssueID+"/comment",
+		httpmock.NewStringResponder(500, "unavailable"))
+
+	server := CreateTestJiraServer()
+	server.Audit = audit.New(failingSink{}, "flarebot-test", "run-1", false)
+	ticket := &jira.Ticket{Key: mockIssueID}
+
+	assert.NoError(t, server.SetLabel(ticket, "cleanup"), "the label was set even though it wasn't recorded")
+	assert.EqualError(t, server.AddComment(ticket, "closing"), "Status-code:500, error: unavailable")
+}
+
+func TestAddComment(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var body map[string]interface{}
+	httpmock.RegisterResponder("POST", mockOrigin+"/rest/api/2/issue/"+mockIssueID+"/comment",
+		func(req *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				return nil, err
+			}
+			return httpmock.NewStringResponse(201, `{"id":"1"}`), nil
+		},
+	)
+
+	err := CreateTestJiraServer().AddComment(&jira.Ticket{Key: mockIssueID}, "channel archived")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"body": "channel archived"}, body)
+}
+
+func TestAddAttachment(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", mockOrigin+"/rest/api/2/issue/"+mockIssueID+"/attachments",
+		func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("X-Atlassian-Token") != "no-check" {
+				return httpmock.NewStringResponse(403, "XSRF check failed"), nil
+			}
+			file, header, err := req.FormFile("file")
+			if err != nil {
+				return nil, err
+			}
+			content, _ := io.ReadAll(file)
+			if header.Filename != "flare-1.json" || string(content) != "[]" {
+				return httpmock.NewStringResponse(400, "unexpected file"), nil
+			}
+			return httpmock.NewStringResponse(200, "[]"), nil
+		},
+	)
+
+	err := CreateTestJiraServer().AddAttachment(&jira.Ticket{Key: mockIssueID}, "flare-1.json", []byte("[]"))
+	assert.NoError(t, err)
+
+	err = CreateTestJiraServer().AddAttachment(&jira.Ticket{Key: mockIssueID}, "other.json", []byte("[]"))
+	assert.EqualError(t, err, "Status-code:400, error: unexpected file")
+	var statusErr *jira.StatusError
+	if assert.ErrorAs(t, err, &statusErr) {
+		assert.Equal(t, 400, statusErr.StatusCode)
+	}
+}
+
+func TestRequestSpans(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", mockOrigin+"/rest/api/2/issue/"+mockIssueID,
+		httpmock.NewStringResponder(200, mockIssueContent))
+	httpmock.RegisterResponder("GET", mockOrigin+"/rest/api/2/issue/MISSING-1",
+		httpmock.NewStringResponder(404, `{"errorMessages":["Issue does not exist"]}`))
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	server := CreateTestJiraServer().WithContext(ctx)
+	_, err := server.GetTicketByKey(mockIssueID)
+	assert.NoError(t, err)
+	_, err = server.GetTicketByKey("MISSING-1")
+	assert.Error(t, err)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	for i, status := range []int{200, 404} {
+		span := spans[i]
+		assert.Equal(t, "jira GET", span.Name)
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+		assert.Contains(t, span.Attributes, attribute.Int("http.response.status_code", status))
+	}
+	assert.Contains(t, spans[0].Attributes, attribute.String("url.path", "/rest/api/2/issue/"+mockIssueID))
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+}
+
+func TestRequestMetrics(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", mockOrigin+"/rest/api/2/issue/"+mockIssueID,
+		httpmock.NewStringResponder(200, mockIssueContent))
+	httpmock.RegisterResponder("GET", mockOrigin+"/rest/api/2/issue/MISSING-1",
+		httpmock.NewStringResponder(404, `{"errorMessages":["Issue does not exist"]}`))
+
+	var out bytes.Buffer
+	lg := logger.New("jira-test")
+	lg.SetOutput(&out)
+	server := CreateTestJiraServer().WithContext(logger.NewContext(context.Background(), lg))
+	_, err := server.GetTicketByKey(mockIssueID)
+	assert.NoError(t, err)
+	_, err = server.GetTicketByKey("MISSING-1")
+	assert.Error(t, err)
+
+	type metric struct {
+		Title  string `json:"title"`
+		Type   string `json:"type"`
+		Method string `json:"method"`
+		Status string `json:"status"`
+	}
+	metrics := []metric{}
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var m metric
+		if assert.NoError(t, decoder.Decode(&m)) && m.Type != "" {
+			metrics = append(metrics, m)
+		}
+	}
+	assert.Equal(t, []metric{
+		{Title: "jira-request-latency", Type: "gauge", Method: "GET", Status: "200"},
+		{Title: "jira-request-latency", Type: "gauge", Method: "GET", Status: "404"},
+		{Title: "jira-request-errors", Type: "counter", Method: "GET", Status: "404"},
+	}, metrics)
+}
+
+func TestTransitionTo(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	transitionsURL := mockOrigin + "/rest/api/2/issue/" + mockIssueID + "/transitions"
+	httpmock.RegisterResponder("GET", transitionsURL, httpmock.NewStringResponder(200,
+		`{"transitions": [{"id": "21", "name": "Mitigate", "to": {"id": "3", "name": "Mitigated"}},
+		                  {"id": "31", "name": "Not a flare", "to": {"id": "4", "name": "NotAFlare"}}]}`))
+	var body map[string]interface{}
+	httpmock.RegisterResponder("POST", transitionsURL,
+		func(req *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				return nil, err
+			}
+			return httpmock.NewStringResponse(204, ""), nil
+		},
+	)
+
+	server := CreateTestJiraServer()
+	ticket := &jira.Ticket{Key: mockIssueID}
+	assert.NoError(t, server.TransitionTo(ticket, "Mitigated"))
+	assert.Equal(t, map[string]interface{}{"transition": map[string]interface{}{"id": "21"}}, body)
+
+	err := server.TransitionTo(ticket, "In Progress")
+	assert.EqualError(t, err, `jira transition to "In Progress" not found, allowed transitions for current status: [Mitigated, NotAFlare]`)
+}
@@ -0,0 +1,398 @@
+package jiratest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Clever/flarebot/jira"
+)
+
+// The fake understands a subset of JQL: clauses joined with AND, followed by an optional
+// ORDER BY. A clause is a field, an operator and a value:
+//
+//	project = FLARE AND status in ("In Progress", Mitigated) AND labels = sev1
+//	created >= "2024-01-01" AND created < -7d ORDER BY created DESC
+//	cf[10100] = "https://slack.com/archives/C1" AND assignee is EMPTY
+//
+// Operators are =, !=, >, >=, <, <=, ~, in, not in, is EMPTY and is not EMPTY. Fields are
+// project, key, status, priority, labels, summary, description, assignee, reporter, created,
+// updated and custom fields, as cf[N] or customfield_N. Dates are "yyyy-MM-dd", "yyyy-MM-dd
+// HH:mm" or relative to now like -7d, with units w, d, h and m. Anything else, OR and
+// parentheses included, is rejected with a 400, so tests notice a query the fake can't check.
+
+type clause struct {
+	field    string
+	operator string
+	values   []string
+}
+
+type ordering struct {
+	field      string
+	descending bool
+}
+
+type query struct {
+	clauses []clause
+	order   []ordering
+}
+
+var tokenPattern = regexp.MustCompile(`\s*("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|!=|>=|<=|[=<>~(),]|[^\s"'=!<>~(),]+)`)
+
+func tokenize(jql string) ([]string, error) {
+	tokens := []string{}
+	rest := strings.TrimSpace(jql)
+	for rest != "" {
+		match := tokenPattern.FindStringSubmatchIndex(rest)
+		if match == nil || match[0] != 0 {
+			return nil, fmt.Errorf("Error in the JQL Query: unexpected %q", rest)
+		}
+		tokens = append(tokens, rest[match[2]:match[3]])
+		rest = strings.TrimSpace(rest[match[1]:])
+	}
+	return tokens, nil
+}
+
+// unquote strips the quotes off a quoted token.
+func unquote(token string) string {
+	if len(token) >= 2 && (token[0] == '"' || token[0] == '\'') {
+		return strings.NewReplacer(`\"`, `"`, `\'`, `'`, `\\`, `\`).Replace(token[1 : len(token)-1])
+	}
+	return token
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *parser) keyword(word string) bool {
+	if strings.EqualFold(p.peek(), word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) value() (string, error) {
+	token := p.next()
+	switch token {
+	case "", "(", ")", ",", "=", "!=", ">", ">=", "<", "<=", "~":
+		return "", fmt.Errorf("Error in the JQL Query: expected a value but got %q", token)
+	}
+	return unquote(token), nil
+}
+
+func parseJQL(jql string) (*query, error) {
+	tokens, err := tokenize(jql)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	q := &query{}
+
+	for p.peek() != "" && !strings.EqualFold(p.peek(), "order") {
+		if len(q.clauses) > 0 && !p.keyword("and") {
+			return nil, fmt.Errorf("jiratest only supports clauses joined with AND, got %q", p.peek())
+		}
+		c, err := p.clause()
+		if err != nil {
+			return nil, err
+		}
+		q.clauses = append(q.clauses, c)
+	}
+
+	if p.keyword("order") {
+		if !p.keyword("by") {
+			return nil, fmt.Errorf("Error in the JQL Query: expected BY after ORDER")
+		}
+		for {
+			field := strings.ToLower(unquote(p.next()))
+			if field == "" {
+				return nil, fmt.Errorf("Error in the JQL Query: expected a field after ORDER BY")
+			}
+			o := ordering{field: field}
+			if p.keyword("desc") {
+				o.descending = true
+			} else {
+				p.keyword("asc")
+			}
+			q.order = append(q.order, o)
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+	}
+	if p.peek() != "" {
+		return nil, fmt.Errorf("Error in the JQL Query: unexpected %q", p.peek())
+	}
+	return q, nil
+}
+
+func (p *parser) clause() (clause, error) {
+	field := unquote(p.next())
+	if field == "(" || strings.EqualFold(field, "not") {
+		return clause{}, fmt.Errorf("jiratest doesn't support %q in JQL", field)
+	}
+	c := clause{field: normalizeField(field)}
+
+	switch token := strings.ToLower(p.next()); token {
+	case "=", "!=", ">", ">=", "<", "<=", "~":
+		c.operator = token
+		value, err := p.value()
+		if err != nil {
+			return c, err
+		}
+		c.values = []string{value}
+	case "in":
+		c.operator = "in"
+		return c, p.list(&c)
+	case "not":
+		if !p.keyword("in") {
+			return c, fmt.Errorf("Error in the JQL Query: expected IN after NOT")
+		}
+		c.operator = "not in"
+		return c, p.list(&c)
+	case "is":
+		c.operator = "is"
+		if p.keyword("not") {
+			c.operator = "is not"
+		}
+		if !p.keyword("empty") && !p.keyword("null") {
+			return c, fmt.Errorf("Error in the JQL Query: expected EMPTY after IS")
+		}
+	default:
+		return c, fmt.Errorf("jiratest doesn't support the operator %q", token)
+	}
+	return c, nil
+}
+
+func (p *parser) list(c *clause) error {
+	if p.next() != "(" {
+		return fmt.Errorf("Error in the JQL Query: expected ( after IN")
+	}
+	for {
+		value, err := p.value()
+		if err != nil {
+			return err
+		}
+		c.values = append(c.values, value)
+		switch p.next() {
+		case ",":
+		case ")":
+			return nil
+		default:
+			return fmt.Errorf("Error in the JQL Query: expected , or ) in the IN list")
+		}
+	}
+}
+
+var cfPattern = regexp.MustCompile(`^(?i)cf\[(\d+)\]$`)
+
+// normalizeField lowercases field names and writes custom fields as customfield_N.
+func normalizeField(field string) string {
+	if match := cfPattern.FindStringSubmatch(field); match != nil {
+		return "customfield_" + match[1]
+	}
+	return strings.ToLower(field)
+}
+
+// values returns what a field of the ticket can match against, and whether the field is a date.
+func values(ticket jira.Ticket, field string) ([]string, bool, error) {
+	fields := ticket.Fields
+	user := func(u jira.User) []string {
+		if u == (jira.User{}) {
+			return nil
+		}
+		return []string{u.AccountId, u.Name, u.EmailAddress, u.DisplayName}
+	}
+	nonEmpty := func(value string) []string {
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	}
+	switch {
+	case field == "project":
+		return []string{fields.Project.Key, fields.Project.Name, fields.Project.ID}, false, nil
+	case field == "key" || field == "issuekey":
+		return []string{ticket.Key}, false, nil
+	case field == "status":
+		return nonEmpty(fields.Status.Name), false, nil
+	case field == "priority":
+		return nonEmpty(fields.Priority.Name), false, nil
+	case field == "labels":
+		return fields.Labels, false, nil
+	case field == "summary":
+		return nonEmpty(fields.Summary), false, nil
+	case field == "description":
+		return nonEmpty(fields.Description), false, nil
+	case field == "assignee":
+		return user(fields.Assignee), false, nil
+	case field == "reporter":
+		return user(fields.Reporter), false, nil
+	case field == "created":
+		return []string{fields.Created.Format(time.RFC3339Nano)}, true, nil
+	case field == "updated":
+		return []string{fields.Updated.Format(time.RFC3339Nano)}, true, nil
+	case strings.HasPrefix(field, "customfield_"):
+		raw, ok := fields.CustomFields[field]
+		if !ok || string(raw) == "null" {
+			return nil, false, nil
+		}
+		if value := fields.CustomFieldString(field); value != "" {
+			return []string{value}, false, nil
+		}
+		return []string{string(raw)}, false, nil
+	}
+	return nil, false, fmt.Errorf("Field '%s' does not exist or jiratest doesn't support it.", field)
+}
+
+func (q *query) matches(ticket jira.Ticket, now time.Time) (bool, error) {
+	for _, c := range q.clauses {
+		ok, err := c.matches(ticket, now)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (c clause) matches(ticket jira.Ticket, now time.Time) (bool, error) {
+	actual, isDate, err := values(ticket, c.field)
+	if err != nil {
+		return false, err
+	}
+	switch c.operator {
+	case "is":
+		return len(actual) == 0, nil
+	case "is not":
+		return len(actual) > 0, nil
+	case "~":
+		for _, value := range actual {
+			if strings.Contains(strings.ToLower(value), strings.ToLower(c.values[0])) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if isDate {
+		if len(c.values) != 1 {
+			return false, fmt.Errorf("jiratest doesn't support %s with dates", c.operator)
+		}
+		want, err := parseDate(c.values[0], now)
+		if err != nil {
+			return false, err
+		}
+		at, _ := time.Parse(time.RFC3339Nano, actual[0])
+		switch c.operator {
+		case "=", "in":
+			return at.Equal(want), nil
+		case "!=", "not in":
+			return !at.Equal(want), nil
+		case ">":
+			return at.After(want), nil
+		case ">=":
+			return !at.Before(want), nil
+		case "<":
+			return at.Before(want), nil
+		case "<=":
+			return !at.After(want), nil
+		}
+	}
+
+	found := false
+	for _, want := range c.values {
+		for _, value := range actual {
+			if strings.EqualFold(value, want) {
+				found = true
+			}
+		}
+	}
+	switch c.operator {
+	case "=", "in":
+		return found, nil
+	case "!=", "not in":
+		return !found, nil
+	}
+	return false, fmt.Errorf("jiratest only compares dates with %s", c.operator)
+}
+
+var relativeDatePattern = regexp.MustCompile(`^([-+]?)(\d+)([wdhm])$`)
+
+// parseDate reads a JQL date in the server's time zone, or a duration relative to now.
+func parseDate(value string, now time.Time) (time.Time, error) {
+	if match := relativeDatePattern.FindStringSubmatch(value); match != nil {
+		n, _ := strconv.Atoi(match[2])
+		unit := map[string]time.Duration{"w": 7 * 24 * time.Hour, "d": 24 * time.Hour, "h": time.Hour, "m": time.Minute}[match[3]]
+		offset := time.Duration(n) * unit
+		if match[1] == "-" {
+			offset = -offset
+		}
+		return now.Add(offset), nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006/01/02 15:04", "2006-01-02", "2006/01/02"} {
+		if at, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return at, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Date value '%s' for field is invalid. Valid formats include: 'yyyy/MM/dd HH:mm', 'yyyy-MM-dd HH:mm', 'yyyy/MM/dd', 'yyyy-MM-dd', or a period format e.g. '-5d', '4w 2d'.", value)
+}
+
+// sort orders issues by the query's ORDER BY, keeping the order they were added in otherwise.
+func (q *query) sort(issues []*issue) {
+	sort.SliceStable(issues, func(a, b int) bool {
+		for _, o := range q.order {
+			cmp := compare(issues[a].ticket, issues[b].ticket, o.field)
+			if cmp == 0 {
+				continue
+			}
+			return (cmp < 0) != o.descending
+		}
+		return false
+	})
+}
+
+func compare(a, b jira.Ticket, field string) int {
+	switch field {
+	case "created":
+		return a.Fields.Created.Compare(b.Fields.Created.Time)
+	case "updated":
+		return a.Fields.Updated.Compare(b.Fields.Updated.Time)
+	case "key", "issuekey":
+		return compareKeys(a.Key, b.Key)
+	}
+	av, _, _ := values(a, field)
+	bv, _, _ := values(b, field)
+	return strings.Compare(strings.Join(av, ","), strings.Join(bv, ","))
+}
+
+// compareKeys orders keys by project, then number, so FLARE-9 comes before FLARE-10.
+func compareKeys(a, b string) int {
+	aProject, aNumber, _ := strings.Cut(a, "-")
+	bProject, bNumber, _ := strings.Cut(b, "-")
+	if cmp := strings.Compare(aProject, bProject); cmp != 0 {
+		return cmp
+	}
+	an, _ := strconv.Atoi(aNumber)
+	bn, _ := strconv.Atoi(bNumber)
+	return an - bn
+}
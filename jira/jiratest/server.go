@@ -0,0 +1,679 @@
+// Package jiratest runs an in-process fake Jira for tests. It keeps issues, comments,
+// attachments, changelogs and users in memory, answers the REST endpoints the jira package uses,
+// and can inject faults like rate limits, 5xx answers and slow responses.
+package jiratest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Clever/flarebot/jira"
+)
+
+// Credentials the fake accepts. Requests without basic auth get a 401.
+const (
+	Username = "jiratest"
+	Password = "jiratest"
+)
+
+// DefaultStatuses is the workflow of a new Server. Every status can transition to every other.
+var DefaultStatuses = []string{"To Do", "In Progress", "Mitigated", "Done", "NotAFlare"}
+
+// Comment is a comment on a fake issue.
+type Comment struct {
+	ID      string    `json:"id"`
+	Body    string    `json:"body"`
+	Author  jira.User `json:"author"`
+	Created jira.Time `json:"created"`
+}
+
+// Attachment is a file uploaded to a fake issue.
+type Attachment struct {
+	Filename string
+	Content  []byte
+}
+
+// Fault makes matching requests fail or slow down.
+type Fault struct {
+	// Method and Path select the requests the fault applies to. Empty matches every request;
+	// Path matches by prefix, e.g. "/rest/api/2/issue/FLARE-1".
+	Method string
+	Path   string
+	// Status is returned instead of the real answer. 0 only delays the request.
+	Status int
+	// RetryAfter is sent as the Retry-After header, in seconds, e.g. with a 429.
+	RetryAfter time.Duration
+	// Delay is how long to wait before answering.
+	Delay time.Duration
+	// Times limits the fault to the next n matching requests. 0 applies it until ClearFaults.
+	Times int
+}
+
+type issue struct {
+	id          string
+	ticket      jira.Ticket
+	comments    []Comment
+	attachments []Attachment
+	changelog   []jira.ChangelogEntry
+}
+
+// Server is a fake Jira. Its zero value isn't usable, create one with NewServer.
+type Server struct {
+	*httptest.Server
+
+	// Now is the server's clock, used for timestamps and relative JQL dates.
+	Now func() time.Time
+	// Actor authors the comments and changelog entries of requests made to the server.
+	Actor jira.User
+	// Statuses are the statuses issues can transition to.
+	Statuses []string
+
+	mu       sync.Mutex
+	issues   map[string]*issue
+	keys     []string
+	users    []jira.User
+	faults   []*Fault
+	requests []string
+	nextID   int
+}
+
+// NewServer starts a fake Jira that's closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		Now:      time.Now,
+		Actor:    jira.User{AccountId: "flarebot", Name: "flarebot", DisplayName: "Flare Bot"},
+		Statuses: DefaultStatuses,
+		issues:   map[string]*issue{},
+		nextID:   10000,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Client returns a jira client for the server.
+func (s *Server) Client() *jira.JiraServer {
+	return &jira.JiraServer{Origin: s.URL, Username: Username, Password: Password}
+}
+
+// AddIssue stores an issue, replacing any with the same key. Created and Updated default to now
+// and the project to the key's prefix.
+func (s *Server) AddIssue(ticket jira.Ticket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ticket.Fields.Created.IsZero() {
+		ticket.Fields.Created = jira.Time{Time: s.Now()}
+	}
+	if ticket.Fields.Updated.IsZero() {
+		ticket.Fields.Updated = ticket.Fields.Created
+	}
+	if ticket.Fields.Project.Key == "" {
+		project, _, _ := strings.Cut(ticket.Key, "-")
+		ticket.Fields.Project = jira.Project{Key: project, Name: project}
+	}
+	ticket.Fields.Labels = append([]string{}, ticket.Fields.Labels...)
+	if _, ok := s.issues[ticket.Key]; !ok {
+		s.keys = append(s.keys, ticket.Key)
+	}
+	s.nextID++
+	s.issues[ticket.Key] = &issue{id: strconv.Itoa(s.nextID), ticket: ticket}
+}
+
+// Issue returns the current state of an issue.
+func (s *Server) Issue(key string) (jira.Ticket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.issues[key]
+	if !ok {
+		return jira.Ticket{}, false
+	}
+	ticket := i.ticket
+	ticket.Fields.Labels = append([]string{}, ticket.Fields.Labels...)
+	return ticket, true
+}
+
+// Comments returns the comments on an issue, oldest first.
+func (s *Server) Comments(key string) []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i, ok := s.issues[key]; ok {
+		return append([]Comment{}, i.comments...)
+	}
+	return nil
+}
+
+// Attachments returns the files uploaded to an issue.
+func (s *Server) Attachments(key string) []Attachment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i, ok := s.issues[key]; ok {
+		return append([]Attachment{}, i.attachments...)
+	}
+	return nil
+}
+
+// AddChangelog appends entries to an issue's history, e.g. past status changes.
+func (s *Server) AddChangelog(key string, entries ...jira.ChangelogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i, ok := s.issues[key]; ok {
+		for _, entry := range entries {
+			if entry.ID == "" {
+				entry.ID = strconv.Itoa(len(i.changelog) + 1)
+			}
+			i.changelog = append(i.changelog, entry)
+		}
+	}
+}
+
+// AddUser makes a user visible to the user endpoints.
+func (s *Server) AddUser(user jira.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = append(s.users, user)
+}
+
+// InjectFault adds a fault. Faults are checked in the order they were added.
+func (s *Server) InjectFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults removes every fault.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns every request the server got, as "METHOD /path".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// fault returns the first fault matching the request, using up one of its Times.
+func (s *Server) fault(r *http.Request) *Fault {
+	for i, f := range s.faults {
+		if (f.Method != "" && f.Method != r.Method) || !strings.HasPrefix(r.URL.Path, f.Path) {
+			continue
+		}
+		matched := *f
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return &matched
+	}
+	return nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	fault := s.fault(r)
+	s.mu.Unlock()
+
+	if fault != nil {
+		if fault.Delay > 0 {
+			select {
+			case <-time.After(fault.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fault.Status != 0 {
+			if fault.RetryAfter > 0 {
+				seconds := (fault.RetryAfter + time.Second - 1) / time.Second
+				w.Header().Set("Retry-After", strconv.Itoa(int(seconds)))
+			}
+			writeErrors(w, fault.Status, http.StatusText(fault.Status))
+			return
+		}
+	}
+
+	if username, password, ok := r.BasicAuth(); !ok || username != Username || password != Password {
+		writeErrors(w, http.StatusUnauthorized, "Client must be authenticated to access this resource.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.route(w, r)
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/rest/api/2/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "search/jql" && r.Method == http.MethodPost:
+		s.search(w, r)
+	case path == "user" && r.Method == http.MethodGet:
+		s.getUser(w, r)
+	case path == "user/search" && r.Method == http.MethodGet:
+		s.searchUsers(w, r)
+	case parts[0] == "issue" && len(parts) >= 2:
+		i, ok := s.issues[parts[1]]
+		if !ok {
+			writeErrors(w, http.StatusNotFound, "Issue does not exist or you do not have permission to see it.")
+			return
+		}
+		sub := strings.Join(parts[2:], "/")
+		switch {
+		case sub == "" && r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, s.encodeIssue(i, fieldsParam(r.URL.Query().Get("fields"))))
+		case sub == "" && r.Method == http.MethodPut:
+			s.updateIssue(w, r, i)
+		case sub == "comment" && r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]interface{}{"comments": i.comments, "total": len(i.comments), "startAt": 0, "maxResults": len(i.comments)})
+		case sub == "comment" && r.Method == http.MethodPost:
+			s.addComment(w, r, i)
+		case sub == "attachments" && r.Method == http.MethodPost:
+			s.addAttachment(w, r, i)
+		case sub == "changelog" && r.Method == http.MethodGet:
+			s.getChangelog(w, r, i)
+		case sub == "transitions" && r.Method == http.MethodGet:
+			s.getTransitions(w, i)
+		case sub == "transitions" && r.Method == http.MethodPost:
+			s.transition(w, r, i)
+		default:
+			writeErrors(w, http.StatusNotFound, "No endpoint for "+r.Method+" "+r.URL.Path)
+		}
+	default:
+		writeErrors(w, http.StatusNotFound, "No endpoint for "+r.Method+" "+r.URL.Path)
+	}
+}
+
+func fieldsParam(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// encodeIssue renders an issue the way Jira does, with custom fields inline. fields limits the
+// fields returned; empty returns all of them.
+func (s *Server) encodeIssue(i *issue, fields []string) map[string]interface{} {
+	type plainFields jira.TicketFields
+	data, _ := json.Marshal(plainFields(i.ticket.Fields))
+	all := map[string]json.RawMessage{}
+	json.Unmarshal(data, &all)
+	for id, value := range i.ticket.Fields.CustomFields {
+		all[id] = value
+	}
+	if len(fields) > 0 && !(len(fields) == 1 && fields[0] == "*all") {
+		selected := map[string]json.RawMessage{}
+		for _, field := range fields {
+			if value, ok := all[field]; ok {
+				selected[field] = value
+			}
+		}
+		all = selected
+	}
+	return map[string]interface{}{
+		"id":     i.id,
+		"key":    i.ticket.Key,
+		"self":   s.URL + "/rest/api/2/issue/" + i.id,
+		"fields": all,
+	}
+}
+
+func (s *Server) updateIssue(w http.ResponseWriter, r *http.Request, i *issue) {
+	var request struct {
+		Fields map[string]json.RawMessage              `json:"fields"`
+		Update map[string][]map[string]json.RawMessage `json:"update"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeErrors(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	ticket := i.ticket
+	ticket.Fields.Labels = append([]string{}, ticket.Fields.Labels...)
+	items := []jira.ChangelogItem{}
+	for field, value := range request.Fields {
+		item, err := s.setField(&ticket, field, value)
+		if err != nil {
+			writeErrors(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		items = append(items, item)
+	}
+	for field, operations := range request.Update {
+		if field != "labels" {
+			writeErrors(w, http.StatusBadRequest, fmt.Sprintf("Field '%s' cannot be updated, only set", field))
+			return
+		}
+		before := strings.Join(ticket.Fields.Labels, " ")
+		for _, operation := range operations {
+			for verb, raw := range operation {
+				var label string
+				if err := json.Unmarshal(raw, &label); err != nil {
+					writeErrors(w, http.StatusBadRequest, "Labels must be strings")
+					return
+				}
+				switch verb {
+				case "add":
+					if !contains(ticket.Fields.Labels, label) {
+						ticket.Fields.Labels = append(ticket.Fields.Labels, label)
+					}
+				case "remove":
+					ticket.Fields.Labels = remove(ticket.Fields.Labels, label)
+				case "set":
+					writeErrors(w, http.StatusBadRequest, "Use fields to set labels")
+					return
+				default:
+					writeErrors(w, http.StatusBadRequest, fmt.Sprintf("Unknown operation '%s'", verb))
+					return
+				}
+			}
+		}
+		items = append(items, jira.ChangelogItem{Field: "labels", FromString: before, ToString: strings.Join(ticket.Fields.Labels, " ")})
+	}
+
+	i.ticket = ticket
+	s.changed(i, items)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setField applies one entry of an update's "fields" and returns the change.
+func (s *Server) setField(ticket *jira.Ticket, field string, value json.RawMessage) (jira.ChangelogItem, error) {
+	item := jira.ChangelogItem{Field: field}
+	fields := &ticket.Fields
+	var err error
+	switch {
+	case field == "summary":
+		item.FromString = fields.Summary
+		err = json.Unmarshal(value, &fields.Summary)
+		item.ToString = fields.Summary
+	case field == "description":
+		item.FromString = fields.Description
+		err = json.Unmarshal(value, &fields.Description)
+		item.ToString = fields.Description
+	case field == "labels":
+		item.FromString = strings.Join(fields.Labels, " ")
+		err = json.Unmarshal(value, &fields.Labels)
+		item.ToString = strings.Join(fields.Labels, " ")
+	case field == "priority":
+		item.FromString = fields.Priority.Name
+		err = json.Unmarshal(value, &fields.Priority)
+		item.ToString = fields.Priority.Name
+	case field == "assignee":
+		var assignee struct {
+			AccountID string `json:"accountId"`
+		}
+		if err = json.Unmarshal(value, &assignee); err == nil {
+			item.FromString = fields.Assignee.DisplayName
+			fields.Assignee = jira.User{AccountId: assignee.AccountID}
+			for _, user := range s.users {
+				if user.AccountId == assignee.AccountID {
+					fields.Assignee = user
+				}
+			}
+			item.ToString = fields.Assignee.DisplayName
+		}
+	case strings.HasPrefix(field, "customfield_"):
+		item.FromString = string(fields.CustomFields[field])
+		if fields.CustomFields == nil {
+			fields.CustomFields = map[string]json.RawMessage{}
+		}
+		copied := map[string]json.RawMessage{}
+		for id, v := range fields.CustomFields {
+			copied[id] = v
+		}
+		copied[field] = value
+		fields.CustomFields = copied
+		item.ToString = string(value)
+	default:
+		return item, fmt.Errorf("Field '%s' cannot be set. It is not on the appropriate screen, or unknown.", field)
+	}
+	if err != nil {
+		return item, fmt.Errorf("Field '%s' has an invalid value: %v", field, err)
+	}
+	return item, nil
+}
+
+// changed records changes in the issue's changelog and bumps its updated time.
+func (s *Server) changed(i *issue, items []jira.ChangelogItem) {
+	now := jira.Time{Time: s.Now()}
+	i.ticket.Fields.Updated = now
+	if len(items) == 0 {
+		return
+	}
+	sort.Slice(items, func(a, b int) bool { return items[a].Field < items[b].Field })
+	i.changelog = append(i.changelog, jira.ChangelogEntry{
+		ID:      strconv.Itoa(len(i.changelog) + 1),
+		Author:  s.Actor,
+		Created: now,
+		Items:   items,
+	})
+}
+
+func (s *Server) addComment(w http.ResponseWriter, r *http.Request, i *issue) {
+	var request struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Body == "" {
+		writeErrors(w, http.StatusBadRequest, "Comment body can not be empty!")
+		return
+	}
+	comment := Comment{ID: strconv.Itoa(len(i.comments) + 1), Body: request.Body, Author: s.Actor, Created: jira.Time{Time: s.Now()}}
+	i.comments = append(i.comments, comment)
+	s.changed(i, nil)
+	writeJSON(w, http.StatusCreated, comment)
+}
+
+func (s *Server) addAttachment(w http.ResponseWriter, r *http.Request, i *issue) {
+	if r.Header.Get("X-Atlassian-Token") != "no-check" {
+		writeErrors(w, http.StatusForbidden, "XSRF check failed")
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, "Expected a multipart file upload: "+err.Error())
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	i.attachments = append(i.attachments, Attachment{Filename: header.Filename, Content: content})
+	s.changed(i, nil)
+	writeJSON(w, http.StatusOK, []map[string]interface{}{{"filename": header.Filename, "size": len(content)}})
+}
+
+func (s *Server) getChangelog(w http.ResponseWriter, r *http.Request, i *issue) {
+	startAt, maxResults := paging(r, 100)
+	end := startAt + maxResults
+	if end > len(i.changelog) {
+		end = len(i.changelog)
+	}
+	values := []jira.ChangelogEntry{}
+	if startAt < end {
+		values = i.changelog[startAt:end]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"values":     values,
+		"startAt":    startAt,
+		"maxResults": maxResults,
+		"total":      len(i.changelog),
+		"isLast":     end >= len(i.changelog),
+	})
+}
+
+func paging(r *http.Request, defaultMax int) (startAt, maxResults int) {
+	startAt, _ = strconv.Atoi(r.URL.Query().Get("startAt"))
+	maxResults, err := strconv.Atoi(r.URL.Query().Get("maxResults"))
+	if err != nil || maxResults <= 0 {
+		maxResults = defaultMax
+	}
+	if startAt < 0 {
+		startAt = 0
+	}
+	return startAt, maxResults
+}
+
+type transition struct {
+	ID   string      `json:"id"`
+	Name string      `json:"name"`
+	To   jira.Status `json:"to"`
+}
+
+func (s *Server) transitions(i *issue) []transition {
+	transitions := []transition{}
+	for n, status := range s.Statuses {
+		if status == i.ticket.Fields.Status.Name {
+			continue
+		}
+		id := strconv.Itoa(n + 1)
+		transitions = append(transitions, transition{ID: id, Name: status, To: jira.Status{ID: id, Name: status}})
+	}
+	return transitions
+}
+
+func (s *Server) getTransitions(w http.ResponseWriter, i *issue) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"transitions": s.transitions(i)})
+}
+
+func (s *Server) transition(w http.ResponseWriter, r *http.Request, i *issue) {
+	var request struct {
+		Transition struct {
+			ID string `json:"id"`
+		} `json:"transition"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeErrors(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	for _, t := range s.transitions(i) {
+		if t.ID == request.Transition.ID {
+			from := i.ticket.Fields.Status.Name
+			i.ticket.Fields.Status = t.To
+			s.changed(i, []jira.ChangelogItem{{Field: "status", FromString: from, ToString: t.To.Name}})
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeErrors(w, http.StatusBadRequest, fmt.Sprintf("Transition id '%s' is not valid for this issue.", request.Transition.ID))
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	accountID := r.URL.Query().Get("accountId")
+	for _, user := range s.users {
+		if user.AccountId == accountID {
+			writeJSON(w, http.StatusOK, user)
+			return
+		}
+	}
+	writeErrors(w, http.StatusNotFound, fmt.Sprintf("User with accountId '%s' does not exist", accountID))
+}
+
+func (s *Server) searchUsers(w http.ResponseWriter, r *http.Request) {
+	query := strings.ToLower(r.URL.Query().Get("query"))
+	users := []jira.User{}
+	for _, user := range s.users {
+		for _, value := range []string{user.Name, user.DisplayName, user.EmailAddress} {
+			if query != "" && strings.Contains(strings.ToLower(value), query) {
+				users = append(users, user)
+				break
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		JQL           string   `json:"jql"`
+		MaxResults    int      `json:"maxResults"`
+		Fields        []string `json:"fields"`
+		NextPageToken string   `json:"nextPageToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeErrors(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	query, err := parseJQL(request.JQL)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	matches := []*issue{}
+	for _, key := range s.keys {
+		i := s.issues[key]
+		ok, err := query.matches(i.ticket, s.Now())
+		if err != nil {
+			writeErrors(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if ok {
+			matches = append(matches, i)
+		}
+	}
+	query.sort(matches)
+
+	start, _ := strconv.Atoi(request.NextPageToken)
+	maxResults := request.MaxResults
+	if maxResults <= 0 {
+		maxResults = 50
+	}
+	end := start + maxResults
+	if end > len(matches) {
+		end = len(matches)
+	}
+	issues := []map[string]interface{}{}
+	for _, i := range matches[min(start, end):end] {
+		issues = append(issues, s.encodeIssue(i, request.Fields))
+	}
+	response := map[string]interface{}{"issues": issues, "isLast": end >= len(matches)}
+	if end < len(matches) {
+		response["nextPageToken"] = strconv.Itoa(end)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeErrors answers with Jira's error body.
+func writeErrors(w http.ResponseWriter, status int, messages ...string) {
+	writeJSON(w, status, map[string]interface{}{"errorMessages": messages, "errors": map[string]string{}})
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(values []string, value string) []string {
+	kept := []string{}
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
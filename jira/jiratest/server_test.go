@@ -0,0 +1,226 @@
+package jiratest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/jira"
+	"github.com/Clever/flarebot/jira/jiratest"
+)
+
+var now = time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+func newServer(t *testing.T) *jiratest.Server {
+	server := jiratest.NewServer(t)
+	server.Now = func() time.Time { return now }
+	server.AddIssue(jira.Ticket{Key: "FLARE-1", Fields: jira.TicketFields{
+		Summary: "api is down",
+		Status:  jira.Status{Name: "In Progress"},
+		Labels:  []string{"sev1"},
+		Created: jira.Time{Time: now.Add(-10 * 24 * time.Hour)},
+		CustomFields: map[string]json.RawMessage{
+			"customfield_10100": json.RawMessage(`"https://slack.com/archives/C1"`),
+		},
+	}})
+	server.AddIssue(jira.Ticket{Key: "FLARE-2", Fields: jira.TicketFields{
+		Summary:  "slow logins",
+		Status:   jira.Status{Name: "Mitigated"},
+		Assignee: jira.User{AccountId: "alice", DisplayName: "Alice Smith"},
+		Created:  jira.Time{Time: now.Add(-2 * 24 * time.Hour)},
+	}})
+	server.AddIssue(jira.Ticket{Key: "FLARE-10", Fields: jira.TicketFields{
+		Summary: "not a flare",
+		Status:  jira.Status{Name: "NotAFlare"},
+		Created: jira.Time{Time: now.Add(-time.Hour)},
+	}})
+	server.AddIssue(jira.Ticket{Key: "OTHER-1", Fields: jira.TicketFields{Status: jira.Status{Name: "In Progress"}}})
+	return server
+}
+
+func keys(tickets []jira.Ticket) []string {
+	keys := []string{}
+	for _, ticket := range tickets {
+		keys = append(keys, ticket.Key)
+	}
+	return keys
+}
+
+func TestSearch(t *testing.T) {
+	server := newServer(t)
+	client := server.Client()
+
+	tests := []struct {
+		jql      string
+		expected []string
+		err      bool
+	}{
+		{jql: `project = FLARE AND status = "In Progress"`, expected: []string{"FLARE-1"}},
+		{jql: `project = "FLARE" ORDER BY created ASC`, expected: []string{"FLARE-1", "FLARE-2", "FLARE-10"}},
+		{jql: `project = FLARE ORDER BY key DESC`, expected: []string{"FLARE-10", "FLARE-2", "FLARE-1"}},
+		{jql: `project = FLARE AND created >= -7d ORDER BY created ASC`, expected: []string{"FLARE-2", "FLARE-10"}},
+		{jql: `project = "FLARE" AND created >= "2024-03-01" AND created < "2024-03-14" ORDER BY created ASC`, expected: []string{"FLARE-1", "FLARE-2"}},
+		{jql: `cf[10100] = "https://slack.com/archives/C1"`, expected: []string{"FLARE-1"}},
+		{jql: `project = FLARE AND status not in (NotAFlare, Mitigated)`, expected: []string{"FLARE-1"}},
+		{jql: `labels = sev1 OR labels = sev2`, err: true},
+		{jql: `assignee is EMPTY AND project = FLARE`, expected: []string{"FLARE-1", "FLARE-10"}},
+		{jql: `assignee = alice`, expected: []string{"FLARE-2"}},
+		{jql: `summary ~ "LOGIN"`, expected: []string{"FLARE-2"}},
+		{jql: `created > yesterday`, err: true},
+		{jql: `resolution = Done`, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.jql, func(t *testing.T) {
+			tickets, err := client.SearchTickets(test.jql, nil)
+			if test.err {
+				var statusErr *jira.StatusError
+				require.True(t, errors.As(err, &statusErr), "expected a StatusError, got %v", err)
+				assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, keys(tickets))
+		})
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	server := jiratest.NewServer(t)
+	for i := 0; i < 250; i++ {
+		server.AddIssue(jira.Ticket{Key: fmt.Sprintf("FLARE-%d", i+1)})
+	}
+
+	tickets, err := server.Client().SearchTickets("project = FLARE", []string{"summary"})
+	require.NoError(t, err)
+	assert.Len(t, tickets, 250)
+	assert.Len(t, server.Requests(), 3)
+}
+
+func TestChanges(t *testing.T) {
+	server := newServer(t)
+	server.AddUser(jira.User{AccountId: "bob", DisplayName: "Bob Jones"})
+	client := server.Client()
+	ticket := &jira.Ticket{Key: "FLARE-1"}
+
+	require.NoError(t, client.SetLabel(ticket, "slack-archived"))
+	require.NoError(t, client.RemoveLabel(ticket, "sev1"))
+	require.NoError(t, client.SetField(ticket, "customfield_10200", "postmortem"))
+	require.NoError(t, client.UpdateTicket(ticket, map[string]interface{}{
+		"fields": map[string]interface{}{"assignee": map[string]string{"accountId": "bob"}},
+	}))
+	require.NoError(t, client.AddComment(ticket, "archived the channel"))
+	require.NoError(t, client.AddAttachment(ticket, "history.txt", []byte("hello")))
+
+	var transitions struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"transitions"`
+	}
+	require.NoError(t, client.DoRequest("GET", "/rest/api/2/issue/FLARE-1/transitions", nil, &transitions))
+	require.Len(t, transitions.Transitions, len(jiratest.DefaultStatuses)-1)
+	for _, transition := range transitions.Transitions {
+		if transition.Name == "Mitigated" {
+			body := map[string]interface{}{"transition": map[string]string{"id": transition.ID}}
+			require.NoError(t, client.DoRequest("POST", "/rest/api/2/issue/FLARE-1/transitions", body, nil))
+		}
+	}
+
+	updated, err := client.GetTicketByKey("FLARE-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"slack-archived"}, updated.Fields.Labels)
+	assert.Equal(t, "postmortem", updated.Fields.CustomFieldString("customfield_10200"))
+	assert.Equal(t, "https://slack.com/archives/C1", updated.Fields.CustomFieldString("customfield_10100"))
+	assert.Equal(t, "Bob Jones", updated.Fields.Assignee.DisplayName)
+	assert.Equal(t, "Mitigated", updated.Fields.Status.Name)
+	comments := server.Comments("FLARE-1")
+	require.Len(t, comments, 1)
+	assert.Equal(t, "archived the channel", comments[0].Body)
+	assert.Equal(t, server.Actor, comments[0].Author)
+	assert.Equal(t, []jiratest.Attachment{{Filename: "history.txt", Content: []byte("hello")}}, server.Attachments("FLARE-1"))
+
+	changelog, err := client.GetChangelog("FLARE-1")
+	require.NoError(t, err)
+	assert.Len(t, changelog, 5)
+	assert.Equal(t, []jira.ChangelogItem{{Field: "labels", FromString: "sev1", ToString: "sev1 slack-archived"}}, changelog[0].Items)
+	changes := jira.StatusChanges(changelog)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "In Progress", changes[0].From)
+	assert.Equal(t, "Mitigated", changes[0].To)
+	assert.True(t, changes[0].At.Equal(now))
+	assert.Equal(t, server.Actor, changes[0].Author)
+
+	err = client.UpdateTicket(ticket, map[string]interface{}{"fields": map[string]interface{}{"resolution": "Done"}})
+	assert.ErrorContains(t, err, "Field 'resolution' cannot be set")
+	_, err = client.GetTicketByKey("FLARE-404")
+	var statusErr *jira.StatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+}
+
+func TestUsers(t *testing.T) {
+	server := jiratest.NewServer(t)
+	alice := jira.User{AccountId: "alice", Name: "alice.smith", DisplayName: "Alice Smith", EmailAddress: "alice@example.com"}
+	server.AddUser(alice)
+	server.AddUser(jira.User{AccountId: "bob", DisplayName: "Bob Jones"})
+	client := server.Client()
+
+	var user jira.User
+	require.NoError(t, client.DoRequest("GET", "/rest/api/2/user?accountId=alice", nil, &user))
+	assert.Equal(t, alice, user)
+
+	var users []jira.User
+	require.NoError(t, client.DoRequest("GET", "/rest/api/2/user/search?query=smith", nil, &users))
+	assert.Equal(t, []jira.User{alice}, users)
+
+	err := client.DoRequest("GET", "/rest/api/2/user?accountId=carol", nil, &user)
+	assert.ErrorContains(t, err, "Status-code:404")
+}
+
+func TestAuthentication(t *testing.T) {
+	server := newServer(t)
+	client := server.Client()
+	client.Password = "wrong"
+
+	_, err := client.GetTicketByKey("FLARE-1")
+	assert.ErrorContains(t, err, "Status-code:401")
+}
+
+func TestFaults(t *testing.T) {
+	server := newServer(t)
+	client := server.Client()
+
+	server.InjectFault(jiratest.Fault{Method: "GET", Path: "/rest/api/2/issue/FLARE-1", Status: http.StatusTooManyRequests, RetryAfter: 1500 * time.Millisecond, Times: 1})
+	req, _ := http.NewRequest("GET", server.URL+"/rest/api/2/issue/FLARE-1", nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+	_, err = client.GetTicketByKey("FLARE-1")
+	assert.NoError(t, err, "the fault only applies once")
+
+	server.InjectFault(jiratest.Fault{Path: "/rest/api/2/search", Status: http.StatusInternalServerError})
+	for i := 0; i < 2; i++ {
+		_, err = client.SearchTickets("project = FLARE", nil)
+		assert.ErrorContains(t, err, "Status-code:500")
+	}
+	_, err = client.GetTicketByKey("FLARE-2")
+	assert.NoError(t, err, "faults only apply to their path")
+	server.ClearFaults()
+	_, err = client.SearchTickets("project = FLARE", nil)
+	assert.NoError(t, err)
+
+	server.InjectFault(jiratest.Fault{Delay: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.WithContext(ctx).GetTicketByKey("FLARE-1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,111 @@
+package jira
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const searchPageSize = 100
+
+type searchResponse struct {
+	Issues        []Ticket `json:"issues"`
+	NextPageToken string   `json:"nextPageToken"`
+	IsLast        bool     `json:"isLast"`
+}
+
+// SearchTickets runs a JQL query and returns every matching ticket, following pagination.
+// fields limits which ticket fields are returned; an empty list returns Jira's default set.
+func (server *JiraServer) SearchTickets(jql string, fields []string) ([]Ticket, error) {
+	tickets := []Ticket{}
+	nextPageToken := ""
+	for {
+		request := map[string]interface{}{
+			"jql":        jql,
+			"maxResults": searchPageSize,
+		}
+		if len(fields) > 0 {
+			request["fields"] = fields
+		}
+		if nextPageToken != "" {
+			request["nextPageToken"] = nextPageToken
+		}
+
+		var response searchResponse
+		err := server.DoRequest("POST", "/rest/api/2/search/jql", request, &response)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, response.Issues...)
+
+		if response.IsLast || response.NextPageToken == "" {
+			break
+		}
+		nextPageToken = response.NextPageToken
+	}
+	return tickets, nil
+}
+
+type ChangelogItem struct {
+	Field      string `json:"field"`
+	FromString string `json:"fromString"`
+	ToString   string `json:"toString"`
+}
+
+type ChangelogEntry struct {
+	ID      string          `json:"id"`
+	Author  User            `json:"author"`
+	Created Time            `json:"created"`
+	Items   []ChangelogItem `json:"items"`
+}
+
+type changelogResponse struct {
+	Values     []ChangelogEntry `json:"values"`
+	StartAt    int              `json:"startAt"`
+	MaxResults int              `json:"maxResults"`
+	Total      int              `json:"total"`
+	IsLast     bool             `json:"isLast"`
+}
+
+// GetChangelog returns the full change history of a ticket, oldest first.
+func (server *JiraServer) GetChangelog(key string) ([]ChangelogEntry, error) {
+	entries := []ChangelogEntry{}
+	startAt := 0
+	for {
+		path := fmt.Sprintf("/rest/api/2/issue/%s/changelog?startAt=%d&maxResults=%d", url.PathEscape(key), startAt, searchPageSize)
+
+		var response changelogResponse
+		err := server.DoRequest("GET", path, nil, &response)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, response.Values...)
+
+		startAt += len(response.Values)
+		if response.IsLast || len(response.Values) == 0 || startAt >= response.Total {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// StatusChange is a single status transition pulled out of a ticket's changelog.
+type StatusChange struct {
+	From   string
+	To     string
+	At     time.Time
+	Author User
+}
+
+// StatusChanges returns the status transitions recorded in a changelog, in order.
+func StatusChanges(entries []ChangelogEntry) []StatusChange {
+	changes := []StatusChange{}
+	for _, entry := range entries {
+		for _, item := range entry.Items {
+			if item.Field == "status" {
+				changes = append(changes, StatusChange{From: item.FromString, To: item.ToString, At: entry.Created.Time, Author: entry.Author})
+			}
+		}
+	}
+	return changes
+}
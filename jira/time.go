@@ -0,0 +1,39 @@
+package jira
+
+import (
+	"bytes"
+	"time"
+)
+
+// jiraTimeLayout is the timestamp format Jira uses in issue and changelog payloads,
+// e.g. "2016-06-15T08:21:13.591-0700". It is close to, but not, RFC 3339.
+const jiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+// Time wraps time.Time so Jira timestamps can be unmarshalled directly.
+// A null or missing timestamp leaves the zero value.
+type Time struct {
+	time.Time
+}
+
+func (t *Time) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) || len(data) < 2 {
+		return nil
+	}
+	parsed, err := time.Parse(jiraTimeLayout, string(data[1:len(data)-1]))
+	if err != nil {
+		// fall back to RFC 3339 for fields that don't use the Jira layout
+		parsed, err = time.Parse(time.RFC3339, string(data[1:len(data)-1]))
+		if err != nil {
+			return err
+		}
+	}
+	t.Time = parsed
+	return nil
+}
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return []byte(`"` + t.Format(jiraTimeLayout) + `"`), nil
+}
@@ -0,0 +1,753 @@
+// Package slacktest runs an in-process fake Slack workspace for tests. It keeps channels,
+// membership, archive state, message history, threads, pins, users and files in memory, answers
+// the Web API methods flarebot's jobs use with cursor pagination, and can rate limit or fail calls.
+// Point a real slack-go client at it with Client, so the tests exercise slack-go's error handling too.
+package slacktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	slk "github.com/slack-go/slack"
+)
+
+// Token is the only token the workspace accepts. Calls with another token fail with invalid_auth.
+const Token = "xoxb-slacktest"
+
+// BotUserID is the user the token belongs to. Channels with the bot in Members list it as a member.
+const BotUserID = "UBOT"
+
+// Fault makes matching calls fail or slow down.
+type Fault struct {
+	// Method is the Web API method, like "conversations.archive". Empty matches every method.
+	Method string
+	// Status is returned as the HTTP status, e.g. 429 or 503.
+	Status int
+	// RetryAfter is sent as the Retry-After header, in whole seconds, with a 429.
+	RetryAfter time.Duration
+	// Error answers the call with "ok": false and this error code, like "internal_error".
+	Error string
+	// Delay is how long to wait before answering.
+	Delay time.Duration
+	// Times limits the fault to the next n matching calls. 0 applies it until ClearFaults.
+	Times int
+}
+
+type conversation struct {
+	channel  slk.Channel
+	members  map[string]bool
+	messages []slk.Message
+	pins     []string
+}
+
+// Server is a fake Slack workspace. Create one with NewServer.
+type Server struct {
+	*httptest.Server
+
+	// Now is the workspace's clock, used for message timestamps and rate limit windows.
+	Now func() time.Time
+	// MaxPageSize caps the page size of list calls, so tests can cover pagination with a few
+	// channels or messages. 0 uses the caller's limit.
+	MaxPageSize int
+
+	mu            sync.Mutex
+	conversations map[string]*conversation
+	ids           []string
+	users         []slk.User
+	files         map[string][]byte
+	faults        []*Fault
+	rateLimits    map[string]int
+	calls         map[string][]time.Time
+	requests      []string
+	nextTS        int
+}
+
+// NewServer starts a fake workspace that's closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		Now:           time.Now,
+		conversations: map[string]*conversation{},
+		files:         map[string][]byte{},
+		rateLimits:    map[string]int{},
+		calls:         map[string][]time.Time{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Client returns a slack-go client for the workspace.
+func (s *Server) Client() *slk.Client {
+	return slk.New(Token, slk.OptionAPIURL(s.URL+"/api/"))
+}
+
+// AddChannel adds a channel, replacing any with the same ID. IsMember adds the bot to Members.
+// Members, IsArchived, IsPrivate and the shared flags are kept up to date by the calls made to
+// the workspace; read them back with Channel.
+func (s *Server) AddChannel(channel slk.Channel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	members := map[string]bool{}
+	for _, member := range channel.Members {
+		members[member] = true
+	}
+	if channel.IsMember {
+		members[BotUserID] = true
+	}
+	if channel.Created == 0 {
+		channel.Created = slk.JSONTime(s.Now().Unix())
+	}
+	channel.IsChannel = true
+	if _, ok := s.conversations[channel.ID]; !ok {
+		s.ids = append(s.ids, channel.ID)
+	}
+	s.conversations[channel.ID] = &conversation{channel: channel, members: members}
+}
+
+// Channel returns the current state of a channel, with its full member list.
+func (s *Server) Channel(id string) (slk.Channel, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.conversations[id]
+	if !ok {
+		return slk.Channel{}, false
+	}
+	channel := c.render()
+	channel.Members = c.memberList()
+	return channel, true
+}
+
+// AddMessages appends messages to a channel's history, oldest first. Messages without a
+// Timestamp get the next one from the workspace clock. Messages with a ThreadTimestamp other
+// than their own are thread replies.
+func (s *Server) AddMessages(channelID string, messages ...slk.Message) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.conversations[channelID]
+	if !ok {
+		return nil
+	}
+	timestamps := []string{}
+	for _, message := range messages {
+		s.post(c, message)
+		timestamps = append(timestamps, c.messages[len(c.messages)-1].Timestamp)
+	}
+	return timestamps
+}
+
+// Messages returns a channel's history, thread replies included, oldest first.
+func (s *Server) Messages(channelID string) []slk.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.conversations[channelID]; ok {
+		return append([]slk.Message{}, c.messages...)
+	}
+	return nil
+}
+
+// UpdateMessage replaces the message with the same Timestamp, like an edit, and reports
+// whether it was found.
+func (s *Server) UpdateMessage(channelID string, message slk.Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.conversations[channelID]; ok {
+		for i := range c.messages {
+			if c.messages[i].Timestamp == message.Timestamp {
+				c.messages[i] = message
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DeleteMessage removes the message with the timestamp ts.
+func (s *Server) DeleteMessage(channelID, ts string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.conversations[channelID]; ok {
+		for i := range c.messages {
+			if c.messages[i].Timestamp == ts {
+				c.messages = append(c.messages[:i], c.messages[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Pin pins the message with the timestamp ts.
+func (s *Server) Pin(channelID, ts string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.conversations[channelID]; ok {
+		c.pins = append(c.pins, ts)
+	}
+}
+
+// AddUser adds a user to the workspace.
+func (s *Server) AddUser(user slk.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = append(s.users, user)
+}
+
+// AddFile makes content downloadable and returns the file with its private URLs pointing at the
+// workspace. Attach the returned file to a message to share it.
+func (s *Server) AddFile(file slk.File, content []byte) slk.File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := "/files/" + file.ID + "/" + url.PathEscape(file.Name)
+	s.files[path] = content
+	file.URLPrivate = s.URL + path
+	file.URLPrivateDownload = s.URL + path + "?download=1"
+	file.Size = len(content)
+	return file
+}
+
+// InjectFault adds a fault. Faults are checked in the order they were added.
+func (s *Server) InjectFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults removes every fault and rate limit.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+	s.rateLimits = map[string]int{}
+}
+
+// SetRateLimit allows perMinute calls of a method a minute, by the workspace clock, like
+// Slack's rate limit tiers. Calls over the limit get a 429 with the seconds left in the window.
+func (s *Server) SetRateLimit(method string, perMinute int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimits[method] = perMinute
+}
+
+// Requests returns the methods called on the workspace, in order.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func (s *Server) fault(method string) *Fault {
+	for i, f := range s.faults {
+		if f.Method != "" && f.Method != method {
+			continue
+		}
+		matched := *f
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return &matched
+	}
+	return nil
+}
+
+// rateLimited returns how long until the method can be called again, or 0 if it can be now.
+func (s *Server) rateLimited(method string) time.Duration {
+	perMinute, ok := s.rateLimits[method]
+	if !ok {
+		return 0
+	}
+	now := s.Now()
+	recent := []time.Time{}
+	for _, at := range s.calls[method] {
+		if now.Sub(at) < time.Minute {
+			recent = append(recent, at)
+		}
+	}
+	s.calls[method] = recent
+	if len(recent) < perMinute {
+		s.calls[method] = append(recent, now)
+		return 0
+	}
+	if perMinute == 0 {
+		return time.Minute
+	}
+	return recent[0].Add(time.Minute).Sub(now)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/api/")
+	r.ParseForm()
+
+	s.mu.Lock()
+	s.requests = append(s.requests, method)
+	fault := s.fault(method)
+	wait := s.rateLimited(method)
+	s.mu.Unlock()
+
+	if fault != nil {
+		if fault.Delay > 0 {
+			select {
+			case <-time.After(fault.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fault.Status == http.StatusTooManyRequests {
+			wait = fault.RetryAfter
+		} else if fault.Status != 0 {
+			w.WriteHeader(fault.Status)
+			return
+		}
+		if fault.Error != "" {
+			writeError(w, fault.Error)
+			return
+		}
+	}
+	if wait > 0 || (fault != nil && fault.Status == http.StatusTooManyRequests) {
+		seconds := (wait + time.Second - 1) / time.Second
+		w.Header().Set("Retry-After", strconv.Itoa(int(seconds)))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "ratelimited"})
+		return
+	}
+
+	token := r.Form.Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if token != Token {
+		if strings.HasPrefix(r.URL.Path, "/files/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		writeError(w, "invalid_auth")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if strings.HasPrefix(r.URL.Path, "/files/") {
+		s.download(w, r)
+		return
+	}
+	handler, ok := map[string]func(http.ResponseWriter, *http.Request){
+		"conversations.list":      s.list,
+		"conversations.info":      s.info,
+		"conversations.history":   s.history,
+		"conversations.replies":   s.replies,
+		"conversations.join":      s.join,
+		"conversations.leave":     s.leave,
+		"conversations.archive":   s.archive,
+		"conversations.unarchive": s.unarchive,
+		"conversations.rename":    s.rename,
+		"chat.postMessage":        s.postMessage,
+		"pins.list":               s.listPins,
+		"users.info":              s.userInfo,
+		"users.lookupByEmail":     s.lookupByEmail,
+	}[method]
+	if !ok {
+		writeError(w, "unknown_method")
+		return
+	}
+	handler(w, r)
+}
+
+// render is the channel as the bot sees it in API answers.
+func (c *conversation) render() slk.Channel {
+	channel := c.channel
+	channel.IsMember = c.members[BotUserID]
+	channel.NumMembers = len(c.members)
+	channel.Members = nil
+	return channel
+}
+
+func (c *conversation) memberList() []string {
+	members := []string{}
+	for member := range c.members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// visible reports whether the bot can see the channel. Private channels are hidden from
+// non-members, like in Slack.
+func (c *conversation) visible() bool {
+	return !c.channel.IsPrivate || c.members[BotUserID]
+}
+
+// lookup finds the channel of a call, writing channel_not_found if the bot can't see it.
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (*conversation, bool) {
+	c, ok := s.conversations[r.Form.Get("channel")]
+	if !ok || !c.visible() {
+		writeError(w, "channel_not_found")
+		return nil, false
+	}
+	return c, true
+}
+
+// page returns the [start, end) window of the items for the call's cursor and limit, and the
+// cursor of the next page. positions are where the items are stored, in the order they're
+// listed, newest first when descending. Cursors point at a position so pages stay stable when
+// items before them change, like a listed channel getting archived.
+func (s *Server) page(r *http.Request, positions []int, descending bool, defaultLimit int) (start, end int, next string) {
+	if cursor := r.Form.Get("cursor"); cursor != "" {
+		position, _ := strconv.Atoi(cursor)
+		for start < len(positions) && ((!descending && positions[start] < position) || (descending && positions[start] > position)) {
+			start++
+		}
+	}
+	limit, err := strconv.Atoi(r.Form.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if s.MaxPageSize > 0 && limit > s.MaxPageSize {
+		limit = s.MaxPageSize
+	}
+	end = min(start+limit, len(positions))
+	if end < len(positions) {
+		next = strconv.Itoa(positions[end])
+	}
+	return start, end, next
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	types := map[string]bool{}
+	for _, t := range strings.Split(r.Form.Get("types"), ",") {
+		types[t] = true
+	}
+	if r.Form.Get("types") == "" {
+		types["public_channel"] = true
+	}
+	excludeArchived := r.Form.Get("exclude_archived") == "true"
+
+	matching := []slk.Channel{}
+	positions := []int{}
+	for position, id := range s.ids {
+		c := s.conversations[id]
+		kind := "public_channel"
+		if c.channel.IsPrivate {
+			kind = "private_channel"
+		}
+		if !types[kind] || !c.visible() || (excludeArchived && c.channel.IsArchived) {
+			continue
+		}
+		matching = append(matching, c.render())
+		positions = append(positions, position)
+	}
+	start, end, next := s.page(r, positions, false, 100)
+	writeOK(w, map[string]interface{}{
+		"channels":          matching[start:end],
+		"response_metadata": map[string]string{"next_cursor": next},
+	})
+}
+
+func (s *Server) info(w http.ResponseWriter, r *http.Request) {
+	if c, ok := s.lookup(w, r); ok {
+		writeOK(w, map[string]interface{}{"channel": c.render()})
+	}
+}
+
+// inRange reports whether ts is within the call's oldest and latest bounds.
+func inRange(r *http.Request, ts string) bool {
+	inclusive := r.Form.Get("inclusive") == "1"
+	at, _ := strconv.ParseFloat(ts, 64)
+	if oldest := r.Form.Get("oldest"); oldest != "" {
+		bound, _ := strconv.ParseFloat(oldest, 64)
+		if at < bound || (at == bound && !inclusive) {
+			return false
+		}
+	}
+	if latest := r.Form.Get("latest"); latest != "" {
+		bound, _ := strconv.ParseFloat(latest, 64)
+		if at > bound || (at == bound && !inclusive) {
+			return false
+		}
+	}
+	return true
+}
+
+func isReply(message slk.Message) bool {
+	return message.ThreadTimestamp != "" && message.ThreadTimestamp != message.Timestamp
+}
+
+func (s *Server) history(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	messages := []slk.Message{}
+	positions := []int{}
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		if message := c.messages[i]; !isReply(message) && inRange(r, message.Timestamp) {
+			messages = append(messages, s.withReplies(c, message))
+			positions = append(positions, i)
+		}
+	}
+	start, end, next := s.page(r, positions, true, 100)
+	writeOK(w, map[string]interface{}{
+		"messages":          messages[start:end],
+		"has_more":          next != "",
+		"pin_count":         len(c.pins),
+		"response_metadata": map[string]string{"next_cursor": next},
+	})
+}
+
+// withReplies fills in the reply count and latest reply of a thread's parent message.
+func (s *Server) withReplies(c *conversation, message slk.Message) slk.Message {
+	replies := 0
+	latest, latestAt := "", 0.0
+	for _, reply := range c.messages {
+		if isReply(reply) && reply.ThreadTimestamp == message.Timestamp {
+			replies++
+			if at, _ := strconv.ParseFloat(reply.Timestamp, 64); latest == "" || at > latestAt {
+				latest, latestAt = reply.Timestamp, at
+			}
+		}
+	}
+	if replies > 0 {
+		message.ThreadTimestamp = message.Timestamp
+		message.ReplyCount = replies
+		message.LatestReply = latest
+	}
+	return message
+}
+
+func (s *Server) replies(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	ts := r.Form.Get("ts")
+	messages := []slk.Message{}
+	positions := []int{}
+	for i, message := range c.messages {
+		if message.Timestamp == ts {
+			messages = append(messages, s.withReplies(c, message))
+			positions = append(positions, i)
+		} else if isReply(message) && message.ThreadTimestamp == ts && inRange(r, message.Timestamp) {
+			messages = append(messages, message)
+			positions = append(positions, i)
+		}
+	}
+	if len(messages) == 0 {
+		writeError(w, "thread_not_found")
+		return
+	}
+	start, end, next := s.page(r, positions, false, 100)
+	writeOK(w, map[string]interface{}{
+		"messages":          messages[start:end],
+		"has_more":          next != "",
+		"response_metadata": map[string]string{"next_cursor": next},
+	})
+}
+
+func (s *Server) join(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	switch {
+	case c.channel.IsPrivate:
+		writeError(w, "method_not_supported_for_channel_type")
+	case c.channel.IsArchived:
+		writeError(w, "is_archived")
+	case c.members[BotUserID]:
+		writeOK(w, map[string]interface{}{"channel": c.render(), "warning": "already_in_channel"})
+	default:
+		c.members[BotUserID] = true
+		writeOK(w, map[string]interface{}{"channel": c.render()})
+	}
+}
+
+func (s *Server) leave(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	switch {
+	case c.channel.IsArchived:
+		writeError(w, "is_archived")
+	case !c.members[BotUserID]:
+		writeOK(w, map[string]interface{}{"not_in_channel": true})
+	default:
+		delete(c.members, BotUserID)
+		writeOK(w, nil)
+	}
+}
+
+func (s *Server) archive(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	switch {
+	case c.channel.IsArchived:
+		writeError(w, "already_archived")
+	case !c.members[BotUserID]:
+		writeError(w, "not_in_channel")
+	default:
+		c.channel.IsArchived = true
+		writeOK(w, nil)
+	}
+}
+
+func (s *Server) unarchive(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	if !c.channel.IsArchived {
+		writeError(w, "not_archived")
+		return
+	}
+	c.channel.IsArchived = false
+	writeOK(w, nil)
+}
+
+var channelNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,80}$`)
+
+func (s *Server) rename(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	name := r.Form.Get("name")
+	if !channelNamePattern.MatchString(name) {
+		writeError(w, "invalid_name_specials")
+		return
+	}
+	for _, other := range s.conversations {
+		if other != c && other.channel.Name == name {
+			writeError(w, "name_taken")
+			return
+		}
+	}
+	switch {
+	case c.channel.IsArchived:
+		writeError(w, "is_archived")
+	case !c.members[BotUserID]:
+		writeError(w, "not_in_channel")
+	default:
+		c.channel.Name = name
+		c.channel.NameNormalized = name
+		writeOK(w, map[string]interface{}{"channel": c.render()})
+	}
+}
+
+// post adds a message to the channel, giving it the next timestamp if it has none.
+func (s *Server) post(c *conversation, message slk.Message) {
+	if message.Timestamp == "" {
+		s.nextTS++
+		message.Timestamp = fmt.Sprintf("%d.%06d", s.Now().Unix(), s.nextTS)
+	}
+	if message.Type == "" {
+		message.Type = slk.TYPE_MESSAGE
+	}
+	c.messages = append(c.messages, message)
+}
+
+func (s *Server) postMessage(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	switch {
+	case c.channel.IsArchived:
+		writeError(w, "is_archived")
+		return
+	case !c.members[BotUserID]:
+		writeError(w, "not_in_channel")
+		return
+	}
+
+	message := slk.Message{Msg: slk.Msg{User: BotUserID, Text: r.Form.Get("text"), ThreadTimestamp: r.Form.Get("thread_ts")}}
+	if blocks := r.Form.Get("blocks"); blocks != "" {
+		if err := json.Unmarshal([]byte(blocks), &message.Blocks); err != nil {
+			writeError(w, "invalid_blocks")
+			return
+		}
+	}
+	if message.Text == "" && len(message.Blocks.BlockSet) == 0 {
+		writeError(w, "no_text")
+		return
+	}
+	s.post(c, message)
+	posted := c.messages[len(c.messages)-1]
+	writeOK(w, map[string]interface{}{"channel": c.channel.ID, "ts": posted.Timestamp, "message": posted})
+}
+
+func (s *Server) listPins(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	items := []slk.Item{}
+	for _, ts := range c.pins {
+		for i := range c.messages {
+			if c.messages[i].Timestamp == ts {
+				message := c.messages[i]
+				items = append(items, slk.NewMessageItem(c.channel.ID, &message))
+			}
+		}
+	}
+	writeOK(w, map[string]interface{}{"items": items, "paging": slk.Paging{Count: len(items), Total: len(items), Page: 1, Pages: 1}})
+}
+
+// download serves a file added with AddFile. Downloads without the token are forbidden.
+func (s *Server) download(w http.ResponseWriter, r *http.Request) {
+	content, ok := s.files[r.URL.EscapedPath()]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(content)
+}
+
+func (s *Server) userInfo(w http.ResponseWriter, r *http.Request) {
+	for _, user := range s.users {
+		if user.ID == r.Form.Get("user") {
+			writeOK(w, map[string]interface{}{"user": user})
+			return
+		}
+	}
+	writeError(w, "user_not_found")
+}
+
+func (s *Server) lookupByEmail(w http.ResponseWriter, r *http.Request) {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Profile.Email, r.Form.Get("email")) {
+			writeOK(w, map[string]interface{}{"user": user})
+			return
+		}
+	}
+	writeError(w, "users_not_found")
+}
+
+func writeOK(w http.ResponseWriter, fields map[string]interface{}) {
+	body := map[string]interface{}{"ok": true}
+	for key, value := range fields {
+		body[key] = value
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError answers like Slack does, with a 200 and the error code in the body.
+func writeError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": code})
+}
@@ -0,0 +1,253 @@
+package slacktest_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	slk "github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/flarebot/slackutil"
+	"github.com/Clever/flarebot/slackutil/slacktest"
+)
+
+func channel(id, name string, member bool) slk.Channel {
+	channel := slk.Channel{}
+	channel.ID = id
+	channel.Name = name
+	channel.IsMember = member
+	return channel
+}
+
+func TestListChannels(t *testing.T) {
+	server := slacktest.NewServer(t)
+	server.MaxPageSize = 2
+	server.AddChannel(channel("C1", "flare-1", true))
+	server.AddChannel(channel("C2", "flare-2", false))
+	archived := channel("C3", "flare-3", false)
+	archived.IsArchived = true
+	server.AddChannel(archived)
+	hidden := channel("G1", "secret", false)
+	hidden.IsPrivate = true
+	server.AddChannel(hidden)
+	private := channel("G2", "private", true)
+	private.IsPrivate = true
+	server.AddChannel(private)
+	client := server.Client()
+
+	names := []string{}
+	params := &slk.GetConversationsParameters{Types: []string{"public_channel", "private_channel"}, ExcludeArchived: true, Limit: 200}
+	for {
+		channels, cursor, err := client.GetConversations(params)
+		require.NoError(t, err)
+		for _, channel := range channels {
+			names = append(names, channel.Name)
+		}
+		if cursor == "" {
+			break
+		}
+		params.Cursor = cursor
+	}
+	assert.Equal(t, []string{"flare-1", "flare-2", "private"}, names)
+	assert.Equal(t, []string{"conversations.list", "conversations.list"}, server.Requests())
+}
+
+func TestListCursorsAreStable(t *testing.T) {
+	server := slacktest.NewServer(t)
+	server.MaxPageSize = 1
+	server.AddChannel(channel("C1", "flare-1", true))
+	server.AddChannel(channel("C2", "flare-2", true))
+	client := server.Client()
+
+	params := &slk.GetConversationsParameters{ExcludeArchived: true}
+	channels, cursor, err := client.GetConversations(params)
+	require.NoError(t, err)
+	require.Equal(t, "C1", channels[0].ID)
+	require.NoError(t, client.ArchiveConversation("C1"))
+
+	params.Cursor = cursor
+	channels, cursor, err = client.GetConversations(params)
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	assert.Equal(t, "C2", channels[0].ID)
+	assert.Empty(t, cursor)
+}
+
+func TestMembershipAndArchiving(t *testing.T) {
+	server := slacktest.NewServer(t)
+	server.AddChannel(channel("C1", "flare-1", false))
+	server.AddChannel(channel("C2", "flare-2", true))
+	client := server.Client()
+
+	err := client.ArchiveConversation("C1")
+	assert.True(t, slackutil.IsError(err, "not_in_channel"), "got %v", err)
+	_, err = client.RenameConversation("C1", "flare-1-renamed")
+	assert.True(t, slackutil.IsError(err, "not_in_channel"), "got %v", err)
+
+	_, _, _, err = client.JoinConversation("C1")
+	require.NoError(t, err)
+	_, err = client.RenameConversation("C1", "flare-2")
+	assert.True(t, slackutil.IsError(err, "name_taken"), "got %v", err)
+	renamed, err := client.RenameConversation("C1", "flare-1-renamed")
+	require.NoError(t, err)
+	assert.Equal(t, "flare-1-renamed", renamed.Name)
+	require.NoError(t, client.ArchiveConversation("C1"))
+	err = client.ArchiveConversation("C1")
+	assert.True(t, slackutil.IsError(err, "already_archived"), "got %v", err)
+	_, _, err = client.PostMessage("C1", slk.MsgOptionText("hello", false))
+	assert.True(t, slackutil.IsError(err, "is_archived"), "got %v", err)
+
+	notInChannel, err := client.LeaveConversation("C2")
+	require.NoError(t, err)
+	assert.False(t, notInChannel)
+	notInChannel, err = client.LeaveConversation("C2")
+	require.NoError(t, err)
+	assert.True(t, notInChannel)
+
+	require.NoError(t, client.UnArchiveConversation("C1"))
+	state, ok := server.Channel("C1")
+	require.True(t, ok)
+	assert.False(t, state.IsArchived)
+	assert.Equal(t, "flare-1-renamed", state.Name)
+	assert.Equal(t, []string{slacktest.BotUserID}, state.Members)
+	state, _ = server.Channel("C2")
+	assert.Empty(t, state.Members)
+
+	_, err = client.GetConversationHistory(&slk.GetConversationHistoryParameters{ChannelID: "C404"})
+	assert.True(t, slackutil.IsError(err, "channel_not_found"), "got %v", err)
+}
+
+func TestHistory(t *testing.T) {
+	server := slacktest.NewServer(t)
+	server.MaxPageSize = 2
+	server.AddChannel(channel("C1", "flare-1", true))
+	timestamps := server.AddMessages("C1",
+		slk.Message{Msg: slk.Msg{User: "U1", Text: "fire a flare", Timestamp: "1700000000.000100"}},
+		slk.Message{Msg: slk.Msg{User: "U2", Text: "looking", Timestamp: "1700000100.000100", ThreadTimestamp: "1700000000.000100"}},
+		slk.Message{Msg: slk.Msg{User: "U1", Text: "mitigated", Timestamp: "1700000200.000100"}},
+		slk.Message{Msg: slk.Msg{User: "U1", Text: "postmortem soon", Timestamp: "1700000300.000100"}},
+	)
+	assert.Len(t, timestamps, 4)
+	server.Pin("C1", "1700000000.000100")
+	client := server.Client()
+
+	history, err := slackutil.History(client, "C1")
+	require.NoError(t, err)
+	texts := []string{}
+	for _, message := range history {
+		texts = append(texts, message.Text)
+	}
+	assert.Equal(t, []string{"postmortem soon", "mitigated", "fire a flare"}, texts)
+	assert.Equal(t, 1, history[2].ReplyCount)
+
+	recent, err := client.GetConversationHistory(&slk.GetConversationHistoryParameters{ChannelID: "C1", Oldest: "1700000200.000100"})
+	require.NoError(t, err)
+	require.Len(t, recent.Messages, 1)
+	assert.Equal(t, "postmortem soon", recent.Messages[0].Text)
+
+	replies, _, _, err := client.GetConversationReplies(&slk.GetConversationRepliesParameters{ChannelID: "C1", Timestamp: "1700000000.000100"})
+	require.NoError(t, err)
+	require.Len(t, replies, 2)
+	assert.Equal(t, "looking", replies[1].Text)
+
+	pins, _, err := client.ListPins("C1")
+	require.NoError(t, err)
+	require.Len(t, pins, 1)
+	assert.Equal(t, "fire a flare", pins[0].Message.Text)
+
+	_, ts, err := client.PostMessage("C1", slk.MsgOptionBlocks(slk.NewSectionBlock(slk.NewTextBlockObject("mrkdwn", "reminder", false, false), nil, nil, slk.SectionBlockOptionBlockID("reminder"))))
+	require.NoError(t, err)
+	messages := server.Messages("C1")
+	assert.Equal(t, ts, messages[len(messages)-1].Timestamp)
+	assert.True(t, slackutil.HasBlockID(messages[len(messages)-1], "reminder"))
+	assert.Equal(t, slacktest.BotUserID, messages[len(messages)-1].User)
+
+	assert.True(t, server.UpdateMessage("C1", slk.Message{Msg: slk.Msg{User: "U1", Text: "mitigated by a rollback", Timestamp: "1700000200.000100", Edited: &slk.Edited{User: "U1"}}}))
+	assert.False(t, server.UpdateMessage("C1", slk.Message{Msg: slk.Msg{Timestamp: "1"}}))
+	server.DeleteMessage("C1", "1700000300.000100")
+	history, err = slackutil.History(client, "C1")
+	require.NoError(t, err)
+	assert.Equal(t, "mitigated by a rollback", history[1].Text)
+	assert.NotNil(t, history[1].Edited)
+	assert.Len(t, history, 3)
+}
+
+func TestUsers(t *testing.T) {
+	server := slacktest.NewServer(t)
+	user := slk.User{ID: "U1", Name: "alice", Profile: slk.UserProfile{Email: "alice@example.com"}}
+	server.AddUser(user)
+	client := server.Client()
+
+	found, err := client.GetUserByEmail("alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "U1", found.ID)
+	found, err = client.GetUserInfo("U1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", found.Name)
+	mention, err := slackutil.Mention(client, "alice@example.com", "Alice")
+	require.NoError(t, err)
+	assert.Equal(t, "<@U1>", mention)
+	mention, err = slackutil.Mention(client, "bob@example.com", "Bob")
+	assert.True(t, slackutil.IsError(err, "users_not_found"))
+	assert.Equal(t, "Bob", mention)
+}
+
+func TestFiles(t *testing.T) {
+	server := slacktest.NewServer(t)
+	file := server.AddFile(slk.File{ID: "F1", Name: "graph 1.png"}, []byte("png"))
+	assert.Equal(t, 3, file.Size)
+
+	var content bytes.Buffer
+	require.NoError(t, server.Client().GetFile(file.URLPrivateDownload, &content))
+	assert.Equal(t, "png", content.String())
+
+	err := slk.New("xoxb-other", slk.OptionAPIURL(server.URL+"/api/")).GetFile(file.URLPrivateDownload, &content)
+	assert.Error(t, err)
+	assert.Error(t, server.Client().GetFile(server.URL+"/files/F2/missing.png", &content))
+}
+
+func TestFaults(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	server := slacktest.NewServer(t)
+	server.Now = func() time.Time { return now }
+	server.AddChannel(channel("C1", "flare-1", true))
+	client := server.Client()
+
+	server.InjectFault(slacktest.Fault{Method: "conversations.archive", Status: http.StatusTooManyRequests, RetryAfter: 2 * time.Second, Times: 1})
+	err := client.ArchiveConversation("C1")
+	var rateLimited *slk.RateLimitedError
+	require.True(t, errors.As(err, &rateLimited), "got %v", err)
+	assert.Equal(t, 2*time.Second, rateLimited.RetryAfter)
+	require.NoError(t, client.ArchiveConversation("C1"))
+
+	server.InjectFault(slacktest.Fault{Method: "conversations.info", Error: "internal_error"})
+	_, err = client.GetConversationInfo(&slk.GetConversationInfoInput{ChannelID: "C1"})
+	assert.True(t, slackutil.IsError(err, "internal_error"), "got %v", err)
+	server.InjectFault(slacktest.Fault{Method: "pins.list", Status: http.StatusServiceUnavailable})
+	_, _, err = client.ListPins("C1")
+	var status slk.StatusCodeError
+	require.True(t, errors.As(err, &status), "got %v", err)
+	assert.Equal(t, http.StatusServiceUnavailable, status.Code)
+	server.ClearFaults()
+
+	server.SetRateLimit("conversations.history", 2)
+	params := &slk.GetConversationHistoryParameters{ChannelID: "C1"}
+	for i := 0; i < 2; i++ {
+		_, err = client.GetConversationHistory(params)
+		require.NoError(t, err)
+		now = now.Add(10 * time.Second)
+	}
+	_, err = client.GetConversationHistory(params)
+	require.True(t, errors.As(err, &rateLimited), "got %v", err)
+	assert.Equal(t, 40*time.Second, rateLimited.RetryAfter)
+	now = now.Add(40 * time.Second)
+	_, err = client.GetConversationHistory(params)
+	assert.NoError(t, err)
+
+	_, _, err = slk.New("xoxb-wrong", slk.OptionAPIURL(server.URL+"/api/")).ListPins("C1")
+	assert.ErrorContains(t, err, "invalid_auth")
+}
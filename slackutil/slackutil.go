@@ -0,0 +1,120 @@
+// Package slackutil has helpers shared by the flarebot jobs that post to Slack.
+package slackutil
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	slk "github.com/slack-go/slack"
+)
+
+const historyPageSize = 200
+
+// RateLimitAttempts is how many times RetryRateLimited calls a method that keeps getting rate
+// limited.
+const RateLimitAttempts = 5
+
+type HistoryClient interface {
+	GetConversationHistory(params *slk.GetConversationHistoryParameters) (*slk.GetConversationHistoryResponse, error)
+}
+
+type UserClient interface {
+	GetUserByEmail(email string) (*slk.User, error)
+}
+
+// HasBlockID reports whether the message contains a section block with the given block ID.
+// Jobs set a block ID on the messages they post so later runs can recognize them.
+func HasBlockID(message slk.Message, blockID string) bool {
+	for _, block := range message.Blocks.BlockSet {
+		if section, ok := block.(*slk.SectionBlock); ok && section.BlockID == blockID {
+			return true
+		}
+	}
+	return false
+}
+
+// PostedSince reports whether a message with the given block ID was posted in the channel after since.
+func PostedSince(client HistoryClient, channelID string, since time.Time, blockID string) (bool, error) {
+	params := &slk.GetConversationHistoryParameters{
+		ChannelID: channelID,
+		Oldest:    fmt.Sprintf("%d", since.Unix()),
+		Limit:     historyPageSize,
+	}
+	for {
+		history, err := client.GetConversationHistory(params)
+		if err != nil {
+			return false, err
+		}
+		for _, message := range history.Messages {
+			if HasBlockID(message, blockID) {
+				return true, nil
+			}
+		}
+		if !history.HasMore || history.ResponseMetaData.NextCursor == "" {
+			return false, nil
+		}
+		params.Cursor = history.ResponseMetaData.NextCursor
+	}
+}
+
+// IsError reports whether err is a Slack API error with the given code, e.g. "not_in_channel".
+func IsError(err error, code string) bool {
+	var slackErr slk.SlackErrorResponse
+	return errors.As(err, &slackErr) && slackErr.Err == code
+}
+
+// Mention returns a Slack mention for the user with this email, falling back to their name,
+// and to an @channel when nobody is known. The fallback is returned along with the error when
+// looking the email up fails, so callers can log it and still post.
+func Mention(client UserClient, email, displayName string) (string, error) {
+	var err error
+	if email != "" {
+		var user *slk.User
+		if user, err = client.GetUserByEmail(email); err == nil {
+			return fmt.Sprintf("<@%s>", user.ID), nil
+		}
+	}
+	if displayName != "" {
+		return displayName, err
+	}
+	return "<!channel>", err
+}
+
+// History returns every message in the channel, newest first.
+func History(client HistoryClient, channelID string) ([]slk.Message, error) {
+	messages := []slk.Message{}
+	params := &slk.GetConversationHistoryParameters{
+		ChannelID: channelID,
+		Limit:     historyPageSize,
+	}
+	for {
+		history, err := client.GetConversationHistory(params)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, history.Messages...)
+		if !history.HasMore || history.ResponseMetaData.NextCursor == "" {
+			return messages, nil
+		}
+		params.Cursor = history.ResponseMetaData.NextCursor
+	}
+}
+
+// RetryRateLimited calls fn until it isn't rate limited, waiting with sleep as long as Slack
+// asks in between, and returns its last error. It gives up after attempts calls. Other errors
+// are returned right away.
+func RetryRateLimited(attempts int, sleep func(time.Duration), fn func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		err = fn()
+		var rateLimited *slk.RateLimitedError
+		if !errors.As(err, &rateLimited) {
+			return err
+		}
+		if i < attempts-1 {
+			sleep(rateLimited.RetryAfter)
+		}
+	}
+	return err
+}
@@ -0,0 +1,173 @@
+package slackutil_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Clever/flarebot/slackutil"
+	slk "github.com/slack-go/slack"
+)
+
+type fakeHistory struct {
+	pages  []*slk.GetConversationHistoryResponse
+	params []slk.GetConversationHistoryParameters
+	err    error
+}
+
+func (f *fakeHistory) GetConversationHistory(params *slk.GetConversationHistoryParameters) (*slk.GetConversationHistoryResponse, error) {
+	f.params = append(f.params, *params)
+	if f.err != nil {
+		return nil, f.err
+	}
+	page := f.pages[0]
+	f.pages = f.pages[1:]
+	return page, nil
+}
+
+type fakeUsers map[string]string
+
+func (f fakeUsers) GetUserByEmail(email string) (*slk.User, error) {
+	if id, ok := f[email]; ok {
+		return &slk.User{ID: id}, nil
+	}
+	return nil, errors.New("users_not_found")
+}
+
+func markedMessage(blockID string) slk.Message {
+	message := slk.Message{}
+	message.Blocks = slk.Blocks{BlockSet: []slk.Block{
+		slk.NewDividerBlock(),
+		slk.NewSectionBlock(nil, nil, nil, slk.SectionBlockOptionBlockID(blockID)),
+	}}
+	return message
+}
+
+func TestHasBlockID(t *testing.T) {
+	assert.True(t, slackutil.HasBlockID(markedMessage("marker"), "marker"))
+	assert.False(t, slackutil.HasBlockID(markedMessage("other"), "marker"))
+	assert.False(t, slackutil.HasBlockID(slk.Message{}, "marker"))
+}
+
+func TestPostedSince(t *testing.T) {
+	since := time.Unix(1700000000, 0)
+
+	firstPage := &slk.GetConversationHistoryResponse{Messages: []slk.Message{{}}, HasMore: true}
+	firstPage.ResponseMetaData.NextCursor = "next"
+	history := &fakeHistory{pages: []*slk.GetConversationHistoryResponse{
+		firstPage,
+		{Messages: []slk.Message{markedMessage("marker")}},
+	}}
+
+	posted, err := slackutil.PostedSince(history, "C1", since, "marker")
+	assert.NoError(t, err)
+	assert.True(t, posted)
+	if assert.Len(t, history.params, 2) {
+		assert.Equal(t, "C1", history.params[0].ChannelID)
+		assert.Equal(t, "1700000000", history.params[0].Oldest)
+		assert.Equal(t, "next", history.params[1].Cursor)
+	}
+
+	history = &fakeHistory{pages: []*slk.GetConversationHistoryResponse{{Messages: []slk.Message{markedMessage("other")}}}}
+	posted, err = slackutil.PostedSince(history, "C1", since, "marker")
+	assert.NoError(t, err)
+	assert.False(t, posted)
+
+	_, err = slackutil.PostedSince(&fakeHistory{err: errors.New("not_in_channel")}, "C1", since, "marker")
+	assert.EqualError(t, err, "not_in_channel")
+}
+
+func TestMention(t *testing.T) {
+	users := fakeUsers{"alice@example.com": "U1"}
+	mention, err := slackutil.Mention(users, "alice@example.com", "Alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "<@U1>", mention)
+
+	mention, err = slackutil.Mention(users, "bob@example.com", "Bob")
+	assert.Error(t, err, "the failed lookup is returned with the fallback")
+	assert.Equal(t, "Bob", mention)
+
+	mention, err = slackutil.Mention(users, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "<!channel>", mention)
+}
+
+func TestHistory(t *testing.T) {
+	firstPage := &slk.GetConversationHistoryResponse{Messages: []slk.Message{markedMessage("a")}, HasMore: true}
+	firstPage.ResponseMetaData.NextCursor = "next"
+	history := &fakeHistory{pages: []*slk.GetConversationHistoryResponse{
+		firstPage,
+		{Messages: []slk.Message{markedMessage("b"), markedMessage("c")}},
+	}}
+
+	messages, err := slackutil.History(history, "C1")
+	assert.NoError(t, err)
+	assert.Len(t, messages, 3)
+	assert.Equal(t, "next", history.params[1].Cursor)
+
+	_, err = slackutil.History(&fakeHistory{err: errors.New("not_in_channel")}, "C1")
+	assert.EqualError(t, err, "not_in_channel")
+}
+
+func TestIsError(t *testing.T) {
+	err := slk.SlackErrorResponse{Err: "not_in_channel"}
+	assert.True(t, slackutil.IsError(err, "not_in_channel"))
+	assert.True(t, slackutil.IsError(fmt.Errorf("archiving: %w", err), "not_in_channel"))
+	assert.False(t, slackutil.IsError(err, "channel_not_found"))
+	assert.False(t, slackutil.IsError(errors.New("not_in_channel"), "not_in_channel"))
+	assert.False(t, slackutil.IsError(nil, "not_in_channel"))
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	tests := []struct {
+		description string
+		attempts    int
+		errs        []error
+		calls       int
+		waits       []time.Duration
+		err         string
+	}{
+		{
+			description: "waits as long as Slack asks",
+			attempts:    3,
+			errs:        []error{&slk.RateLimitedError{RetryAfter: 30 * time.Second}, &slk.RateLimitedError{RetryAfter: time.Second}, nil},
+			calls:       3,
+			waits:       []time.Duration{30 * time.Second, time.Second},
+		},
+		{
+			description: "returns other errors right away",
+			attempts:    3,
+			errs:        []error{slk.SlackErrorResponse{Err: "channel_not_found"}},
+			calls:       1,
+			err:         "channel_not_found",
+		},
+		{
+			description: "gives up after the attempts",
+			attempts:    2,
+			errs:        []error{&slk.RateLimitedError{RetryAfter: time.Second}, &slk.RateLimitedError{RetryAfter: time.Second}},
+			calls:       2,
+			waits:       []time.Duration{time.Second},
+			err:         "slack rate limit exceeded, retry after 1s",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			calls := 0
+			var waits []time.Duration
+			err := slackutil.RetryRateLimited(test.attempts, func(d time.Duration) { waits = append(waits, d) }, func() error {
+				calls++
+				return test.errs[calls-1]
+			})
+			if test.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.err)
+			}
+			assert.Equal(t, test.calls, calls)
+			assert.Equal(t, test.waits, waits)
+		})
+	}
+}
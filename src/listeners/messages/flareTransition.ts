@@ -101,7 +101,7 @@ async function flareTransition({
       nextThursday8am.setUTCDate(
         nextThursday8am.getUTCDate() + ((4 - nextThursday8am.getUTCDay() + 7) % 7),
       );
-      nextThursday8am.setHours(15, 0, 0, 0);
+      nextThursday8am.setUTCHours(15, 0, 0, 0);
 
       await client.chat.scheduleMessage({
         channel: channelId,
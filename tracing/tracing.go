@@ -0,0 +1,83 @@
+// Package tracing sets up OpenTelemetry tracing for the flarebot jobs.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters a job can send spans to.
+const (
+	// ExporterNone drops spans. It's the default.
+	ExporterNone = "none"
+	// ExporterStdout writes spans as JSON to stderr, so they don't mix with command output.
+	ExporterStdout = "stdout"
+	// ExporterOTLP sends spans over OTLP/HTTP. The endpoint and headers come from the standard
+	// OTEL_EXPORTER_OTLP_* env vars.
+	ExporterOTLP = "otlp"
+)
+
+// ValidExporter reports whether name is one of the exporters, or empty for the default.
+func ValidExporter(name string) bool {
+	switch name {
+	case "", ExporterNone, ExporterStdout, ExporterOTLP:
+		return true
+	}
+	return false
+}
+
+// NewExporter returns the named exporter, or nil for ExporterNone. The pointer is the shape the
+// generated InitLaunchConfig takes, so a Lambda can hand the same exporter to its launch config.
+func NewExporter(ctx context.Context, name string) (*sdktrace.SpanExporter, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch name {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown traces exporter %q, expected %s, %s or %s", name, ExporterNone, ExporterStdout, ExporterOTLP)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &exporter, nil
+}
+
+// Install installs a global tracer provider that sends spans to exporter, and drops them when
+// it's nil. The returned function flushes spans that haven't been exported yet; Lambdas call it
+// at the end of every invocation since the process can be frozen afterwards.
+func Install(exporter *sdktrace.SpanExporter, service string) (func(context.Context) error, error) {
+	if exporter == nil || *exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", service)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(*exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.ForceFlush, nil
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
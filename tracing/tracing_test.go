@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestNewExporter(t *testing.T) {
+	exporter, err := NewExporter(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Nil(t, exporter)
+	flush, err := Install(exporter, "flarebot-test")
+	assert.NoError(t, err)
+	assert.NoError(t, flush(context.Background()))
+
+	exporter, err = NewExporter(context.Background(), ExporterStdout)
+	assert.NoError(t, err)
+	assert.NotNil(t, exporter)
+
+	_, err = NewExporter(context.Background(), "zipkin")
+	assert.EqualError(t, err, `unknown traces exporter "zipkin", expected none, stdout or otlp`)
+	assert.False(t, ValidExporter("zipkin"))
+}
+
+func TestInstall(t *testing.T) {
+	var exporter sdktrace.SpanExporter = tracetest.NewInMemoryExporter()
+	flush, err := Install(&exporter, "flarebot-test")
+	assert.NoError(t, err)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	_, span := otel.Tracer("test").Start(context.Background(), "installed")
+	span.End()
+	assert.NoError(t, flush(context.Background()))
+	spans := exporter.(*tracetest.InMemoryExporter).GetSpans()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "installed", spans[0].Name)
+	}
+}
+
+func TestEnd(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+
+	_, ok := tracer.Start(context.Background(), "ok")
+	End(ok, nil)
+	_, failed := tracer.Start(context.Background(), "failed")
+	End(failed, errors.New("boom"))
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Equal(t, "boom", spans[1].Status.Description)
+	assert.Len(t, spans[1].Events, 1)
+}